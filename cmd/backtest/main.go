@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"trading/configs"
+	"trading/pkg/backtest"
+	"trading/pkg/price"
+	"trading/pkg/robot"
+	_ "trading/pkg/robot/strategies"
+	"trading/pkg/tracing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.StampMilli})
+	tracing.UseContextLogger()
+
+	config, err := configs.ReadBacktestConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read config")
+	}
+
+	// заявок тысячи, без verbose в логе только предупреждения стратегии
+	if !config.Verbose {
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	}
+
+	specs, err := price.ParseSpecs(config.Instruments)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read instruments")
+	}
+	price.Register(specs...)
+
+	params, err := robot.ParseParams(config.Params)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read strategy params")
+	}
+
+	strategy, err := robot.NewStrategy(config.Strategy, params)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create strategy")
+	}
+
+	f, err := os.Open(config.Ticks)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open ticks")
+	}
+	defer f.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	report, err := backtest.Run(ctx, config.Strategy, strategy, f, backtest.Config{
+		Interval: config.TickAggregateTime,
+		Cash:     config.Cash,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Backtest failed")
+	}
+
+	if err = report.WriteSummary(os.Stdout); err != nil {
+		log.Fatal().Err(err).Msg("Failed to print summary")
+	}
+	fmt.Printf("elapsed:       %v\n", time.Since(start).Round(time.Millisecond))
+
+	exports := []struct {
+		path  string
+		write func(f *os.File) error
+	}{
+		{config.Report, func(f *os.File) error { return report.WriteJSON(f) }},
+		{config.TradesCSV, func(f *os.File) error { return report.WriteTradesCSV(f) }},
+		{config.EquityCSV, func(f *os.File) error { return report.WriteEquityCSV(f) }},
+	}
+	for _, e := range exports {
+		if e.path == "" {
+			continue
+		}
+
+		if err = writeFile(e.path, e.write); err != nil {
+			log.Fatal().Err(err).Msgf("Failed to write %s", e.path)
+		}
+	}
+}
+
+func writeFile(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err = write(f); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
@@ -2,56 +2,219 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 	"trading/configs"
+	"trading/pkg/broker"
+	api "trading/pkg/gen/broker"
 	"trading/pkg/gen/exchange"
+	"trading/pkg/metrics"
+	"trading/pkg/models"
+	"trading/pkg/price"
+	"trading/pkg/tracing"
 )
 
 func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.StampMilli})
+	tracing.UseContextLogger()
 	log.Printf("Starting broker...")
 
-	config := configs.ReadBrokerConfig()
-	broker := StarStockbrocker(config.ExchangeAddr)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	e, err := broker.client.Statistic(context.Background(), &exchange.BrokerID{ID: broker.id})
+	config, err := configs.ReadBrokerConfig(os.Args[1:])
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to get broker statistics")
+		log.Fatal().Err(err).Msg("Failed to read config")
 	}
 
-	for {
-		ohlcv, err := e.Recv()
-		if err != nil {
-			log.Fatal().Err(err).Msg("Failed to get broker statistics")
+	specs, err := price.ParseSpecs(config.Instruments)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read instruments")
+	}
+	price.Register(specs...)
+
+	stopTracing, err := tracing.Setup("broker", config.Trace.File, config.Trace.ZipkinURL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup tracing")
+	}
+
+	repo, err := broker.NewSQLiteRepository(ctx, config.DBPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open broker database")
+	}
+	defer repo.Close()
+
+	if config.DevSeed {
+		log.Warn().Msg("dev_seed is on: test clients with known passwords are created")
+		if err = repo.SeedDevClients(ctx); err != nil {
+			log.Fatal().Err(err).Msg("Failed to seed dev clients")
 		}
+	}
+	prometheus.MustRegister(broker.NewOpenOrdersCollector(repo))
 
-		log.Printf("ohlcv: %+v", ohlcv)
+	client, err := StarStockbrocker(config.ExchangeAddr)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to gRPC server")
 	}
-}
 
-type Broker struct {
-	id     int64
-	client exchange.ExchangeClient
+	pnlMethod, err := broker.ParsePnLMethod(config.PnLMethod, models.PnLAverage)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Wrong pnl method in config")
+	}
+
+	b := broker.NewBroker(config.ID, repo, client, broker.RiskLimits(config.Risk), pnlMethod)
+	b.TrustClientHeader, b.TokenTTL = config.TrustClientHeader, config.TokenTTL
+	if b.TrustClientHeader {
+		log.Warn().Msg("Broker trusts X-Client-ID header without token, use only for development")
+	}
+	conn := broker.NewExchangeConn(b, broker.DefaultBackoff)
+	conn.OnConnect = func(ctx context.Context, stream string) {
+		// после старта и каждого переподключения сверяем заявки с биржей
+		if stream != broker.StreamResults {
+			return
+		}
+
+		if _, err := b.Reconcile(ctx); err != nil {
+			log.Err(err).Msg("Failed to reconcile orders with exchange")
+		}
+	}
+
+	stopGRPC, err := startGRPCServer(config.GRPCAddr, b)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to start grpc server")
+	}
+
+	httpServer := &http.Server{Addr: config.Addr, Handler: broker.NewHTTPHandler(b, conn)}
+	go func() {
+		log.Printf("Starting broker http server on %s", config.Addr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("Failed to start http server")
+		}
+	}()
+
+	// потоки биржи живут дольше апи: исполнения уже выставленных заявок
+	// успевают записаться, пока апи дорабатывает запросы
+	connCtx, stopConn := context.WithCancel(context.Background())
+	connDone := make(chan struct{})
+	go func() {
+		conn.Run(connCtx)
+		close(connDone)
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down broker...")
+
+	stopGRPC()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err = httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Err(err).Msg("Failed to stop http server")
+	}
+
+	stopConn()
+	<-connDone
+
+	if err = stopTracing(shutdownCtx); err != nil {
+		log.Err(err).Msg("Failed to flush traces")
+	}
 }
 
-func StarStockbrocker(exchangeAddr string) *Broker {
-	grpcConn, err := grpc.Dial(
-		exchangeAddr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+// shutdownTimeout сколько ждать завершения запросов при остановке, потом соединения рвутся
+const shutdownTimeout = 10 * time.Second
+
+// startGRPCServer grpc апи для клиентов, отдельный proto от биржи, вместе со
+// стандартным health сервисом. Возвращает функцию остановки
+func startGRPCServer(addr string, b *broker.Broker) (func(), error) {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor, logInterceptor, metrics.UnaryServerInterceptor),
+		grpc.ChainStreamInterceptor(tracing.StreamServerInterceptor, logStreamInterceptor, metrics.StreamServerInterceptor),
 	)
+	grpcServer := broker.NewGRPCServer(b)
+	api.RegisterBrokerServer(server, grpcServer)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	log.Printf("Starting broker grpc server on %s", addr)
+	l, err := net.Listen("tcp", addr)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to connect to gRPC server")
+		return nil, fmt.Errorf("cant create net.Listen: %w", err)
+	}
+
+	go func() {
+		if err := server.Serve(l); err != nil {
+			log.Err(err).Msg("grpc server stopped")
+		}
+	}()
+	healthServer.SetServingStatus(api.Broker_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	return func() {
+		healthServer.Shutdown()
+		grpcServer.Shutdown()
+		gracefulStop(server, shutdownTimeout)
+	}, nil
+}
+
+// gracefulStop ждёт завершения запросов не дольше timeout, потом рвёт соединения
+func gracefulStop(server *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		log.Warn().Msgf("grpc server didnt stop in %v, closing connections", timeout)
+		server.Stop()
 	}
+}
+
+func logInterceptor(
+	ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (resp interface{}, err error) {
+
+	log.Ctx(ctx).Info().Msgf("request: %v, method: %v", req, info.FullMethod)
+
+	return handler(ctx, req)
+}
+
+func logStreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) (err error) {
 
-	client := exchange.NewExchangeClient(grpcConn)
-	return &Broker{
-		id:     1,
-		client: client,
+	log.Ctx(stream.Context()).Info().Msgf("stream method: %v", info.FullMethod)
+
+	return handler(srv, stream)
+}
+
+// StarStockbrocker создаёт клиента биржи, grpc сам переустанавливает
+// соединение, поэтому недоступная биржа при старте не ошибка
+func StarStockbrocker(exchangeAddr string) (exchange.ExchangeClient, error) {
+	opts := append(tracing.DialOptions(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	grpcConn, err := grpc.Dial(exchangeAddr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cant dial exchange %s: %w", exchangeAddr, err)
 	}
+
+	return exchange.NewExchangeClient(grpcConn), nil
 }
@@ -1,20 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 	"trading/configs"
 	"trading/pkg/client"
+	"trading/pkg/metrics"
 	"trading/pkg/models"
+	"trading/pkg/tracing"
 
 	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-// телеграм авторизация
+// обновления от телеграма приходят на вебхук TELEGRAM_WEBHOOK_URL или, без него
+// (или с TELEGRAM_UPDATES=polling), бот сам опрашивает getUpdates - так его можно
+// запустить локально без публичного https адреса.
+//
+// телеграм авторизация: бот выдаёт одноразовую ссылку на страницу входа (/login),
+// после входа по логину и паролю брокера чат привязывается к клиенту брокера
 // https://makesomecode.me/2021/10/telegram-bot-oauth/
 func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
@@ -22,84 +35,212 @@ func main() {
 	log.Logger = log.Output(
 		zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.StampMilli},
 	)
+	tracing.UseContextLogger()
 	log.Print("Starting telegram client...")
 
-	config := configs.ReadClientConfig()
-	log.Print("config" + config.TelegramToken)
+	config, err := configs.ReadClientConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read config")
+	}
+
+	stopTracing, err := tracing.Setup("client", config.Trace.File, config.Trace.ZipkinURL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup tracing")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repo, err := client.NewSQLiteRepository(ctx, config.DBPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open client database")
+	}
+	defer repo.Close()
 
 	ch := make(chan tgbotapi.Chattable, 100)
 
 	bClient := client.NewClient(config.BrokerAddr)
-	cl := client.NewTelegramClient(bClient, ch)
-	run(cl, ch, config)
+	if _, err = bClient.Instruments(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to load instruments, using default price format")
+	}
+	auth := client.NewAuth(bClient, repo)
+	http.Handle("/login", tracing.Middleware(client.NewLoginHandler(auth, ch)))
+
+	alerts, err := client.NewAlerts(ctx, repo)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load price alerts")
+	}
+
+	stream, err := client.NewBrokerStream(config.BrokerGRPCAddr)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to broker grpc")
+	}
+
+	web := client.NewWebHandler(bClient, stream)
+	http.Handle("/terminal/", tracing.Middleware(web))
+
+	cl := client.NewTelegramClient(bClient, auth, alerts, config.LoginURL, ch)
+	prometheus.MustRegister(client.NewWizardSessionsCollector(cl.Dealer))
+	http.Handle("/metrics", metrics.Handler())
+	go alerts.Watch(ctx, stream.Quotes(ctx, nil), cl.NotifyAlert)
+
+	// уведомления об исполнении и снятии заявок в чат, привязанный к клиенту
+	notifier := client.NewNotifier(ctx, stream, cl.NotifyOrder)
+	auth.OnLogin, auth.OnLogout = notifier.Watch, notifier.Stop
+	if err = notifier.WatchAll(ctx, repo); err != nil {
+		log.Fatal().Err(err).Msg("Failed to subscribe chats to order updates")
+	}
+
+	httpServer := &http.Server{Addr: config.Addr}
+	httpServer.RegisterOnShutdown(web.Shutdown)
+
+	run(ctx, cl, ch, httpServer, config)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err = stopTracing(shutdownCtx); err != nil {
+		log.Err(err).Msg("Failed to flush traces")
+	}
 }
 
-func run(client *client.TelegramClient, in <-chan tgbotapi.Chattable, config configs.ClientConfig) {
-	bot, err := tgbotapi.NewBotAPI(config.TelegramToken)
+// shutdownTimeout сколько ждать завершения http запросов при остановке
+const shutdownTimeout = 10 * time.Second
+
+// run принимает обновления и отправляет ответы до отмены ctx. При остановке новые
+// обновления не принимаются, а уже готовые ответы дотправляются
+func run(
+	ctx context.Context, tg *client.TelegramClient, in <-chan tgbotapi.Chattable,
+	httpServer *http.Server, config configs.ClientConfig,
+) {
+	bot, err := newBot(config)
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Failed to create bot, token: %s", config.TelegramToken)
+		log.Fatal().Err(err).Msg("Failed to create bot")
 	}
 	// bot.Debug = true
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
-	// call on update webhook address
-	wh, err := tgbotapi.NewWebhook(config.TelegramWebhookURL)
+	updates, err := listenUpdates(bot, config)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create webhook")
+		log.Fatal().Err(err).Msgf("Failed to listen %s updates", config.TelegramUpdates)
 	}
 
-	_, err = bot.Request(wh)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to webhook request")
-	}
+	// страница входа нужна в обоих режимах, вебхук висит на том же сервере
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("Failed to start http server")
+		}
+	}()
+	go dispatch(tg, updates)
 
-	go func() { _ = http.ListenAndServe(config.Addr, nil) }()
-	go func() { // принимаем сообщения и отправляем в обработку
-		updates := bot.ListenForWebhook("/")
-		for update := range updates {
-			switch {
-			case update.CallbackQuery != nil:
-				log.Printf("command callback: %v", update.CallbackQuery.Data)
-
-				go client.HandleCommand(models.Message{
-					ChatID:    update.CallbackQuery.Message.Chat.ID,
-					MessageID: update.CallbackQuery.Message.MessageID,
-					Text:      update.CallbackQuery.Data,
-				})
-			case update.Message == nil:
-				log.Printf("nil message %v", update.UpdateID)
-
-				continue
-
-			case update.Message.IsCommand():
-				log.Printf("command: %s", update.Message.Command())
-
-				go client.HandleCommand(models.Message{
-					ChatID:    update.Message.Chat.ID,
-					MessageID: update.Message.MessageID,
-					Text:      strings.TrimLeft(update.Message.Text, "/"),
-				})
-
-			case update.Message != nil:
-				log.Printf("userInput: %v", update.Message.Chat.ID)
-
-				go client.HandleUserInput(models.Message{
-					ChatID:    update.Message.Chat.ID,
-					MessageID: update.Message.MessageID,
-					Text:      update.Message.Text,
-				})
-			}
+	// отправка останавливается последней: ответы на вход и вебхук, которые
+	// http сервер дорабатывает при остановке, тоже должны уйти
+	sendCtx, stopSending := context.WithCancel(context.Background())
+	go func() {
+		defer stopSending()
+
+		<-ctx.Done()
+		log.Print("Shutting down telegram client...")
+
+		if config.TelegramUpdates == configs.UpdatesPolling {
+			bot.StopReceivingUpdates()
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Err(err).Msg("Failed to stop http server")
 		}
 	}()
 
-	// читае сообщения из канала и отправляем в бот, можно ограничить rps,
-	// самое простое отправлять сообщение каждые 0.05 секунды (20 в секунду)
-	for msg := range in {
-		_, err = bot.Send(msg)
+	// читаем сообщения из канала и отправляем в бот с учётом лимитов телеграма
+	client.NewSender(bot).Run(sendCtx, in)
+}
+
+func newBot(config configs.ClientConfig) (*tgbotapi.BotAPI, error) {
+	if config.TelegramAPIURL == "" {
+		return tgbotapi.NewBotAPI(config.TelegramToken)
+	}
+
+	return tgbotapi.NewBotAPIWithAPIEndpoint(
+		config.TelegramToken, strings.TrimRight(config.TelegramAPIURL, "/")+"/bot%s/%s",
+	)
+}
+
+// listenUpdates обновления от телеграма: через вебхук или опросом getUpdates.
+// Телеграм не отдаёт getUpdates, пока установлен вебхук, поэтому при опросе он удаляется
+func listenUpdates(bot *tgbotapi.BotAPI, config configs.ClientConfig) (tgbotapi.UpdatesChannel, error) {
+	switch config.TelegramUpdates {
+	case configs.UpdatesWebhook:
+		// call on update webhook address
+		wh, err := tgbotapi.NewWebhook(config.TelegramWebhookURL)
 		if err != nil {
-			log.Err(err).Msg("Failed to send message")
+			return nil, fmt.Errorf("cant create webhook: %w", err)
+		}
+
+		if _, err = bot.Request(wh); err != nil {
+			return nil, fmt.Errorf("cant set webhook: %w", err)
+		}
+
+		return bot.ListenForWebhook("/"), nil
+	case configs.UpdatesPolling:
+		if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			return nil, fmt.Errorf("cant delete webhook: %w", err)
 		}
 
-		time.Sleep(time.Second / 20)
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
+
+		return bot.GetUpdatesChan(u), nil
+	}
+
+	return nil, fmt.Errorf("unknown updates source %q, want %s or %s",
+		config.TelegramUpdates, configs.UpdatesWebhook, configs.UpdatesPolling)
+}
+
+// dispatch принимает обновления и отправляет в обработку, откуда бы они ни пришли
+func dispatch(client *client.TelegramClient, updates tgbotapi.UpdatesChannel) {
+	for update := range updates {
+		// обновление телеграма - край системы, здесь запрос получает свой ID
+		id := tracing.NewID()
+		logger := log.With().Str(tracing.LogField, id).Logger()
+
+		switch {
+		case update.CallbackQuery != nil:
+			logger.Printf("command callback: %v", update.CallbackQuery.Data)
+
+			go client.HandleCommand(models.Message{
+				ChatID:        update.CallbackQuery.Message.Chat.ID,
+				UserID:        update.CallbackQuery.From.ID,
+				MessageID:     update.CallbackQuery.Message.MessageID,
+				Text:          update.CallbackQuery.Data,
+				CorrelationID: id,
+			})
+		case update.Message == nil:
+			logger.Printf("nil message %v", update.UpdateID)
+
+			continue
+
+		case update.Message.IsCommand():
+			logger.Printf("command: %s", update.Message.Command())
+
+			go client.HandleCommand(models.Message{
+				ChatID:        update.Message.Chat.ID,
+				UserID:        update.Message.From.ID,
+				MessageID:     update.Message.MessageID,
+				Text:          strings.TrimLeft(update.Message.Text, "/"),
+				CorrelationID: id,
+			})
+
+		case update.Message != nil:
+			logger.Printf("userInput: %v", update.Message.Chat.ID)
+
+			go client.HandleUserInput(models.Message{
+				ChatID:        update.Message.Chat.ID,
+				UserID:        update.Message.From.ID,
+				MessageID:     update.Message.MessageID,
+				Text:          update.Message.Text,
+				CorrelationID: id,
+			})
+		}
 	}
 }
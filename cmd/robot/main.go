@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"trading/configs"
+	"trading/pkg/robot"
+	_ "trading/pkg/robot/strategies"
+	"trading/pkg/tracing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.StampMilli})
+	tracing.UseContextLogger()
+
+	config, err := configs.ReadRobotConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read config")
+	}
+
+	params, err := robot.ParseParams(config.Params)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read strategy params")
+	}
+
+	strategy, err := robot.NewStrategy(config.Strategy, params)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create strategy")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Starting robot %s for %s...", config.Strategy, config.Login)
+	err = robot.Run(ctx, robot.Config{
+		BrokerAddr:     config.BrokerAddr,
+		BrokerGRPCAddr: config.BrokerGRPCAddr,
+		Login:          config.Login,
+		Password:       config.Password,
+		Tickers:        config.Tickers,
+	}, config.Strategy, strategy)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Robot stopped")
+	}
+
+	// открытые заявки остаются у брокера, при следующем запуске робот их подхватит
+	log.Printf("Robot stopped")
+}
@@ -1,46 +1,356 @@
 package configs
 
 import (
-	"os"
+	"strings"
 	"time"
+	"trading/pkg/models"
 )
 
 type ExchangeConfig struct {
-	Addr              string
-	TickAggregateTime time.Duration
-	Tickers           []string
+	Addr              string        `config:"addr" usage:"адрес grpc сервера биржи"`
+	Ticks             string        `config:"ticks" usage:"csv файл истории сделок, которые транслирует биржа"`
+	TickAggregateTime time.Duration `config:"tick_aggregate_time" usage:"за какой интервал сделки собираются в одну свечу"`
+	Tickers           []string      `config:"tickers" usage:"транслируемые инструменты, сделки по остальным пропускаются"`
+	Instruments       []string      `config:"instruments" usage:"параметры инструментов тикер:знаки:шаг:стоимость пункта"`
+	MetricsAddr       string        `config:"metrics_addr" usage:"адрес http сервера с /metrics"`
+	Trace             TraceConfig   `config:"trace"`
 }
 
-func ReadConfig() ExchangeConfig {
-	return ExchangeConfig{
+// DefaultInstruments фьючерс на индекс РТС: цена с двумя знаками, шаг 0.10, пункт - рубль.
+// У инструментов не из списка шаг не проверяется, см. price.DefaultSpec
+var DefaultInstruments = []string{"SPFB.RTS:2:0.10:1"}
+
+// TraceConfig экспорт трейсов OpenTelemetry, всё пусто - трейсы не пишутся
+type TraceConfig struct {
+	File string `config:"file" usage:"файл, куда дописываются спаны в JSON"`
+	// ZipkinURL коллектор, принимающий zipkin v2 JSON, например http://localhost:9411/api/v2/spans
+	ZipkinURL string `config:"zipkin_url" usage:"адрес коллектора трейсов"`
+}
+
+func (c TraceConfig) validate(p *problems) {
+	if c.ZipkinURL != "" {
+		p.checkURL("trace.zipkin_url", c.ZipkinURL)
+	}
+}
+
+// ReadConfig конфиг биржи, args - аргументы командной строки без имени программы
+func ReadConfig(args []string) (ExchangeConfig, error) {
+	config := ExchangeConfig{
 		Addr:              ":8080",
+		Ticks:             "./data/SPFB.RTS_190517_190517.csv",
 		TickAggregateTime: time.Second,
 		Tickers: []string{
 			"SPFB.RTS",
 		},
+		Instruments: DefaultInstruments,
+		MetricsAddr: ":8090",
+	}
+
+	if err := load("exchange", &config, args); err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
+
+func (c ExchangeConfig) Validate() error {
+	var p problems
+	p.checkAddr("addr", c.Addr, false)
+	p.checkAddr("metrics_addr", c.MetricsAddr, false)
+	p.checkNotEmpty("ticks", c.Ticks)
+	c.Trace.validate(&p)
+
+	if c.TickAggregateTime <= 0 {
+		p.add("tick_aggregate_time must be positive, got %v", c.TickAggregateTime)
+	}
+
+	if len(c.Tickers) == 0 {
+		p.add("tickers is empty")
+	}
+	for _, ticker := range c.Tickers {
+		p.checkNotEmpty("tickers item", ticker)
 	}
+	p.checkInstruments(c.Instruments)
+
+	return p.err()
 }
 
 type BrokerConfig struct {
-	Addr, ExchangeAddr string
+	ID           int64      `config:"id" usage:"идентификатор брокера на бирже"`
+	Addr         string     `config:"addr" usage:"адрес http апи"`
+	GRPCAddr     string     `config:"grpc_addr" usage:"адрес grpc апи"`
+	ExchangeAddr string     `config:"exchange_addr" usage:"адрес биржи"`
+	DBPath       string     `config:"db_path" usage:"файл базы брокера"`
+	Risk         RiskConfig `config:"risk"`
+	PnLMethod    string     `config:"pnl_method" usage:"расчёт прибыли: average или fifo"`
+	// TrustClientHeader брокер верит заголовку X-Client-ID без токена входа, только для разработки
+	TrustClientHeader bool          `config:"trust_client_header" usage:"доверять заголовку X-Client-ID без токена"`
+	TokenTTL          time.Duration `config:"token_ttl" usage:"сколько действует токен входа"`
+	Trace             TraceConfig   `config:"trace"`
+	Instruments       []string      `config:"instruments" usage:"параметры инструментов тикер:знаки:шаг:стоимость пункта"`
+	// DevSeed тестовые клиенты из README, только для разработки
+	DevSeed bool `config:"dev_seed" usage:"создать тестовых клиентов Vasily, Ivan и Olga"`
 }
 
-func ReadBrokerConfig() BrokerConfig {
-	return BrokerConfig{
+// RiskConfig лимиты предторговых проверок брокера, 0 - проверка выключена
+type RiskConfig struct {
+	MaxOrderVolume int32   `config:"max_order_volume" usage:"наибольший объём заявки"`
+	MaxPosition    int64   `config:"max_position" usage:"наибольшая позиция по инструменту"`
+	MaxNotional    int64   `config:"max_notional" usage:"наибольшая сумма заявки в копейках"`
+	PriceCollar    float64 `config:"price_collar" usage:"допустимое отклонение от последней цены, доля"`
+}
+
+// ReadBrokerConfig конфиг брокера, args - аргументы командной строки без имени программы
+func ReadBrokerConfig(args []string) (BrokerConfig, error) {
+	config := BrokerConfig{
+		ID:           1,
 		Addr:         ":8081",
+		GRPCAddr:     ":8083",
 		ExchangeAddr: "localhost:8080",
+		DBPath:       "./data/broker.db",
+		Risk: RiskConfig{
+			MaxOrderVolume: 1000,
+			MaxPosition:    5000,
+			PriceCollar:    0.1,
+		},
+		PnLMethod:   string(models.PnLAverage),
+		TokenTTL:    24 * time.Hour,
+		Instruments: DefaultInstruments,
+	}
+
+	if err := load("broker", &config, args); err != nil {
+		return config, err
 	}
+
+	return config, config.Validate()
+}
+
+func (c BrokerConfig) Validate() error {
+	var p problems
+	if c.ID <= 0 {
+		p.add("id must be positive, got %d", c.ID)
+	}
+
+	p.checkAddr("addr", c.Addr, false)
+	p.checkAddr("grpc_addr", c.GRPCAddr, false)
+	p.checkAddr("exchange_addr", c.ExchangeAddr, true)
+	p.checkNotEmpty("db_path", c.DBPath)
+
+	switch models.PnLMethod(c.PnLMethod) {
+	case models.PnLAverage, models.PnLFIFO:
+	default:
+		p.add("pnl_method: want %s or %s, got %q", models.PnLAverage, models.PnLFIFO, c.PnLMethod)
+	}
+
+	if c.TokenTTL <= 0 {
+		p.add("token_ttl must be positive, got %v", c.TokenTTL)
+	}
+
+	if c.Risk.MaxOrderVolume < 0 {
+		p.add("risk.max_order_volume is negative")
+	}
+	if c.Risk.MaxPosition < 0 {
+		p.add("risk.max_position is negative")
+	}
+	if c.Risk.MaxNotional < 0 {
+		p.add("risk.max_notional is negative")
+	}
+	if c.Risk.PriceCollar < 0 || c.Risk.PriceCollar >= 1 {
+		p.add("risk.price_collar must be in [0, 1), got %v", c.Risk.PriceCollar)
+	}
+	c.Trace.validate(&p)
+	p.checkInstruments(c.Instruments)
+
+	return p.err()
 }
 
 type ClientConfig struct {
-	Addr, TelegramToken, TelegramWebhookURL, BrokerAddr string
+	Addr               string `config:"addr" usage:"адрес http сервера: вебхук, вход, терминал"`
+	TelegramToken      string `config:"telegram_token" env:"TELEGRAM_TOKEN" usage:"токен бота"`
+	TelegramWebhookURL string `config:"telegram_webhook_url" env:"TELEGRAM_WEBHOOK_URL" usage:"публичный адрес вебхука"`
+	BrokerAddr         string `config:"broker_addr" usage:"адрес http апи брокера"`
+	// BrokerGRPCAddr grpc апи брокера, из него бот берёт котировки
+	BrokerGRPCAddr string `config:"broker_grpc_addr" usage:"адрес grpc апи брокера"`
+	// LoginURL адрес страницы входа на http сервере клиента, снаружи
+	LoginURL string `config:"login_url" env:"LOGIN_URL" usage:"адрес страницы входа снаружи"`
+	DBPath   string `config:"db_path" usage:"файл базы клиента"`
+	// TelegramUpdates откуда бот берёт обновления: webhook или polling (getUpdates)
+	TelegramUpdates string `config:"telegram_updates" env:"TELEGRAM_UPDATES" usage:"webhook или polling"`
+	// TelegramAPIURL адрес Bot API, пусто - api.telegram.org. Для локального фейкового сервера
+	TelegramAPIURL string      `config:"telegram_api_url" env:"TELEGRAM_API_URL" usage:"адрес Bot API"`
+	Trace          TraceConfig `config:"trace"`
 }
 
-func ReadClientConfig() ClientConfig {
-	return ClientConfig{
-		BrokerAddr:         "localhost:8081",
-		Addr:               ":8082",
-		TelegramWebhookURL: os.Getenv("TELEGRAM_WEBHOOK_URL"),
-		TelegramToken:      os.Getenv("TELEGRAM_TOKEN"),
+// источники обновлений телеграма
+const (
+	UpdatesWebhook = "webhook"
+	UpdatesPolling = "polling"
+)
+
+// ReadClientConfig конфиг клиента, args - аргументы командной строки без имени программы
+func ReadClientConfig(args []string) (ClientConfig, error) {
+	config := ClientConfig{
+		BrokerAddr:     "http://localhost:8081",
+		BrokerGRPCAddr: "localhost:8083",
+		Addr:           ":8082",
+		DBPath:         "./data/client.db",
 	}
+
+	if err := load("client", &config, args); err != nil {
+		return config, err
+	}
+
+	// без публичного адреса для вебхука бот опрашивает телеграм сам
+	if config.TelegramUpdates == "" {
+		config.TelegramUpdates = UpdatesPolling
+		if config.TelegramWebhookURL != "" {
+			config.TelegramUpdates = UpdatesWebhook
+		}
+	}
+
+	// страница входа на том же сервере, что и вебхук, локально - на своём адресе
+	if config.LoginURL == "" {
+		if config.TelegramWebhookURL != "" {
+			config.LoginURL = strings.TrimRight(config.TelegramWebhookURL, "/") + "/login"
+		} else {
+			config.LoginURL = "http://localhost" + config.Addr + "/login"
+		}
+	}
+
+	return config, config.Validate()
+}
+
+func (c ClientConfig) Validate() error {
+	var p problems
+	p.checkAddr("addr", c.Addr, false)
+	p.checkNotEmpty("telegram_token", c.TelegramToken)
+	p.checkNotEmpty("db_path", c.DBPath)
+	p.checkAddr("broker_grpc_addr", c.BrokerGRPCAddr, true)
+
+	// NewClient сам добавляет http://
+	brokerAddr := c.BrokerAddr
+	if !strings.Contains(brokerAddr, "://") {
+		brokerAddr = "http://" + brokerAddr
+	}
+	p.checkURL("broker_addr", brokerAddr)
+
+	switch c.TelegramUpdates {
+	case UpdatesWebhook:
+		if c.TelegramWebhookURL == "" {
+			p.add("telegram_webhook_url is required for %s updates", UpdatesWebhook)
+		}
+	case UpdatesPolling:
+	default:
+		p.add("telegram_updates: want %s or %s, got %q", UpdatesWebhook, UpdatesPolling, c.TelegramUpdates)
+	}
+
+	if c.TelegramWebhookURL != "" {
+		p.checkURL("telegram_webhook_url", c.TelegramWebhookURL)
+	}
+	if c.TelegramAPIURL != "" {
+		p.checkURL("telegram_api_url", c.TelegramAPIURL)
+	}
+	p.checkURL("login_url", c.LoginURL)
+	c.Trace.validate(&p)
+
+	return p.err()
+}
+
+type RobotConfig struct {
+	BrokerAddr     string `config:"broker_addr" usage:"адрес http апи брокера"`
+	BrokerGRPCAddr string `config:"broker_grpc_addr" usage:"адрес grpc апи брокера"`
+	Login          string `config:"login" usage:"логин клиента, от имени которого торгует робот"`
+	// Password лучше передавать через ROBOT_PASSWORD, а не хранить в файле
+	Password string `config:"password" usage:"пароль клиента"`
+	Strategy string `config:"strategy" usage:"имя стратегии"`
+	// Params параметры стратегии строками ключ=значение, например fast=5
+	Params  []string `config:"params" usage:"параметры стратегии ключ=значение"`
+	Tickers []string `config:"tickers" usage:"инструменты, свечи которых получает стратегия, пусто - все"`
+}
+
+// ReadRobotConfig конфиг робота, args - аргументы командной строки без имени программы
+func ReadRobotConfig(args []string) (RobotConfig, error) {
+	config := RobotConfig{
+		BrokerAddr:     "http://localhost:8081",
+		BrokerGRPCAddr: "localhost:8083",
+	}
+
+	if err := load("robot", &config, args); err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
+
+func (c RobotConfig) Validate() error {
+	var p problems
+	p.checkAddr("broker_grpc_addr", c.BrokerGRPCAddr, true)
+
+	brokerAddr := c.BrokerAddr
+	if !strings.Contains(brokerAddr, "://") {
+		brokerAddr = "http://" + brokerAddr
+	}
+	p.checkURL("broker_addr", brokerAddr)
+
+	p.checkNotEmpty("login", c.Login)
+	p.checkNotEmpty("password", c.Password)
+	p.checkNotEmpty("strategy", c.Strategy)
+	for _, param := range c.Params {
+		if !strings.Contains(param, "=") {
+			p.add("params: %q, want key=value", param)
+		}
+	}
+
+	return p.err()
+}
+
+type BacktestConfig struct {
+	Ticks             string        `config:"ticks" usage:"csv файл истории сделок в формате биржи"`
+	TickAggregateTime time.Duration `config:"tick_aggregate_time" usage:"сколько времени истории в одной свече"`
+	Instruments       []string      `config:"instruments" usage:"параметры инструментов тикер:знаки:шаг:стоимость пункта"`
+	Strategy          string        `config:"strategy" usage:"имя стратегии"`
+	Params            []string      `config:"params" usage:"параметры стратегии ключ=значение"`
+	Cash              int64         `config:"cash" usage:"начальные деньги в копейках"`
+	// пусто - отчёт не пишется, итоги в любом случае печатаются в stdout
+	Report    string `config:"report" usage:"файл отчёта json"`
+	TradesCSV string `config:"trades_csv" usage:"файл исполнений csv"`
+	EquityCSV string `config:"equity_csv" usage:"файл кривой стоимости счёта csv"`
+	Verbose   bool   `config:"verbose" usage:"писать в лог каждую заявку"`
+}
+
+// ReadBacktestConfig конфиг бэктеста, args - аргументы командной строки без имени программы
+func ReadBacktestConfig(args []string) (BacktestConfig, error) {
+	config := BacktestConfig{
+		Ticks:             "./data/SPFB.RTS_190517_190517.csv",
+		TickAggregateTime: time.Second,
+		Instruments:       DefaultInstruments,
+		Cash:              200000,
+	}
+
+	if err := load("backtest", &config, args); err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
+
+func (c BacktestConfig) Validate() error {
+	var p problems
+	p.checkNotEmpty("ticks", c.Ticks)
+	p.checkNotEmpty("strategy", c.Strategy)
+	p.checkInstruments(c.Instruments)
+
+	if c.TickAggregateTime <= 0 {
+		p.add("tick_aggregate_time must be positive, got %v", c.TickAggregateTime)
+	}
+	if c.Cash <= 0 {
+		p.add("cash must be positive, got %d", c.Cash)
+	}
+	for _, param := range c.Params {
+		if !strings.Contains(param, "=") {
+			p.add("params: %q, want key=value", param)
+		}
+	}
+
+	return p.err()
 }
@@ -0,0 +1,373 @@
+// Package configs настройки биржи, брокера, клиента, робота и бэктеста.
+//
+// Каждое значение берётся из четырёх источников, следующий перекрывает предыдущий:
+//
+//  1. значения по умолчанию из Read*Config
+//  2. файл конфига из флага -config или переменной <SERVICE>_CONFIG, формат по
+//     расширению: .yaml, .yml или .toml. Ключи - теги config, вложенные структуры -
+//     секции файла. Неизвестный ключ - ошибка, чтобы опечатка не прошла молча
+//  3. переменные окружения <SERVICE>_<KEY>: BROKER_GRPC_ADDR, BROKER_RISK_PRICE_COLLAR.
+//     Поле с тегом env читается из своей переменной, например TELEGRAM_TOKEN
+//  4. флаги командной строки: -grpc-addr, -risk.price-collar
+//
+// Списки в окружении и флагах - через запятую, интервалы - как в time.ParseDuration.
+// Собранный конфиг проверяется, все ошибки возвращаются разом. Примеры файлов лежат
+// рядом: exchange.example.yaml, broker.example.toml, client.example.yaml,
+// robot.example.yaml, backtest.example.yaml
+package configs
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"trading/pkg/price"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field одно значение конфига и все его имена
+type field struct {
+	path  []string // ключи от корня конфига
+	env   string
+	usage string
+	value reflect.Value
+}
+
+func (f field) key() string {
+	return strings.Join(f.path, ".")
+}
+
+func (f field) flag() string {
+	return strings.ReplaceAll(f.key(), "_", "-")
+}
+
+// fields поля структуры с тегом config, вложенные структуры разворачиваются
+func fields(v reflect.Value, prefix string, path []string) []field {
+	var res []field
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := sf.Tag.Get("config")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		p := append(append([]string{}, path...), key)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			res = append(res, fields(fv, prefix, p)...)
+
+			continue
+		}
+
+		env := sf.Tag.Get("env")
+		if env == "" {
+			env = prefix + "_" + strings.ToUpper(strings.Join(p, "_"))
+		}
+
+		res = append(res, field{path: p, env: env, usage: sf.Tag.Get("usage"), value: fv})
+	}
+
+	return res
+}
+
+// load заполняет cfg, в котором уже лежат значения по умолчанию, из файла,
+// окружения и флагов. Ошибку во флаге flag печатает сам и завершает процесс
+func load(service string, cfg interface{}, args []string) error {
+	prefix := strings.ToUpper(service)
+	all := fields(reflect.ValueOf(cfg).Elem(), prefix, nil)
+
+	set := flag.NewFlagSet(service, flag.ExitOnError)
+	path := set.String("config", os.Getenv(prefix+"_CONFIG"), "файл конфига .yaml, .yml или .toml, env "+prefix+"_CONFIG")
+
+	flags := make(map[string]string)
+	for _, f := range all {
+		f := f
+		set.Var(&flagValue{
+			def:    formatValue(f.value),
+			isBool: f.value.Kind() == reflect.Bool,
+			set: func(s string) error {
+				if err := setString(reflect.New(f.value.Type()).Elem(), s); err != nil {
+					return err
+				}
+				flags[f.key()] = s
+
+				return nil
+			},
+		}, f.flag(), f.usage+", env "+f.env)
+	}
+	_ = set.Parse(args)
+
+	if *path != "" {
+		if err := loadFile(*path, all); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range all {
+		s, ok := os.LookupEnv(f.env)
+		if !ok {
+			continue
+		}
+		if err := setString(f.value, s); err != nil {
+			return fmt.Errorf("%w: %s=%q: %v", ErrInvalidConfig, f.env, s, err)
+		}
+	}
+
+	// уже проверены при разборе
+	for _, f := range all {
+		if s, ok := flags[f.key()]; ok {
+			_ = setString(f.value, s)
+		}
+	}
+
+	return nil
+}
+
+func loadFile(path string, all []field) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cant read config file: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("%w: config file %s: unknown format %q, want .yaml, .yml or .toml", ErrInvalidConfig, path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: cant parse config file %s: %v", ErrInvalidConfig, path, err)
+	}
+
+	known := make(map[string]bool)
+	for _, f := range all {
+		for i := range f.path {
+			known[strings.Join(f.path[:i+1], ".")] = true
+		}
+
+		raw, ok := lookup(values, f.path)
+		if !ok {
+			continue
+		}
+		if err := setFile(f.value, raw); err != nil {
+			return fmt.Errorf("%w: config file %s: %s: %v", ErrInvalidConfig, path, f.key(), err)
+		}
+	}
+
+	if unknown := unknownKeys(values, known, ""); len(unknown) > 0 {
+		return fmt.Errorf("%w: config file %s: unknown keys %s", ErrInvalidConfig, path, strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+func lookup(values map[string]interface{}, path []string) (interface{}, bool) {
+	var cur interface{} = values
+	for _, key := range path {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+func unknownKeys(values map[string]interface{}, known map[string]bool, prefix string) []string {
+	var res []string
+	for key, val := range values {
+		full := prefix + key
+		if !known[full] {
+			res = append(res, full)
+
+			continue
+		}
+		if m, ok := val.(map[string]interface{}); ok {
+			res = append(res, unknownKeys(m, known, full+".")...)
+		}
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// setFile значение из файла: списки приходят списками, остальное приводится к строке
+func setFile(v reflect.Value, raw interface{}) error {
+	if list, ok := raw.([]interface{}); ok && v.Kind() == reflect.Slice {
+		res := make([]string, 0, len(list))
+		for _, item := range list {
+			res = append(res, fmt.Sprint(item))
+		}
+		v.Set(reflect.ValueOf(res))
+
+		return nil
+	}
+
+	switch raw.(type) {
+	case map[string]interface{}, []interface{}:
+		return fmt.Errorf("want a single value, got %T", raw)
+	}
+
+	return setString(v, fmt.Sprint(raw))
+}
+
+// setString разбирает строку в поле его типа
+func setString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var res []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				res = append(res, item)
+			}
+		}
+		v.Set(reflect.ValueOf(res))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+
+	return nil
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ",")
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+// flagValue флаг конфига, значение запоминается и применяется после окружения
+type flagValue struct {
+	def    string
+	isBool bool
+	set    func(string) error
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+
+	return f.def
+}
+
+func (f *flagValue) Set(s string) error {
+	return f.set(s)
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// problems ошибки проверки конфига, собираются все сразу
+type problems []string
+
+func (p *problems) add(format string, args ...interface{}) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+func (p problems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(p, "; "))
+}
+
+// checkAddr адрес host:port. Для сервера хост можно опустить, для подключения - нет
+func (p *problems) checkAddr(key, addr string, dial bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		p.add("%s: %v", key, err)
+
+		return
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 || (dial && n == 0) {
+		p.add("%s: wrong port %q", key, port)
+	}
+	if dial && host == "" {
+		p.add("%s: no host in %q", key, addr)
+	}
+}
+
+// checkURL абсолютный http или https адрес
+func (p *problems) checkURL(key, s string) {
+	u, err := url.Parse(s)
+	if err != nil {
+		p.add("%s: %v", key, err)
+
+		return
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		p.add("%s: want http(s)://host/..., got %q", key, s)
+	}
+}
+
+// checkInstruments параметры инструментов в формате price.ParseSpec
+func (p *problems) checkInstruments(list []string) {
+	if _, err := price.ParseSpecs(list); err != nil {
+		p.add("instruments: %v", err)
+	}
+}
+
+func (p *problems) checkNotEmpty(key, s string) {
+	if strings.TrimSpace(s) == "" {
+		p.add("%s is empty", key)
+	}
+}
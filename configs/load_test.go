@@ -0,0 +1,244 @@
+package configs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile конфиг во временном файле с расширением ext
+func writeFile(t *testing.T, ext, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config"+ext)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, ".yaml", "grpc_addr: \":9001\"\nrisk:\n  price_collar: 0.2\n")
+
+	tests := []struct {
+		name   string
+		env    map[string]string
+		args   []string
+		addr   string
+		collar float64
+	}{
+		{name: "defaults", addr: ":8083", collar: 0.1},
+		{name: "file over defaults", args: []string{"-config", file}, addr: ":9001", collar: 0.2},
+		{
+			name: "file from env",
+			env:  map[string]string{"BROKER_CONFIG": file},
+			addr: ":9001", collar: 0.2,
+		},
+		{
+			name: "env over file",
+			env:  map[string]string{"BROKER_GRPC_ADDR": ":9002", "BROKER_RISK_PRICE_COLLAR": "0.3"},
+			args: []string{"-config", file},
+			addr: ":9002", collar: 0.3,
+		},
+		{
+			name: "flags over env",
+			env:  map[string]string{"BROKER_GRPC_ADDR": ":9002", "BROKER_RISK_PRICE_COLLAR": "0.3"},
+			args: []string{"-config", file, "-grpc-addr", ":9003", "-risk.price-collar", "0.4"},
+			addr: ":9003", collar: 0.4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			c, err := ReadBrokerConfig(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.GRPCAddr != tt.addr || c.Risk.PriceCollar != tt.collar {
+				t.Errorf("grpc_addr, risk.price_collar = %q, %v, want %q, %v", c.GRPCAddr, c.Risk.PriceCollar, tt.addr, tt.collar)
+			}
+			// то, что нигде не задано, остаётся по умолчанию
+			if c.Risk.MaxPosition != 5000 || c.TokenTTL != 24*time.Hour {
+				t.Errorf("defaults lost: max_position %d, token_ttl %v", c.Risk.MaxPosition, c.TokenTTL)
+			}
+		})
+	}
+}
+
+func TestLoadNestedTOML(t *testing.T) {
+	file := writeFile(t, ".toml", `
+id = 2
+token_ttl = "2h"
+instruments = ["SPFB.RTS:2:0.10:1", "SBER:2:0.01:1"]
+
+[risk]
+max_order_volume = 10
+max_notional = 100000
+
+[trace]
+file = "spans.jsonl"
+`)
+	t.Setenv("BROKER_RISK_MAX_POSITION", "7")
+
+	c, err := ReadBrokerConfig([]string{"-config", file, "-risk.max-order-volume", "20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := RiskConfig{MaxOrderVolume: 20, MaxPosition: 7, MaxNotional: 100000, PriceCollar: 0.1}
+	if c.ID != 2 || c.Risk != want || c.Trace.File != "spans.jsonl" {
+		t.Errorf("id %d, risk %+v, trace %+v, want 2, %+v and spans.jsonl", c.ID, c.Risk, c.Trace, want)
+	}
+	if c.TokenTTL != 2*time.Hour {
+		t.Errorf("token_ttl = %v, want 2h", c.TokenTTL)
+	}
+	if want := []string{"SPFB.RTS:2:0.10:1", "SBER:2:0.01:1"}; !reflect.DeepEqual(c.Instruments, want) {
+		t.Errorf("instruments = %v, want %v", c.Instruments, want)
+	}
+}
+
+func TestLoadSlices(t *testing.T) {
+	file := writeFile(t, ".yml", "tickers:\n  - SPFB.RTS\n  - SBER\n")
+
+	c, err := ReadConfig([]string{"-config", file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"SPFB.RTS", "SBER"}; !reflect.DeepEqual(c.Tickers, want) {
+		t.Errorf("tickers from file = %v, want %v", c.Tickers, want)
+	}
+
+	// в окружении и флагах список через запятую, пустые элементы отбрасываются
+	t.Setenv("EXCHANGE_TICKERS", "GAZP, LKOH,")
+	if c, err = ReadConfig([]string{"-config", file}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"GAZP", "LKOH"}; !reflect.DeepEqual(c.Tickers, want) {
+		t.Errorf("tickers from env = %v, want %v", c.Tickers, want)
+	}
+
+	if c, err = ReadConfig([]string{"-tickers", "YNDX"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"YNDX"}; !reflect.DeepEqual(c.Tickers, want) {
+		t.Errorf("tickers from flag = %v, want %v", c.Tickers, want)
+	}
+}
+
+func TestLoadDurations(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want time.Duration
+		err  string
+	}{
+		{name: "minutes", env: "90m", want: 90 * time.Minute},
+		{name: "compound", env: "1h30m15s", want: time.Hour + 30*time.Minute + 15*time.Second},
+		{name: "no unit", env: "5", err: "EXCHANGE_TICK_AGGREGATE_TIME"},
+		{name: "words", env: "2 hours", err: "EXCHANGE_TICK_AGGREGATE_TIME"},
+		{name: "not positive", env: "0s", err: "tick_aggregate_time must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("EXCHANGE_TICK_AGGREGATE_TIME", tt.env)
+
+			c, err := ReadConfig(nil)
+			if tt.err != "" {
+				if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want ErrInvalidConfig about %s", err, tt.err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.TickAggregateTime != tt.want {
+				t.Errorf("tick_aggregate_time = %v, want %v", c.TickAggregateTime, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name, ext, data string
+		err             string
+	}{
+		{"unknown key", ".yaml", "grpc_addr: \":1\"\nrisk:\n  max_posiiton: 1\n", "unknown keys risk.max_posiiton"},
+		{"unknown section", ".toml", "[risks]\nmax_position = 1\n", "unknown keys risks"},
+		{"section instead of value", ".yaml", "db_path:\n  file: x\n", "db_path: want a single value"},
+		{"wrong type", ".toml", "id = \"first\"\n", "id: strconv.ParseInt"},
+		{"unknown format", ".json", "{}", `unknown format ".json"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadBrokerConfig([]string{"-config", writeFile(t, tt.ext, tt.data)})
+			if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want ErrInvalidConfig with %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadEnvTag(t *testing.T) {
+	t.Setenv("TELEGRAM_TOKEN", "123:abc")
+	t.Setenv("CLIENT_TELEGRAM_TOKEN", "ignored")
+
+	c, err := ReadClientConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TelegramToken != "123:abc" {
+		t.Errorf("telegram_token = %q, want it from TELEGRAM_TOKEN", c.TelegramToken)
+	}
+}
+
+func TestValidateCollectsAllProblems(t *testing.T) {
+	c := BrokerConfig{
+		ID:           0,
+		Addr:         "8081",
+		GRPCAddr:     ":8083",
+		ExchangeAddr: ":8080",
+		PnLMethod:    "lifo",
+		Risk:         RiskConfig{MaxPosition: -1, PriceCollar: 1},
+		Trace:        TraceConfig{ZipkinURL: "localhost:9411"},
+		Instruments:  []string{"SPFB.RTS:2"},
+	}
+
+	err := c.Validate()
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("error = %v, want ErrInvalidConfig", err)
+	}
+
+	for _, problem := range []string{
+		"id must be positive",
+		"addr: address 8081: missing port",
+		`exchange_addr: no host in ":8080"`,
+		"db_path is empty",
+		`pnl_method: want average or fifo, got "lifo"`,
+		"token_ttl must be positive",
+		"risk.max_position is negative",
+		"risk.price_collar must be in [0, 1)",
+		"trace.zipkin_url",
+		"instruments:",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("error %q has no %q", err, problem)
+		}
+	}
+	if n := strings.Count(err.Error(), "; "); n != 9 {
+		t.Errorf("error has %d problems, want 10", n+1)
+	}
+}
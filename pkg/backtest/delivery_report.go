@@ -0,0 +1,90 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+	"trading/pkg/price"
+)
+
+// WriteJSON весь отчёт одним json
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("cant write report: %w", err)
+	}
+
+	return nil
+}
+
+// WriteTradesCSV исполнения, деньги в копейках
+func (r *Report) WriteTradesCSV(w io.Writer) error {
+	rows := [][]string{{"time", "order_id", "ticker", "side", "volume", "price", "closed", "pnl"}}
+	for _, t := range r.Trades {
+		rows = append(rows, []string{
+			t.Time.Format(time.RFC3339),
+			strconv.FormatInt(t.OrderID, 10),
+			t.Ticker,
+			t.Side,
+			strconv.Itoa(int(t.Volume)),
+			t.Price.String(),
+			strconv.Itoa(int(t.Closed)),
+			strconv.FormatFloat(t.PnL, 'f', 2, 64),
+		})
+	}
+
+	return writeCSV(w, rows)
+}
+
+// WriteEquityCSV кривая стоимости счёта, деньги в копейках
+func (r *Report) WriteEquityCSV(w io.Writer) error {
+	rows := [][]string{{"time", "equity", "drawdown"}}
+	for _, p := range r.Equity {
+		rows = append(rows, []string{
+			p.Time.Format(time.RFC3339),
+			strconv.FormatFloat(p.Equity, 'f', 2, 64),
+			strconv.FormatFloat(p.Drawdown, 'f', 2, 64),
+		})
+	}
+
+	return writeCSV(w, rows)
+}
+
+func writeCSV(w io.Writer, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("cant write csv: %w", err)
+	}
+
+	return nil
+}
+
+// WriteSummary итоги для человека, деньги в рублях
+func (r *Report) WriteSummary(w io.Writer) error {
+	s := r.Summary
+	_, err := fmt.Fprintf(w, `strategy:      %s
+period:        %s - %s, %d candles
+equity:        %s -> %s (pnl %s)
+trades:        %d, closing %d, win rate %.1f%%
+max drawdown:  %s (%.2f%%)
+sharpe:        %.2f
+`,
+		r.Strategy,
+		s.From.Format(time.RFC3339), s.To.Format(time.RFC3339), s.Candles,
+		price.FormatMoney(s.Cash), rubles(s.Equity), rubles(s.PnL),
+		s.Trades, s.ClosingTrades, s.WinRate*100,
+		rubles(s.MaxDrawdown), s.MaxDrawdownPct,
+		s.Sharpe)
+
+	return err
+}
+
+func rubles(kopecks float64) string {
+	return price.FormatMoney(int64(math.Round(kopecks)))
+}
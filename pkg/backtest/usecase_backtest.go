@@ -0,0 +1,202 @@
+// Package backtest прогоняет стратегию робота на файле истории биржи без сети.
+// Сделки читаются, собираются в свечи и исполняют заявки тем же кодом, что и на
+// бирже (exchange.TickReader, exchange.Aggregate, exchange.OrderBook), только
+// время не ждёт: часы робота идут по времени сделок, свеча собирается из всех
+// сделок за Interval истории, а следующая группа сделок читается сразу, как
+// стратегия обработала предыдущую. За промежутки истории без сделок свечей нет.
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"trading/pkg/exchange"
+	api "trading/pkg/gen/exchange"
+	"trading/pkg/models"
+	"trading/pkg/robot"
+)
+
+var ErrNoOrder = errors.New("order not found")
+var ErrWrongConfig = errors.New("wrong backtest config")
+
+// брокер и клиент, от имени которых симуляция ставит заявки в стакан
+const (
+	simBrokerID = 1
+	simClientID = 1
+)
+
+// Config параметры прогона
+type Config struct {
+	// Interval сколько времени истории в одной свече, как tick_aggregate_time биржи
+	Interval time.Duration
+	// Cash начальные деньги в копейках, от них считаются доходности для Sharpe
+	Cash int64
+}
+
+// simGateway заявки робота прямо в стакан биржи. Риск проверок брокера нет,
+// отклоняется только то, что отклонила бы биржа
+type simGateway struct {
+	book   *exchange.OrderBook
+	orders map[int64]models.Order // все заявки прогона по ID
+}
+
+func (g *simGateway) Deal(ctx context.Context, deal models.Deal) (models.Order, error) {
+	isBuy := deal.Type == models.DealBuy
+	id, err := g.book.Create(&api.Deal{
+		BrokerID: simBrokerID,
+		ClientID: simClientID,
+		Ticker:   deal.Ticker,
+		Volume:   deal.Volume,
+		Price:    deal.Price,
+		IsBuy:    isBuy,
+	})
+	if errors.Is(err, exchange.ErrWrongDeal) {
+		return models.Order{}, fmt.Errorf("%w: %v", robot.ErrRejected, err)
+	}
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	order := models.Order{
+		ID:            id,
+		ClientOrderID: deal.ClientOrderID,
+		ClientID:      simClientID,
+		Ticker:        deal.Ticker,
+		Volume:        deal.Volume,
+		Price:         deal.Price,
+		IsBuy:         isBuy,
+		Status:        models.OrderPlaced,
+	}
+	g.orders[id] = order
+
+	return order, nil
+}
+
+func (g *simGateway) Cancel(ctx context.Context, orderID int64) (models.OrderStatus, error) {
+	order, ok := g.orders[orderID]
+	if !ok {
+		return "", fmt.Errorf("%w: %d", ErrNoOrder, orderID)
+	}
+
+	if order.Status.IsOpen() && g.book.Cancel(simBrokerID, orderID) {
+		order.Status = models.OrderCancelled
+		g.orders[orderID] = order
+	}
+
+	return order.Status, nil
+}
+
+// fill состояние заявки после исполнения d
+func (g *simGateway) fill(d *api.Deal) models.Order {
+	order := g.orders[d.ID]
+	order.Filled += d.Volume
+	order.Status = models.OrderFilled
+	if d.Partial {
+		order.Status = models.OrderPartial
+	}
+	g.orders[d.ID] = order
+
+	return order
+}
+
+// Run прогоняет стратегию s на сделках из ticks и возвращает отчёт. Порядок событий
+// на каждой группе сделок как при торговле: таймеры робота, исполнения заявок,
+// выставленных раньше. Свеча за Interval приходит, когда пришли сделки уже за
+// следующий, или в конце истории, её время - начало интервала. Таймер срабатывает
+// на первой группе сделок не раньше своего времени
+func Run(ctx context.Context, name string, s robot.Strategy, ticks io.Reader, config Config) (*Report, error) {
+	if config.Interval <= 0 || config.Cash <= 0 {
+		return nil, fmt.Errorf("%w: want positive interval and cash, got %v and %d",
+			ErrWrongConfig, config.Interval, config.Cash)
+	}
+
+	book := exchange.NewOrderBook()
+	gateway := &simGateway{book: book, orders: make(map[int64]models.Order)}
+	r := robot.New(name, s, gateway)
+	l := newLedger(config.Cash)
+	reader := exchange.NewTickReader(ticks)
+
+	// свеча собирается в candle с начала интервала bucket, нулевое - сделок ещё не было
+	var bucket time.Time
+	var candle exchange.OHLCV
+	var candles int64
+	emit := func() {
+		candles++
+		r.HandleCandle(ctx, models.Candle{
+			ID:       candles,
+			Time:     bucket.Unix(),
+			Interval: int32(config.Interval / time.Second),
+			Open:     candle.Open,
+			High:     candle.High,
+			Low:      candle.Low,
+			Close:    candle.Close,
+			Volume:   candle.Volume,
+			Ticker:   candle.Ticker,
+		})
+		l.mark(bucket, candle.Ticker, candle.Close, r)
+	}
+
+	var lastFill int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entries, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		now := entries[0].At()
+		if bucket.IsZero() {
+			r.Start(ctx, now, nil, nil)
+		}
+		if at := now.Truncate(config.Interval); !at.Equal(bucket) {
+			if !bucket.IsZero() {
+				emit()
+			}
+			bucket, candle = at, exchange.OHLCV{}
+		}
+		r.Advance(ctx, now)
+
+		ohlcv := exchange.Aggregate(book, entries)
+
+		var fills []*api.Deal
+		fills, lastFill = book.Fills(simBrokerID, lastFill)
+		for _, d := range fills {
+			order := gateway.fill(d)
+			l.trade(now, r.Position(order.Ticker), order, d.Volume, d.Price)
+			r.HandleFill(ctx, robot.Fill{Order: order, Volume: d.Volume, Price: d.Price, Time: now.Unix()})
+		}
+
+		candle = merge(candle, ohlcv)
+	}
+	if !bucket.IsZero() {
+		emit()
+	}
+
+	return l.report(name, config.Interval), nil
+}
+
+// merge добавляет к свече candle сделки next, пустая candle становится next
+func merge(candle, next exchange.OHLCV) exchange.OHLCV {
+	if candle.Ticker == "" {
+		return next
+	}
+
+	if next.High > candle.High {
+		candle.High = next.High
+	}
+	if next.Low < candle.Low {
+		candle.Low = next.Low
+	}
+	candle.Close = next.Close
+	candle.Volume += next.Volume
+
+	return candle
+}
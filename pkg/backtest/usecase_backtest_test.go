@@ -0,0 +1,270 @@
+package backtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"trading/pkg/models"
+	"trading/pkg/robot"
+)
+
+const ticks = `<TICKER>,<PER>,<DATE>,<TIME>,<LAST>,<VOL>
+T,0,20190517,100000,101.00,1
+T,0,20190517,100001,99.50,1
+T,0,20190517,100002,102.50,1
+T,0,20190517,100003,101.00,1
+`
+
+// roundTrip покупает по 100.00 и продаёт купленное по 102.00
+type roundTrip struct {
+	robot.Base
+	bought bool
+}
+
+func (s *roundTrip) OnCandle(ctx context.Context, r *robot.Robot, c models.Candle) {
+	if len(r.Orders()) > 0 {
+		return
+	}
+
+	var err error
+	switch {
+	case !s.bought:
+		s.bought = true
+		_, err = r.Buy(ctx, "T", 10000, 1)
+	case r.Position("T").Volume > 0:
+		_, err = r.Sell(ctx, "T", 10200, 1)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	report, err := Run(context.Background(), "test", &roundTrip{}, strings.NewReader(ticks),
+		Config{Interval: time.Second, Cash: 200000})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// у T шаг 0.01 и пункт - рубль, поэтому единица цены - копейка
+	var equity []float64
+	for _, p := range report.Equity {
+		equity = append(equity, p.Equity)
+	}
+	want := []float64{200000, 199950, 200200, 200200}
+	if len(equity) != len(want) {
+		t.Fatalf("equity = %v, want %v", equity, want)
+	}
+	for i := range want {
+		if equity[i] != want[i] {
+			t.Errorf("equity = %v, want %v", equity, want)
+
+			break
+		}
+	}
+
+	if len(report.Trades) != 2 {
+		t.Fatalf("trades = %+v, want buy and sell", report.Trades)
+	}
+	if sell := report.Trades[1]; sell.Price != "102.00" || sell.Closed != 1 || sell.PnL != 200 {
+		t.Errorf("sell = %+v, want 1 closed at 102.00 with pnl 200", sell)
+	}
+
+	s := report.Summary
+	if s.PnL != 200 || s.WinRate != 1 || s.MaxDrawdown != 50 || s.Candles != 4 {
+		t.Errorf("summary = %+v", s)
+	}
+	if s.Sharpe <= 0 {
+		t.Errorf("sharpe = %v, want positive", s.Sharpe)
+	}
+	if !s.From.Equal(time.Date(2019, 5, 17, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("from = %v", s.From)
+	}
+}
+
+// clockCheck запоминает свечи и время, когда сработал таймер на 3 минуты
+type clockCheck struct {
+	robot.Base
+	candles []models.Candle
+	fired   time.Time
+}
+
+func (s *clockCheck) OnStart(ctx context.Context, r *robot.Robot) {
+	r.After(3*time.Minute, func(ctx context.Context) { s.fired = r.Now() })
+}
+
+func (s *clockCheck) OnCandle(ctx context.Context, r *robot.Robot, c models.Candle) {
+	s.candles = append(s.candles, c)
+}
+
+func TestRunHistoryGap(t *testing.T) {
+	// с 10:01:10 до 10:05:00 сделок нет
+	const gap = `<TICKER>,<PER>,<DATE>,<TIME>,<LAST>,<VOL>
+T,0,20190517,100000,101.00,1
+T,0,20190517,100030,103.00,2
+T,0,20190517,100110,102.00,1
+T,0,20190517,100500,100.00,1
+`
+	s := &clockCheck{}
+	report, err := Run(context.Background(), "test", s, strings.NewReader(gap),
+		Config{Interval: time.Minute, Cash: 200000})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	at := func(hhmmss string) time.Time {
+		t.Helper()
+
+		v, err := time.Parse("20060102 150405", "20190517 "+hhmmss)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	want := []models.Candle{
+		{ID: 1, Time: at("100000").Unix(), Interval: 60, Open: 10100, High: 10300, Low: 10100, Close: 10300, Volume: 3, Ticker: "T"},
+		{ID: 2, Time: at("100100").Unix(), Interval: 60, Open: 10200, High: 10200, Low: 10200, Close: 10200, Volume: 1, Ticker: "T"},
+		{ID: 3, Time: at("100500").Unix(), Interval: 60, Open: 10000, High: 10000, Low: 10000, Close: 10000, Volume: 1, Ticker: "T"},
+	}
+	if len(s.candles) != len(want) {
+		t.Fatalf("candles = %+v, want %+v", s.candles, want)
+	}
+	for i := range want {
+		if s.candles[i] != want[i] {
+			t.Errorf("candle %d = %+v, want %+v", i, s.candles[i], want[i])
+		}
+	}
+
+	// часы идут по времени сделок, а не по номеру свечи
+	if !s.fired.Equal(at("100500")) {
+		t.Errorf("timer fired at %v, want at the first trade after the gap", s.fired)
+	}
+	if !report.Summary.To.Equal(at("100500")) || report.Summary.Candles != 3 {
+		t.Errorf("summary = %+v, want 3 candles up to 10:05", report.Summary)
+	}
+}
+
+// partialBuy покупает 2 контракта по 100.00 и запоминает исполнения
+type partialBuy struct {
+	robot.Base
+	placed bool
+	fills  []robot.Fill
+}
+
+func (s *partialBuy) OnCandle(ctx context.Context, r *robot.Robot, c models.Candle) {
+	if s.placed {
+		return
+	}
+
+	s.placed = true
+	if _, err := r.Buy(ctx, "T", 10000, 2); err != nil {
+		panic(err)
+	}
+}
+
+func (s *partialBuy) OnFill(ctx context.Context, r *robot.Robot, f robot.Fill) {
+	s.fills = append(s.fills, f)
+}
+
+func TestRunPartialFill(t *testing.T) {
+	// на каждой цене продаётся один контракт
+	const partial = `<TICKER>,<PER>,<DATE>,<TIME>,<LAST>,<VOL>
+T,0,20190517,100000,101.00,1
+T,0,20190517,100001,100.00,1
+T,0,20190517,100002,99.50,1
+T,0,20190517,100003,101.00,1
+`
+	s := &partialBuy{}
+	report, err := Run(context.Background(), "test", s, strings.NewReader(partial),
+		Config{Interval: time.Second, Cash: 200000})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(s.fills) != 2 {
+		t.Fatalf("fills = %+v, want 2", s.fills)
+	}
+	if o := s.fills[0].Order; o.Status != models.OrderPartial || o.Filled != 1 {
+		t.Errorf("first fill order = %+v, want partial with 1 filled", o)
+	}
+	if o := s.fills[1].Order; o.Status != models.OrderFilled || o.Filled != 2 {
+		t.Errorf("second fill order = %+v, want filled with 2 filled", o)
+	}
+
+	if len(report.Trades) != 2 || report.Trades[0].Volume != 1 || report.Trades[1].Volume != 1 {
+		t.Errorf("trades = %+v, want 2 of 1", report.Trades)
+	}
+	// 2 контракта по 100.00, последняя цена 101.00
+	if report.Summary.Equity != 200200 {
+		t.Errorf("equity = %v, want 200200", report.Summary.Equity)
+	}
+}
+
+// shortTrip продаёт по 102.00 и откупает по 100.00
+type shortTrip struct {
+	robot.Base
+	sold bool
+}
+
+func (s *shortTrip) OnCandle(ctx context.Context, r *robot.Robot, c models.Candle) {
+	if len(r.Orders()) > 0 {
+		return
+	}
+
+	var err error
+	switch {
+	case !s.sold:
+		s.sold = true
+		_, err = r.Sell(ctx, "T", 10200, 1)
+	case r.Position("T").Volume < 0:
+		_, err = r.Buy(ctx, "T", 10000, 1)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRunShortPosition(t *testing.T) {
+	const short = `<TICKER>,<PER>,<DATE>,<TIME>,<LAST>,<VOL>
+T,0,20190517,100000,101.00,1
+T,0,20190517,100001,102.50,1
+T,0,20190517,100002,103.00,1
+T,0,20190517,100003,99.50,1
+T,0,20190517,100004,100.00,1
+`
+	report, err := Run(context.Background(), "test", &shortTrip{}, strings.NewReader(short),
+		Config{Interval: time.Second, Cash: 200000})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// рост цены против короткой позиции уменьшает счёт
+	var equity []float64
+	for _, p := range report.Equity {
+		equity = append(equity, p.Equity)
+	}
+	want := []float64{200000, 199950, 199900, 200200, 200200}
+	if len(equity) != len(want) {
+		t.Fatalf("equity = %v, want %v", equity, want)
+	}
+	for i := range want {
+		if equity[i] != want[i] {
+			t.Errorf("equity = %v, want %v", equity, want)
+
+			break
+		}
+	}
+
+	if len(report.Trades) != 2 {
+		t.Fatalf("trades = %+v, want sell and buy", report.Trades)
+	}
+	if buy := report.Trades[1]; buy.Side != models.DealBuy || buy.Closed != 1 || buy.PnL != 200 {
+		t.Errorf("buy = %+v, want 1 closed with pnl 200", buy)
+	}
+	if s := report.Summary; s.PnL != 200 || s.WinRate != 1 || s.MaxDrawdown != 100 {
+		t.Errorf("summary = %+v", s)
+	}
+}
@@ -0,0 +1,223 @@
+package backtest
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+	"trading/pkg/models"
+	"trading/pkg/price"
+	"trading/pkg/robot"
+)
+
+// tradingYear время торгов за год для годового Sharpe: 252 дня по 14 часов
+// основной и вечерней сессии
+const tradingYear = 252 * 14 * time.Hour
+
+// Trade исполнение заявки робота
+type Trade struct {
+	Time    time.Time   `json:"time"`
+	OrderID int64       `json:"order_id"`
+	Ticker  string      `json:"ticker"`
+	Side    string      `json:"side"` // BUY или SELL
+	Volume  int32       `json:"volume"`
+	Price   json.Number `json:"price"` // в знаках инструмента
+	// Closed сколько контрактов позиции закрыло исполнение, PnL - их результат
+	// по средней цене входа в копейках
+	Closed int32   `json:"closed"`
+	PnL    float64 `json:"pnl"`
+}
+
+// EquityPoint стоимость счёта по закрытию свечи в копейках
+type EquityPoint struct {
+	Time     time.Time `json:"time"`
+	Equity   float64   `json:"equity"`
+	Drawdown float64   `json:"drawdown"` // от предыдущего максимума
+}
+
+// Summary итоги прогона, деньги в копейках
+type Summary struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Candles int       `json:"candles"`
+
+	Cash   int64   `json:"cash"`
+	Equity float64 `json:"equity"`
+	PnL    float64 `json:"pnl"`
+
+	Trades int `json:"trades"`
+	// ClosingTrades исполнения, закрывшие хотя бы часть позиции, WinRate - доля прибыльных среди них
+	ClosingTrades int     `json:"closing_trades"`
+	Wins          int     `json:"wins"`
+	WinRate       float64 `json:"win_rate"`
+
+	MaxDrawdown    float64 `json:"max_drawdown"`
+	MaxDrawdownPct float64 `json:"max_drawdown_pct"` // от максимума, на котором началась просадка
+	// Sharpe годовой по доходностям счёта от свечи к свече, безрисковая ставка 0
+	Sharpe float64 `json:"sharpe"`
+}
+
+// Report результат прогона: итоги, исполнения и кривая стоимости счёта
+type Report struct {
+	Strategy string        `json:"strategy"`
+	Summary  Summary       `json:"summary"`
+	Trades   []Trade       `json:"trades"`
+	Equity   []EquityPoint `json:"equity"`
+}
+
+// ledger учёт денег прогона: результат закрытых контрактов по средней цене входа,
+// как у позиции робота, и переоценка открытых по последней цене
+type ledger struct {
+	cash     int64
+	realized float64
+
+	tickers []string // в порядке первой свечи, чтобы сумма считалась одинаково
+	marks   map[string]int64
+
+	peak     float64
+	maxDDPct float64
+	trades   []Trade
+	equity   []EquityPoint
+}
+
+func newLedger(cash int64) *ledger {
+	return &ledger{cash: cash, marks: make(map[string]int64), peak: float64(cash)}
+}
+
+// trade исполнение volume по цене units, pos - позиция до него
+func (l *ledger) trade(at time.Time, pos robot.Position, order models.Order, volume int32, units int64) {
+	t := Trade{
+		Time:    at,
+		OrderID: order.ID,
+		Ticker:  order.Ticker,
+		Side:    models.DealSell,
+		Volume:  volume,
+		Price:   json.Number(price.Lookup(order.Ticker).Format(units)),
+	}
+	if order.IsBuy {
+		t.Side = models.DealBuy
+	}
+
+	if pos.Volume != 0 && (pos.Volume > 0) != order.IsBuy {
+		closed := int64(volume)
+		if held := abs(pos.Volume); held < closed {
+			closed = held
+		}
+
+		diff := float64(units) - pos.AvgPrice
+		if pos.Volume < 0 {
+			diff = -diff
+		}
+
+		t.Closed = int32(closed)
+		t.PnL = price.Lookup(order.Ticker).Money(diff * float64(closed))
+		l.realized += t.PnL
+	}
+
+	l.trades = append(l.trades, t)
+}
+
+// mark переоценивает счёт по закрытию свечи ticker
+func (l *ledger) mark(at time.Time, ticker string, last int64, r *robot.Robot) {
+	if _, ok := l.marks[ticker]; !ok {
+		l.tickers = append(l.tickers, ticker)
+	}
+	l.marks[ticker] = last
+
+	equity := float64(l.cash) + l.realized
+	for _, t := range l.tickers {
+		p := r.Position(t)
+		if p.Volume != 0 {
+			equity += price.Lookup(t).Money((float64(l.marks[t]) - p.AvgPrice) * float64(p.Volume))
+		}
+	}
+
+	if equity > l.peak {
+		l.peak = equity
+	}
+	drawdown := l.peak - equity
+	if pct := drawdown / l.peak * 100; pct > l.maxDDPct {
+		l.maxDDPct = pct
+	}
+
+	l.equity = append(l.equity, EquityPoint{Time: at, Equity: equity, Drawdown: drawdown})
+}
+
+func (l *ledger) report(name string, interval time.Duration) *Report {
+	s := Summary{
+		Candles:        len(l.equity),
+		Cash:           l.cash,
+		Equity:         float64(l.cash),
+		Trades:         len(l.trades),
+		MaxDrawdownPct: l.maxDDPct,
+		Sharpe:         sharpe(float64(l.cash), l.equity, interval),
+	}
+
+	if len(l.equity) > 0 {
+		s.From = l.equity[0].Time
+		s.To = l.equity[len(l.equity)-1].Time
+		s.Equity = l.equity[len(l.equity)-1].Equity
+	}
+	s.PnL = s.Equity - float64(l.cash)
+
+	for _, p := range l.equity {
+		if p.Drawdown > s.MaxDrawdown {
+			s.MaxDrawdown = p.Drawdown
+		}
+	}
+
+	for _, t := range l.trades {
+		if t.Closed == 0 {
+			continue
+		}
+
+		s.ClosingTrades++
+		if t.PnL > 0 {
+			s.Wins++
+		}
+	}
+	if s.ClosingTrades > 0 {
+		s.WinRate = float64(s.Wins) / float64(s.ClosingTrades)
+	}
+
+	return &Report{Strategy: name, Summary: s, Trades: l.trades, Equity: l.equity}
+}
+
+// sharpe среднее доходностей к их стандартному отклонению, приведённое к году.
+// Меньше двух свечей или счёт не менялся - 0
+func sharpe(cash float64, equity []EquityPoint, interval time.Duration) float64 {
+	if len(equity) < 2 {
+		return 0
+	}
+
+	returns := make([]float64, 0, len(equity))
+	prev := cash
+	for _, p := range equity {
+		returns = append(returns, (p.Equity-prev)/prev)
+		prev = p.Equity
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	if std == 0 {
+		return 0
+	}
+
+	return mean / std * math.Sqrt(float64(tradingYear/interval))
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
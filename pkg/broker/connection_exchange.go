@@ -0,0 +1,272 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+	"trading/pkg/gen/exchange"
+	"trading/pkg/tracing"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ConnState состояние потока от биржи
+type ConnState string
+
+const (
+	StateConnecting   ConnState = "connecting"
+	StateConnected    ConnState = "connected"
+	StateDisconnected ConnState = "disconnected"
+)
+
+const (
+	StreamStatistic = "statistic"
+	StreamResults   = "results"
+)
+
+// StreamHealth состояние одного потока для health эндпоинта
+type StreamHealth struct {
+	State      ConnState `json:"state"`
+	Since      time.Time `json:"since"`
+	Reconnects int       `json:"reconnects"`
+	LastID     int64     `json:"last_id,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Backoff экспоненциальная задержка между переподключениями со случайным разбросом
+type Backoff struct {
+	Min, Max time.Duration
+	Factor   float64
+	Jitter   float64 // доля задержки, на которую она может случайно уменьшиться
+}
+
+var DefaultBackoff = Backoff{
+	Min:    100 * time.Millisecond,
+	Max:    30 * time.Second,
+	Factor: 2,
+	Jitter: 0.5,
+}
+
+// Delay задержка перед попыткой attempt, попытки считаются с нуля
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Min) * math.Pow(b.Factor, float64(attempt))
+	if d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+
+	d -= d * b.Jitter * rand.Float64()
+
+	return time.Duration(d)
+}
+
+// ExchangeConn держит потоки Statistic и Results от биржи,
+// переподключается с backoff и продолжает Statistic с последней полученной свечи
+type ExchangeConn struct {
+	broker  *Broker
+	backoff Backoff
+
+	// OnConnect вызывается после каждого (пере)подключения потока
+	OnConnect func(ctx context.Context, stream string)
+
+	mu      sync.RWMutex
+	streams map[string]*StreamHealth
+}
+
+func NewExchangeConn(b *Broker, backoff Backoff) *ExchangeConn {
+	now := time.Now()
+
+	return &ExchangeConn{
+		broker:  b,
+		backoff: backoff,
+		streams: map[string]*StreamHealth{
+			StreamStatistic: {State: StateConnecting, Since: now},
+			StreamResults:   {State: StateConnecting, Since: now},
+		},
+	}
+}
+
+// Run держит оба потока до отмены ctx
+func (c *ExchangeConn) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.keep(ctx, StreamStatistic, c.statistic)
+	}()
+	go func() {
+		defer wg.Done()
+		c.keep(ctx, StreamResults, c.results)
+	}()
+
+	wg.Wait()
+}
+
+// Health состояние потоков, ok - если все подключены
+func (c *ExchangeConn) Health() (map[string]StreamHealth, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ok := true
+	health := make(map[string]StreamHealth, len(c.streams))
+	for name, s := range c.streams {
+		health[name] = *s
+		ok = ok && s.State == StateConnected
+	}
+
+	return health, ok
+}
+
+// keep переоткрывает поток, пока ctx не отменён
+func (c *ExchangeConn) keep(ctx context.Context, name string, stream func(ctx context.Context, name string) error) {
+	for attempt := 0; ; attempt++ {
+		c.setState(name, StateConnecting, nil)
+
+		started := time.Now()
+		err := stream(ctx, name)
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.setState(name, StateDisconnected, err)
+
+		// поток успел поработать - начинаем задержки сначала
+		if time.Since(started) > c.backoff.Max {
+			attempt = 0
+		}
+
+		delay := c.backoff.Delay(attempt)
+		log.Err(err).Msgf("exchange %s stream lost, reconnect in %v", name, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		c.mu.Lock()
+		c.streams[name].Reconnects++
+		c.mu.Unlock()
+		reconnects.WithLabelValues(name).Inc()
+	}
+}
+
+func (c *ExchangeConn) statistic(ctx context.Context, name string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	e, err := c.broker.Exchange().Statistic(ctx, &exchange.BrokerID{ID: c.broker.ID, LastID: c.lastID(name)})
+	if err != nil {
+		return err
+	}
+
+	for first := true; ; first = false {
+		ohlcv, err := e.Recv()
+		if err != nil {
+			return err
+		}
+
+		// поток считаем живым только после первого сообщения, до этого
+		// grpc не гарантирует, что биржа вообще доступна
+		if first {
+			c.connected(ctx, name)
+		}
+
+		log.Printf("ohlcv: %+v", ohlcv)
+
+		if err = c.broker.HandleCandle(ctx, ohlcv); err != nil {
+			log.Err(err).Msg("Failed to save ohlcv")
+		}
+
+		c.mu.Lock()
+		c.streams[name].LastID = ohlcv.ID
+		c.mu.Unlock()
+	}
+}
+
+func (c *ExchangeConn) results(ctx context.Context, name string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lastID, err := c.broker.LastFillID(ctx)
+	if err != nil {
+		return err
+	}
+
+	e, err := c.broker.Exchange().Results(ctx, &exchange.BrokerID{ID: c.broker.ID, LastID: lastID})
+	if err != nil {
+		return err
+	}
+
+	// в Results сделки приходят редко, поэтому ждём заголовки ответа,
+	// а не первое сообщение. Пустые заголовки - ответ без тела (например
+	// Unimplemented), саму ошибку вернёт Recv
+	md, err := e.Header()
+	if err != nil {
+		return err
+	}
+	if md.Len() > 0 {
+		c.connected(ctx, name)
+	}
+
+	for {
+		deal, err := e.Recv()
+		if err != nil {
+			return err
+		}
+
+		// исполнение пишется в лог с ID запроса, который выставил заявку
+		dealCtx := tracing.WithID(ctx, deal.CorrelationID)
+		log.Ctx(dealCtx).Printf("deal: %+v", deal)
+
+		_, err = c.broker.HandleFill(dealCtx, deal)
+		switch {
+		case err == nil, errors.Is(err, ErrDuplicateFill):
+		case errors.Is(err, ErrOrderNotFound):
+			// отложено до выставления заявки, LastFillID не уйдёт дальше него
+			log.Ctx(dealCtx).Warn().Err(err).Msgf("Deal %d is not placed yet", deal.ID)
+		default:
+			// не применённое исполнение биржа пришлёт снова после переподключения
+			return fmt.Errorf("cant apply deal %d: %w", deal.ID, err)
+		}
+
+		c.mu.Lock()
+		c.streams[name].LastID = deal.FillID
+		c.mu.Unlock()
+	}
+}
+
+func (c *ExchangeConn) connected(ctx context.Context, name string) {
+	c.setState(name, StateConnected, nil)
+	log.Printf("exchange %s stream connected", name)
+
+	if c.OnConnect != nil {
+		c.OnConnect(ctx, name)
+	}
+}
+
+func (c *ExchangeConn) setState(name string, state ConnState, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.streams[name]
+	if s.State != state {
+		s.State = state
+		s.Since = time.Now()
+	}
+
+	if err != nil {
+		s.LastError = err.Error()
+	}
+}
+
+func (c *ExchangeConn) lastID(name string) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.streams[name].LastID
+}
@@ -0,0 +1,420 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	api "trading/pkg/gen/broker"
+	"trading/pkg/models"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ClientIDMetadata ключ metadata, в котором клиент передаёт свой ID
+const ClientIDMetadata = "client-id"
+
+// OrderSeqMetadata заголовок потока заявок с номером последнего события до подписки
+const OrderSeqMetadata = "order-seq"
+
+// errShuttingDown брокер останавливается, клиенту стоит переподключиться позже
+var errShuttingDown = status.Error(codes.Unavailable, "broker is shutting down")
+
+// GRPCServer grpc апи брокера, та же бизнес логика что и у http апи
+type GRPCServer struct {
+	broker *Broker
+	// closing закрывается в Shutdown, подписки клиентов завершаются с Unavailable
+	closing chan struct{}
+	api.UnimplementedBrokerServer
+}
+
+func NewGRPCServer(b *Broker) *GRPCServer {
+	return &GRPCServer{broker: b, closing: make(chan struct{})}
+}
+
+// Shutdown завершает подписки Quotes, Fills и Orders, иначе GracefulStop ждал бы их вечно
+func (s *GRPCServer) Shutdown() {
+	close(s.closing)
+}
+
+func (s *GRPCServer) Login(ctx context.Context, req *api.LoginRequest) (*api.LoginResponse, error) {
+	client, token, err := s.broker.Login(ctx, req.Login, req.Password)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &api.LoginResponse{ClientID: client.ID, Token: token.Token}, nil
+}
+
+func (s *GRPCServer) Status(ctx context.Context, req *api.StatusRequest) (*api.StatusResponse, error) {
+	clientID, err := s.clientID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := s.broker.Status(ctx, clientID, req.Method)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &api.StatusResponse{
+		Balance:       st.Body.Balance,
+		PnLMethod:     string(st.Body.PnLMethod),
+		RealizedPnL:   st.Body.RealizedPnL,
+		UnrealizedPnL: st.Body.UnrealizedPnL,
+	}
+	for _, p := range st.Body.Positions {
+		resp.Positions = append(resp.Positions, &api.Position{
+			Ticker:        p.Ticker,
+			Volume:        p.Volume,
+			AvgPrice:      p.AvgPrice,
+			MarkPrice:     p.MarkPrice,
+			RealizedPnL:   p.RealizedPnL,
+			UnrealizedPnL: p.UnrealizedPnL,
+		})
+	}
+	for _, o := range st.Body.OpenOrders {
+		resp.OpenOrders = append(resp.OpenOrders, orderToProto(o))
+	}
+
+	return resp, nil
+}
+
+func (s *GRPCServer) Deal(ctx context.Context, req *api.DealRequest) (*api.Order, error) {
+	clientID, err := s.clientID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := s.broker.Deal(ctx, models.Order{
+		ClientID:      clientID,
+		ClientOrderID: req.ClientOrderID,
+		Ticker:        req.Ticker,
+		Volume:        req.Volume,
+		Price:         req.Price,
+		IsBuy:         req.IsBuy,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return orderToProto(order), nil
+}
+
+func (s *GRPCServer) Cancel(ctx context.Context, req *api.CancelRequest) (*api.Order, error) {
+	clientID, err := s.clientID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := s.broker.Cancel(ctx, clientID, req.ID, req.ClientOrderID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return orderToProto(order), nil
+}
+
+func (s *GRPCServer) GetOrder(ctx context.Context, req *api.OrderRequest) (*api.Order, error) {
+	clientID, err := s.clientID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := s.broker.Order(ctx, clientID, req.ID, req.ClientOrderID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return orderToProto(order), nil
+}
+
+func (s *GRPCServer) History(ctx context.Context, req *api.HistoryRequest) (*api.HistoryResponse, error) {
+	if req.Ticker == "" {
+		return nil, status.Error(codes.InvalidArgument, "ticker is required")
+	}
+
+	seconds := req.Seconds
+	switch {
+	case seconds < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "seconds must be a positive number, got %d", seconds)
+	case seconds == 0:
+		seconds = DefaultHistory
+	}
+
+	prices, err := s.broker.History(ctx, req.Ticker, time.Now().Unix(), seconds)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &api.HistoryResponse{Ticker: req.Ticker}
+	for _, c := range prices {
+		resp.Prices = append(resp.Prices, candleToProto(c))
+	}
+
+	return resp, nil
+}
+
+func (s *GRPCServer) Instruments(ctx context.Context, _ *api.InstrumentsRequest) (*api.InstrumentsResponse, error) {
+	instruments, err := s.broker.Instruments(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &api.InstrumentsResponse{}
+	for _, i := range instruments {
+		resp.Instruments = append(resp.Instruments, &api.Instrument{
+			Ticker:     i.Ticker,
+			LastPrice:  i.LastPrice,
+			Scale:      int32(i.Scale),
+			TickSize:   i.TickSize,
+			PointValue: i.PointValue,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *GRPCServer) Quotes(req *api.QuotesRequest, stream api.Broker_QuotesServer) error {
+	tickers := make(map[string]bool, len(req.Tickers))
+	for _, t := range req.Tickers {
+		tickers[t] = true
+	}
+
+	candles, unsubscribe := s.broker.SubscribeCandles()
+	defer unsubscribe()
+
+	// по заголовкам клиент понимает, что события уже не потеряются
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.closing:
+			return errShuttingDown
+		case c := <-candles:
+			if len(tickers) > 0 && !tickers[c.Ticker] {
+				continue
+			}
+
+			if err := stream.Send(candleToProto(c)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *GRPCServer) Fills(_ *api.FillsRequest, stream api.Broker_FillsServer) error {
+	clientID, err := s.clientID(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	fills, unsubscribe := s.broker.SubscribeFills(clientID)
+	defer unsubscribe()
+
+	// по заголовкам клиент понимает, что события уже не потеряются
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.closing:
+			return errShuttingDown
+		case e := <-fills:
+			err = stream.Send(&api.Fill{
+				FillID: e.Fill.FillID,
+				Time:   e.Fill.Time,
+				Volume: e.Fill.Volume,
+				Price:  e.Fill.Price,
+				Order:  orderToProto(e.Order),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *GRPCServer) Orders(req *api.OrdersRequest, stream api.Broker_OrdersServer) error {
+	clientID, err := s.clientID(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	orders, unsubscribe := s.broker.SubscribeOrders(clientID)
+	defer unsubscribe()
+
+	// после подписки события уже не теряются: пропущенные досылаются из истории,
+	// а те, что успели прийти и в подписку, отбрасываются по номеру
+	var replay []OrderEvent
+	last := req.AfterSeq
+	if req.Resume {
+		replay, err = s.broker.OrderEvents(stream.Context(), clientID, req.AfterSeq)
+	} else {
+		last, err = s.broker.LastOrderSeq(stream.Context(), clientID)
+	}
+	if err != nil {
+		return grpcError(err)
+	}
+
+	// по заголовкам клиент понимает, что события уже не потеряются
+	if err := stream.SendHeader(metadata.Pairs(OrderSeqMetadata, strconv.FormatInt(last, 10))); err != nil {
+		return err
+	}
+
+	send := func(e OrderEvent) error {
+		if e.Seq > 0 && e.Seq <= last {
+			return nil
+		}
+		if e.Seq > 0 {
+			last = e.Seq
+		}
+
+		return stream.Send(orderUpdateToProto(e))
+	}
+
+	for _, e := range replay {
+		if err = send(e); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.closing:
+			return errShuttingDown
+		case e, ok := <-orders:
+			if !ok {
+				return status.Errorf(codes.ResourceExhausted, "order subscriber is behind, resume after seq %d", last)
+			}
+
+			if err = send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func orderUpdateToProto(e OrderEvent) *api.OrderUpdate {
+	update := &api.OrderUpdate{
+		Order:  orderToProto(e.Order),
+		Time:   e.Time,
+		Reason: e.Reason,
+		Seq:    e.Seq,
+
+		CorrelationID: e.CorrelationID,
+	}
+	if e.Fill != nil {
+		update.FillVolume = e.Fill.Volume
+		update.FillPrice = e.Fill.Price
+	}
+
+	return update
+}
+
+// clientID клиент по токену из metadata authorization или по client-id, как в http апи
+func (s *GRPCServer) clientID(ctx context.Context) (int64, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var token string
+	if values := md.Get("authorization"); len(values) > 0 && strings.HasPrefix(values[0], bearerPrefix) {
+		token = strings.TrimPrefix(values[0], bearerPrefix)
+	}
+
+	var headerID int64
+	if values := md.Get(ClientIDMetadata); len(values) > 0 {
+		headerID, _ = strconv.ParseInt(values[0], 10, 64)
+	}
+
+	clientID, err := s.broker.Authenticate(ctx, token, headerID)
+	if err != nil {
+		return 0, grpcError(err)
+	}
+
+	return clientID, nil
+}
+
+// grpcError переводит ошибки бизнес логики в grpc коды так же, как http апи
+func grpcError(err error) error {
+	code := codes.Internal
+	switch errorCode(err) {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.FailedPrecondition
+	case http.StatusUnprocessableEntity:
+		return riskStatus(err)
+	}
+
+	var st interface{ GRPCStatus() *status.Status }
+	if code == codes.Internal && errors.As(err, &st) {
+		return err
+	}
+
+	return status.Error(code, err.Error())
+}
+
+// riskStatus отказ риск проверки, причина передаётся в ErrorInfo.Reason
+func riskStatus(err error) error {
+	st := status.New(codes.FailedPrecondition, err.Error())
+
+	var riskErr *RiskError
+	if !errors.As(err, &riskErr) {
+		return st.Err()
+	}
+
+	withReason, dErr := st.WithDetails(&errdetails.ErrorInfo{Reason: string(riskErr.Reason), Domain: "broker"})
+	if dErr != nil {
+		return st.Err()
+	}
+
+	return withReason.Err()
+}
+
+func orderToProto(o models.Order) *api.Order {
+	return &api.Order{
+		ID:            o.ID,
+		ClientOrderID: o.ClientOrderID,
+		DealID:        o.DealID,
+		Ticker:        o.Ticker,
+		Volume:        o.Volume,
+		Filled:        o.Filled,
+		Price:         o.Price,
+		IsBuy:         o.IsBuy,
+		Status:        string(o.Status),
+	}
+}
+
+func candleToProto(c models.Candle) *api.Candle {
+	return &api.Candle{
+		ID:       c.ID,
+		Time:     c.Time,
+		Interval: c.Interval,
+		Open:     c.Open,
+		High:     c.High,
+		Low:      c.Low,
+		Close:    c.Close,
+		Volume:   c.Volume,
+		Ticker:   c.Ticker,
+	}
+}
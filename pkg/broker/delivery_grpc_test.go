@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+	api "trading/pkg/gen/broker"
+	"trading/pkg/models"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCHistorySeconds(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	s := NewGRPCServer(NewBroker(1, repo, nil, RiskLimits{}, models.PnLAverage))
+
+	now := time.Now().Unix()
+	for _, at := range []int64{now - 3000, now - 100} {
+		if err := repo.SaveCandle(ctx, models.Candle{Time: at, Ticker: "T", Close: 100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		seconds int64
+		want    int
+	}{
+		{0, 1}, // по умолчанию DefaultHistory
+		{3600, 2},
+	}
+	for _, tt := range tests {
+		resp, err := s.History(ctx, &api.HistoryRequest{Ticker: "T", Seconds: tt.seconds})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Prices) != tt.want {
+			t.Errorf("History(%d seconds) = %d candles, want %d", tt.seconds, len(resp.Prices), tt.want)
+		}
+	}
+
+	if _, err := s.History(ctx, &api.HistoryRequest{Ticker: "T", Seconds: -1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("History(-1 seconds) = %v, want InvalidArgument", err)
+	}
+}
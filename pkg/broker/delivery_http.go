@@ -0,0 +1,345 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"trading/pkg/metrics"
+	"trading/pkg/models"
+	"trading/pkg/tracing"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoClientID = errors.New("client id is required")
+var ErrBadRequest = errors.New("bad request")
+
+// ClientIDHeader заголовок, в котором клиент передаёт свой ID
+const ClientIDHeader = "X-Client-ID"
+
+// bearerPrefix токен входа передаётся в заголовке Authorization: Bearer <token>
+const bearerPrefix = "Bearer "
+
+// HTTPHandler http апи брокера
+type HTTPHandler struct {
+	broker *Broker
+	conn   *ExchangeConn
+	mux    *http.ServeMux
+}
+
+func NewHTTPHandler(b *Broker, conn *ExchangeConn) *HTTPHandler {
+	h := &HTTPHandler{
+		broker: b,
+		conn:   conn,
+		mux:    http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("/health", h.health)
+	h.mux.Handle("/metrics", metrics.Handler())
+	h.handle("/api/v1/login", h.login)
+	h.handle("/api/v1/refresh", h.refresh)
+	h.handle("/api/v1/status", h.withClient(http.MethodGet, h.status))
+	h.handle("/api/v1/deal", h.withClient(http.MethodPost, h.deal))
+	h.handle("/api/v1/cancel", h.withClient(http.MethodPost, h.cancel))
+	h.handle("/api/v1/order", h.withClient(http.MethodGet, h.order))
+	h.handle("/api/v1/history", h.history)
+	h.handle("/api/v1/instruments", h.instruments)
+
+	return h
+}
+
+// handle метод апи, время ответа попадает в http_request_duration_seconds,
+// у запроса есть ID из заголовка X-Correlation-ID или новый
+func (h *HTTPHandler) handle(pattern string, handler http.HandlerFunc) {
+	h.mux.Handle(pattern, tracing.Middleware(metrics.InstrumentHTTP(pattern, handler)))
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+type healthResponse struct {
+	Status   string                  `json:"status"`
+	Exchange map[string]StreamHealth `json:"exchange"`
+	Alerts   []Alert                 `json:"alerts,omitempty"`
+}
+
+// health состояние подключения к бирже, 503 если хотя бы один поток не подключен
+func (h *HTTPHandler) health(w http.ResponseWriter, r *http.Request) {
+	streams, ok := h.conn.Health()
+
+	resp := healthResponse{Status: "ok", Exchange: streams, Alerts: h.broker.Alerts()}
+	code := http.StatusOK
+	if !ok {
+		resp.Status = "degraded"
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, resp)
+}
+
+type clientHandler func(w http.ResponseWriter, r *http.Request, clientID int64)
+
+// withClient проверяет метод и узнаёт клиента по токену или по заголовку X-Client-ID
+func (h *HTTPHandler) withClient(method string, next clientHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeJSON(w, http.StatusMethodNotAllowed, models.ErrorResponse{Error: "method not allowed"})
+
+			return
+		}
+
+		headerID, _ := strconv.ParseInt(r.Header.Get(ClientIDHeader), 10, 64)
+
+		clientID, err := h.broker.Authenticate(r.Context(), bearerToken(r), headerID)
+		if err != nil {
+			writeError(w, r, err)
+
+			return
+		}
+
+		next(w, r, clientID)
+	}
+}
+
+func (h *HTTPHandler) login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, models.ErrorResponse{Error: "method not allowed"})
+
+		return
+	}
+
+	var req models.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", ErrBadRequest, err))
+
+		return
+	}
+
+	client, token, err := h.broker.Login(r.Context(), req.Login, req.Password)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, loginResponse(client, token))
+}
+
+// refresh новый токен вместо токена из заголовка Authorization, старый перестаёт действовать
+func (h *HTTPHandler) refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, models.ErrorResponse{Error: "method not allowed"})
+
+		return
+	}
+
+	client, token, err := h.broker.RefreshToken(r.Context(), bearerToken(r))
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, loginResponse(client, token))
+}
+
+func loginResponse(client models.Client, token Token) models.LoginResponse {
+	var resp models.LoginResponse
+	resp.Body.ClientID = client.ID
+	resp.Body.Token = token.Token
+	resp.Body.ExpiresAt = token.ExpiresAt.Unix()
+
+	return resp
+}
+
+// bearerToken токен из заголовка Authorization: Bearer <token>, пусто если его нет
+func bearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, bearerPrefix) {
+		return strings.TrimPrefix(auth, bearerPrefix)
+	}
+
+	return ""
+}
+
+func (h *HTTPHandler) status(w http.ResponseWriter, r *http.Request, clientID int64) {
+	status, err := h.broker.Status(r.Context(), clientID, r.URL.Query().Get("method"))
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (h *HTTPHandler) deal(w http.ResponseWriter, r *http.Request, clientID int64) {
+	var req models.DealRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", ErrBadRequest, err))
+
+		return
+	}
+
+	order := models.Order{
+		ClientID:      clientID,
+		ClientOrderID: req.Deal.ClientOrderID,
+		Ticker:        req.Deal.Ticker,
+		Volume:        req.Deal.Volume,
+		Price:         req.Deal.Price,
+	}
+
+	switch req.Deal.Type {
+	case models.DealBuy:
+		order.IsBuy = true
+	case models.DealSell:
+	default:
+		writeError(w, r, fmt.Errorf("%w: type must be %s or %s", ErrWrongOrder, models.DealBuy, models.DealSell))
+
+		return
+	}
+
+	order, err := h.broker.Deal(r.Context(), order)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.DealResponse{Body: order})
+}
+
+func (h *HTTPHandler) cancel(w http.ResponseWriter, r *http.Request, clientID int64) {
+	var req models.CancelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", ErrBadRequest, err))
+
+		return
+	}
+
+	order, err := h.broker.Cancel(r.Context(), clientID, req.ID, req.ClientOrderID)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	var resp models.CancelResponse
+	resp.Body.ID = order.ID
+	resp.Body.Status = order.Status
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *HTTPHandler) order(w http.ResponseWriter, r *http.Request, clientID int64) {
+	var orderID int64
+	if id := r.URL.Query().Get("id"); id != "" {
+		var err error
+		if orderID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			writeError(w, r, fmt.Errorf("%w: id: %v", ErrBadRequest, err))
+
+			return
+		}
+	}
+
+	order, err := h.broker.Order(r.Context(), clientID, orderID, r.URL.Query().Get("client_order_id"))
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.OrderResponse{Body: order})
+}
+
+func (h *HTTPHandler) history(w http.ResponseWriter, r *http.Request) {
+	ticker := r.URL.Query().Get("ticker")
+	if ticker == "" {
+		writeError(w, r, fmt.Errorf("%w: ticker is required", ErrBadRequest))
+
+		return
+	}
+
+	seconds := int64(DefaultHistory)
+	if v := r.URL.Query().Get("seconds"); v != "" {
+		var err error
+		if seconds, err = strconv.ParseInt(v, 10, 64); err != nil || seconds <= 0 {
+			writeError(w, r, fmt.Errorf("%w: seconds must be a positive number, got %q", ErrBadRequest, v))
+
+			return
+		}
+	}
+
+	prices, err := h.broker.History(r.Context(), ticker, time.Now().Unix(), seconds)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	var resp models.HistoryResponse
+	resp.Body.Ticker = ticker
+	resp.Body.Prices = prices
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *HTTPHandler) instruments(w http.ResponseWriter, r *http.Request) {
+	instruments, err := h.broker.Instruments(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.InstrumentsResponse{Body: instruments})
+}
+
+// errorCode http код для ошибок бизнес логики, остальное - 500
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrBadRequest), errors.Is(err, ErrWrongOrder), errors.Is(err, ErrUnknownPnLMethod):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNoClientID), errors.Is(err, ErrWrongCredentials), errors.Is(err, ErrWrongToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrWrongClient):
+		return http.StatusForbidden
+	case errors.Is(err, ErrClientNotFound), errors.Is(err, ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrOrderNotOpen), errors.Is(err, ErrDuplicateOrder), errors.Is(err, ErrCancelRejected):
+		return http.StatusConflict
+	case errors.Is(err, ErrRiskRejected):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code := errorCode(err)
+	if code == http.StatusInternalServerError {
+		log.Ctx(r.Context()).Err(err).Msg("Failed to handle request")
+	}
+
+	resp := models.ErrorResponse{Error: err.Error()}
+
+	var riskErr *RiskError
+	if errors.As(err, &riskErr) {
+		resp.Reason = string(riskErr.Reason)
+	}
+
+	writeJSON(w, code, resp)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Err(err).Msg("Failed to write response")
+	}
+}
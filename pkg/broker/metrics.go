@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"context"
+	"time"
+	"trading/pkg/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+var reconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "broker_exchange_reconnects_total",
+	Help: "Переподключения потоков statistic и results от биржи.",
+}, []string{"stream"})
+
+// openOrdersTimeout сколько ждать базу при сборе метрик
+const openOrdersTimeout = 2 * time.Second
+
+var openOrdersDesc = prometheus.NewDesc(
+	"broker_open_orders",
+	"Открытые заявки клиентов по статусам new, placed и partial.",
+	[]string{"status"}, nil,
+)
+
+// openOrdersCollector считает открытые заявки в базе при каждом сборе метрик,
+// так число не расходится с базой после перезапуска или сверки с биржей
+type openOrdersCollector struct {
+	repo IRepository
+}
+
+// NewOpenOrdersCollector метрика broker_open_orders, регистрируется в main
+func NewOpenOrdersCollector(repo IRepository) prometheus.Collector {
+	return openOrdersCollector{repo: repo}
+}
+
+func (c openOrdersCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- openOrdersDesc
+}
+
+func (c openOrdersCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), openOrdersTimeout)
+	defer cancel()
+
+	orders, err := c.repo.AllOpenOrders(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to count open orders for metrics")
+		ch <- prometheus.NewInvalidMetric(openOrdersDesc, err)
+
+		return
+	}
+
+	counts := map[models.OrderStatus]int{
+		models.OrderNew:     0,
+		models.OrderPlaced:  0,
+		models.OrderPartial: 0,
+	}
+	for _, o := range orders {
+		counts[o.Status]++
+	}
+
+	for status, n := range counts {
+		ch <- prometheus.MustNewConstMetric(openOrdersDesc, prometheus.GaugeValue, float64(n), string(status))
+	}
+}
@@ -0,0 +1,119 @@
+package broker
+
+// migrations схема из README, каждая миграция применяется один раз,
+// номер миграции - индекс в слайсе + 1
+var migrations = []string{
+	`CREATE TABLE clients (
+		id       INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		login_id INTEGER NOT NULL,
+		balance  INTEGER NOT NULL
+	);
+
+	CREATE TABLE positions (
+		id      INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		ticker  VARCHAR(300) NOT NULL,
+		volume  INTEGER NOT NULL
+	);
+	CREATE UNIQUE INDEX positions_user_ticker ON positions(user_id, ticker);
+
+	CREATE TABLE orders_history (
+		id      INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		time    INTEGER NOT NULL,
+		user_id INTEGER,
+		ticker  VARCHAR(300) NOT NULL,
+		volume  INTEGER NOT NULL,
+		price   INTEGER NOT NULL,
+		is_buy  INTEGER NOT NULL
+	);
+	CREATE INDEX orders_history_user_id ON orders_history(user_id);
+
+	CREATE TABLE request (
+		id      INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		ticker  VARCHAR(300) NOT NULL,
+		volume  INTEGER NOT NULL,
+		price   INTEGER NOT NULL,
+		is_buy  INTEGER NOT NULL -- 1 - покупаем, 0 - продаем
+	);
+	CREATE INDEX request_user_id ON request(user_id);
+
+	CREATE TABLE stat (
+		id       INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		time     INTEGER,
+		interval INTEGER,
+		open     INTEGER,
+		high     INTEGER,
+		low      INTEGER,
+		close    INTEGER,
+		volume   INTEGER,
+		ticker   VARCHAR(300)
+	);
+	CREATE INDEX stat_ticker_time ON stat(ticker, time);`,
+
+	// связь заявки брокера с заявкой на бирже и её состояние
+	`ALTER TABLE request ADD COLUMN deal_id INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE request ADD COLUMN filled INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE request ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'new';
+	CREATE INDEX request_deal_id ON request(deal_id);
+
+	ALTER TABLE orders_history ADD COLUMN deal_id INTEGER NOT NULL DEFAULT 0;`,
+
+	// здесь были тестовые клиенты из README, теперь их создаёт SeedDevClients
+	// только по dev_seed. Номер миграции остаётся занятым
+	`SELECT 1;`,
+
+	// номер исполнения на бирже, по нему отбрасываются повторно присланные сделки
+	`ALTER TABLE orders_history ADD COLUMN fill_id INTEGER NOT NULL DEFAULT 0;
+	CREATE UNIQUE INDEX orders_history_fill_id ON orders_history(fill_id) WHERE fill_id > 0;`,
+
+	// ID заявки, который выдал сам клиент, по нему отбрасываются повторные запросы
+	`ALTER TABLE request ADD COLUMN client_order_id VARCHAR(64) NOT NULL DEFAULT '';
+	CREATE UNIQUE INDEX request_client_order_id ON request(user_id, client_order_id) WHERE client_order_id != '';`,
+
+	// логин и пароль клиента, токены входа хранятся как sha256
+	`ALTER TABLE clients ADD COLUMN login VARCHAR(300) NOT NULL DEFAULT '';
+	ALTER TABLE clients ADD COLUMN password_hash VARCHAR(300) NOT NULL DEFAULT '';
+	CREATE UNIQUE INDEX clients_login ON clients(login) WHERE login != '';
+
+	CREATE TABLE tokens (
+		token   VARCHAR(64) NOT NULL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES clients(id),
+		created INTEGER NOT NULL
+	);`,
+
+	// события заявок по порядку, по номеру последнего полученного события
+	// подписчик досылает то, что пропустил
+	`CREATE TABLE order_events (
+		seq            INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		user_id        INTEGER NOT NULL,
+		order_id       INTEGER NOT NULL,
+		status         VARCHAR(20) NOT NULL,
+		filled         INTEGER NOT NULL,
+		fill_id        INTEGER NOT NULL DEFAULT 0,
+		fill_volume    INTEGER NOT NULL DEFAULT 0,
+		fill_price     INTEGER NOT NULL DEFAULT 0,
+		reason         VARCHAR(300) NOT NULL DEFAULT '',
+		correlation_id VARCHAR(64) NOT NULL DEFAULT '',
+		time           INTEGER NOT NULL, -- время исполнения или изменения заявки
+		created        INTEGER NOT NULL
+	);
+	CREATE INDEX order_events_user_seq ON order_events(user_id, seq);
+	CREATE INDEX order_events_created ON order_events(created);`,
+
+	// исполнения, которые пришли раньше, чем брокер сохранил deal ID заявки:
+	// применяются, когда заявка выставлена, поток Results продолжается с первого из них
+	`CREATE TABLE pending_fills (
+		fill_id        INTEGER NOT NULL PRIMARY KEY,
+		deal_id        INTEGER NOT NULL,
+		user_id        INTEGER NOT NULL,
+		ticker         VARCHAR(300) NOT NULL,
+		volume         INTEGER NOT NULL,
+		partial        INTEGER NOT NULL,
+		price          INTEGER NOT NULL,
+		is_buy         INTEGER NOT NULL,
+		time           INTEGER NOT NULL,
+		correlation_id VARCHAR(64) NOT NULL DEFAULT ''
+	);
+	CREATE INDEX pending_fills_deal ON pending_fills(deal_id);`,
+}
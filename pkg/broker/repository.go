@@ -0,0 +1,72 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"trading/pkg/models"
+)
+
+var ErrClientNotFound = errors.New("client not found")
+var ErrOrderNotFound = errors.New("order not found")
+var ErrDuplicateFill = errors.New("fill already applied")
+var ErrDuplicateOrder = errors.New("client order id already used")
+
+// PendingFill отложенное исполнение и ID запроса, который выставил заявку
+type PendingFill struct {
+	models.Fill
+	CorrelationID string
+}
+
+// IRepository хранилище состояния брокера: клиенты, позиции, заявки, сделки и цены
+type IRepository interface {
+	Client(ctx context.Context, clientID int64) (models.Client, error)
+	ClientByLogin(ctx context.Context, login string) (models.Client, error)
+	// ClientByToken клиент по sha256 токена входа, выданного не раньше since
+	ClientByToken(ctx context.Context, tokenHash string, since int64) (models.Client, error)
+	SaveToken(ctx context.Context, clientID int64, tokenHash string, created int64) error
+	// DeleteToken отзывает токен, DeleteTokens - все токены, выданные раньше before
+	DeleteToken(ctx context.Context, tokenHash string) error
+	DeleteTokens(ctx context.Context, before int64) error
+	Positions(ctx context.Context, clientID int64) ([]models.Position, error)
+
+	// CreateOrder сохраняет заявку, ErrDuplicateOrder если у клиента уже есть заявка с тем же ClientOrderID
+	CreateOrder(ctx context.Context, order models.Order) (int64, error)
+	Order(ctx context.Context, orderID int64) (models.Order, error)
+	OrderByClientOrderID(ctx context.Context, clientID int64, clientOrderID string) (models.Order, error)
+	OrderByDealID(ctx context.Context, dealID int64) (models.Order, error)
+	OpenOrders(ctx context.Context, clientID int64) ([]models.Order, error)
+	// AllOpenOrders открытые заявки всех клиентов, для сверки с биржей
+	AllOpenOrders(ctx context.Context) ([]models.Order, error)
+	SetOrderPlaced(ctx context.Context, orderID, dealID int64) error
+	SetOrderStatus(ctx context.Context, orderID int64, status models.OrderStatus) error
+
+	// ApplyFill в одной транзакции пишет сделку в историю,
+	// меняет позицию и баланс клиента и исполненный объём заявки.
+	// Повторное исполнение с тем же FillID возвращает ErrDuplicateFill
+	ApplyFill(ctx context.Context, fill models.Fill) (models.Order, error)
+	// LastFillID номер исполнения биржи, после которого продолжается поток Results:
+	// последний применённый или, если есть отложенные, номер перед первым из них
+	LastFillID(ctx context.Context) (int64, error)
+	// SavePendingFill откладывает исполнение, заявку которого брокер ещё не знает по deal ID.
+	// ApplyFill удаляет его из отложенных
+	SavePendingFill(ctx context.Context, fill PendingFill) error
+	PendingFills(ctx context.Context, dealID int64) ([]PendingFill, error)
+	DeletePendingFill(ctx context.Context, fillID int64) error
+	Fills(ctx context.Context, clientID int64) ([]models.Fill, error)
+
+	// SaveOrderEvent сохраняет событие заявки и возвращает его номер
+	SaveOrderEvent(ctx context.Context, event OrderEvent) (int64, error)
+	// OrderEvents события заявок клиента с номером больше after по порядку
+	OrderEvents(ctx context.Context, clientID, after int64) ([]OrderEvent, error)
+	// LastOrderSeq номер последнего события заявок клиента, 0 если событий не было
+	LastOrderSeq(ctx context.Context, clientID int64) (int64, error)
+	DeleteOrderEvents(ctx context.Context, before int64) error
+
+	SaveCandle(ctx context.Context, candle models.Candle) error
+	Candles(ctx context.Context, ticker string, since int64) ([]models.Candle, error)
+	// Tickers инструменты, по которым есть история цен
+	Tickers(ctx context.Context) ([]string, error)
+	DeleteCandles(ctx context.Context, before int64) error
+
+	Close() error
+}
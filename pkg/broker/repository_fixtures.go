@@ -0,0 +1,28 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+)
+
+// SeedDevClients создаёт тестовых клиентов из README: Vasily/123456, Ivan/qwerty и
+// Olga/1qaz2wsx по 2000 рублей. Только для разработки и тестов, в рабочей базе
+// это известные всем логины с деньгами. Уже созданных клиентов не трогает
+func (r *SQLiteRepository) SeedDevClients(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO clients (id, login_id, login, password_hash, balance) VALUES
+		(1, 1, 'Vasily',
+			'pbkdf2-sha256$100000$ab20b701bd909ced2e8b23a22cc181b1$46e7c03dde8b2c531209e45b4fd55116d8b1c0a890d0025ae1dee00226278d06',
+			200000),
+		(2, 2, 'Ivan',
+			'pbkdf2-sha256$100000$59ea5d71b5cdfcd7ee5ecd36e8e8c54b$7c06c194b85b01ed3eabb2c83d3fe03b3c015f4746e4eec23e4648500597d08a',
+			200000),
+		(3, 3, 'Olga',
+			'pbkdf2-sha256$100000$138805042a25b251d860838f5ec1c7f4$7dc9221083f19cc26c71287d747c1a496478dcd532936afc2fb9a5cf2dc05f96',
+			200000)
+		ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("cant seed dev clients: %w", err)
+	}
+
+	return nil
+}
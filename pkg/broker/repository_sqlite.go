@@ -0,0 +1,547 @@
+package broker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"trading/pkg/models"
+	"trading/pkg/price"
+	"trading/pkg/sqlite"
+)
+
+// SQLiteRepository хранилище брокера во встроенной sqlite базе
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(ctx context.Context, path string) (*SQLiteRepository, error) {
+	db, err := sqlite.Open(ctx, path, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLiteRepository{db: db}, nil
+}
+
+func (r *SQLiteRepository) Close() error {
+	return r.db.Close()
+}
+
+const clientColumns = `id, login_id, login, password_hash, balance`
+
+func (r *SQLiteRepository) queryClient(ctx context.Context, where string, args ...interface{}) (models.Client, error) {
+	var c models.Client
+
+	arg := args[0]
+	err := r.db.QueryRowContext(ctx,
+		`SELECT `+clientColumns+` FROM clients WHERE `+where, args...,
+	).Scan(&c.ID, &c.LoginID, &c.Login, &c.PasswordHash, &c.Balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Client{}, fmt.Errorf("%w: %v", ErrClientNotFound, arg)
+	}
+	if err != nil {
+		return models.Client{}, fmt.Errorf("cant get client %v: %w", arg, err)
+	}
+
+	return c, nil
+}
+
+func (r *SQLiteRepository) Client(ctx context.Context, clientID int64) (models.Client, error) {
+	return r.queryClient(ctx, `id = ?`, clientID)
+}
+
+func (r *SQLiteRepository) ClientByLogin(ctx context.Context, login string) (models.Client, error) {
+	return r.queryClient(ctx, `login = ?`, login)
+}
+
+func (r *SQLiteRepository) ClientByToken(ctx context.Context, tokenHash string, since int64) (models.Client, error) {
+	return r.queryClient(ctx, `id = (SELECT user_id FROM tokens WHERE token = ? AND created >= ?)`, tokenHash, since)
+}
+
+func (r *SQLiteRepository) SaveToken(ctx context.Context, clientID int64, tokenHash string, created int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO tokens (token, user_id, created) VALUES (?, ?, ?)`, tokenHash, clientID, created,
+	)
+	if err != nil {
+		return fmt.Errorf("cant save token of client %d: %w", clientID, err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) DeleteToken(ctx context.Context, tokenHash string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM tokens WHERE token = ?`, tokenHash); err != nil {
+		return fmt.Errorf("cant delete token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) DeleteTokens(ctx context.Context, before int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM tokens WHERE created < ?`, before); err != nil {
+		return fmt.Errorf("cant delete expired tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) Positions(ctx context.Context, clientID int64) ([]models.Position, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT ticker, volume FROM positions WHERE user_id = ? AND volume != 0 ORDER BY ticker`, clientID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cant get positions: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []models.Position
+	for rows.Next() {
+		var p models.Position
+		if err = rows.Scan(&p.Ticker, &p.Volume); err != nil {
+			return nil, fmt.Errorf("cant scan position: %w", err)
+		}
+		positions = append(positions, p)
+	}
+
+	return positions, rows.Err()
+}
+
+const orderColumns = `id, client_order_id, deal_id, user_id, ticker, volume, filled, price, is_buy, status`
+
+func scanOrder(row interface{ Scan(...interface{}) error }) (models.Order, error) {
+	var o models.Order
+	err := row.Scan(
+		&o.ID, &o.ClientOrderID, &o.DealID, &o.ClientID, &o.Ticker, &o.Volume, &o.Filled, &o.Price, &o.IsBuy, &o.Status,
+	)
+
+	return o, err
+}
+
+func (r *SQLiteRepository) CreateOrder(ctx context.Context, order models.Order) (int64, error) {
+	if order.Status == "" {
+		order.Status = models.OrderNew
+	}
+
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO request (user_id, client_order_id, ticker, volume, price, is_buy, status) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		order.ClientID, order.ClientOrderID, order.Ticker, order.Volume, order.Price, order.IsBuy, order.Status,
+	)
+
+	if sqlite.IsUniqueViolation(err) {
+		return 0, fmt.Errorf("%w: %s", ErrDuplicateOrder, order.ClientOrderID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cant create order: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("cant get order id: %w", err)
+	}
+
+	return id, nil
+}
+
+func (r *SQLiteRepository) Order(ctx context.Context, orderID int64) (models.Order, error) {
+	o, err := scanOrder(r.db.QueryRowContext(ctx,
+		`SELECT `+orderColumns+` FROM request WHERE id = ?`, orderID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Order{}, fmt.Errorf("%w: %d", ErrOrderNotFound, orderID)
+	}
+	if err != nil {
+		return models.Order{}, fmt.Errorf("cant get order %d: %w", orderID, err)
+	}
+
+	return o, nil
+}
+
+func (r *SQLiteRepository) OrderByClientOrderID(
+	ctx context.Context, clientID int64, clientOrderID string,
+) (models.Order, error) {
+	o, err := scanOrder(r.db.QueryRowContext(ctx,
+		`SELECT `+orderColumns+` FROM request WHERE user_id = ? AND client_order_id = ?`, clientID, clientOrderID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Order{}, fmt.Errorf("%w: client order %s", ErrOrderNotFound, clientOrderID)
+	}
+	if err != nil {
+		return models.Order{}, fmt.Errorf("cant get order by client order %s: %w", clientOrderID, err)
+	}
+
+	return o, nil
+}
+
+func (r *SQLiteRepository) OrderByDealID(ctx context.Context, dealID int64) (models.Order, error) {
+	o, err := scanOrder(r.db.QueryRowContext(ctx,
+		`SELECT `+orderColumns+` FROM request WHERE deal_id = ?`, dealID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Order{}, fmt.Errorf("%w: deal %d", ErrOrderNotFound, dealID)
+	}
+	if err != nil {
+		return models.Order{}, fmt.Errorf("cant get order by deal %d: %w", dealID, err)
+	}
+
+	return o, nil
+}
+
+func (r *SQLiteRepository) OpenOrders(ctx context.Context, clientID int64) ([]models.Order, error) {
+	return r.queryOrders(ctx,
+		`SELECT `+orderColumns+` FROM request WHERE user_id = ? AND status IN (?, ?, ?) ORDER BY id`,
+		clientID, models.OrderNew, models.OrderPlaced, models.OrderPartial,
+	)
+}
+
+func (r *SQLiteRepository) AllOpenOrders(ctx context.Context) ([]models.Order, error) {
+	return r.queryOrders(ctx,
+		`SELECT `+orderColumns+` FROM request WHERE status IN (?, ?, ?) ORDER BY id`,
+		models.OrderNew, models.OrderPlaced, models.OrderPartial,
+	)
+}
+
+func (r *SQLiteRepository) queryOrders(ctx context.Context, query string, args ...interface{}) ([]models.Order, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cant get orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cant scan order: %w", err)
+		}
+		orders = append(orders, o)
+	}
+
+	return orders, rows.Err()
+}
+
+func (r *SQLiteRepository) SetOrderPlaced(ctx context.Context, orderID, dealID int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE request SET deal_id = ?, status = ? WHERE id = ?`, dealID, models.OrderPlaced, orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("cant set order %d placed: %w", orderID, err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) SetOrderStatus(ctx context.Context, orderID int64, status models.OrderStatus) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE request SET status = ? WHERE id = ?`, status, orderID)
+	if err != nil {
+		return fmt.Errorf("cant set order %d status: %w", orderID, err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) ApplyFill(ctx context.Context, fill models.Fill) (models.Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("cant begin fill tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	order, err := scanOrder(tx.QueryRowContext(ctx,
+		`SELECT `+orderColumns+` FROM request WHERE deal_id = ?`, fill.DealID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Order{}, fmt.Errorf("%w: deal %d", ErrOrderNotFound, fill.DealID)
+	}
+	if err != nil {
+		return models.Order{}, fmt.Errorf("cant get order by deal %d: %w", fill.DealID, err)
+	}
+
+	if fill.FillID > 0 {
+		var applied bool
+		err = tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM orders_history WHERE fill_id = ?)`, fill.FillID,
+		).Scan(&applied)
+		if err != nil {
+			return models.Order{}, fmt.Errorf("cant check fill %d: %w", fill.FillID, err)
+		}
+		if applied {
+			return order, fmt.Errorf("%w: %d", ErrDuplicateFill, fill.FillID)
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`INSERT INTO orders_history (time, user_id, ticker, volume, price, is_buy, deal_id, fill_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		fill.Time, order.ClientID, order.Ticker, fill.Volume, fill.Price, order.IsBuy, fill.DealID, fill.FillID,
+	); err != nil {
+		return models.Order{}, fmt.Errorf("cant save fill: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM pending_fills WHERE fill_id = ?`, fill.FillID); err != nil {
+		return models.Order{}, fmt.Errorf("cant delete pending fill: %w", err)
+	}
+
+	// покупка увеличивает позицию и уменьшает баланс на стоимость в копейках,
+	// продажа наоборот
+	volume := int64(fill.Volume)
+	amount := price.Lookup(order.Ticker).Notional(fill.Price, volume)
+	if !order.IsBuy {
+		volume, amount = -volume, -amount
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`INSERT INTO positions (user_id, ticker, volume) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, ticker) DO UPDATE SET volume = volume + excluded.volume`,
+		order.ClientID, order.Ticker, volume,
+	); err != nil {
+		return models.Order{}, fmt.Errorf("cant update position: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`UPDATE clients SET balance = balance - ? WHERE id = ?`, amount, order.ClientID,
+	); err != nil {
+		return models.Order{}, fmt.Errorf("cant update balance: %w", err)
+	}
+
+	order.Filled += fill.Volume
+	order.Status = models.OrderPartial
+	if order.Filled >= order.Volume {
+		order.Status = models.OrderFilled
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`UPDATE request SET filled = ?, status = ? WHERE id = ?`, order.Filled, order.Status, order.ID,
+	); err != nil {
+		return models.Order{}, fmt.Errorf("cant update order: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Order{}, fmt.Errorf("cant commit fill: %w", err)
+	}
+
+	return order, nil
+}
+
+func (r *SQLiteRepository) LastFillID(ctx context.Context) (int64, error) {
+	var id int64
+	if err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE((SELECT MIN(fill_id) - 1 FROM pending_fills), (SELECT MAX(fill_id) FROM orders_history), 0)`,
+	).Scan(&id); err != nil {
+		return 0, fmt.Errorf("cant get last fill id: %w", err)
+	}
+
+	return id, nil
+}
+
+func (r *SQLiteRepository) SavePendingFill(ctx context.Context, f PendingFill) error {
+	if _, err := r.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO pending_fills
+		(fill_id, deal_id, user_id, ticker, volume, partial, price, is_buy, time, correlation_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.FillID, f.DealID, f.ClientID, f.Ticker, f.Volume, f.Partial, f.Price, f.IsBuy, f.Time, f.CorrelationID,
+	); err != nil {
+		return fmt.Errorf("cant save pending fill %d: %w", f.FillID, err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) PendingFills(ctx context.Context, dealID int64) ([]PendingFill, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT fill_id, deal_id, user_id, ticker, volume, partial, price, is_buy, time, correlation_id
+		FROM pending_fills WHERE deal_id = ? ORDER BY fill_id`, dealID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cant get pending fills: %w", err)
+	}
+	defer rows.Close()
+
+	var fills []PendingFill
+	for rows.Next() {
+		var f PendingFill
+		if err = rows.Scan(
+			&f.FillID, &f.DealID, &f.ClientID, &f.Ticker, &f.Volume, &f.Partial, &f.Price, &f.IsBuy, &f.Time, &f.CorrelationID,
+		); err != nil {
+			return nil, fmt.Errorf("cant scan pending fill: %w", err)
+		}
+		fills = append(fills, f)
+	}
+
+	return fills, rows.Err()
+}
+
+func (r *SQLiteRepository) DeletePendingFill(ctx context.Context, fillID int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM pending_fills WHERE fill_id = ?`, fillID); err != nil {
+		return fmt.Errorf("cant delete pending fill %d: %w", fillID, err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) Fills(ctx context.Context, clientID int64) ([]models.Fill, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT fill_id, deal_id, user_id, ticker, volume, time, price, is_buy FROM orders_history
+		WHERE user_id = ? ORDER BY id`,
+		clientID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cant get fills: %w", err)
+	}
+	defer rows.Close()
+
+	var fills []models.Fill
+	for rows.Next() {
+		var f models.Fill
+		if err = rows.Scan(&f.FillID, &f.DealID, &f.ClientID, &f.Ticker, &f.Volume, &f.Time, &f.Price, &f.IsBuy); err != nil {
+			return nil, fmt.Errorf("cant scan fill: %w", err)
+		}
+		fills = append(fills, f)
+	}
+
+	return fills, rows.Err()
+}
+
+func (r *SQLiteRepository) SaveOrderEvent(ctx context.Context, e OrderEvent) (int64, error) {
+	var fill models.Fill
+	if e.Fill != nil {
+		fill = *e.Fill
+	}
+
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO order_events
+		(user_id, order_id, status, filled, fill_id, fill_volume, fill_price, reason, correlation_id, time, created)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Order.ClientID, e.Order.ID, e.Order.Status, e.Order.Filled,
+		fill.FillID, fill.Volume, fill.Price, e.Reason, e.CorrelationID, e.Time, time.Now().Unix(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("cant save event of order %d: %w", e.Order.ID, err)
+	}
+
+	seq, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("cant get order event seq: %w", err)
+	}
+
+	return seq, nil
+}
+
+func (r *SQLiteRepository) OrderEvents(ctx context.Context, clientID, after int64) ([]OrderEvent, error) {
+	// заявка берётся из request, а состояние на момент события - из order_events
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT e.seq, e.status, e.filled, e.fill_id, e.fill_volume, e.fill_price, e.reason, e.correlation_id, e.time,
+		o.id, o.client_order_id, o.deal_id, o.user_id, o.ticker, o.volume, o.price, o.is_buy
+		FROM order_events e JOIN request o ON o.id = e.order_id
+		WHERE e.user_id = ? AND e.seq > ? ORDER BY e.seq`,
+		clientID, after,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cant get order events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []OrderEvent
+	for rows.Next() {
+		var e OrderEvent
+		var f models.Fill
+		o := &e.Order
+		if err = rows.Scan(
+			&e.Seq, &o.Status, &o.Filled, &f.FillID, &f.Volume, &f.Price, &e.Reason, &e.CorrelationID, &e.Time,
+			&o.ID, &o.ClientOrderID, &o.DealID, &o.ClientID, &o.Ticker, &o.Volume, &o.Price, &o.IsBuy,
+		); err != nil {
+			return nil, fmt.Errorf("cant scan order event: %w", err)
+		}
+
+		if f.Volume > 0 {
+			f.DealID, f.ClientID, f.Ticker, f.IsBuy, f.Time = o.DealID, o.ClientID, o.Ticker, o.IsBuy, e.Time
+			e.Fill = &f
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *SQLiteRepository) LastOrderSeq(ctx context.Context, clientID int64) (int64, error) {
+	var seq int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(seq), 0) FROM order_events WHERE user_id = ?`, clientID,
+	).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("cant get last order event of client %d: %w", clientID, err)
+	}
+
+	return seq, nil
+}
+
+func (r *SQLiteRepository) DeleteOrderEvents(ctx context.Context, before int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM order_events WHERE created < ?`, before); err != nil {
+		return fmt.Errorf("cant delete old order events: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) SaveCandle(ctx context.Context, c models.Candle) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO stat (time, interval, open, high, low, close, volume, ticker) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.Time, c.Interval, c.Open, c.High, c.Low, c.Close, c.Volume, c.Ticker,
+	)
+	if err != nil {
+		return fmt.Errorf("cant save candle: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) Candles(ctx context.Context, ticker string, since int64) ([]models.Candle, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, time, interval, open, high, low, close, volume, ticker FROM stat
+		WHERE ticker = ? AND time >= ? ORDER BY time, id`,
+		ticker, since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cant get candles: %w", err)
+	}
+	defer rows.Close()
+
+	var candles []models.Candle
+	for rows.Next() {
+		var c models.Candle
+		if err = rows.Scan(&c.ID, &c.Time, &c.Interval, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume, &c.Ticker); err != nil {
+			return nil, fmt.Errorf("cant scan candle: %w", err)
+		}
+		candles = append(candles, c)
+	}
+
+	return candles, rows.Err()
+}
+
+func (r *SQLiteRepository) Tickers(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT DISTINCT ticker FROM stat ORDER BY ticker`)
+	if err != nil {
+		return nil, fmt.Errorf("cant get tickers: %w", err)
+	}
+	defer rows.Close()
+
+	var tickers []string
+	for rows.Next() {
+		var ticker string
+		if err = rows.Scan(&ticker); err != nil {
+			return nil, fmt.Errorf("cant scan ticker: %w", err)
+		}
+		tickers = append(tickers, ticker)
+	}
+
+	return tickers, rows.Err()
+}
+
+func (r *SQLiteRepository) DeleteCandles(ctx context.Context, before int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM stat WHERE time < ?`, before); err != nil {
+		return fmt.Errorf("cant delete candles: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package broker
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"trading/pkg/models"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var ErrWrongCredentials = errors.New("wrong login or password")
+var ErrWrongToken = errors.New("wrong or expired token")
+
+// DefaultTokenTTL сколько действует токен входа, если брокеру не задан свой срок
+const DefaultTokenTTL = 24 * time.Hour
+
+// Token токен входа и время, до которого он действует
+type Token struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// Login проверяет логин и пароль клиента и выдаёт новый токен входа
+func (b *Broker) Login(ctx context.Context, login, password string) (models.Client, Token, error) {
+	client, err := b.repo.ClientByLogin(ctx, login)
+	if errors.Is(err, ErrClientNotFound) {
+		return models.Client{}, Token{}, ErrWrongCredentials
+	}
+	if err != nil {
+		return models.Client{}, Token{}, err
+	}
+
+	if !checkPassword(client.PasswordHash, password) {
+		return models.Client{}, Token{}, ErrWrongCredentials
+	}
+
+	// заодно чистим истёкшие токены всех клиентов
+	if err = b.repo.DeleteTokens(ctx, time.Now().Add(-b.TokenTTL).Unix()); err != nil {
+		return models.Client{}, Token{}, err
+	}
+
+	token, err := b.issueToken(ctx, client.ID)
+
+	return client, token, err
+}
+
+// RefreshToken меняет действующий токен на новый, старый больше не принимается
+func (b *Broker) RefreshToken(ctx context.Context, token string) (models.Client, Token, error) {
+	client, err := b.clientByToken(ctx, token)
+	if err != nil {
+		return models.Client{}, Token{}, err
+	}
+
+	fresh, err := b.issueToken(ctx, client.ID)
+	if err != nil {
+		return models.Client{}, Token{}, err
+	}
+
+	if err = b.repo.DeleteToken(ctx, hashToken(token)); err != nil {
+		return models.Client{}, Token{}, err
+	}
+
+	return client, fresh, nil
+}
+
+// Authenticate ID клиента по токену входа. Без токена ID клиента из запроса
+// принимается, только если брокер ему доверяет, например при разработке
+func (b *Broker) Authenticate(ctx context.Context, token string, clientID int64) (int64, error) {
+	if token == "" {
+		if !b.TrustClientHeader || clientID <= 0 {
+			return 0, ErrNoClientID
+		}
+
+		return clientID, nil
+	}
+
+	client, err := b.clientByToken(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+
+	return client.ID, nil
+}
+
+// clientByToken клиент по ещё действующему токену
+func (b *Broker) clientByToken(ctx context.Context, token string) (models.Client, error) {
+	client, err := b.repo.ClientByToken(ctx, hashToken(token), time.Now().Add(-b.TokenTTL).Unix())
+	if errors.Is(err, ErrClientNotFound) {
+		return models.Client{}, ErrWrongToken
+	}
+
+	return client, err
+}
+
+func (b *Broker) issueToken(ctx context.Context, clientID int64) (Token, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return Token{}, fmt.Errorf("cant generate token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	now := time.Now()
+	if err := b.repo.SaveToken(ctx, clientID, hashToken(token), now.Unix()); err != nil {
+		return Token{}, err
+	}
+
+	return Token{Token: token, ExpiresAt: now.Add(b.TokenTTL)}, nil
+}
+
+// hashToken в базе хранится только хеш токена
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// checkPassword сверяет пароль с хешем вида pbkdf2-sha256$итерации$соль$хеш
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+
+	salt, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+
+	want, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(pbkdf2.Key([]byte(password), salt, iterations, len(want), sha256.New), want)
+}
@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"trading/pkg/models"
+)
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	b := NewBroker(1, repo, nil, RiskLimits{}, models.PnLAverage)
+
+	// без токена заголовку не верим, пока это не включено явно
+	if _, err := b.Authenticate(ctx, "", 1); !errors.Is(err, ErrNoClientID) {
+		t.Errorf("Authenticate by header = %v, want ErrNoClientID", err)
+	}
+	b.TrustClientHeader = true
+	if id, err := b.Authenticate(ctx, "", 1); err != nil || id != 1 {
+		t.Errorf("Authenticate by trusted header = %d, %v, want 1", id, err)
+	}
+	b.TrustClientHeader = false
+
+	client, token, err := b.Login(ctx, "Vasily", "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := time.Until(token.ExpiresAt); got <= 0 || got > DefaultTokenTTL {
+		t.Errorf("token expires in %v, want within %v", got, DefaultTokenTTL)
+	}
+	if id, err := b.Authenticate(ctx, token.Token, 0); err != nil || id != client.ID {
+		t.Errorf("Authenticate = %d, %v, want %d", id, err, client.ID)
+	}
+
+	// после замены старый токен не действует
+	_, fresh, err := b.RefreshToken(ctx, token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Authenticate(ctx, token.Token, 0); !errors.Is(err, ErrWrongToken) {
+		t.Errorf("Authenticate with rotated token = %v, want ErrWrongToken", err)
+	}
+	if _, _, err = b.RefreshToken(ctx, token.Token); !errors.Is(err, ErrWrongToken) {
+		t.Errorf("RefreshToken with rotated token = %v, want ErrWrongToken", err)
+	}
+	if id, err := b.Authenticate(ctx, fresh.Token, 0); err != nil || id != client.ID {
+		t.Errorf("Authenticate with new token = %d, %v, want %d", id, err, client.ID)
+	}
+
+	// токен, выданный раньше срока, не принимается
+	if err = repo.SaveToken(ctx, client.ID, hashToken("old"), time.Now().Add(-DefaultTokenTTL-time.Minute).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Authenticate(ctx, "old", 0); !errors.Is(err, ErrWrongToken) {
+		t.Errorf("Authenticate with expired token = %v, want ErrWrongToken", err)
+	}
+}
@@ -0,0 +1,439 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"trading/pkg/gen/exchange"
+	"trading/pkg/models"
+	"trading/pkg/price"
+	"trading/pkg/tracing"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrOrderNotOpen = errors.New("order is not open")
+var ErrCancelRejected = errors.New("exchange did not cancel order")
+var ErrWrongClient = errors.New("order belongs to another client")
+var ErrWrongOrder = errors.New("wrong order")
+
+// historyDepth сколько секунд истории цен хранит брокер: час, на минутном графике 60 свечей
+const historyDepth = 3600
+
+// DefaultHistory сколько секунд истории отдаётся, если клиент не указал
+const DefaultHistory = 300
+
+// Broker бизнес логика брокера
+type Broker struct {
+	ID int64
+	// TrustClientHeader без токена входа ID клиента берётся из запроса, только для разработки
+	TrustClientHeader bool
+	// TokenTTL сколько действует токен входа
+	TokenTTL time.Duration
+
+	repo     IRepository
+	exchange exchange.ExchangeClient
+	limits   RiskLimits
+	// pnlMethod способ расчёта результата, если клиент не выбрал свой
+	pnlMethod models.PnLMethod
+
+	pricesMu  sync.RWMutex
+	lastClose map[string]int64
+
+	// сверка с биржей не должна видеть заявки, которые прямо сейчас выставляются
+	placing sync.RWMutex
+	// проверка рисков и сохранение заявки атомарны, иначе две заявки потратят один баланс
+	riskMu sync.Mutex
+
+	alertsMu sync.Mutex
+	alerts   []Alert
+
+	// сохранение deal ID заявки и откладывание исполнения неизвестной заявки
+	// не должны разминуться, иначе отложенное исполнение никто не применит
+	pendingMu sync.Mutex
+
+	events *events
+	pnl    *pnlBook
+}
+
+func NewBroker(
+	id int64, repo IRepository, exch exchange.ExchangeClient, limits RiskLimits, pnlMethod models.PnLMethod,
+) *Broker {
+	return &Broker{
+		ID:        id,
+		repo:      repo,
+		exchange:  exch,
+		limits:    limits,
+		pnlMethod: pnlMethod,
+		TokenTTL:  DefaultTokenTTL,
+		lastClose: make(map[string]int64),
+		events:    newEvents(),
+		pnl:       newPnLBook(),
+	}
+}
+
+// Exchange клиент биржи, через который работает брокер
+func (b *Broker) Exchange() exchange.ExchangeClient {
+	return b.exchange
+}
+
+// Status баланс, позиции с результатом и открытые заявки клиента,
+// method - способ расчёта результата, пустой - способ брокера по умолчанию
+func (b *Broker) Status(ctx context.Context, clientID int64, method string) (models.Status, error) {
+	var status models.Status
+
+	pnlMethod, err := ParsePnLMethod(method, b.pnlMethod)
+	if err != nil {
+		return status, err
+	}
+
+	client, err := b.repo.Client(ctx, clientID)
+	if err != nil {
+		return status, err
+	}
+	status.Body.Balance = client.Balance
+
+	if status.Body.Positions, err = b.repo.Positions(ctx, clientID); err != nil {
+		return status, err
+	}
+
+	if err = b.valuate(ctx, clientID, pnlMethod, &status); err != nil {
+		return status, err
+	}
+
+	if status.Body.OpenOrders, err = b.repo.OpenOrders(ctx, clientID); err != nil {
+		return status, err
+	}
+
+	return status, nil
+}
+
+// Deal сохраняет заявку клиента и отправляет её на биржу
+func (b *Broker) Deal(ctx context.Context, order models.Order) (models.Order, error) {
+	if order.Ticker == "" || order.Volume <= 0 || order.Price <= 0 {
+		return models.Order{}, fmt.Errorf("%w: ticker, volume and price are required", ErrWrongOrder)
+	}
+
+	if err := price.Lookup(order.Ticker).Check(order.Price); err != nil {
+		return models.Order{}, fmt.Errorf("%w: %v", ErrWrongOrder, err)
+	}
+
+	if len(order.ClientOrderID) > models.MaxClientOrderIDLen {
+		return models.Order{}, fmt.Errorf("%w: client order id longer than %d", ErrWrongOrder, models.MaxClientOrderIDLen)
+	}
+
+	b.placing.RLock()
+	defer b.placing.RUnlock()
+
+	order, created, err := b.createOrder(ctx, order)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	// повтор запроса, заявка уже сохранена и отправлена на биржу
+	if !created {
+		log.Ctx(ctx).Printf("repeated deal %s of client %d, order %d", order.ClientOrderID, order.ClientID, order.ID)
+
+		return order, nil
+	}
+
+	dealID, err := b.exchange.Create(ctx, &exchange.Deal{
+		BrokerID: int32(b.ID),
+		ClientID: int32(order.ClientID),
+		Ticker:   order.Ticker,
+		Volume:   order.Volume,
+		Price:    order.Price,
+		IsBuy:    order.IsBuy,
+
+		CorrelationID: tracing.ID(ctx),
+	})
+	if err != nil {
+		// об отказе клиент узнаёт из ответа, в поток заявок он не попадает
+		if sErr := b.repo.SetOrderStatus(ctx, order.ID, models.OrderRejected); sErr != nil {
+			log.Ctx(ctx).Err(sErr).Msgf("cant reject order %d", order.ID)
+		}
+
+		return models.Order{}, fmt.Errorf("cant create deal on exchange: %w", err)
+	}
+
+	if err = b.setPlaced(ctx, order.ID, dealID.ID); err != nil {
+		return models.Order{}, err
+	}
+	log.Ctx(ctx).Info().Msgf("order %d of client %d placed on exchange as %d", order.ID, order.ClientID, dealID.ID)
+
+	return b.repo.Order(ctx, order.ID)
+}
+
+// createOrder проверяет риски и сохраняет заявку. Если у клиента уже есть заявка
+// с тем же ClientOrderID, возвращает её и created = false. Заявку, которую отклонили,
+// так и не выставив на биржу, повтор выставляет снова: created = true
+func (b *Broker) createOrder(ctx context.Context, order models.Order) (_ models.Order, created bool, err error) {
+	b.riskMu.Lock()
+	defer b.riskMu.Unlock()
+
+	if order.ClientOrderID != "" {
+		prev, err := b.repo.OrderByClientOrderID(ctx, order.ClientID, order.ClientOrderID)
+		if err == nil {
+			if prev.Ticker != order.Ticker || prev.Volume != order.Volume ||
+				prev.Price != order.Price || prev.IsBuy != order.IsBuy {
+				return models.Order{}, false, fmt.Errorf(
+					"%w: %s with other parameters", ErrDuplicateOrder, order.ClientOrderID,
+				)
+			}
+
+			if prev.Status != models.OrderRejected || prev.DealID != 0 {
+				return prev, false, nil
+			}
+
+			if err = b.checkRisk(ctx, prev); err != nil {
+				return models.Order{}, false, err
+			}
+			if err = b.repo.SetOrderStatus(ctx, prev.ID, models.OrderNew); err != nil {
+				return models.Order{}, false, err
+			}
+			prev.Status = models.OrderNew
+
+			return prev, true, nil
+		}
+
+		if !errors.Is(err, ErrOrderNotFound) {
+			return models.Order{}, false, err
+		}
+	}
+
+	if err = b.checkRisk(ctx, order); err != nil {
+		return models.Order{}, false, err
+	}
+
+	if order.ID, err = b.repo.CreateOrder(ctx, order); err != nil {
+		return models.Order{}, false, err
+	}
+
+	return order, true, nil
+}
+
+// Order заявка клиента по ID брокера или по ClientOrderID, если он задан
+func (b *Broker) Order(ctx context.Context, clientID, orderID int64, clientOrderID string) (models.Order, error) {
+	var order models.Order
+	var err error
+
+	switch {
+	case clientOrderID != "":
+		order, err = b.repo.OrderByClientOrderID(ctx, clientID, clientOrderID)
+	case orderID > 0:
+		order, err = b.repo.Order(ctx, orderID)
+	default:
+		return models.Order{}, fmt.Errorf("%w: id or client order id is required", ErrWrongOrder)
+	}
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	if order.ClientID != clientID {
+		return models.Order{}, fmt.Errorf("%w: %d", ErrWrongClient, orderID)
+	}
+
+	return order, nil
+}
+
+// Cancel снимает открытую заявку клиента с биржи, заявка ищется так же как в Order
+func (b *Broker) Cancel(ctx context.Context, clientID, orderID int64, clientOrderID string) (models.Order, error) {
+	order, err := b.Order(ctx, clientID, orderID, clientOrderID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	orderID = order.ID
+
+	if !order.Status.IsOpen() {
+		return models.Order{}, fmt.Errorf("%w: %d is %s", ErrOrderNotOpen, orderID, order.Status)
+	}
+
+	res, err := b.exchange.Cancel(ctx, &exchange.DealID{ID: order.DealID, BrokerID: b.ID})
+	if err != nil {
+		return models.Order{}, fmt.Errorf("cant cancel deal on exchange: %w", err)
+	}
+
+	// на бирже заявки уже нет: исполнение или уже применено, или ещё в пути
+	if !res.GetSuccess() {
+		if order, err = b.repo.Order(ctx, orderID); err != nil {
+			return models.Order{}, err
+		}
+		if order.Status.IsOpen() {
+			return order, fmt.Errorf("%w: %d is not on exchange, fill is pending", ErrCancelRejected, orderID)
+		}
+
+		return order, nil
+	}
+
+	if err = b.repo.SetOrderStatus(ctx, orderID, models.OrderCancelled); err != nil {
+		return models.Order{}, err
+	}
+	order.Status = models.OrderCancelled
+	b.publishOrder(ctx, OrderEvent{Order: order, Reason: "cancelled by client", CorrelationID: tracing.ID(ctx)})
+
+	return order, nil
+}
+
+// History история цен по инструменту за последние seconds секунд, но не больше historyDepth
+func (b *Broker) History(ctx context.Context, ticker string, now, seconds int64) ([]models.Candle, error) {
+	if seconds <= 0 || seconds > historyDepth {
+		seconds = historyDepth
+	}
+
+	return b.repo.Candles(ctx, ticker, now-seconds)
+}
+
+// Instruments инструменты, цены по которым биржа присылала за последние historyDepth секунд
+func (b *Broker) Instruments(ctx context.Context) ([]models.Instrument, error) {
+	tickers, err := b.repo.Tickers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	instruments := make([]models.Instrument, 0, len(tickers))
+	for _, ticker := range tickers {
+		last, err := b.LastClose(ctx, ticker)
+		if err != nil {
+			return nil, err
+		}
+		spec := price.Lookup(ticker)
+		instruments = append(instruments, models.Instrument{
+			Ticker:     ticker,
+			LastPrice:  last,
+			Scale:      spec.Scale,
+			TickSize:   spec.TickSize,
+			PointValue: spec.PointValue,
+		})
+	}
+
+	return instruments, nil
+}
+
+// HandleCandle сохраняет свечу от биржи и удаляет устаревшую историю
+func (b *Broker) HandleCandle(ctx context.Context, ohlcv *exchange.OHLCV) error {
+	candle := models.Candle{
+		ID:       ohlcv.ID,
+		Time:     int64(ohlcv.Time),
+		Interval: ohlcv.Interval,
+		Open:     ohlcv.Open,
+		High:     ohlcv.High,
+		Low:      ohlcv.Low,
+		Close:    ohlcv.Close,
+		Volume:   ohlcv.Volume,
+		Ticker:   ohlcv.Ticker,
+	}
+
+	if err := b.repo.SaveCandle(ctx, candle); err != nil {
+		return err
+	}
+
+	b.pricesMu.Lock()
+	b.lastClose[candle.Ticker] = candle.Close
+	b.pricesMu.Unlock()
+
+	b.pnl.mark(candle.Ticker, candle.Close)
+
+	b.publishCandle(candle)
+
+	return b.repo.DeleteCandles(ctx, candle.Time-historyDepth)
+}
+
+// HandleFill применяет исполнение заявки от биржи к счёту клиента
+func (b *Broker) HandleFill(ctx context.Context, deal *exchange.Deal) (models.Order, error) {
+	fill := models.Fill{
+		FillID:   deal.FillID,
+		DealID:   deal.ID,
+		ClientID: int64(deal.ClientID),
+		Ticker:   deal.Ticker,
+		Volume:   deal.Volume,
+		Partial:  deal.Partial,
+		Time:     int64(deal.Time),
+		Price:    deal.Price,
+		IsBuy:    deal.IsBuy,
+	}
+
+	// между записью в базу и applyFill исполнение может попасть в загрузку истории P&L
+	b.pnl.begin(fill.FillID)
+	defer b.pnl.end(fill.FillID)
+
+	order, err := b.repo.ApplyFill(ctx, fill)
+	if errors.Is(err, ErrOrderNotFound) {
+		order, err = b.holdFill(ctx, fill, deal.CorrelationID)
+	}
+	if errors.Is(err, ErrDuplicateFill) {
+		if dErr := b.repo.DeletePendingFill(ctx, fill.FillID); dErr != nil {
+			log.Ctx(ctx).Err(dErr).Send()
+		}
+	}
+	if err != nil {
+		return order, err
+	}
+	fill.IsBuy = order.IsBuy
+
+	b.pnl.applyFill(fill)
+	b.publishFill(FillEvent{Fill: fill, Order: order})
+	b.publishOrder(ctx, OrderEvent{Order: order, Fill: &fill, CorrelationID: deal.CorrelationID})
+
+	return order, nil
+}
+
+// holdFill исполнение пришло раньше, чем Deal сохранил deal ID заявки: пробует
+// ещё раз и откладывает его до setPlaced. Возвращает ошибку с ErrOrderNotFound
+func (b *Broker) holdFill(ctx context.Context, fill models.Fill, correlationID string) (models.Order, error) {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+
+	order, err := b.repo.ApplyFill(ctx, fill)
+	if !errors.Is(err, ErrOrderNotFound) {
+		return order, err
+	}
+
+	if sErr := b.repo.SavePendingFill(ctx, PendingFill{Fill: fill, CorrelationID: correlationID}); sErr != nil {
+		return order, sErr
+	}
+
+	return order, fmt.Errorf("%w, fill %d is pending", err, fill.FillID)
+}
+
+// setPlaced сохраняет deal ID заявки и применяет исполнения, которые пришли раньше
+func (b *Broker) setPlaced(ctx context.Context, orderID, dealID int64) error {
+	b.pendingMu.Lock()
+	err := b.repo.SetOrderPlaced(ctx, orderID, dealID)
+	b.pendingMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	fills, err := b.repo.PendingFills(ctx, dealID)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fills {
+		deal := &exchange.Deal{
+			ID:       f.DealID,
+			ClientID: int32(f.ClientID),
+			Ticker:   f.Ticker,
+			Volume:   f.Volume,
+			Partial:  f.Partial,
+			Time:     int32(f.Time),
+			Price:    f.Price,
+			IsBuy:    f.IsBuy,
+			FillID:   f.FillID,
+
+			CorrelationID: f.CorrelationID,
+		}
+		if _, err = b.HandleFill(ctx, deal); err != nil && !errors.Is(err, ErrDuplicateFill) {
+			return fmt.Errorf("cant apply pending fill %d: %w", f.FillID, err)
+		}
+	}
+
+	return nil
+}
+
+// LastFillID с какого номера исполнения продолжается поток Results
+func (b *Broker) LastFillID(ctx context.Context) (int64, error) {
+	return b.repo.LastFillID(ctx)
+}
@@ -0,0 +1,223 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"trading/pkg/gen/exchange"
+	"trading/pkg/models"
+	"trading/pkg/price"
+
+	"google.golang.org/grpc"
+)
+
+// lateCancelExchange биржа, на которой заявки уже нет: снятие не удаётся,
+// а onCancel успевает применить её исполнение
+type lateCancelExchange struct {
+	exchange.ExchangeClient
+	onCancel func(dealID int64)
+}
+
+func (e *lateCancelExchange) Cancel(ctx context.Context, in *exchange.DealID, opts ...grpc.CallOption) (*exchange.CancelResult, error) {
+	if e.onCancel != nil {
+		e.onCancel(in.ID)
+	}
+
+	return &exchange.CancelResult{Success: false}, nil
+}
+
+func TestCancelNotOnExchange(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	exch := &lateCancelExchange{}
+	b := NewBroker(1, repo, exch, RiskLimits{}, models.PnLAverage)
+
+	// исполнение ещё не дошло - заявка открыта, снять её нельзя
+	pending := createOrder(t, repo, 1, 301)
+	order, err := b.Cancel(ctx, 1, pending, "")
+	if !errors.Is(err, ErrCancelRejected) || order.Status != models.OrderPlaced {
+		t.Errorf("Cancel with pending fill = %s, %v, want placed and ErrCancelRejected", order.Status, err)
+	}
+
+	// исполнение пришло, пока биржа снимала заявку - в ответе настоящее состояние
+	filled := createOrder(t, repo, 1, 302)
+	exch.onCancel = func(dealID int64) {
+		if _, err := repo.ApplyFill(ctx, models.Fill{FillID: 1, DealID: dealID, Volume: 1, Price: 100}); err != nil {
+			t.Error(err)
+		}
+	}
+	if order, err = b.Cancel(ctx, 1, filled, ""); err != nil || order.Status != models.OrderFilled {
+		t.Errorf("Cancel of order filled meanwhile = %s, %v, want filled", order.Status, err)
+	}
+}
+
+func TestHistoryDepth(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	b := NewBroker(1, repo, nil, RiskLimits{}, models.PnLAverage)
+
+	const now = 100000
+	for _, at := range []int64{now - 2*historyDepth, now - 3000, now - 100} {
+		if err := repo.SaveCandle(ctx, models.Candle{Time: at, Ticker: "T", Close: 100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		seconds int64
+		want    int
+	}{
+		{DefaultHistory, 1},
+		{3600, 2},
+		{0, 2},                 // по умолчанию вся хранимая история
+		{10 * historyDepth, 2}, // глубже хранимой не бывает
+	}
+	for _, tt := range tests {
+		candles, err := b.History(ctx, "T", now, tt.seconds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candles) != tt.want {
+			t.Errorf("History(%d seconds) = %d candles, want %d", tt.seconds, len(candles), tt.want)
+		}
+	}
+}
+
+func TestFillDebitsNotional(t *testing.T) {
+	// пункт стоит 3 рубля: 2 контракта по 1.50 - 9 рублей, 900 копеек
+	price.Register(price.Spec{Ticker: "FILL", Scale: 2, TickSize: 1, PointValue: 300})
+
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	trade := func(isBuy bool, dealID int64) {
+		t.Helper()
+
+		id, err := repo.CreateOrder(ctx, models.Order{ClientID: 1, Ticker: "FILL", Volume: 2, Price: 150, IsBuy: isBuy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = repo.SetOrderPlaced(ctx, id, dealID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = repo.ApplyFill(ctx, models.Fill{FillID: dealID, DealID: dealID, Volume: 2, Price: 150}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	balance := func() int64 {
+		t.Helper()
+
+		c, err := repo.Client(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c.Balance
+	}
+
+	trade(true, 401)
+	if got := balance(); got != 200000-900 {
+		t.Errorf("balance after buy = %d, want %d", got, 200000-900)
+	}
+
+	trade(false, 402)
+	if got := balance(); got != 200000 {
+		t.Errorf("balance after sell = %d, want 200000", got)
+	}
+}
+
+// racingExchange выставляет заявку, а onCreate успевает прислать её исполнение
+// раньше, чем брокер сохранил deal ID
+type racingExchange struct {
+	exchange.ExchangeClient
+	onCreate func(dealID int64)
+}
+
+func (e *racingExchange) Create(ctx context.Context, in *exchange.Deal, opts ...grpc.CallOption) (*exchange.DealID, error) {
+	const dealID = 501
+	e.onCreate(dealID)
+
+	return &exchange.DealID{ID: dealID}, nil
+}
+
+func TestFillBeforeDealPlaced(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	exch := &racingExchange{}
+	b := NewBroker(1, repo, exch, RiskLimits{}, models.PnLAverage)
+
+	exch.onCreate = func(dealID int64) {
+		_, err := b.HandleFill(ctx, &exchange.Deal{ID: dealID, FillID: 7, ClientID: 1, Ticker: "T", Volume: 1, Price: 100, IsBuy: true})
+		if !errors.Is(err, ErrOrderNotFound) {
+			t.Errorf("HandleFill before placed: error = %v, want %v", err, ErrOrderNotFound)
+		}
+
+		// поток Results продолжится с отложенного исполнения
+		if last, err := repo.LastFillID(ctx); err != nil || last != 6 {
+			t.Errorf("LastFillID with pending fill = %d, %v, want 6", last, err)
+		}
+	}
+
+	order, err := b.Deal(ctx, models.Order{ClientID: 1, Ticker: "T", Volume: 1, Price: 100, IsBuy: true})
+	if err != nil {
+		t.Fatalf("Deal: %v", err)
+	}
+	if order.Status != models.OrderFilled || order.Filled != 1 {
+		t.Errorf("order = %+v, want filled by the pending fill", order)
+	}
+
+	positions, err := repo.Positions(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 || positions[0].Volume != 1 {
+		t.Errorf("positions = %+v, want 1 T", positions)
+	}
+	if last, err := repo.LastFillID(ctx); err != nil || last != 7 {
+		t.Errorf("LastFillID = %d, %v, want 7", last, err)
+	}
+}
+
+// flakyExchange не выставляет первые fail заявок
+type flakyExchange struct {
+	exchange.ExchangeClient
+	fail    int
+	created int
+}
+
+func (e *flakyExchange) Create(ctx context.Context, in *exchange.Deal, opts ...grpc.CallOption) (*exchange.DealID, error) {
+	if e.fail > 0 {
+		e.fail--
+
+		return nil, errors.New("exchange is down")
+	}
+	e.created++
+
+	return &exchange.DealID{ID: int64(600 + e.created)}, nil
+}
+
+func TestDealRetryAfterReject(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	exch := &flakyExchange{fail: 1}
+	b := NewBroker(1, repo, exch, RiskLimits{}, models.PnLAverage)
+
+	deal := models.Order{ClientID: 1, Ticker: "T", Volume: 1, Price: 100, IsBuy: true, ClientOrderID: "retry-1"}
+	if _, err := b.Deal(ctx, deal); err == nil {
+		t.Fatal("Deal with exchange down: want error")
+	}
+
+	// повтор с тем же ClientOrderID выставляет ту же заявку, а не отдаёт отказ
+	order, err := b.Deal(ctx, deal)
+	if err != nil {
+		t.Fatalf("retried Deal: %v", err)
+	}
+	if order.Status != models.OrderPlaced || order.DealID != 601 {
+		t.Errorf("retried order = %+v, want placed as 601", order)
+	}
+
+	// выставленную заявку следующий повтор уже не отправляет
+	if again, err := b.Deal(ctx, deal); err != nil || again.ID != order.ID || exch.created != 1 {
+		t.Errorf("second retry = %+v, %v, created %d times, want order %d once", again, err, exch.created, order.ID)
+	}
+}
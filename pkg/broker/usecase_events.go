@@ -0,0 +1,169 @@
+package broker
+
+import (
+	"context"
+	"sync"
+	"time"
+	"trading/pkg/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// eventsBuffer сколько событий подписчик может не забрать. Дальше свечи и исполнения
+// теряются, а подписка на заявки закрывается, чтобы подписчик дочитал их из истории
+const eventsBuffer = 100
+
+// orderEventsDepth сколько хранятся события заявок для досылки после переподключения
+const orderEventsDepth = 24 * time.Hour
+
+// FillEvent исполнение заявки клиента вместе с её новым состоянием
+type FillEvent struct {
+	Fill  models.Fill
+	Order models.Order
+}
+
+// OrderEvent изменение состояния заявки клиента: исполнение, снятие или отклонение.
+// Fill заполнен только для исполнений, Reason - причина снятия или отклонения
+type OrderEvent struct {
+	Seq    int64 // номер события у клиента, 0 если событие не сохранилось
+	Time   int64
+	Order  models.Order
+	Fill   *models.Fill
+	Reason string
+	// CorrelationID ID запроса, который изменил заявку, пусто - изменение без запроса клиента
+	CorrelationID string
+}
+
+// events рассылка цен, исполнений и состояний заявок подписчикам api брокера
+type events struct {
+	sync.Mutex
+	candles map[chan models.Candle]struct{}
+	fills   map[int64]map[chan FillEvent]struct{}
+	orders  map[int64]map[chan OrderEvent]struct{}
+}
+
+func newEvents() *events {
+	return &events{
+		candles: make(map[chan models.Candle]struct{}),
+		fills:   make(map[int64]map[chan FillEvent]struct{}),
+		orders:  make(map[int64]map[chan OrderEvent]struct{}),
+	}
+}
+
+// SubscribeCandles подписка на все новые свечи, вызовите отписку после использования
+func (b *Broker) SubscribeCandles() (<-chan models.Candle, func()) {
+	ch := make(chan models.Candle, eventsBuffer)
+
+	b.events.Lock()
+	b.events.candles[ch] = struct{}{}
+	b.events.Unlock()
+
+	return ch, func() {
+		b.events.Lock()
+		delete(b.events.candles, ch)
+		b.events.Unlock()
+	}
+}
+
+// SubscribeFills подписка на исполнения заявок клиента
+func (b *Broker) SubscribeFills(clientID int64) (<-chan FillEvent, func()) {
+	ch := make(chan FillEvent, eventsBuffer)
+
+	b.events.Lock()
+	if b.events.fills[clientID] == nil {
+		b.events.fills[clientID] = make(map[chan FillEvent]struct{})
+	}
+	b.events.fills[clientID][ch] = struct{}{}
+	b.events.Unlock()
+
+	return ch, func() {
+		b.events.Lock()
+		delete(b.events.fills[clientID], ch)
+		b.events.Unlock()
+	}
+}
+
+// SubscribeOrders подписка на изменения состояния заявок клиента. Канал закрывается,
+// если подписчик отстал, пропущенное досылает OrderEvents по номеру последнего события
+func (b *Broker) SubscribeOrders(clientID int64) (<-chan OrderEvent, func()) {
+	ch := make(chan OrderEvent, eventsBuffer)
+
+	b.events.Lock()
+	if b.events.orders[clientID] == nil {
+		b.events.orders[clientID] = make(map[chan OrderEvent]struct{})
+	}
+	b.events.orders[clientID][ch] = struct{}{}
+	b.events.Unlock()
+
+	return ch, func() {
+		b.events.Lock()
+		delete(b.events.orders[clientID], ch)
+		b.events.Unlock()
+	}
+}
+
+// OrderEvents события заявок клиента после события after
+func (b *Broker) OrderEvents(ctx context.Context, clientID, after int64) ([]OrderEvent, error) {
+	return b.repo.OrderEvents(ctx, clientID, after)
+}
+
+// LastOrderSeq номер последнего события заявок клиента
+func (b *Broker) LastOrderSeq(ctx context.Context, clientID int64) (int64, error) {
+	return b.repo.LastOrderSeq(ctx, clientID)
+}
+
+// медленный подписчик не должен тормозить обработку потоков биржи
+func (b *Broker) publishCandle(candle models.Candle) {
+	b.events.Lock()
+	defer b.events.Unlock()
+
+	for ch := range b.events.candles {
+		select {
+		case ch <- candle:
+		default:
+			log.Warn().Msgf("candle subscriber is full, drop candle %d", candle.ID)
+		}
+	}
+}
+
+func (b *Broker) publishFill(event FillEvent) {
+	b.events.Lock()
+	defer b.events.Unlock()
+
+	for ch := range b.events.fills[event.Order.ClientID] {
+		select {
+		case ch <- event:
+		default:
+			log.Warn().Msgf("fill subscriber is full, drop fill %d", event.Fill.FillID)
+		}
+	}
+}
+
+// publishOrder сохраняет событие, чтобы его можно было дослать, и рассылает подписчикам.
+// Номер выдаётся и событие рассылается под одной блокировкой: подписчик пропускает
+// события с номером не больше последнего полученного, поэтому они должны идти по порядку
+func (b *Broker) publishOrder(ctx context.Context, event OrderEvent) {
+	event.Time = time.Now().Unix()
+	if event.Fill != nil {
+		event.Time = event.Fill.Time
+	}
+
+	b.events.Lock()
+	defer b.events.Unlock()
+
+	seq, err := b.repo.SaveOrderEvent(ctx, event)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msgf("cant save event of order %d, it wont be resent", event.Order.ID)
+	}
+	event.Seq = seq
+
+	for ch := range b.events.orders[event.Order.ClientID] {
+		select {
+		case ch <- event:
+		default:
+			log.Warn().Msgf("order subscriber of client %d is behind, close it", event.Order.ClientID)
+			delete(b.events.orders[event.Order.ClientID], ch)
+			close(ch)
+		}
+	}
+}
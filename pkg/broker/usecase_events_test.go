@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"trading/pkg/models"
+)
+
+func TestOrderEventsReplay(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	b := NewBroker(1, repo, nil, RiskLimits{}, models.PnLAverage)
+
+	order, err := repo.Order(ctx, createOrder(t, repo, 1, 101))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, unsubscribe := b.SubscribeOrders(1)
+	defer unsubscribe()
+
+	// подписчик ничего не читает: буфер заполнился, следующее событие закрывает подписку
+	for i := 0; i <= eventsBuffer; i++ {
+		b.publishOrder(ctx, OrderEvent{Order: order, Reason: "test"})
+	}
+
+	var last int64
+	for e := range orders {
+		last = e.Seq
+	}
+	if last != eventsBuffer {
+		t.Fatalf("last received seq = %d, want %d", last, eventsBuffer)
+	}
+
+	missed, err := b.OrderEvents(ctx, 1, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missed) != 1 || missed[0].Seq != eventsBuffer+1 || missed[0].Order.ID != order.ID {
+		t.Errorf("missed events = %+v, want one event %d of order %d", missed, eventsBuffer+1, order.ID)
+	}
+
+	// чужие события не досылаются
+	if other, err := b.OrderEvents(ctx, 2, 0); err != nil || len(other) != 0 {
+		t.Errorf("events of other client = %+v, %v", other, err)
+	}
+}
+
+func TestOrderEventsInOrder(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	b := NewBroker(1, repo, nil, RiskLimits{}, models.PnLAverage)
+
+	order, err := repo.Order(ctx, createOrder(t, repo, 1, 101))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, unsubscribe := b.SubscribeOrders(1)
+	defer unsubscribe()
+
+	// исполнение и снятие одной заявки публикуются одновременно
+	var wg sync.WaitGroup
+	for i := 0; i < eventsBuffer; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.publishOrder(ctx, OrderEvent{Order: order, Reason: "test"})
+		}()
+	}
+	wg.Wait()
+
+	var last int64
+	for i := 0; i < eventsBuffer; i++ {
+		e := <-orders
+		if e.Seq <= last {
+			t.Fatalf("event %d after %d, subscriber would drop it", e.Seq, last)
+		}
+		last = e.Seq
+	}
+}
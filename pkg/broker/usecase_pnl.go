@@ -0,0 +1,358 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"trading/pkg/models"
+	"trading/pkg/price"
+)
+
+var ErrUnknownPnLMethod = errors.New("unknown pnl method")
+
+// ParsePnLMethod способ расчёта из строки, пустая строка - def
+func ParsePnLMethod(s string, def models.PnLMethod) (models.PnLMethod, error) {
+	switch m := models.PnLMethod(s); m {
+	case "":
+		return def, nil
+	case models.PnLAverage, models.PnLFIFO:
+		return m, nil
+	default:
+		return "", fmt.Errorf("%w: %q, want %s or %s", ErrUnknownPnLMethod, s, models.PnLAverage, models.PnLFIFO)
+	}
+}
+
+// lot часть позиции, открытая по одной цене, volume со знаком
+type lot struct {
+	volume int64
+	price  int64
+}
+
+// costBasis позиция по инструменту, цена входа и реализованный результат
+type costBasis struct {
+	method   models.PnLMethod
+	volume   int64
+	avgPrice float64
+	lots     []lot // только для fifo
+	realized float64
+
+	mark int64   // последняя цена закрытия
+	open float64 // переоценка открытой позиции по mark
+}
+
+// apply учитывает исполнение, volume > 0 - покупка, < 0 - продажа
+func (c *costBasis) apply(volume, price int64) {
+	if c.method == models.PnLFIFO {
+		c.applyFIFO(volume, price)
+	} else {
+		c.applyAverage(volume, price)
+	}
+
+	c.volume += volume
+}
+
+func (c *costBasis) applyAverage(volume, price int64) {
+	// позиция увеличивается - пересчитываем среднюю цену
+	if c.volume == 0 || sameSign(c.volume, volume) {
+		total := abs(c.volume) + abs(volume)
+		c.avgPrice = (c.avgPrice*float64(abs(c.volume)) + float64(price*abs(volume))) / float64(total)
+
+		return
+	}
+
+	closed := min64(abs(volume), abs(c.volume))
+	c.realized += float64(closed) * (float64(price) - c.avgPrice) * float64(sign(c.volume))
+
+	switch rest := c.volume + volume; {
+	case rest == 0:
+		c.avgPrice = 0
+	case !sameSign(rest, c.volume):
+		// позиция перевернулась, остаток открыт по цене сделки
+		c.avgPrice = float64(price)
+	}
+}
+
+func (c *costBasis) applyFIFO(volume, price int64) {
+	for volume != 0 && len(c.lots) > 0 && !sameSign(c.lots[0].volume, volume) {
+		first := &c.lots[0]
+		closed := min64(abs(volume), abs(first.volume))
+		c.realized += float64(closed*(price-first.price)) * float64(sign(first.volume))
+
+		if first.volume > 0 {
+			first.volume -= closed
+			volume += closed
+		} else {
+			first.volume += closed
+			volume -= closed
+		}
+
+		if first.volume == 0 {
+			c.lots = c.lots[1:]
+		}
+	}
+
+	if volume != 0 {
+		c.lots = append(c.lots, lot{volume: volume, price: price})
+	}
+
+	// средняя цена оставшихся лотов
+	var cost, total int64
+	for _, l := range c.lots {
+		cost += abs(l.volume) * l.price
+		total += abs(l.volume)
+	}
+
+	c.avgPrice = 0
+	if total > 0 {
+		c.avgPrice = float64(cost) / float64(total)
+	}
+}
+
+// unrealized переоценка открытой позиции по цене mark
+func (c *costBasis) unrealized(mark int64) float64 {
+	if mark <= 0 || c.volume == 0 {
+		return 0
+	}
+
+	return (float64(mark) - c.avgPrice) * float64(c.volume)
+}
+
+// clientPnL позиции клиента по обоим способам расчёта
+type clientPnL struct {
+	// applied исполнения, которые попали в загруженную историю, пока ещё записывались
+	// в базу: applyFill их пропускает и забывает, поэтому карта не растёт
+	applied map[int64]struct{}
+	tickers map[models.PnLMethod]map[string]*costBasis
+}
+
+func newClientPnL() *clientPnL {
+	return &clientPnL{
+		applied: make(map[int64]struct{}),
+		tickers: map[models.PnLMethod]map[string]*costBasis{
+			models.PnLAverage: {},
+			models.PnLFIFO:    {},
+		},
+	}
+}
+
+// apply учитывает исполнение, mark - последняя цена закрытия инструмента
+func (c *clientPnL) apply(fill models.Fill, mark int64) {
+	volume := int64(fill.Volume)
+	if !fill.IsBuy {
+		volume = -volume
+	}
+
+	for method, tickers := range c.tickers {
+		basis, ok := tickers[fill.Ticker]
+		if !ok {
+			basis = &costBasis{method: method}
+			tickers[fill.Ticker] = basis
+		}
+
+		basis.apply(volume, fill.Price)
+		basis.revalue(mark)
+	}
+}
+
+// revalue переоценивает открытую позицию по новой цене закрытия
+func (c *costBasis) revalue(mark int64) {
+	if mark > 0 {
+		c.mark = mark
+	}
+	c.open = c.unrealized(c.mark)
+}
+
+// pnlBook цены входа и результат клиентов в памяти, загружаются из истории исполнений
+// и переоцениваются по каждой новой свече
+type pnlBook struct {
+	sync.Mutex
+	clients map[int64]*clientPnL
+	marks   map[string]int64 // последняя цена закрытия по инструменту
+	// inflight исполнения между begin и end: уже могут быть в базе, но ещё не
+	// дошли до applyFill. Сколько HandleFill сейчас пишет каждое
+	inflight map[int64]int
+}
+
+func newPnLBook() *pnlBook {
+	return &pnlBook{
+		clients:  make(map[int64]*clientPnL),
+		marks:    make(map[string]int64),
+		inflight: make(map[int64]int),
+	}
+}
+
+// begin исполнение сейчас запишется в базу, вызывается до записи
+func (p *pnlBook) begin(fillID int64) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.inflight[fillID]++
+}
+
+// end запись исполнения закончена, applyFill, если запись удалась, уже вызван
+func (p *pnlBook) end(fillID int64) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.inflight[fillID]--; p.inflight[fillID] <= 0 {
+		delete(p.inflight, fillID)
+	}
+}
+
+// applyFill учитывает исполнение, если клиент уже загружен, иначе оно придёт из истории.
+// Исполнение, которое загрузка истории успела прочитать из базы, второй раз не учитывается
+func (p *pnlBook) applyFill(fill models.Fill) {
+	p.Lock()
+	defer p.Unlock()
+
+	c, ok := p.clients[fill.ClientID]
+	if !ok {
+		return
+	}
+
+	if _, ok = c.applied[fill.FillID]; ok {
+		delete(c.applied, fill.FillID)
+
+		return
+	}
+	c.apply(fill, p.marks[fill.Ticker])
+}
+
+// mark переоценивает позиции загруженных клиентов по закрытию свечи
+func (p *pnlBook) mark(ticker string, last int64) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.marks[ticker] = last
+	for _, c := range p.clients {
+		for _, tickers := range c.tickers {
+			if basis, ok := tickers[ticker]; ok {
+				basis.revalue(last)
+			}
+		}
+	}
+}
+
+// basis позиции клиента по способу method, при первом обращении загружает историю
+func (p *pnlBook) basis(
+	ctx context.Context, repo IRepository, clientID int64, method models.PnLMethod,
+) (map[string]costBasis, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	c, ok := p.clients[clientID]
+	if !ok {
+		fills, err := repo.Fills(ctx, clientID)
+		if err != nil {
+			return nil, err
+		}
+
+		c = newClientPnL()
+		for _, f := range fills {
+			if _, ok := p.inflight[f.FillID]; ok {
+				c.applied[f.FillID] = struct{}{}
+			}
+			c.apply(f, p.marks[f.Ticker])
+		}
+		p.clients[clientID] = c
+	}
+
+	res := make(map[string]costBasis, len(c.tickers[method]))
+	for ticker, basis := range c.tickers[method] {
+		res[ticker] = *basis
+	}
+
+	return res, nil
+}
+
+// valuate дополняет позиции ценой входа и результатом по всем инструментам, которыми
+// торговал клиент: закрытые позиции с реализованным результатом тоже попадают в ответ
+func (b *Broker) valuate(ctx context.Context, clientID int64, method models.PnLMethod, status *models.Status) error {
+	basis, err := b.pnl.basis(ctx, b.repo, clientID, method)
+	if err != nil {
+		return err
+	}
+
+	status.Body.PnLMethod = method
+
+	volumes := make(map[string]int64, len(status.Body.Positions))
+	for _, p := range status.Body.Positions {
+		volumes[p.Ticker] = p.Volume
+	}
+
+	for ticker := range basis {
+		if _, ok := volumes[ticker]; !ok {
+			status.Body.Positions = append(status.Body.Positions, models.Position{Ticker: ticker})
+		}
+	}
+	sort.Slice(status.Body.Positions, func(i, j int) bool {
+		return status.Body.Positions[i].Ticker < status.Body.Positions[j].Ticker
+	})
+
+	positions := status.Body.Positions[:0]
+	for _, p := range status.Body.Positions {
+		cb, ok := basis[p.Ticker]
+		if !ok {
+			positions = append(positions, p)
+
+			continue
+		}
+
+		// до первой свечи после запуска цена берётся из сохранённой истории
+		if cb.mark <= 0 && cb.volume != 0 {
+			last, err := b.LastClose(ctx, p.Ticker)
+			if err != nil {
+				return err
+			}
+			cb.revalue(last)
+		}
+
+		// результат считается в единицах цены, клиенту - в деньгах
+		spec := price.Lookup(p.Ticker)
+		p.MarkPrice = cb.mark
+		p.AvgPrice = cb.avgPrice
+		p.RealizedPnL = spec.Money(cb.realized)
+		p.UnrealizedPnL = spec.Money(cb.open)
+
+		if p.Volume == 0 && p.RealizedPnL == 0 {
+			continue
+		}
+
+		status.Body.RealizedPnL += p.RealizedPnL
+		status.Body.UnrealizedPnL += p.UnrealizedPnL
+		positions = append(positions, p)
+	}
+	status.Body.Positions = positions
+
+	return nil
+}
+
+func sameSign(a, b int64) bool {
+	return (a > 0) == (b > 0)
+}
+
+func sign(v int64) int64 {
+	if v < 0 {
+		return -1
+	}
+
+	return 1
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
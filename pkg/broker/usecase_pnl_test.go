@@ -0,0 +1,184 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"trading/pkg/gen/exchange"
+	"trading/pkg/models"
+	"trading/pkg/price"
+)
+
+func TestCostBasis(t *testing.T) {
+	type fill struct {
+		volume int64 // > 0 - покупка
+		price  int64
+	}
+	type result struct {
+		volume   int64
+		avgPrice float64
+		realized float64
+	}
+
+	tests := []struct {
+		name  string
+		fills []fill
+		// результат по средней цене и по fifo
+		average, fifo result
+	}{
+		{
+			name:    "adding to long",
+			fills:   []fill{{1, 100}, {1, 110}},
+			average: result{2, 105, 0},
+			fifo:    result{2, 105, 0},
+		},
+		{
+			name:    "partial close of long",
+			fills:   []fill{{1, 100}, {1, 110}, {-1, 120}},
+			average: result{1, 105, 15},
+			fifo:    result{1, 110, 20},
+		},
+		{
+			name:    "close out with loss",
+			fills:   []fill{{2, 100}, {-2, 90}},
+			average: result{0, 0, -20},
+			fifo:    result{0, 0, -20},
+		},
+		{
+			name:    "long flips to short",
+			fills:   []fill{{1, 100}, {1, 110}, {-3, 120}},
+			average: result{-1, 120, 30},
+			fifo:    result{-1, 120, 30},
+		},
+		{
+			name:    "partial cover of short",
+			fills:   []fill{{-1, 100}, {-1, 90}, {1, 80}},
+			average: result{-1, 95, 15},
+			fifo:    result{-1, 90, 20},
+		},
+		{
+			name:    "short flips to long",
+			fills:   []fill{{-1, 100}, {-1, 90}, {3, 80}},
+			average: result{1, 80, 30},
+			fifo:    result{1, 80, 30},
+		},
+		{
+			name:    "reopen after close out",
+			fills:   []fill{{1, 100}, {-1, 110}, {1, 90}},
+			average: result{1, 90, 10},
+			fifo:    result{1, 90, 10},
+		},
+	}
+
+	for _, tt := range tests {
+		for method, want := range map[models.PnLMethod]result{models.PnLAverage: tt.average, models.PnLFIFO: tt.fifo} {
+			t.Run(tt.name+"/"+string(method), func(t *testing.T) {
+				c := costBasis{method: method}
+				for _, f := range tt.fills {
+					c.apply(f.volume, f.price)
+				}
+
+				got := result{c.volume, c.avgPrice, c.realized}
+				if got != want {
+					t.Errorf("volume, avg, realized = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestPnLFillDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	book := newPnLBook()
+
+	// исполнение 7 уже в базе, но HandleFill ещё не дошёл до applyFill, а тут загрузка
+	createOrder(t, repo, 2, 1)
+	book.begin(7)
+	if _, err := repo.ApplyFill(ctx, models.Fill{FillID: 7, DealID: 1, Volume: 1, Price: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := book.basis(ctx, repo, 1, models.PnLAverage); err != nil {
+		t.Fatal(err)
+	}
+
+	book.applyFill(models.Fill{FillID: 7, ClientID: 1, Ticker: "T", Volume: 1, Price: 100, IsBuy: true})
+	book.end(7)
+	// сверка довезла пропущенное 5 после 7
+	book.applyFill(models.Fill{FillID: 5, ClientID: 1, Ticker: "T", Volume: 1, Price: 100, IsBuy: true})
+
+	c := book.clients[1]
+	if got := c.tickers[models.PnLAverage]["T"].volume; got != 2 {
+		t.Errorf("volume = %d, want 2", got)
+	}
+	if len(c.applied) != 0 || len(book.inflight) != 0 {
+		t.Errorf("applied = %v, inflight = %v, want both empty", c.applied, book.inflight)
+	}
+}
+
+func TestStatusPnL(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	b := NewBroker(1, repo, nil, RiskLimits{}, models.PnLAverage)
+
+	// T куплен по 100 и продан по 110, по U открыта покупка по 50
+	deals := []struct {
+		ticker      string
+		isBuy       bool
+		volume      int32
+		price, deal int64
+	}{
+		{"T", true, 2, 100, 201},
+		{"T", false, 2, 110, 202},
+		{"U", true, 1, 50, 203},
+	}
+	for i, d := range deals {
+		id, err := repo.CreateOrder(ctx, models.Order{ClientID: 1, Ticker: d.ticker, Volume: d.volume, Price: d.price, IsBuy: d.isBuy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = repo.SetOrderPlaced(ctx, id, d.deal); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = b.HandleFill(ctx, &exchange.Deal{
+			ID: d.deal, FillID: int64(i + 1), ClientID: 1, Ticker: d.ticker, Volume: d.volume, Price: d.price, IsBuy: d.isBuy,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.HandleCandle(ctx, &exchange.OHLCV{ID: 1, Time: 1000, Ticker: "U", Close: 60}); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := b.Status(ctx, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.Body.Positions) != 2 {
+		t.Fatalf("positions = %+v, want closed T and open U", status.Body.Positions)
+	}
+
+	closed, open := status.Body.Positions[0], status.Body.Positions[1]
+	if closed.Ticker != "T" || closed.Volume != 0 || closed.RealizedPnL != price.Lookup("T").Money(20) {
+		t.Errorf("closed position = %+v, want T with realized 20", closed)
+	}
+	if open.Ticker != "U" || open.MarkPrice != 60 || open.UnrealizedPnL != price.Lookup("U").Money(10) {
+		t.Errorf("open position = %+v, want U marked at 60", open)
+	}
+
+	// новая свеча переоценивает позицию без повторной загрузки истории
+	if err = b.HandleCandle(ctx, &exchange.OHLCV{ID: 2, Time: 1001, Ticker: "U", Close: 40}); err != nil {
+		t.Fatal(err)
+	}
+	if status, err = b.Status(ctx, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := status.Body.UnrealizedPnL; got != price.Lookup("U").Money(-10) {
+		t.Errorf("unrealized after new candle = %v, want %v", got, price.Lookup("U").Money(-10))
+	}
+	if got := status.Body.RealizedPnL; got != price.Lookup("T").Money(20) {
+		t.Errorf("total realized = %v, want %v", got, price.Lookup("T").Money(20))
+	}
+}
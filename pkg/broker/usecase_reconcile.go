@@ -0,0 +1,216 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"trading/pkg/gen/exchange"
+	"trading/pkg/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// alertsSize сколько последних расхождений брокер держит для health эндпоинта
+const alertsSize = 100
+
+// Alert расхождение с биржей, которое сверка не смогла объяснить
+type Alert struct {
+	Time    time.Time `json:"time"`
+	OrderID int64     `json:"order_id,omitempty"`
+	DealID  int64     `json:"deal_id,omitempty"`
+	Message string    `json:"message"`
+}
+
+// ReconcileReport итог сверки заявок с биржей
+type ReconcileReport struct {
+	FillsApplied int `json:"fills_applied"`
+	Linked       int `json:"linked"`
+	Cancelled    int `json:"cancelled"`
+	Rejected     int `json:"rejected"`
+	Alerts       int `json:"alerts"`
+}
+
+// Reconcile сверяет открытые заявки и исполнения брокера с биржей:
+// применяет пропущенные исполнения, привязывает заявки, ответ на которые
+// потерялся, и закрывает заявки, которых на бирже больше нет, если и в журнале
+// исполнений биржи их исполнения не нашлось
+func (b *Broker) Reconcile(ctx context.Context) (ReconcileReport, error) {
+	b.placing.Lock()
+	defer b.placing.Unlock()
+
+	var report ReconcileReport
+
+	if err := b.repo.DeleteOrderEvents(ctx, time.Now().Add(-orderEventsDepth).Unix()); err != nil {
+		log.Ctx(ctx).Err(err).Msg("cant delete old order events")
+	}
+
+	since, err := b.repo.LastFillID(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	state, err := b.exchange.Orders(ctx, &exchange.OrdersRequest{BrokerID: b.ID, SinceFillID: since})
+	if err != nil {
+		return report, fmt.Errorf("cant get orders from exchange: %w", err)
+	}
+
+	for _, deal := range state.Fills {
+		_, err = b.HandleFill(ctx, deal)
+		switch {
+		case err == nil:
+			report.FillsApplied++
+		case errors.Is(err, ErrDuplicateFill):
+		case errors.Is(err, ErrOrderNotFound):
+			b.alert(&report, Alert{DealID: deal.ID, Message: "fill for unknown deal"})
+		default:
+			return report, err
+		}
+	}
+
+	local, err := b.repo.AllOpenOrders(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	open := make(map[int64]*exchange.Order, len(state.Open))
+	for _, o := range state.Open {
+		open[o.ID] = o
+	}
+
+	var unplaced []models.Order
+	var journal []*exchange.Deal
+	var journalLoaded bool
+	for _, o := range local {
+		if o.Status == models.OrderNew {
+			unplaced = append(unplaced, o)
+
+			continue
+		}
+
+		eo, ok := open[o.DealID]
+		delete(open, o.DealID)
+
+		if !ok {
+			// исполнение заявки могло пройти мимо: до снятия ищем его во всём журнале биржи
+			if !journalLoaded {
+				all, err := b.exchange.Orders(ctx, &exchange.OrdersRequest{BrokerID: b.ID})
+				if err != nil {
+					return report, fmt.Errorf("cant get fills journal from exchange: %w", err)
+				}
+				journal, journalLoaded = all.Fills, true
+			}
+
+			if o, err = b.applyMissed(ctx, &report, o, journal); err != nil {
+				return report, err
+			}
+			if !o.Status.IsOpen() {
+				continue
+			}
+		}
+
+		switch {
+		case !ok:
+			// биржа заявку не знает: снята или биржа перезапускалась
+			if err = b.repo.SetOrderStatus(ctx, o.ID, models.OrderCancelled); err != nil {
+				return report, err
+			}
+			report.Cancelled++
+			o.Status = models.OrderCancelled
+			b.publishOrder(ctx, OrderEvent{Order: o, Reason: "order is not open on exchange"})
+			b.alert(&report, Alert{OrderID: o.ID, DealID: o.DealID, Message: "order is not open on exchange, cancelled"})
+		case eo.Filled != o.Filled:
+			b.alert(&report, Alert{
+				OrderID: o.ID,
+				DealID:  o.DealID,
+				Message: fmt.Sprintf("filled volume mismatch: broker %d, exchange %d", o.Filled, eo.Filled),
+			})
+		}
+	}
+
+	// заявки, ответ на которые не дошёл: ищем такую же неизвестную заявку на бирже
+	for _, o := range unplaced {
+		eo := matchUnplaced(o, open)
+		if eo == nil {
+			if err = b.repo.SetOrderStatus(ctx, o.ID, models.OrderRejected); err != nil {
+				return report, err
+			}
+			report.Rejected++
+			o.Status = models.OrderRejected
+			b.publishOrder(ctx, OrderEvent{Order: o, Reason: "order was not placed on exchange"})
+
+			continue
+		}
+
+		delete(open, eo.ID)
+		if err = b.setPlaced(ctx, o.ID, eo.ID); err != nil {
+			return report, err
+		}
+		report.Linked++
+	}
+
+	for _, eo := range open {
+		b.alert(&report, Alert{DealID: eo.ID, Message: "unknown order on exchange"})
+	}
+
+	log.Info().Interface("report", report).Msg("reconciliation done")
+
+	return report, nil
+}
+
+// applyMissed применяет исполнения заявки o из журнала биржи, которых брокер
+// не получил, и возвращает заявку после них
+func (b *Broker) applyMissed(ctx context.Context, report *ReconcileReport, o models.Order, journal []*exchange.Deal) (models.Order, error) {
+	for _, deal := range journal {
+		if deal.ID != o.DealID {
+			continue
+		}
+
+		order, err := b.HandleFill(ctx, deal)
+		switch {
+		case err == nil:
+			report.FillsApplied++
+			o = order
+		case errors.Is(err, ErrDuplicateFill):
+		default:
+			return o, err
+		}
+	}
+
+	return o, nil
+}
+
+func matchUnplaced(o models.Order, open map[int64]*exchange.Order) *exchange.Order {
+	var found *exchange.Order
+	for _, eo := range open {
+		if int64(eo.ClientID) == o.ClientID && eo.Ticker == o.Ticker && eo.Volume == o.Volume &&
+			eo.Price == o.Price && eo.IsBuy == o.IsBuy && (found == nil || eo.ID < found.ID) {
+			found = eo
+		}
+	}
+
+	return found
+}
+
+func (b *Broker) alert(report *ReconcileReport, a Alert) {
+	a.Time = time.Now()
+	report.Alerts++
+
+	log.Error().Bool("alert", true).Int64("order", a.OrderID).Int64("deal", a.DealID).Msg(a.Message)
+
+	b.alertsMu.Lock()
+	defer b.alertsMu.Unlock()
+
+	b.alerts = append(b.alerts, a)
+	if len(b.alerts) > alertsSize {
+		b.alerts = b.alerts[len(b.alerts)-alertsSize:]
+	}
+}
+
+// Alerts последние расхождения с биржей
+func (b *Broker) Alerts() []Alert {
+	b.alertsMu.Lock()
+	defer b.alertsMu.Unlock()
+
+	return append([]Alert(nil), b.alerts...)
+}
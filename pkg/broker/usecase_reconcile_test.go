@@ -0,0 +1,168 @@
+package broker
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"trading/pkg/gen/exchange"
+	"trading/pkg/models"
+
+	"google.golang.org/grpc"
+)
+
+// fakeExchange отдаёт на Orders заранее заданное состояние биржи
+type fakeExchange struct {
+	exchange.ExchangeClient
+	state *exchange.OrdersState
+}
+
+func (f *fakeExchange) Orders(ctx context.Context, in *exchange.OrdersRequest, opts ...grpc.CallOption) (*exchange.OrdersState, error) {
+	state := &exchange.OrdersState{Open: f.state.Open, LastFillID: f.state.LastFillID}
+	for _, d := range f.state.Fills {
+		if d.FillID > in.SinceFillID {
+			state.Fills = append(state.Fills, d)
+		}
+	}
+
+	return state, nil
+}
+
+func newTestRepo(t *testing.T) *SQLiteRepository {
+	t.Helper()
+
+	ctx := context.Background()
+	repo, err := NewSQLiteRepository(ctx, filepath.Join(t.TempDir(), "broker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	if err = repo.SeedDevClients(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return repo
+}
+
+// createOrder заявка клиента 1 на покупку T по 100, dealID 0 - не дошла до биржи
+func createOrder(t *testing.T, repo *SQLiteRepository, volume int32, dealID int64) int64 {
+	t.Helper()
+
+	ctx := context.Background()
+	id, err := repo.CreateOrder(ctx, models.Order{ClientID: 1, Ticker: "T", Volume: volume, Price: 100, IsBuy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dealID != 0 {
+		if err = repo.SetOrderPlaced(ctx, id, dealID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return id
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	partial := createOrder(t, repo, 2, 101)
+	gone := createOrder(t, repo, 1, 102)
+	lost := createOrder(t, repo, 3, 0)
+	unplaced := createOrder(t, repo, 4, 0)
+
+	exch := &fakeExchange{state: &exchange.OrdersState{
+		Open: []*exchange.Order{
+			{ID: 101, ClientID: 1, Ticker: "T", Volume: 2, Filled: 1, Price: 100, IsBuy: true},
+			// ответ на lost не дошёл, а на бирже заявка есть
+			{ID: 103, ClientID: 1, Ticker: "T", Volume: 3, Price: 100, IsBuy: true},
+			{ID: 104, ClientID: 2, Ticker: "T", Volume: 1, Price: 100, IsBuy: false},
+		},
+		Fills: []*exchange.Deal{
+			{ID: 101, FillID: 5000, ClientID: 1, Ticker: "T", Volume: 1, Price: 100, IsBuy: true, Partial: true},
+		},
+		LastFillID: 5000,
+	}}
+	b := NewBroker(1, repo, exch, RiskLimits{}, models.PnLAverage)
+
+	report, err := b.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	want := ReconcileReport{FillsApplied: 1, Linked: 1, Cancelled: 1, Rejected: 1, Alerts: 2}
+	if report != want {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+
+	statuses := map[int64]models.OrderStatus{
+		partial:  models.OrderPartial,
+		gone:     models.OrderCancelled,
+		lost:     models.OrderPlaced,
+		unplaced: models.OrderRejected,
+	}
+	for id, status := range statuses {
+		o, err := repo.Order(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o.Status != status {
+			t.Errorf("order %d status = %s, want %s", id, o.Status, status)
+		}
+	}
+
+	// повторная сверка ничего не меняет, кроме чужой заявки на бирже
+	report, err = b.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("second Reconcile: %v", err)
+	}
+	if want = (ReconcileReport{Alerts: 1}); report != want {
+		t.Errorf("second report = %+v, want %+v", report, want)
+	}
+}
+
+func TestReconcileMissedFill(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	missed := createOrder(t, repo, 1, 201)
+	createOrder(t, repo, 1, 202)
+	// исполнение 4000 потерялось, а более позднее 5000 дошло
+	if _, err := repo.ApplyFill(ctx, models.Fill{FillID: 5000, DealID: 202, Volume: 1, Price: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	exch := &fakeExchange{state: &exchange.OrdersState{
+		Fills: []*exchange.Deal{
+			{ID: 201, FillID: 4000, ClientID: 1, Ticker: "T", Volume: 1, Price: 100, IsBuy: true},
+			{ID: 202, FillID: 5000, ClientID: 1, Ticker: "T", Volume: 1, Price: 100, IsBuy: true},
+		},
+		LastFillID: 5000,
+	}}
+	b := NewBroker(1, repo, exch, RiskLimits{}, models.PnLAverage)
+
+	report, err := b.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if want := (ReconcileReport{FillsApplied: 1}); report != want {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+
+	o, err := repo.Order(ctx, missed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Status != models.OrderFilled {
+		t.Errorf("order status = %s, want %s instead of cancelled", o.Status, models.OrderFilled)
+	}
+
+	positions, err := repo.Positions(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 || positions[0].Volume != 2 {
+		t.Errorf("positions = %+v, want 2 T", positions)
+	}
+}
@@ -0,0 +1,170 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"trading/pkg/models"
+	"trading/pkg/price"
+)
+
+var ErrRiskRejected = errors.New("order rejected by risk check")
+
+// RejectReason машиночитаемая причина отказа в заявке
+type RejectReason string
+
+const (
+	ReasonMaxOrderVolume      RejectReason = "MAX_ORDER_VOLUME"
+	ReasonMaxPosition         RejectReason = "MAX_POSITION"
+	ReasonMaxNotional         RejectReason = "MAX_NOTIONAL"
+	ReasonPriceCollar         RejectReason = "PRICE_COLLAR"
+	ReasonNoMarketPrice       RejectReason = "NO_MARKET_PRICE"
+	ReasonInsufficientBalance RejectReason = "INSUFFICIENT_BALANCE"
+)
+
+// RiskError отказ в заявке по одной из проверок
+type RiskError struct {
+	Reason  RejectReason
+	Message string
+}
+
+func (e *RiskError) Error() string {
+	return fmt.Sprintf("%v: %s: %s", ErrRiskRejected, e.Reason, e.Message)
+}
+
+func (e *RiskError) Is(target error) bool {
+	return target == ErrRiskRejected
+}
+
+// RiskLimits лимиты предторговых проверок, 0 - проверка выключена
+type RiskLimits struct {
+	MaxOrderVolume int32
+	MaxPosition    int64
+	MaxNotional    int64 // копейки
+	// PriceCollar допустимое отклонение цены заявки от последней цены закрытия, доля
+	PriceCollar float64
+}
+
+// riskAccount то, что нужно проверкам о счёте клиента
+type riskAccount struct {
+	balance    int64
+	position   int64
+	openOrders []models.Order
+}
+
+// checkRisk проверяет заявку до отправки на биржу, lastClose - 0 если цены ещё нет
+func (l RiskLimits) checkRisk(order models.Order, acc riskAccount, lastClose int64) error {
+	spec := price.Lookup(order.Ticker)
+	notional := spec.Notional(order.Price, int64(order.Volume))
+
+	if l.MaxOrderVolume > 0 && order.Volume > l.MaxOrderVolume {
+		return &RiskError{ReasonMaxOrderVolume, fmt.Sprintf("volume %d > %d", order.Volume, l.MaxOrderVolume)}
+	}
+
+	if l.MaxNotional > 0 && notional > l.MaxNotional {
+		return &RiskError{ReasonMaxNotional, fmt.Sprintf(
+			"notional %s > %s", price.FormatMoney(notional), price.FormatMoney(l.MaxNotional),
+		)}
+	}
+
+	if l.PriceCollar > 0 {
+		if lastClose <= 0 {
+			return &RiskError{ReasonNoMarketPrice, "no price for " + order.Ticker}
+		}
+
+		deviation := float64(order.Price-lastClose) / float64(lastClose)
+		if deviation > l.PriceCollar || deviation < -l.PriceCollar {
+			return &RiskError{ReasonPriceCollar, fmt.Sprintf(
+				"price %s is more than %.1f%% away from last close %s",
+				spec.Format(order.Price), l.PriceCollar*100, spec.Format(lastClose),
+			)}
+		}
+	}
+
+	// позиция, если исполнятся все заявки в ту же сторону, включая эту
+	position, reserved := acc.position, int64(0)
+	for _, o := range acc.openOrders {
+		rest := int64(o.Volume - o.Filled)
+		if o.IsBuy {
+			reserved += price.Lookup(o.Ticker).Notional(o.Price, rest)
+		}
+
+		if o.Ticker != order.Ticker || o.IsBuy != order.IsBuy {
+			continue
+		}
+
+		if o.IsBuy {
+			position += rest
+		} else {
+			position -= rest
+		}
+	}
+
+	if order.IsBuy {
+		position += int64(order.Volume)
+	} else {
+		position -= int64(order.Volume)
+	}
+
+	if l.MaxPosition > 0 && (position > l.MaxPosition || position < -l.MaxPosition) {
+		return &RiskError{ReasonMaxPosition, fmt.Sprintf("position %d exceeds %d", position, l.MaxPosition)}
+	}
+
+	// продажа денег не требует, покупка - не больше баланса за вычетом открытых покупок
+	if available := acc.balance - reserved; order.IsBuy && notional > available {
+		return &RiskError{ReasonInsufficientBalance, fmt.Sprintf(
+			"notional %s > available %s", price.FormatMoney(notional), price.FormatMoney(available),
+		)}
+	}
+
+	return nil
+}
+
+// checkRisk собирает состояние счёта клиента и проверяет заявку
+func (b *Broker) checkRisk(ctx context.Context, order models.Order) error {
+	client, err := b.repo.Client(ctx, order.ClientID)
+	if err != nil {
+		return err
+	}
+
+	acc := riskAccount{balance: client.Balance}
+
+	positions, err := b.repo.Positions(ctx, order.ClientID)
+	if err != nil {
+		return err
+	}
+	for _, p := range positions {
+		if p.Ticker == order.Ticker {
+			acc.position = p.Volume
+		}
+	}
+
+	if acc.openOrders, err = b.repo.OpenOrders(ctx, order.ClientID); err != nil {
+		return err
+	}
+
+	lastClose, err := b.LastClose(ctx, order.Ticker)
+	if err != nil {
+		return err
+	}
+
+	return b.limits.checkRisk(order, acc, lastClose)
+}
+
+// LastClose последняя цена закрытия по инструменту, 0 если цен ещё не было
+func (b *Broker) LastClose(ctx context.Context, ticker string) (int64, error) {
+	b.pricesMu.RLock()
+	last, ok := b.lastClose[ticker]
+	b.pricesMu.RUnlock()
+
+	if ok {
+		return last, nil
+	}
+
+	candles, err := b.repo.Candles(ctx, ticker, 0)
+	if err != nil || len(candles) == 0 {
+		return 0, err
+	}
+
+	return candles[len(candles)-1].Close, nil
+}
@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"trading/pkg/models"
+	"trading/pkg/price"
+)
+
+func TestCheckRisk(t *testing.T) {
+	// пункт стоит 2 рубля: 100.00 за контракт - 200 рублей, 20000 копеек
+	price.Register(price.Spec{Ticker: "RISK", Scale: 2, TickSize: 10, PointValue: 200})
+
+	limits := RiskLimits{MaxOrderVolume: 10, MaxPosition: 5, MaxNotional: 100000, PriceCollar: 0.1}
+	buy := func(volume int32, units int64) models.Order {
+		return models.Order{Ticker: "RISK", Volume: volume, Price: units, IsBuy: true}
+	}
+	sell := func(volume int32, units int64) models.Order {
+		return models.Order{Ticker: "RISK", Volume: volume, Price: units}
+	}
+	rich := riskAccount{balance: 1000000}
+
+	tests := []struct {
+		name      string
+		limits    RiskLimits
+		order     models.Order
+		acc       riskAccount
+		lastClose int64
+		want      RejectReason // пусто - заявка проходит
+	}{
+		{"passes", limits, buy(1, 10000), rich, 10000, ""},
+		{"volume over limit", limits, buy(11, 10000), rich, 10000, ReasonMaxOrderVolume},
+		{"notional in kopecks over limit", limits, buy(5, 10010), rich, 10000, ReasonMaxNotional},
+		{"notional at limit", limits, buy(5, 10000), rich, 10000, ""},
+		{"no market price", limits, buy(1, 10000), rich, 0, ReasonNoMarketPrice},
+		{"no market price without collar", RiskLimits{}, buy(1, 10000), rich, 0, ""},
+		{"price above collar", limits, buy(1, 11010), rich, 10000, ReasonPriceCollar},
+		{"price below collar", limits, sell(1, 8990), rich, 10000, ReasonPriceCollar},
+		{
+			"position with open orders over limit", limits, buy(2, 10000),
+			riskAccount{balance: 1000000, position: 2, openOrders: []models.Order{buy(2, 10000)}},
+			10000, ReasonMaxPosition,
+		},
+		{
+			"short position over limit", limits, sell(3, 10000),
+			riskAccount{balance: 0, position: -3}, 10000, ReasonMaxPosition,
+		},
+		{
+			"sell closing long needs no money", limits, sell(3, 10000),
+			riskAccount{balance: 0, position: 3}, 10000, "",
+		},
+		{
+			"balance", limits, buy(1, 10000),
+			riskAccount{balance: 19999}, 10000, ReasonInsufficientBalance,
+		},
+		{
+			"balance reserved by open buys", limits, buy(1, 10000),
+			riskAccount{balance: 50000, openOrders: []models.Order{{Ticker: "RISK", Volume: 2, Filled: 0, Price: 10000, IsBuy: true}}},
+			10000, ReasonInsufficientBalance,
+		},
+		{
+			"filled part of open buy is not reserved", limits, buy(1, 10000),
+			riskAccount{balance: 50000, openOrders: []models.Order{{Ticker: "RISK", Volume: 2, Filled: 1, Price: 10000, IsBuy: true}}},
+			10000, "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.checkRisk(tt.order, tt.acc, tt.lastClose)
+
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("checkRisk = %v, want nil", err)
+				}
+
+				return
+			}
+
+			var riskErr *RiskError
+			if !errors.As(err, &riskErr) || riskErr.Reason != tt.want {
+				t.Errorf("checkRisk = %v, want %s", err, tt.want)
+			}
+			if !errors.Is(err, ErrRiskRejected) {
+				t.Errorf("checkRisk error %v is not ErrRiskRejected", err)
+			}
+		})
+	}
+}
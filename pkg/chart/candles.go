@@ -0,0 +1,144 @@
+package chart
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"trading/pkg/models"
+	"trading/pkg/price"
+)
+
+var ErrNoCandles = errors.New("no candles to draw")
+
+// цвета тёмной темы, как в торговых терминалах
+var (
+	background = color.RGBA{R: 0x13, G: 0x17, B: 0x22, A: 0xff}
+	grid       = color.RGBA{R: 0x2a, G: 0x2e, B: 0x39, A: 0xff}
+	label      = color.RGBA{R: 0xb2, G: 0xb5, B: 0xbe, A: 0xff}
+	up         = color.RGBA{R: 0x26, G: 0xa6, B: 0x9a, A: 0xff}
+	down       = color.RGBA{R: 0xef, G: 0x53, B: 0x50, A: 0xff}
+)
+
+const (
+	padding    = 10
+	axisWidth  = 70 // справа под подписи цен
+	gridLines  = 5
+	labelScale = 2
+)
+
+// Candles рисует свечной график с объёмами снизу и пишет его в w как png
+func Candles(w io.Writer, candles []models.Candle, width, height int) error {
+	if len(candles) == 0 {
+		return ErrNoCandles
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	plotW := width - 2*padding - axisWidth
+	priceH := (height - 3*padding) * 3 / 4
+	volumeTop := padding + priceH + padding
+	volumeH := height - volumeTop - padding
+
+	low, high, maxVolume := candles[0].Low, candles[0].High, int32(0)
+	for _, c := range candles {
+		if c.Low < low {
+			low = c.Low
+		}
+		if c.High > high {
+			high = c.High
+		}
+		if c.Volume > maxVolume {
+			maxVolume = c.Volume
+		}
+	}
+	if high == low {
+		high, low = high+1, low-1
+	}
+
+	priceY := func(p int64) int {
+		return padding + int(float64(high-p)/float64(high-low)*float64(priceH-1))
+	}
+
+	// сетка и подписи цен в знаках инструмента
+	spec := price.Lookup(candles[0].Ticker)
+	for i := 0; i < gridLines; i++ {
+		level := high - (high-low)*int64(i)/int64(gridLines-1)
+		y := priceY(level)
+
+		fillRect(img, padding, y, padding+plotW, y+1, grid)
+		drawText(img, padding+plotW+6, y-2*labelScale, spec.Format(level), labelScale, label)
+	}
+	fillRect(img, padding, volumeTop-padding/2, padding+plotW, volumeTop-padding/2+1, grid)
+
+	step := float64(plotW) / float64(len(candles))
+	bodyW := int(step * 0.7)
+	if bodyW < 1 {
+		bodyW = 1
+	}
+
+	for i, c := range candles {
+		col := up
+		if c.Close < c.Open {
+			col = down
+		}
+
+		center := padding + int(step*float64(i)+step/2)
+		left := center - bodyW/2
+
+		// тень от минимума до максимума
+		fillRect(img, center, priceY(c.High), center+1, priceY(c.Low)+1, col)
+
+		top, bottom := priceY(c.Open), priceY(c.Close)
+		if top > bottom {
+			top, bottom = bottom, top
+		}
+		fillRect(img, left, top, left+bodyW, bottom+1, col)
+
+		if maxVolume > 0 {
+			barH := int(float64(c.Volume) / float64(maxVolume) * float64(volumeH))
+			fillRect(img, left, volumeTop+volumeH-barH, left+bodyW, volumeTop+volumeH, col)
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// Aggregate собирает свечи в свечи большего интервала seconds
+func Aggregate(candles []models.Candle, seconds int64) []models.Candle {
+	if seconds <= 1 {
+		return candles
+	}
+
+	var res []models.Candle
+	for _, c := range candles {
+		start := c.Time - c.Time%seconds
+
+		if n := len(res); n > 0 && res[n-1].Time == start {
+			last := &res[n-1]
+			if c.High > last.High {
+				last.High = c.High
+			}
+			if c.Low < last.Low {
+				last.Low = c.Low
+			}
+			last.Close = c.Close
+			last.Volume += c.Volume
+
+			continue
+		}
+
+		c.Time = start
+		c.Interval = int32(seconds)
+		res = append(res, c)
+	}
+
+	return res
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, col color.Color) {
+	draw.Draw(img, image.Rect(x0, y0, x1, y1), image.NewUniform(col), image.Point{}, draw.Src)
+}
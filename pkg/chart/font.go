@@ -0,0 +1,44 @@
+package chart
+
+import (
+	"image"
+	"image/color"
+)
+
+// glyphs растровый шрифт 3x5 для подписей цен, без внешних шрифтов
+var glyphs = map[rune][5]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'.': {"...", "...", "...", "...", ".#."},
+	'-': {"...", "...", "###", "...", "..."},
+}
+
+// drawText пишет строку из цифр, каждый пиксель глифа - квадрат scale x scale
+func drawText(img *image.RGBA, x, y int, text string, scale int, col color.Color) {
+	for _, r := range text {
+		glyph, ok := glyphs[r]
+		if !ok {
+			x += 4 * scale
+
+			continue
+		}
+
+		for row, line := range glyph {
+			for c, px := range line {
+				if px == '#' {
+					fillRect(img, x+c*scale, y+row*scale, x+(c+1)*scale, y+(row+1)*scale, col)
+				}
+			}
+		}
+
+		x += 4 * scale
+	}
+}
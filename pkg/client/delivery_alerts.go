@@ -0,0 +1,126 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"trading/pkg/models"
+	"trading/pkg/price"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleAlert команды алертов:
+//
+//	alert <ticker> above|below <price> - новый алерт
+//	alert, alerts                      - список своих алертов в чате
+//	alert delete <id>                  - удалить алерт, с кнопки под списком
+func (t *TelegramClient) handleAlert(m models.Message, args []string) {
+	switch {
+	case len(args) == 0:
+		t.sendAlerts(m, false, "")
+	case args[0] == "delete" && len(args) == 2:
+		t.handleAlertDelete(m, args[1])
+	default:
+		instruments, err := t.Client.Instruments(messageContext(m))
+		if err != nil {
+			t.out <- createErrorMessage(m.ChatID, err)
+
+			return
+		}
+
+		alert, err := ParseAlert(m.ChatID, m.UserID, args, instruments)
+		if err != nil {
+			t.out <- createErrorMessage(m.ChatID, err)
+
+			return
+		}
+
+		if alert, err = t.Alerts.Create(messageContext(m), alert); err != nil {
+			t.out <- createErrorMessage(m.ChatID, err)
+
+			return
+		}
+
+		text := fmt.Sprintf("🔔 Алерт %d: %s", alert.ID, alert)
+		if !alert.Armed {
+			text += ". Цена уже за уровнем, алерт сработает, когда она вернётся и снова его пересечёт"
+		}
+		t.out <- tgbotapi.NewMessage(m.ChatID, text)
+	}
+}
+
+func (t *TelegramClient) handleAlertDelete(m models.Message, arg string) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, fmt.Errorf("cant parse alert id: %w", err))
+
+		return
+	}
+
+	note := fmt.Sprintf("Алерт %d удалён", id)
+	if err = t.Alerts.Delete(messageContext(m), m.ChatID, m.UserID, id); err != nil {
+		note = fmt.Sprintf("Алерт %d удалить не удалось: %v", id, err)
+	}
+
+	t.sendAlerts(m, true, note)
+}
+
+// sendAlerts список алертов пользователя в чате с кнопками удаления
+func (t *TelegramClient) sendAlerts(m models.Message, edit bool, note string) {
+	alerts, err := t.Alerts.List(messageContext(m), m.ChatID, m.UserID)
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
+
+		return
+	}
+
+	var b strings.Builder
+	if note != "" {
+		b.WriteString(note + "\n\n")
+	}
+
+	if len(alerts) == 0 {
+		b.WriteString("Алертов нет. Новый: /alert SPFB.RTS above 1210.00")
+	} else {
+		b.WriteString("Алерты:\n")
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, a := range alerts {
+		b.WriteString(fmt.Sprintf("%d. %s\n", a.ID, a))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("❌ %s", a), fmt.Sprintf("alert delete %d", a.ID)),
+		))
+	}
+
+	if edit {
+		nMsg := tgbotapi.NewEditMessageText(m.ChatID, m.MessageID, b.String())
+		if len(rows) > 0 {
+			markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+			nMsg.ReplyMarkup = &markup
+		}
+		t.out <- nMsg
+
+		return
+	}
+
+	nMsg := tgbotapi.NewMessage(m.ChatID, b.String())
+	if len(rows) > 0 {
+		nMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	t.out <- nMsg
+}
+
+// NotifyAlert сообщение о сработавшем алерте
+func (t *TelegramClient) NotifyAlert(alert PriceAlert, c models.Candle) {
+	level := c.High
+	if !alert.Above {
+		level = c.Low
+	}
+
+	spec := price.Lookup(c.Ticker)
+	t.out <- tgbotapi.NewMessage(alert.ChatID, fmt.Sprintf(
+		"🔔 %s: цена %s, последняя %s", alert, spec.Format(level), spec.Format(c.Close),
+	))
+}
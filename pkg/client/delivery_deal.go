@@ -0,0 +1,348 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"trading/pkg/models"
+	"trading/pkg/price"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// instrumentsPerRow кнопок инструментов в одном ряду
+const instrumentsPerRow = 3
+
+// instrumentsTTL сколько мастер использует полученный от брокера список инструментов
+const instrumentsTTL = 30 * time.Second
+
+const instrumentsKey = "instruments"
+
+// dealFields поля сделки в порядке шагов мастера, их названия и кнопки правки
+var dealFields = []struct {
+	step DealStep
+	name string
+}{
+	{StepSide, "Действие"},
+	{StepTicker, "Инструмент"},
+	{StepPrice, "Цена"},
+	{StepVolume, "Количество"},
+}
+
+// handleDealStart новое сообщение с мастером открытия позиции
+func (t *TelegramClient) handleDealStart(m models.Message) {
+	deal := t.Dealer.newDeal(messageUser(m))
+	text, markup := renderDeal(deal, nil, "")
+
+	nMsg := tgbotapi.NewMessage(m.ChatID, text)
+	nMsg.ParseMode = tgbotapi.ModeMarkdownV2
+	nMsg.ReplyMarkup = markup
+	t.out <- nMsg
+}
+
+// handleDeal кнопки под мастером:
+//
+//	deal select <value> - сторона сделки или инструмент
+//	deal back           - на шаг назад
+//	deal edit <step>    - с подтверждения к полю
+//	deal delete         - отменить сделку
+//	deal open           - отправить заявку брокеру
+func (t *TelegramClient) handleDeal(m models.Message, args []string) {
+	if len(args) == 0 {
+		t.out <- createErrorMessage(m.ChatID, ErrNoArguments)
+
+		return
+	}
+
+	switch args[0] {
+	case "open":
+		t.handleDealOpen(m)
+
+		return
+	case "delete":
+		if _, err := t.buttonDeal(m); err != nil {
+			t.out <- createErrorMessage(m.ChatID, err)
+
+			return
+		}
+
+		t.Dealer.deleteDeal(messageUser(m))
+		t.out <- tgbotapi.NewEditMessageText(m.ChatID, m.MessageID, "Открытие позиции отменено")
+
+		return
+	}
+
+	deal, err := t.buttonDeal(m)
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
+
+		return
+	}
+	deal.MsgID = m.MessageID
+
+	var value string
+	if len(args) > 1 {
+		value = args[1]
+	}
+
+	t.applyDealEvent(messageContext(m), messageUser(m), deal, DealEvent(args[0]), value)
+}
+
+// buttonDeal сделка нажавшего кнопку под мастером. Кнопки чужого мастера в группе
+// и другого своего мастера не трогают его сделку
+func (t *TelegramClient) buttonDeal(m models.Message) (Deal, error) {
+	deal, err := t.Dealer.getDeal(messageUser(m))
+	if err != nil {
+		return Deal{}, err
+	}
+
+	if deal.MsgID != 0 && deal.MsgID != m.MessageID {
+		return Deal{}, fmt.Errorf("сделка в другом сообщении: %w", ErrDealNotFound)
+	}
+
+	return deal, nil
+}
+
+// handleDealInput ввод цены или количества текстом, сообщение пользователя удаляется,
+// чтобы в чате оставался только мастер
+func (t *TelegramClient) handleDealInput(m models.Message) {
+	deal, err := t.Dealer.getDeal(messageUser(m))
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
+
+		return
+	}
+
+	t.applyDealEvent(messageContext(m), messageUser(m), deal, EventInput, strings.TrimSpace(m.Text))
+	t.out <- tgbotapi.NewDeleteMessage(m.ChatID, m.MessageID)
+}
+
+// applyDealEvent переводит мастер на следующий шаг и перерисовывает его,
+// ошибку ввода показывает в самом мастере
+func (t *TelegramClient) applyDealEvent(
+	ctx context.Context, user ChatUser, deal Deal, event DealEvent, value string,
+) {
+	chatID := user.ChatID
+	instruments, err := t.instruments(ctx)
+	if err != nil {
+		t.out <- createErrorMessage(chatID, err)
+
+		return
+	}
+
+	tickers := make([]string, 0, len(instruments))
+	for _, i := range instruments {
+		tickers = append(tickers, i.Ticker)
+	}
+
+	var note string
+	next, err := deal.Handle(event, value, tickers)
+	switch {
+	case errors.Is(err, ErrWrongDealInput):
+		note = "❗ " + err.Error()
+	case err != nil:
+		t.out <- createErrorMessage(chatID, err)
+
+		return
+	default:
+		deal = next
+		t.Dealer.saveDeal(user, deal)
+	}
+
+	if deal.MsgID == 0 {
+		return
+	}
+
+	text, markup := renderDeal(deal, instruments, note)
+	nMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, deal.MsgID, text, markup)
+	nMsg.ParseMode = tgbotapi.ModeMarkdownV2
+	t.out <- nMsg
+}
+
+// handleDealOpen отправляет заполненную сделку брокеру
+func (t *TelegramClient) handleDealOpen(m models.Message) {
+	acc, ok := t.account(m)
+	if !ok {
+		return
+	}
+
+	deal, err := t.buttonDeal(m)
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
+
+		return
+	}
+
+	if deal.Step != StepConfirm {
+		t.out <- createErrorMessage(m.ChatID, fmt.Errorf("%w: deal is not filled", ErrWrongTransition))
+
+		return
+	}
+
+	// повторное нажатие кнопки не выставит вторую заявку, а заявка после правки - новая
+	if deal.ClientOrderID == "" {
+		if deal.ClientOrderID, err = newClientOrderID(m.ChatID); err != nil {
+			t.out <- createErrorMessage(m.ChatID, err)
+
+			return
+		}
+		t.Dealer.saveDeal(messageUser(m), deal)
+	}
+
+	order, err := t.Client.Deal(messageContext(m), acc, models.Deal{
+		Ticker: deal.Ticker,
+		Type:   deal.Side,
+		Volume: deal.Volume,
+		Price:  deal.Price,
+
+		ClientOrderID: deal.ClientOrderID,
+	})
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
+
+		return
+	}
+
+	t.Dealer.deleteDeal(messageUser(m))
+
+	nMsg := tgbotapi.NewEditMessageText(m.ChatID, m.MessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2,
+		fmt.Sprintf("Заявка %d выставлена: %s %d по %s, статус %s",
+			order.ID, order.Ticker, order.Volume, price.Lookup(order.Ticker).Format(order.Price), order.Status),
+	))
+	nMsg.ParseMode = tgbotapi.ModeMarkdownV2
+	t.out <- nMsg
+}
+
+// instruments инструменты брокера для мастера, на каждое нажатие брокер не спрашивается
+func (t *TelegramClient) instruments(ctx context.Context) ([]models.Instrument, error) {
+	if val, ok := t.instrumentsCache.Get(instrumentsKey); ok {
+		if instruments, ok := val.([]models.Instrument); ok {
+			return instruments, nil
+		}
+	}
+
+	instruments, err := t.Client.Instruments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.instrumentsCache.Set(instrumentsKey, instruments, instrumentsTTL)
+
+	return instruments, nil
+}
+
+// newClientOrderID ID заявки из мастера, уникальный для каждой новой отправки
+func newClientOrderID(chatID int64) (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("cant generate client order id: %w", err)
+	}
+
+	return fmt.Sprintf("tg-%d-%s", chatID, hex.EncodeToString(raw)), nil
+}
+
+// renderDeal текст мастера с отметкой текущего шага и кнопки этого шага
+func renderDeal(deal Deal, instruments []models.Instrument, note string) (string, tgbotapi.InlineKeyboardMarkup) {
+	esc := func(format string, args ...interface{}) string {
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, fmt.Sprintf(format, args...))
+	}
+
+	var b strings.Builder
+	b.WriteString("__Открытие позиции__\n\n")
+
+	for _, f := range dealFields {
+		if f.step == deal.Step {
+			b.WriteString("\\> ")
+		}
+		b.WriteString(esc("%s: %s\n", f.name, dealValue(deal, f.step)))
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	switch deal.Step {
+	case StepSide:
+		b.WriteString("\n*Выберите действие*")
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Купить", "deal select "+models.DealBuy),
+			tgbotapi.NewInlineKeyboardButtonData("Продать", "deal select "+models.DealSell),
+		))
+	case StepTicker:
+		if len(instruments) == 0 {
+			b.WriteString(esc("\nБрокер сейчас не торгует ни одним инструментом"))
+		} else {
+			b.WriteString("\n*Выберите инструмент*")
+		}
+
+		var row []tgbotapi.InlineKeyboardButton
+		for _, i := range instruments {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(i.Ticker, "deal select "+i.Ticker))
+			if len(row) == instrumentsPerRow {
+				rows = append(rows, row)
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	case StepPrice:
+		b.WriteString("\n*Введите цену:*")
+		for _, i := range instruments {
+			if i.Ticker == deal.Ticker && i.LastPrice > 0 {
+				b.WriteString(esc(" последняя %s, шаг %s", i.Spec().Format(i.LastPrice), i.Spec().Format(i.TickSize)))
+			}
+		}
+	case StepVolume:
+		b.WriteString("\n*Введите количество:*")
+	case StepConfirm:
+		b.WriteString("\n*Проверьте заявку*")
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🆗 Открыть", "deal open"),
+		))
+
+		var edit []tgbotapi.InlineKeyboardButton
+		for _, f := range dealFields {
+			edit = append(edit, tgbotapi.NewInlineKeyboardButtonData("✏️ "+f.name, "deal edit "+string(f.step)))
+		}
+		rows = append(rows, edit[:2], edit[2:])
+	}
+
+	if note != "" {
+		b.WriteString(esc("\n\n%s", note))
+	}
+
+	nav := tgbotapi.NewInlineKeyboardRow()
+	if dealSteps[deal.Step].prev != "" {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "deal back"))
+	}
+	nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("❌ Отменить", "deal delete"))
+	rows = append(rows, nav)
+
+	return b.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// dealValue значение поля для показа, пусто если поле ещё не заполнено
+func dealValue(deal Deal, step DealStep) string {
+	if !deal.filled(step) {
+		return ""
+	}
+
+	switch step {
+	case StepSide:
+		if deal.Side == models.DealBuy {
+			return "покупка"
+		}
+
+		return "продажа"
+	case StepTicker:
+		return deal.Ticker
+	case StepPrice:
+		return price.Lookup(deal.Ticker).Format(deal.Price)
+	case StepVolume:
+		return fmt.Sprint(deal.Volume)
+	}
+
+	return ""
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+)
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>Вход в брокера</title></head>
+<body>
+{{if .Done}}
+	<p>Вы вошли как {{.Login}}, можно вернуться в телеграм.</p>
+{{else if .Expired}}
+	<p>Ссылка на вход устарела, запросите новую командой /login в боте.</p>
+{{else}}
+	<form method="post">
+		<input type="hidden" name="nonce" value="{{.Nonce}}">
+		<p><label>Логин <input name="login" value="{{.Login}}" required></label></p>
+		<p><label>Пароль <input name="password" type="password" required></label></p>
+		{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+		<p><button type="submit">Войти</button></p>
+	</form>
+{{end}}
+</body>
+</html>
+`))
+
+type loginView struct {
+	Nonce, Login, Error string
+	Done, Expired       bool
+}
+
+// LoginHandler страница входа по одноразовой ссылке из бота
+type LoginHandler struct {
+	auth *Auth
+	out  chan<- tgbotapi.Chattable
+}
+
+func NewLoginHandler(auth *Auth, out chan<- tgbotapi.Chattable) *LoginHandler {
+	return &LoginHandler{auth: auth, out: out}
+}
+
+func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		view := loginView{Nonce: r.URL.Query().Get("nonce")}
+		if _, err := h.auth.CheckLogin(view.Nonce); err != nil {
+			view.Expired = true
+		}
+
+		h.render(w, view)
+	case http.MethodPost:
+		h.login(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *LoginHandler) login(w http.ResponseWriter, r *http.Request) {
+	view := loginView{Nonce: r.PostFormValue("nonce"), Login: r.PostFormValue("login")}
+
+	chatID, acc, err := h.auth.CompleteLogin(r.Context(), view.Nonce, view.Login, r.PostFormValue("password"))
+	switch {
+	case errors.Is(err, ErrLoginExpired):
+		view.Expired = true
+	case errors.Is(err, ErrUnauthorized):
+		view.Error = "Неверный логин или пароль"
+	case err != nil:
+		log.Ctx(r.Context()).Err(err).Msg("Failed to login")
+		view.Error = "Брокер недоступен, попробуйте позже"
+	default:
+		view.Done = true
+		h.out <- tgbotapi.NewMessage(chatID, "Вы вошли в брокера как "+acc.Login)
+	}
+
+	h.render(w, view)
+}
+
+func (h *LoginHandler) render(w http.ResponseWriter, view loginView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := loginPage.Execute(w, view); err != nil {
+		log.Err(err).Msg("Failed to render login page")
+	}
+}
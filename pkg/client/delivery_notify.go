@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"trading/pkg/models"
+	"trading/pkg/price"
+	"trading/pkg/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// NotifyOrder сообщение чату об исполнении, снятии или отклонении его заявки
+func (t *TelegramClient) NotifyOrder(chatID int64, u OrderUpdate) {
+	log.Info().Str(tracing.LogField, u.CorrelationID).Msgf("notify chat %d: order %d is %s", chatID, u.Order.ID, u.Order.Status)
+	t.out <- tgbotapi.NewMessage(chatID, formatOrderUpdate(u))
+}
+
+func formatOrderUpdate(u OrderUpdate) string {
+	o := u.Order
+	spec := price.Lookup(o.Ticker)
+
+	side := "покупка"
+	if !o.IsBuy {
+		side = "продажа"
+	}
+	order := fmt.Sprintf("Заявка #%d %s %s %d по %s", o.ID, o.Ticker, side, o.Volume, spec.Format(o.Price))
+
+	switch o.Status {
+	case models.OrderFilled:
+		return fmt.Sprintf("✅ %s исполнена: %d по %s", order, u.FillVolume, spec.Format(u.FillPrice))
+	case models.OrderPartial:
+		return fmt.Sprintf("◐ %s исполнена частично: %d по %s, осталось %d",
+			order, u.FillVolume, spec.Format(u.FillPrice), o.Volume-o.Filled)
+	case models.OrderCancelled:
+		text := fmt.Sprintf("🚫 %s снята", order)
+		if o.Filled > 0 {
+			text += fmt.Sprintf(", исполнено %d", o.Filled)
+		}
+
+		return withReason(text, u.Reason)
+	case models.OrderRejected:
+		return withReason(fmt.Sprintf("❌ %s отклонена", order), u.Reason)
+	}
+
+	return fmt.Sprintf("%s: %s", order, o.Status)
+}
+
+func withReason(text, reason string) string {
+	if reason == "" {
+		return text
+	}
+
+	return text + ": " + reason
+}
+
+// statusNames состояние заявки для пользователя
+var statusNames = map[models.OrderStatus]string{
+	models.OrderNew:       "ещё не дошла до биржи",
+	models.OrderPlaced:    "выставлена",
+	models.OrderPartial:   "исполнена частично",
+	models.OrderFilled:    "исполнена",
+	models.OrderCancelled: "снята",
+	models.OrderRejected:  "отклонена",
+}
+
+// cancelOrder снимает заявку и описывает результат, ok - заявка снята. Если снять
+// не вышло, в тексте настоящее состояние заявки, а не ответ на снятие
+func cancelOrder(ctx context.Context, c IClient, acc Account, orderID int64) (text string, ok bool) {
+	resp, err := c.Cancel(ctx, acc, models.CancelRequest{ID: orderID})
+	if err == nil && resp.Body.Status == models.OrderCancelled {
+		return fmt.Sprintf("Заявка %d снята", orderID), true
+	}
+
+	if err != nil && !errors.Is(err, ErrConflict) {
+		return fmt.Sprintf("Заявку %d снять не удалось: %v", orderID, err), false
+	}
+
+	// биржа уже исполнила заявку или исполняет прямо сейчас
+	order, err := c.Order(ctx, acc, orderID, "")
+	if err != nil {
+		return fmt.Sprintf("Заявку %d снять не удалось: %v", orderID, err), false
+	}
+	if order.Status.IsOpen() {
+		return fmt.Sprintf("Заявку %d снять не удалось: биржа её уже исполняет, исполнено %d из %d",
+			orderID, order.Filled, order.Volume), false
+	}
+
+	return fmt.Sprintf("Заявку %d снять нельзя: она уже %s", orderID, statusNames[order.Status]), false
+}
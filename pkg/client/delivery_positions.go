@@ -0,0 +1,153 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"trading/pkg/models"
+	"trading/pkg/price"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleMyPositions экран "Мои позиции": новое сообщение по кнопке из меню,
+// обновление того же сообщения по кнопке "Обновить"
+func (t *TelegramClient) handleMyPositions(m models.Message, edit bool) {
+	acc, ok := t.account(m)
+	if !ok {
+		return
+	}
+
+	t.sendPositions(m, acc, edit, "")
+}
+
+// handleCancelOrder снимает заявку по кнопке под экраном позиций и перерисовывает экран
+func (t *TelegramClient) handleCancelOrder(m models.Message, args []string) {
+	if len(args) == 0 {
+		t.out <- createErrorMessage(m.ChatID, ErrNoArguments)
+
+		return
+	}
+
+	orderID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, fmt.Errorf("cant parse order id: %w", err))
+
+		return
+	}
+
+	acc, ok := t.account(m)
+	if !ok {
+		return
+	}
+
+	note, ok := cancelOrder(messageContext(m), t.Client, acc, orderID)
+	if ok {
+		note = "✅ " + note
+	} else {
+		note = "❗ " + note
+	}
+
+	t.sendPositions(m, acc, true, note)
+}
+
+func (t *TelegramClient) sendPositions(m models.Message, acc Account, edit bool, note string) {
+	status, err := t.Client.Status(messageContext(m), acc)
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
+
+		return
+	}
+
+	text, markup := renderPositions(status, note)
+
+	if edit {
+		nMsg := tgbotapi.NewEditMessageTextAndMarkup(m.ChatID, m.MessageID, text, markup)
+		nMsg.ParseMode = tgbotapi.ModeMarkdownV2
+		t.out <- nMsg
+
+		return
+	}
+
+	nMsg := tgbotapi.NewMessage(m.ChatID, text)
+	nMsg.ParseMode = tgbotapi.ModeMarkdownV2
+	nMsg.ReplyMarkup = markup
+	t.out <- nMsg
+}
+
+// renderPositions текст экрана позиций и кнопки снятия открытых заявок
+func renderPositions(status models.Status, note string) (string, tgbotapi.InlineKeyboardMarkup) {
+	esc := func(format string, args ...interface{}) string {
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, fmt.Sprintf(format, args...))
+	}
+
+	var b strings.Builder
+	b.WriteString("*Мои позиции*\n\n")
+
+	if note != "" {
+		b.WriteString(esc("%s\n\n", note))
+	}
+
+	body := status.Body
+	b.WriteString(esc("Баланс: %s\n", price.FormatMoney(body.Balance)))
+	b.WriteString(esc("PnL (%s): реализованный %s, нереализованный %s\n\n",
+		body.PnLMethod, formatPnL(body.RealizedPnL), formatPnL(body.UnrealizedPnL)))
+
+	positions := 0
+	for _, p := range body.Positions {
+		if p.Volume == 0 && p.RealizedPnL == 0 {
+			continue
+		}
+
+		if positions == 0 {
+			b.WriteString("__Позиции__\n")
+		}
+		positions++
+
+		spec := price.Lookup(p.Ticker)
+		b.WriteString(esc("%s: %d шт, средняя %.*f, цена %s, PnL %s / %s\n",
+			p.Ticker, p.Volume, spec.Scale+1, spec.Float(p.AvgPrice), spec.Format(p.MarkPrice),
+			formatPnL(p.RealizedPnL), formatPnL(p.UnrealizedPnL)))
+	}
+	if positions == 0 {
+		b.WriteString("Позиций нет\n")
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	b.WriteString("\n")
+	if len(body.OpenOrders) == 0 {
+		b.WriteString("Открытых заявок нет\n")
+	} else {
+		b.WriteString("__Открытые заявки__\n")
+	}
+
+	for _, o := range body.OpenOrders {
+		side := "покупка"
+		if !o.IsBuy {
+			side = "продажа"
+		}
+
+		b.WriteString(esc("#%d %s %s %d/%d по %s, %s\n",
+			o.ID, o.Ticker, side, o.Filled, o.Volume, price.Lookup(o.Ticker).Format(o.Price), o.Status))
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("❌ Снять #%d %s", o.ID, o.Ticker), fmt.Sprintf("cancel %d", o.ID),
+			),
+		))
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔄 Обновить", "myPositions refresh"),
+		tgbotapi.NewInlineKeyboardButtonData("🏠 Меню", "home"),
+	))
+
+	return b.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// formatPnL PnL в копейках (дробных после усреднения) в рублях
+func formatPnL(kopecks float64) string {
+	return price.FormatMoney(int64(math.Round(kopecks)))
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"trading/pkg/chart"
+	"trading/pkg/models"
+	"trading/pkg/price"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// timeframes интервалы свечей на графике, секунды
+var timeframes = []struct {
+	seconds int64
+	name    string
+}{
+	{1, "1с"},
+	{5, "5с"},
+	{15, "15с"},
+	{60, "1м"},
+}
+
+var ErrWrongTimeframe = errors.New("unknown timeframe")
+
+const chartWidth, chartHeight = 800, 480
+
+// chartCandles сколько свечей на графике, столько истории запрашивается у брокера
+const chartCandles = 60
+
+func isTimeframe(seconds int64) bool {
+	for _, tf := range timeframes {
+		if tf.seconds == seconds {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handlePrices график цен: без аргументов - новое сообщение с первым инструментом брокера,
+// "prices <ticker> <seconds>" с кнопок под графиком - замена картинки в том же сообщении
+func (t *TelegramClient) handlePrices(m models.Message, args []string) {
+	instruments, err := t.Client.Instruments(messageContext(m))
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
+
+		return
+	}
+
+	ticker, seconds, edit := "", timeframes[0].seconds, len(args) == 2
+	if len(instruments) > 0 {
+		ticker = instruments[0].Ticker
+	}
+	if edit {
+		ticker = args[0]
+		if seconds, err = strconv.ParseInt(args[1], 10, 64); err != nil || !isTimeframe(seconds) {
+			t.out <- createErrorMessage(m.ChatID, fmt.Errorf("%w: %q", ErrWrongTimeframe, args[1]))
+
+			return
+		}
+	}
+
+	markup := pricesMarkup(instruments, ticker, seconds)
+	switch {
+	case len(instruments) == 0:
+		t.pricesNote(m, edit, "Брокер сейчас не торгует ни одним инструментом", nil)
+
+		return
+	case !hasInstrument(instruments, ticker):
+		t.pricesNote(m, edit, "Брокер сейчас не торгует "+ticker, &markup)
+
+		return
+	}
+
+	candles, err := t.Client.History(messageContext(m), ticker, seconds*chartCandles)
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
+
+		return
+	}
+
+	var png bytes.Buffer
+	err = chart.Candles(&png, chart.Aggregate(candles, seconds), chartWidth, chartHeight)
+	if errors.Is(err, chart.ErrNoCandles) {
+		t.pricesNote(m, edit, "Нет цен по "+ticker, &markup)
+
+		return
+	}
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
+
+		return
+	}
+
+	caption := fmt.Sprintf("%s, последняя цена %s", ticker, price.Lookup(ticker).Format(candles[len(candles)-1].Close))
+	file := tgbotapi.FileBytes{Name: "chart.png", Bytes: png.Bytes()}
+
+	if edit {
+		media := tgbotapi.NewInputMediaPhoto(file)
+		media.Caption = caption
+
+		t.out <- tgbotapi.EditMessageMediaConfig{
+			BaseEdit: tgbotapi.BaseEdit{ChatID: m.ChatID, MessageID: m.MessageID, ReplyMarkup: &markup},
+			Media:    media,
+		}
+
+		return
+	}
+
+	photo := tgbotapi.NewPhoto(m.ChatID, file)
+	photo.Caption = caption
+	photo.ReplyMarkup = markup
+	t.out <- photo
+}
+
+// pricesNote текст вместо графика. С кнопок под графиком меняется подпись к прежней
+// картинке, а не приходит новое сообщение
+func (t *TelegramClient) pricesNote(m models.Message, edit bool, text string, markup *tgbotapi.InlineKeyboardMarkup) {
+	if edit {
+		nMsg := tgbotapi.NewEditMessageCaption(m.ChatID, m.MessageID, text)
+		nMsg.ReplyMarkup = markup
+		t.out <- nMsg
+
+		return
+	}
+
+	nMsg := tgbotapi.NewMessage(m.ChatID, text)
+	if markup != nil {
+		nMsg.ReplyMarkup = *markup
+	}
+	t.out <- nMsg
+}
+
+func hasInstrument(instruments []models.Instrument, ticker string) bool {
+	for _, i := range instruments {
+		if i.Ticker == ticker {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pricesMarkup кнопки выбора инструмента и интервала, выбранные отмечены точкой
+func pricesMarkup(instruments []models.Instrument, ticker string, seconds int64) tgbotapi.InlineKeyboardMarkup {
+	mark := func(selected bool, name string) string {
+		if selected {
+			return "• " + name
+		}
+
+		return name
+	}
+
+	var tickerRow, tfRow []tgbotapi.InlineKeyboardButton
+	for _, i := range instruments {
+		tickerRow = append(tickerRow, tgbotapi.NewInlineKeyboardButtonData(
+			mark(i.Ticker == ticker, i.Ticker), fmt.Sprintf("prices %s %d", i.Ticker, seconds),
+		))
+	}
+
+	for _, tf := range timeframes {
+		tfRow = append(tfRow, tgbotapi.NewInlineKeyboardButtonData(
+			mark(tf.seconds == seconds, tf.name), fmt.Sprintf("prices %s %d", ticker, tf.seconds),
+		))
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(tickerRow, tfRow)
+}
@@ -0,0 +1,445 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// лимиты Bot API: около 30 сообщений в секунду всего, 1 в секунду в личный чат
+// и 20 в минуту в группу https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+const (
+	globalInterval  = time.Second / 30
+	privateInterval = time.Second
+	groupInterval   = time.Minute / 20
+)
+
+// повтор временных ошибок: сеть, 5xx. Задержка удваивается до maxRetryDelay
+const (
+	maxSendAttempts = 5
+	minRetryDelay   = 500 * time.Millisecond
+	maxRetryDelay   = 30 * time.Second
+)
+
+// senderWorkers сколько сообщений в разные чаты отправляется одновременно
+const senderWorkers = 4
+
+// maxChatQueue сколько сообщений ждёт отправки в один чат. Из переполненной
+// очереди вытесняется самое старое сообщение, правки одного сообщения схлопываются
+const maxChatQueue = 50
+
+// flushTimeout сколько при остановке ждать отправки уже принятых сообщений
+const (
+	flushTimeout = 5 * time.Second
+	flushPoll    = 50 * time.Millisecond
+)
+
+// BotAPI то, что нужно отправителю от бота, tgbotapi.BotAPI подходит
+type BotAPI interface {
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
+// editKey правка сообщения: более новая правка того же вида заменяет ещё не отправленную
+type editKey struct {
+	kind      string
+	messageID int
+}
+
+type outMessage struct {
+	msg      tgbotapi.Chattable
+	edit     *editKey
+	attempts int
+}
+
+// chatQueue очередь сообщений одного чата, сообщения чата уходят по одному и по порядку
+type chatQueue struct {
+	msgs []*outMessage
+	next time.Time // раньше этого времени в чат не пишем
+	busy bool      // сообщение чата сейчас отправляется
+}
+
+// Sender отправляет исходящие сообщения в телеграм с учётом общего лимита и лимита
+// на чат. Занятый чат не задерживает остальные, на 429 вся отправка ждёт retry_after
+type Sender struct {
+	bot BotAPI
+	now func() time.Time // часы, в тестах подменяются
+
+	mu          sync.Mutex
+	chats       map[int64]*chatQueue
+	globalNext  time.Time
+	pausedUntil time.Time // после 429 телеграм не примет сообщения ни в какой чат
+	wake        chan struct{}
+}
+
+func NewSender(bot BotAPI) *Sender {
+	return &Sender{
+		bot:   bot,
+		now:   time.Now,
+		chats: make(map[int64]*chatQueue),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Run читает сообщения из in и отправляет их, пока не закроется in или ctx.
+// Уже принятые сообщения после этого ещё flushTimeout дотправляются
+func (s *Sender) Run(ctx context.Context, in <-chan tgbotapi.Chattable) {
+	// у отправки свой контекст: при остановке очереди должны успеть уйти
+	workCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var wg sync.WaitGroup
+	for i := 0; i < senderWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(workCtx)
+		}()
+	}
+
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case msg, ok := <-in:
+			if !ok {
+				running = false
+
+				continue
+			}
+			s.enqueue(msg)
+		}
+	}
+
+	s.flush(in, flushTimeout)
+	stopWorkers()
+	wg.Wait()
+}
+
+// flush забирает из in то, что там уже лежит, и ждёт, пока очереди опустеют,
+// но не дольше timeout
+func (s *Sender) flush(in <-chan tgbotapi.Chattable, timeout time.Duration) {
+	for drained := false; !drained; {
+		select {
+		case msg, ok := <-in:
+			if !ok {
+				drained = true
+
+				continue
+			}
+			s.enqueue(msg)
+		default:
+			drained = true
+		}
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(flushPoll)
+	defer poll.Stop()
+
+	for s.pending() > 0 {
+		select {
+		case <-deadline.C:
+			log.Warn().Msgf("Sender stopped, %d messages not sent", s.pending())
+
+			return
+		case <-poll.C:
+		}
+	}
+}
+
+// pending сообщения в очередях и в отправке
+func (s *Sender) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, q := range s.chats {
+		n += len(q.msgs)
+		if q.busy {
+			n++
+		}
+	}
+
+	return n
+}
+
+// enqueue ставит сообщение в очередь чата. Правка сообщения, для которого в очереди
+// уже есть неотправленная правка того же вида, заменяет её на месте
+func (s *Sender) enqueue(msg tgbotapi.Chattable) {
+	chatID, edit := target(msg)
+
+	s.mu.Lock()
+	q, ok := s.chats[chatID]
+	if !ok {
+		q = &chatQueue{}
+		s.chats[chatID] = q
+	}
+
+	replaced := false
+	if edit != nil {
+		for _, m := range q.msgs {
+			if m.edit != nil && *m.edit == *edit {
+				m.msg, m.attempts = msg, 0
+				replaced = true
+
+				break
+			}
+		}
+	}
+	if !replaced {
+		if len(q.msgs) >= maxChatQueue {
+			q.msgs = q.msgs[1:]
+			outboundQueue.Dec()
+			sendErrors.WithLabelValues(sendOverflow).Inc()
+			log.Warn().Msgf("Chat %d queue is full, drop the oldest message", chatID)
+		}
+		q.msgs = append(q.msgs, &outMessage{msg: msg, edit: edit})
+		outboundQueue.Inc()
+	}
+	s.mu.Unlock()
+
+	s.signal()
+}
+
+func (s *Sender) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Sender) work(ctx context.Context) {
+	for {
+		chatID, m, wait := s.take(s.now())
+		if m == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+
+				return
+			case <-s.wake:
+			case <-timer.C:
+			}
+			timer.Stop()
+
+			continue
+		}
+
+		if err := s.waitGlobal(ctx); err != nil {
+			s.done(s.now(), chatID, m, err)
+
+			return
+		}
+
+		_, err := s.bot.Request(m.msg)
+		s.done(s.now(), chatID, m, err)
+	}
+}
+
+// take первое сообщение из чата, в который уже можно писать. Если таких нет -
+// через сколько появится
+func (s *Sender) take(now time.Time) (int64, *outMessage, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := time.Minute
+	var chatID int64
+	var ready *chatQueue
+
+	for id, q := range s.chats {
+		if q.busy {
+			continue
+		}
+
+		if len(q.msgs) == 0 {
+			if q.next.Before(now) {
+				delete(s.chats, id)
+			}
+
+			continue
+		}
+
+		if d := q.next.Sub(now); d > 0 {
+			if d < wait {
+				wait = d
+			}
+
+			continue
+		}
+
+		// дольше всех ждавший чат первый, чтобы один чат не занимал отправку
+		if ready == nil || q.next.Before(ready.next) {
+			chatID, ready = id, q
+		}
+	}
+
+	if ready == nil {
+		return 0, nil, wait
+	}
+
+	m := ready.msgs[0]
+	ready.msgs = ready.msgs[1:]
+	ready.busy = true
+	outboundQueue.Dec()
+
+	return chatID, m, 0
+}
+
+// waitGlobal занимает место в общем лимите и ждёт своей очереди. Если за время
+// ожидания телеграм ответил 429, место занимается заново после паузы
+func (s *Sender) waitGlobal(ctx context.Context) error {
+	for {
+		timer := time.NewTimer(s.reserve(s.now()))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if !s.paused(s.now()) {
+			return nil
+		}
+	}
+}
+
+// reserve место в общем лимите, через сколько по нему можно отправлять
+func (s *Sender) reserve(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at := s.globalNext
+	if at.Before(now) {
+		at = now
+	}
+	if at.Before(s.pausedUntil) {
+		at = s.pausedUntil
+	}
+	s.globalNext = at.Add(globalInterval)
+
+	return at.Sub(now)
+}
+
+func (s *Sender) paused(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return now.Before(s.pausedUntil)
+}
+
+// done итог отправки: следующее сообщение чата не раньше лимита, на 429 и временные
+// ошибки сообщение возвращается в начало очереди. 429 останавливает всю отправку
+func (s *Sender) done(now time.Time, chatID int64, m *outMessage, err error) {
+	s.mu.Lock()
+	defer s.signal()
+	defer s.mu.Unlock()
+
+	q := s.chats[chatID]
+	q.busy = false
+	q.next = now.Add(chatInterval(chatID))
+
+	retry, delay := retryAfter(err, m.attempts)
+	if until := now.Add(delay); tooManyRequests(err) && until.After(s.pausedUntil) {
+		s.pausedUntil = until
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		// отправитель останавливается, сообщение не отправлено
+	case retry && m.attempts+1 < maxSendAttempts:
+		m.attempts++
+		q.msgs = append([]*outMessage{m}, q.msgs...)
+		q.next = now.Add(delay)
+		outboundQueue.Inc()
+		sendErrors.WithLabelValues(sendRetried).Inc()
+
+		log.Warn().Err(err).Msgf("Failed to send message to chat %d, retry in %v", chatID, delay)
+	default:
+		sendErrors.WithLabelValues(sendDropped).Inc()
+		log.Err(err).Msgf("Failed to send message to chat %d", chatID)
+	}
+}
+
+// chatInterval личные чаты положительные, группы отрицательные, 0 - запросы не в чат
+func chatInterval(chatID int64) time.Duration {
+	switch {
+	case chatID < 0:
+		return groupInterval
+	case chatID == 0:
+		return 0
+	}
+
+	return privateInterval
+}
+
+// retryAfter стоит ли повторять отправку и через сколько
+func retryAfter(err error, attempts int) (bool, time.Duration) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		switch {
+		case tgErr.Code == http.StatusTooManyRequests && tgErr.RetryAfter > 0:
+			return true, time.Duration(tgErr.RetryAfter) * time.Second
+		case tgErr.Code != http.StatusTooManyRequests && tgErr.Code < http.StatusInternalServerError:
+			// 400 и 403 не пройдут и со второго раза: сообщение не изменилось, бот заблокирован
+			return false, 0
+		}
+	}
+
+	delay := minRetryDelay << attempts
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+
+	return true, delay
+}
+
+func tooManyRequests(err error) bool {
+	var tgErr *tgbotapi.Error
+
+	return errors.As(err, &tgErr) && tgErr.Code == http.StatusTooManyRequests && tgErr.RetryAfter > 0
+}
+
+// target чат сообщения и, для правок, какое сообщение и как правится
+func target(msg tgbotapi.Chattable) (int64, *editKey) {
+	edit := func(kind string, base tgbotapi.BaseEdit) (int64, *editKey) {
+		if base.InlineMessageID != "" {
+			return base.ChatID, nil
+		}
+
+		return base.ChatID, &editKey{kind: kind, messageID: base.MessageID}
+	}
+
+	switch m := msg.(type) {
+	case tgbotapi.EditMessageTextConfig:
+		return edit("text", m.BaseEdit)
+	case tgbotapi.EditMessageCaptionConfig:
+		return edit("caption", m.BaseEdit)
+	case tgbotapi.EditMessageMediaConfig:
+		return edit("media", m.BaseEdit)
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return edit("markup", m.BaseEdit)
+	case tgbotapi.MessageConfig:
+		return m.ChatID, nil
+	case tgbotapi.PhotoConfig:
+		return m.ChatID, nil
+	case tgbotapi.DocumentConfig:
+		return m.ChatID, nil
+	case tgbotapi.DeleteMessageConfig:
+		return m.ChatID, nil
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var senderStart = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+// sendNext берёт следующее сообщение в момент now и сразу завершает его отправку с err
+func sendNext(t *testing.T, s *Sender, now time.Time, err error) (int64, tgbotapi.Chattable) {
+	t.Helper()
+
+	chatID, m, _ := s.take(now)
+	if m == nil {
+		return 0, nil
+	}
+	s.done(now, chatID, m, err)
+
+	return chatID, m.msg
+}
+
+func TestSenderChatLimits(t *testing.T) {
+	s := NewSender(nil)
+	s.enqueue(tgbotapi.NewMessage(1, "first"))
+	s.enqueue(tgbotapi.NewMessage(1, "second"))
+	s.enqueue(tgbotapi.NewMessage(-1, "group"))
+
+	// в разные чаты сразу, во второй раз в тот же чат - только через интервал
+	if chatID, _ := sendNext(t, s, senderStart, nil); chatID == 0 {
+		t.Fatal("nothing to send at start")
+	}
+	if chatID, _ := sendNext(t, s, senderStart, nil); chatID == 0 {
+		t.Fatal("other chat waits for busy one")
+	}
+	if _, m, wait := s.take(senderStart); m != nil || wait != privateInterval {
+		t.Fatalf("take before chat interval = %v, wait %v, want nothing for %v", m, wait, privateInterval)
+	}
+
+	chatID, msg := sendNext(t, s, senderStart.Add(privateInterval), nil)
+	if chatID != 1 || msg.(tgbotapi.MessageConfig).Text != "second" {
+		t.Errorf("after interval sent %v to chat %d, want second to chat 1", msg, chatID)
+	}
+
+	// группа пишет реже личного чата
+	s.enqueue(tgbotapi.NewMessage(-1, "group again"))
+	if _, m, _ := s.take(senderStart.Add(privateInterval)); m != nil {
+		t.Errorf("group message sent before group interval")
+	}
+	if chatID, _ := sendNext(t, s, senderStart.Add(groupInterval), nil); chatID != -1 {
+		t.Errorf("group message not sent after group interval")
+	}
+}
+
+func TestSenderGlobalLimit(t *testing.T) {
+	s := NewSender(nil)
+
+	for i := 0; i < 3; i++ {
+		if got, want := s.reserve(senderStart), time.Duration(i)*globalInterval; got != want {
+			t.Errorf("slot %d in %v, want %v", i, got, want)
+		}
+	}
+
+	// свободное время не копится: через секунду слот сразу
+	if got := s.reserve(senderStart.Add(time.Second)); got != 0 {
+		t.Errorf("slot after idle second in %v, want now", got)
+	}
+}
+
+func TestSenderRetryAfter(t *testing.T) {
+	s := NewSender(nil)
+	s.enqueue(tgbotapi.NewMessage(1, "limited"))
+	s.enqueue(tgbotapi.NewMessage(2, "other chat"))
+
+	tooMany := &tgbotapi.Error{Code: http.StatusTooManyRequests, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 3}}
+	chatID, m, _ := s.take(senderStart)
+	s.done(senderStart, chatID, m, tooMany)
+
+	// сообщение вернулось в начало очереди своего чата и ждёт retry_after
+	if next, _, _ := s.take(senderStart.Add(time.Second)); next == chatID {
+		t.Errorf("chat %d got a message before retry_after", chatID)
+	}
+	if q := s.chats[chatID]; len(q.msgs) != 1 || !q.next.Equal(senderStart.Add(3*time.Second)) {
+		t.Errorf("limited chat queue %d, next %v, want retry at +3s", len(q.msgs), q.next)
+	}
+
+	// и никакой чат не получает слот общего лимита раньше паузы
+	if got := s.reserve(senderStart.Add(time.Second)); got != 2*time.Second {
+		t.Errorf("global slot during pause in %v, want 2s", got)
+	}
+	if !s.paused(senderStart.Add(2*time.Second)) || s.paused(senderStart.Add(3*time.Second)) {
+		t.Error("pause must last exactly retry_after")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	network := errors.New("connection reset")
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+		retry    bool
+		delay    time.Duration
+	}{
+		{"sent", nil, 0, false, 0},
+		{"first network error", network, 0, true, minRetryDelay},
+		{"third network error", network, 2, true, 4 * minRetryDelay},
+		{"backoff is capped", network, 20, true, maxRetryDelay},
+		{"server error", &tgbotapi.Error{Code: http.StatusBadGateway}, 1, true, 2 * minRetryDelay},
+		{"bad request", &tgbotapi.Error{Code: http.StatusBadRequest}, 0, false, 0},
+		{"bot blocked", &tgbotapi.Error{Code: http.StatusForbidden}, 0, false, 0},
+		{
+			"too many requests",
+			&tgbotapi.Error{Code: http.StatusTooManyRequests, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}},
+			3, true, 7 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry, delay := retryAfter(tt.err, tt.attempts)
+			if retry != tt.retry || delay != tt.delay {
+				t.Errorf("retryAfter = %v, %v, want %v, %v", retry, delay, tt.retry, tt.delay)
+			}
+		})
+	}
+}
+
+func TestSenderDropsAfterAttempts(t *testing.T) {
+	s := NewSender(nil)
+	s.enqueue(tgbotapi.NewMessage(1, "unlucky"))
+
+	now := senderStart
+	for i := 0; i < maxSendAttempts; i++ {
+		chatID, m, wait := s.take(now)
+		if m == nil {
+			now = now.Add(wait)
+			chatID, m, _ = s.take(now)
+		}
+		if m == nil {
+			t.Fatalf("attempt %d: nothing to send", i+1)
+		}
+		s.done(now, chatID, m, errors.New("timeout"))
+	}
+
+	if n := s.pending(); n != 0 {
+		t.Errorf("pending after %d failed attempts = %d, want 0", maxSendAttempts, n)
+	}
+}
+
+func TestSenderCoalescesEdits(t *testing.T) {
+	s := NewSender(nil)
+	s.enqueue(tgbotapi.NewMessage(1, "chart"))
+	s.enqueue(tgbotapi.NewEditMessageText(1, 10, "v1"))
+	s.enqueue(tgbotapi.NewEditMessageText(1, 11, "other message"))
+	s.enqueue(tgbotapi.NewEditMessageCaption(1, 10, "caption"))
+	s.enqueue(tgbotapi.NewEditMessageText(1, 10, "v2"))
+
+	q := s.chats[1]
+	if len(q.msgs) != 4 {
+		t.Fatalf("queue length = %d, want 4", len(q.msgs))
+	}
+	if edit := q.msgs[1].msg.(tgbotapi.EditMessageTextConfig); edit.Text != "v2" {
+		t.Errorf("queued edit = %q, want the latest v2 in place of v1", edit.Text)
+	}
+}
+
+func TestSenderQueueCap(t *testing.T) {
+	s := NewSender(nil)
+	for i := 0; i < maxChatQueue+5; i++ {
+		s.enqueue(tgbotapi.NewMessage(1, string(rune('a'+i%26))))
+	}
+
+	q := s.chats[1]
+	if len(q.msgs) != maxChatQueue {
+		t.Fatalf("queue length = %d, want %d", len(q.msgs), maxChatQueue)
+	}
+	if first := q.msgs[0].msg.(tgbotapi.MessageConfig).Text; first != string(rune('a'+5)) {
+		t.Errorf("first queued = %q, want the oldest messages dropped", first)
+	}
+}
@@ -1,34 +1,46 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strconv"
 	"strings"
-	"time"
 	"trading/pkg/models"
+	"trading/pkg/tracing"
 
 	"github.com/akyoto/cache"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/rs/zerolog/log"
 )
 
-var ErrDealNowFound = fmt.Errorf("deal not found")
-var ErrActionNotFound = fmt.Errorf("action not found")
 var ErrCommandNotFound = fmt.Errorf("command not found")
 var ErrNoArguments = fmt.Errorf("arguments not found")
+var ErrLoginDisabled = fmt.Errorf("login url is not configured")
 
 // TelegramClient is client for telegram
 type TelegramClient struct {
 	Client IClient
+	Auth   *Auth
+	Alerts *Alerts
 	Dealer *Dealer
-	out    chan<- tgbotapi.Chattable
+	// LoginURL страница входа, к ней добавляется одноразовый код
+	LoginURL string
+	out      chan<- tgbotapi.Chattable
+
+	instrumentsCache *cache.Cache // инструменты брокера для мастера сделки
 }
 
-func NewTelegramClient(bClient IClient, out chan<- tgbotapi.Chattable) *TelegramClient {
+func NewTelegramClient(
+	bClient IClient, auth *Auth, alerts *Alerts, loginURL string, out chan<- tgbotapi.Chattable,
+) *TelegramClient {
 	return &TelegramClient{
-		Client: bClient,
-		Dealer: NewDealer(),
-		out:    out,
+		Client:   bClient,
+		Auth:     auth,
+		Alerts:   alerts,
+		Dealer:   NewDealer(),
+		LoginURL: loginURL,
+		out:      out,
+
+		instrumentsCache: cache.New(instrumentsTTL),
 	}
 }
 
@@ -48,6 +60,10 @@ func (t *TelegramClient) HandleCommand(m models.Message) {
 	}
 
 	switch cmd[0] {
+	case "start", "login":
+		t.handleLogin(m)
+	case "logout":
+		t.handleLogout(m)
 	case "home":
 		nMsg := tgbotapi.NewMessage(m.ChatID, "*Главное меню*")
 		nMsg.ParseMode = tgbotapi.ModeMarkdownV2
@@ -63,297 +79,85 @@ func (t *TelegramClient) HandleCommand(m models.Message) {
 
 		t.out <- nMsg
 	case "deal_start":
-		nMsg := tgbotapi.NewMessage(m.ChatID, "")
-		nMsg.ParseMode = tgbotapi.ModeMarkdownV2
-		newDeal := t.Dealer.newDeal(m.ChatID)
-		nMsg.Text = newDeal.Render()
-
-		initDealMenu := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Купить", "deal action buy"),
-				tgbotapi.NewInlineKeyboardButtonData("Продать", "deal action sell"),
-			),
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("❌ Отменить", "deal delete"),
-			),
-		)
-		nMsg.ReplyMarkup = &initDealMenu
-		t.out <- nMsg
+		t.handleDealStart(m)
 	case "deal":
-		if len(cmd) < 2 {
-			t.out <- createErrorMessage(m.ChatID, ErrNoArguments)
-
-			return
-		}
-
-		nMsg, err := t.Dealer.handleDeal(m.ChatID, m.MessageID, cmd[1:]...)
-		if err != nil {
-			t.out <- createErrorMessage(m.ChatID, err)
-
-			return
-		}
-		t.out <- nMsg
+		t.handleDeal(m, cmd[1:])
 	case "myPositions":
-		nMsg := tgbotapi.NewMessage(m.ChatID, "*Мои позиции*")
-		nMsg.ParseMode = tgbotapi.ModeMarkdownV2
-		t.out <- nMsg
+		t.handleMyPositions(m, len(cmd) > 1 && cmd[1] == "refresh")
+	case "cancel":
+		t.handleCancelOrder(m, cmd[1:])
 	case "prices":
-		t.handlePrices(m)
+		t.handlePrices(m, cmd[1:])
+	case "alert", "alerts":
+		t.handleAlert(m, cmd[1:])
 	}
 }
 
+// HandleUserInput текст от пользователя - ввод цены или количества в мастере сделки
 func (t *TelegramClient) HandleUserInput(m models.Message) {
-	// nMsg := tgbotapi.NewMessage(m.ChatID, "обработка пользовательского сообщения")
-	// nMsg.ParseMode = tgbotapi.ModeMarkdownV2
-	nMsg, err := t.Dealer.handleDeal(m.ChatID, m.MessageID, "userInput", m.Text)
-	if err != nil {
-		t.out <- createErrorMessage(m.ChatID, err)
-
-		return
-	}
-
-	t.out <- nMsg
-
-	// then delte user input message
-	dMsg := tgbotapi.NewDeleteMessage(m.ChatID, m.MessageID)
-	t.out <- dMsg
-}
-
-// handlers
-
-func (t *TelegramClient) handlePrices(m models.Message) {
-	t.Client.Status()
-
-	nMsg := tgbotapi.NewMessage(m.ChatID, "*Цены*")
-	nMsg.ParseMode = tgbotapi.ModeMarkdownV2
-	t.out <- nMsg
+	t.handleDealInput(m)
 }
 
-//// deal
-
-type Deal struct {
-	state string
-	msgID int
-
-	Action string
-	Tool   string
-	Price  int64
-	Volume int64
+// messageUser пользователь в чате, который написал сообщение или нажал кнопку
+func messageUser(m models.Message) ChatUser {
+	return ChatUser{ChatID: m.ChatID, UserID: m.UserID}
 }
 
-func (d Deal) Render() string {
-	sel := "\\> "
-	ren := []struct {
-		key   string
-		value string
-	}{
-		{"Header", "__Открытие позиции__\n\n"},
-		{"action", fmt.Sprintf("Действие: %s\n", d.Action)},
-		{"tool", fmt.Sprintf("Инструмент: %s\n", d.Tool)},
-		{"price", fmt.Sprintf("Цена: %d\n", d.Price)},
-		{"volume", fmt.Sprintf("Количество: %d\n", d.Volume)},
-	}
-
-	text := ""
-	for _, v := range ren {
-		if d.state == v.key {
-			text += sel + v.value
-			continue
-		}
-
-		text += v.value
-	}
-
-	return text
+// messageContext контекст обработки сообщения: его ID запроса и логгер с ним
+func messageContext(m models.Message) context.Context {
+	return tracing.WithID(context.Background(), m.CorrelationID)
 }
 
-// dealer
-
-type Dealer struct {
-	cache   *cache.Cache
-	expTime time.Duration
-	states  map[string]func(msg *tgbotapi.EditMessageTextConfig, deal *Deal, args ...string) error
-}
+// handlers
 
-func NewDealer() *Dealer {
-	const cacheTimeout = time.Minute * 5
+// account клиент брокера, к которому автор сообщения привязал чат, если он не входил -
+// предлагает войти. В группе каждый торгует только своим счётом
+func (t *TelegramClient) account(m models.Message) (Account, bool) {
+	acc, err := t.Auth.Account(messageContext(m), m.ChatID, m.UserID)
+	if errors.Is(err, ErrAccountNotFound) {
+		t.handleLogin(m)
 
-	d := &Dealer{
-		cache:   cache.New(cacheTimeout),
-		expTime: cacheTimeout,
+		return Account{}, false
 	}
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
 
-	deleteBtn := tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("❌ Отменить", "deal delete"),
-	)
-
-	d.states = map[string]func(msg *tgbotapi.EditMessageTextConfig, deal *Deal, args ...string) error{
-		"userInput": func(msg *tgbotapi.EditMessageTextConfig, deal *Deal, args ...string) error {
-			switch deal.state {
-			case "price":
-				price, err := strconv.Atoi(args[0])
-				if err != nil {
-					return fmt.Errorf("cant convert user input to price: %w", err)
-				}
-
-				deal.Price = int64(price)
-				deal.state = "volume"
-				backMenu := tgbotapi.NewInlineKeyboardMarkup(
-					deleteBtn,
-				)
-				msg.ReplyMarkup = &backMenu
-				msg.Text = deal.Render() + "\n\\> *Введите количество*:"
-
-				return nil
-
-			case "volume":
-				volume, err := strconv.Atoi(args[0])
-				if err != nil {
-					return fmt.Errorf("cant convert user input to volume: %w", err)
-				}
-
-				deal.Volume = int64(volume)
-				deal.state = "end"
-				msg.Text = deal.Render()
-
-				backMenu := tgbotapi.NewInlineKeyboardMarkup(
-					tgbotapi.NewInlineKeyboardRow(
-						tgbotapi.NewInlineKeyboardButtonData("🆗 Открыть", "deal open"),
-					),
-					deleteBtn,
-				)
-				msg.ReplyMarkup = &backMenu
-
-				return nil
-			}
-
-			msg.Text = deal.Render()
-
-			return nil
-		},
-		"action": func(msg *tgbotapi.EditMessageTextConfig, deal *Deal, args ...string) error {
-			deal.msgID = msg.MessageID
-
-			deal.Action = args[0]
-			switch args[0] {
-			case "buy":
-				deal.Action = "покупка"
-			case "sell":
-				deal.Action = "продажа"
-			default:
-				return fmt.Errorf("%w: %s", ErrActionNotFound, args[0])
-			}
-
-			deal.state = "tool"
-			msg.Text = deal.Render()
-
-			backMenu := tgbotapi.NewInlineKeyboardMarkup(
-				tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData("SPFB.RTS", "deal tool SPFBRTS"),
-					tgbotapi.NewInlineKeyboardButtonData("IMOEX", "deal tool IMOEX"),
-				),
-				deleteBtn,
-			)
-			msg.ReplyMarkup = &backMenu
-
-			return nil
-		},
-		"tool": func(msg *tgbotapi.EditMessageTextConfig, deal *Deal, args ...string) error {
-			log.Printf("args: %v", args)
-
-			switch args[0] {
-			case "SPFBRTS":
-				deal.Tool = "SPFB.RTS"
-			case "IMOEX":
-				deal.Tool = "IMOEX"
-			default:
-				return fmt.Errorf("%w: %s", ErrActionNotFound, args[0])
-			}
-
-			deal.Tool = args[0]
-			deal.state = "price"
-			msg.Text = deal.Render()
-			msg.Text += "\n\\> *Введите цену:*"
-
-			backMenu := tgbotapi.NewInlineKeyboardMarkup(deleteBtn)
-			msg.ReplyMarkup = &backMenu
-
-			return nil
-		},
-		"price": func(msg *tgbotapi.EditMessageTextConfig, deal *Deal, args ...string) error {
-			log.Printf("args: %v", args)
-
-			deal.Tool = args[0]
-			deal.state = "volume"
-			msg.Text = deal.Render()
-
-			backMenu := tgbotapi.NewInlineKeyboardMarkup(deleteBtn)
-			msg.ReplyMarkup = &backMenu
-
-			return nil
-		},
-		"volume": func(msg *tgbotapi.EditMessageTextConfig, deal *Deal, args ...string) error {
-			deal.Tool = args[0]
-			deal.state = "end"
-			msg.Text = deal.Render()
-
-			backMenu := tgbotapi.NewInlineKeyboardMarkup(
-				tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData("SPFB.RTS", "buy SPFBRTS"),
-					tgbotapi.NewInlineKeyboardButtonData("IMOEX", "buy IMOEX"),
-				),
-				deleteBtn,
-			)
-			msg.ReplyMarkup = &backMenu
-
-			return nil
-		},
-		"open": func(msg *tgbotapi.EditMessageTextConfig, deal *Deal, args ...string) error {
-			msg.Text = "Позиция открыта"
-
-			return nil
-		},
+		return Account{}, false
 	}
 
-	return d
+	return acc, true
 }
 
-func (d *Dealer) newDeal(chatID int64) Deal {
-	deal := Deal{state: "action"}
-	d.cache.Set(chatID, deal, d.expTime)
+// handleLogin ссылка на страницу входа в брокера
+func (t *TelegramClient) handleLogin(m models.Message) {
+	if t.LoginURL == "" {
+		t.out <- createErrorMessage(m.ChatID, ErrLoginDisabled)
 
-	return deal
-}
-
-func (d *Dealer) handleDeal(chatID int64, msgID int, args ...string) (tgbotapi.Chattable, error) {
-	val, ok := d.cache.Get(chatID)
-	if !ok {
-		return nil, fmt.Errorf("сделка не найдена: %w", ErrDealNowFound)
+		return
 	}
 
-	deal, ok := val.(Deal)
-	if !ok {
-		return nil, fmt.Errorf("сделка неправильный тип: %w", ErrDealNowFound)
-	}
+	nonce, err := t.Auth.StartLogin(m.ChatID, m.UserID)
+	if err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
 
-	f, ok := d.states[args[0]]
-	if !ok {
-		return nil, fmt.Errorf("ошибка %w, не найдено действие: %v", ErrActionNotFound, args[0])
+		return
 	}
 
-	msg := tgbotapi.NewEditMessageText(chatID, msgID, "")
-	if deal.msgID != 0 {
-		msg.MessageID = deal.msgID
-	}
+	nMsg := tgbotapi.NewMessage(m.ChatID, "Чтобы торговать, войдите в брокера. Ссылка действует 10 минут")
+	nMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("🔑 Войти", t.LoginURL+"?nonce="+nonce),
+		),
+	)
+	t.out <- nMsg
+}
 
-	log.Printf("msg: %v: %v", deal.msgID, msgID)
+func (t *TelegramClient) handleLogout(m models.Message) {
+	if err := t.Auth.Logout(messageContext(m), m.ChatID, m.UserID); err != nil {
+		t.out <- createErrorMessage(m.ChatID, err)
 
-	msg.ParseMode = tgbotapi.ModeMarkdownV2
-	if err := f(&msg, &deal, args[1:]...); err != nil {
-		return nil, fmt.Errorf("ошибка при обработке сделки: %w", err)
+		return
 	}
 
-	d.cache.Set(chatID, deal, d.expTime)
-
-	return msg, nil
+	t.out <- tgbotapi.NewMessage(m.ChatID, "Вы вышли из брокера")
 }
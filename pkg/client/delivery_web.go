@@ -0,0 +1,617 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"trading/pkg/chart"
+	"trading/pkg/models"
+	"trading/pkg/price"
+
+	"github.com/akyoto/cache"
+	"github.com/rs/zerolog/log"
+)
+
+// webPrefix терминал живёт под своим префиксом, корень занят вебхуком телеграма
+const webPrefix = "/terminal/"
+
+const (
+	sessionCookie = "terminal_session"
+	sessionTTL    = 12 * time.Hour
+	// eventsPing как часто слать комментарий в поток событий, чтобы прокси не рвали соединение
+	eventsPing = 15 * time.Second
+	// pricesRows сколько последних свечей показывать в таблице цен
+	pricesRows = 20
+)
+
+//go:embed web/*.html
+var webFS embed.FS
+
+var webFuncs = template.FuncMap{
+	"side": sideName,
+	"sign": func(v float64) string {
+		switch {
+		case v > 0:
+			return "up"
+		case v < 0:
+			return "down"
+		}
+
+		return ""
+	},
+	"price": func(ticker string, units int64) string {
+		return price.Lookup(ticker).Format(units)
+	},
+	"avgPrice": func(ticker string, units float64) string {
+		spec := price.Lookup(ticker)
+
+		return strconv.FormatFloat(spec.Float(units), 'f', spec.Scale+1, 64)
+	},
+	"money": price.FormatMoney,
+	"pnl":   formatPnL,
+	"clock": func(unix int64) string {
+		return time.Unix(unix, 0).Format("15:04:05")
+	},
+}
+
+// webPages страницы терминала: у каждой свой "content" внутри общего "layout"
+var webPages = func() map[string]*template.Template {
+	pages := make(map[string]*template.Template)
+	for _, name := range []string{"login", "dashboard", "order", "prices"} {
+		pages[name] = template.Must(
+			template.New(name).Funcs(webFuncs).ParseFS(webFS, "web/layout.html", "web/"+name+".html"),
+		)
+	}
+
+	return pages
+}()
+
+// webSession вход в терминал: клиент брокера и сообщение для следующей страницы
+type webSession struct {
+	mu    sync.Mutex
+	acc   Account
+	flash string
+}
+
+func (s *webSession) setFlash(format string, args ...interface{}) {
+	s.mu.Lock()
+	s.flash = fmt.Sprintf(format, args...)
+	s.mu.Unlock()
+}
+
+func (s *webSession) popFlash() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flash := s.flash
+	s.flash = ""
+
+	return flash
+}
+
+type pageView struct {
+	Title, Login, Flash, Error string
+	Data                       interface{}
+}
+
+type orderForm struct {
+	Instruments                                []models.Instrument
+	ClientOrderID, Ticker, Type, Price, Volume string
+}
+
+type timeframeView struct {
+	Seconds int64
+	Name    string
+}
+
+type pricesView struct {
+	Ticker      string
+	Seconds     int64
+	Instruments []models.Instrument
+	Timeframes  []timeframeView
+	Candles     []models.Candle // последние свечи, новые сверху
+}
+
+// WebHandler html терминал: счёт, заявки и цены в браузере, для тех, кто не пользуется
+// телеграмом. Живые обновления приходят через server-sent events из потоков брокера
+type WebHandler struct {
+	client   IClient
+	stream   *BrokerStream
+	sessions *cache.Cache
+	mux      *http.ServeMux
+	// closing закрывается в Shutdown, потоки событий отключаются и браузер переподключится
+	closing chan struct{}
+}
+
+func NewWebHandler(client IClient, stream *BrokerStream) *WebHandler {
+	h := &WebHandler{
+		client:   client,
+		stream:   stream,
+		sessions: cache.New(sessionTTL),
+		mux:      http.NewServeMux(),
+		closing:  make(chan struct{}),
+	}
+
+	h.mux.HandleFunc(webPrefix+"login", h.login)
+	h.mux.HandleFunc(webPrefix+"logout", h.logout)
+	h.mux.HandleFunc(webPrefix, h.withSession(h.dashboard))
+	h.mux.HandleFunc(webPrefix+"dashboard", h.withSession(h.dashboardFragment))
+	h.mux.HandleFunc(webPrefix+"order", h.withSession(h.order))
+	h.mux.HandleFunc(webPrefix+"cancel", h.withSession(h.cancel))
+	h.mux.HandleFunc(webPrefix+"prices", h.withSession(h.prices))
+	h.mux.HandleFunc(webPrefix+"chart.png", h.withSession(h.chart))
+	h.mux.HandleFunc(webPrefix+"events", h.withSession(h.events))
+
+	return h
+}
+
+func (h *WebHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+type sessionHandler func(w http.ResponseWriter, r *http.Request, s *webSession)
+
+// withSession пускает только вошедших, остальных отправляет на страницу входа
+func (h *WebHandler) withSession(next sessionHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s, ok := h.session(r); ok {
+			next(w, r, s)
+
+			return
+		}
+
+		h.toLogin(w, r)
+	}
+}
+
+// toLogin отправляет на страницу входа, а потоку событий и фрагменту, которые
+// страница запрашивает сама, отвечает 401
+func (h *WebHandler) toLogin(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == webPrefix+"events" || r.URL.Path == webPrefix+"dashboard" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	http.Redirect(w, r, webPrefix+"login", http.StatusSeeOther)
+}
+
+// sessionLifetime сессия живёт не дольше токена брокера
+func sessionLifetime(acc Account) time.Duration {
+	ttl := sessionTTL
+	if acc.ExpiresAt > 0 {
+		if left := time.Until(time.Unix(acc.ExpiresAt, 0)); left < ttl {
+			ttl = left
+		}
+	}
+
+	return ttl
+}
+
+func (h *WebHandler) session(r *http.Request) (*webSession, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, false
+	}
+
+	val, ok := h.sessions.Get(cookie.Value)
+	if !ok {
+		return nil, false
+	}
+
+	return val.(*webSession), true
+}
+
+func (h *WebHandler) login(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.render(w, "login", pageView{Title: "Вход"})
+	case http.MethodPost:
+		login := r.PostFormValue("login")
+
+		acc, err := h.client.Login(r.Context(), login, r.PostFormValue("password"))
+		if err != nil {
+			view := pageView{Title: "Вход", Error: "Брокер недоступен, попробуйте позже", Data: login}
+			if errors.Is(err, ErrUnauthorized) {
+				view.Error = "Неверный логин или пароль"
+			} else {
+				log.Ctx(r.Context()).Err(err).Msg("Failed to login to terminal")
+			}
+
+			w.WriteHeader(http.StatusUnauthorized)
+			h.render(w, "login", view)
+
+			return
+		}
+
+		id, err := newSessionID()
+		if err != nil {
+			h.fail(w, r, err)
+
+			return
+		}
+		ttl := sessionLifetime(acc)
+		h.sessions.Set(id, &webSession{acc: acc}, ttl)
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    id,
+			Path:     webPrefix,
+			MaxAge:   int(ttl.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			// формы терминала не отправятся с чужого сайта вместе с кукой
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, webPrefix, http.StatusSeeOther)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *WebHandler) logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		h.sessions.Delete(cookie.Value)
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: webPrefix, MaxAge: -1})
+	http.Redirect(w, r, webPrefix+"login", http.StatusSeeOther)
+}
+
+func (h *WebHandler) dashboard(w http.ResponseWriter, r *http.Request, s *webSession) {
+	// ServeMux отдаёт префиксу все неизвестные пути внутри терминала
+	if r.URL.Path != webPrefix {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	status, err := h.client.Status(r.Context(), s.acc)
+	if err != nil {
+		h.fail(w, r, err)
+
+		return
+	}
+
+	h.render(w, "dashboard", pageView{Title: "Счёт", Login: s.acc.Login, Flash: s.popFlash(), Data: status.Body})
+}
+
+// dashboardFragment только таблицы счёта, страница подменяет их после события по заявке
+func (h *WebHandler) dashboardFragment(w http.ResponseWriter, r *http.Request, s *webSession) {
+	status, err := h.client.Status(r.Context(), s.acc)
+	if err != nil {
+		h.fail(w, r, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err = webPages["dashboard"].ExecuteTemplate(w, "dashboard", status.Body); err != nil {
+		log.Ctx(r.Context()).Err(err).Msg("Failed to render dashboard")
+	}
+}
+
+func (h *WebHandler) order(w http.ResponseWriter, r *http.Request, s *webSession) {
+	instruments, err := h.client.Instruments(r.Context())
+	if err != nil {
+		h.fail(w, r, err)
+
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		coid, err := newSessionID()
+		if err != nil {
+			h.fail(w, r, err)
+
+			return
+		}
+
+		form := orderForm{Instruments: instruments, ClientOrderID: "web-" + coid, Type: models.DealBuy}
+		h.render(w, "order", pageView{Title: "Заявка", Login: s.acc.Login, Data: form})
+
+		return
+	}
+
+	form := orderForm{
+		Instruments:   instruments,
+		ClientOrderID: r.PostFormValue("client_order_id"),
+		Ticker:        r.PostFormValue("ticker"),
+		Type:          r.PostFormValue("type"),
+		Price:         r.PostFormValue("price"),
+		Volume:        r.PostFormValue("volume"),
+	}
+
+	order, err := h.placeOrder(r.Context(), s.acc, form)
+	if err != nil {
+		// отказ брокера окончательный, исправленная заявка - уже другая. Повторять
+		// с тем же ID имеет смысл, только если ответ не дошёл
+		if !errors.Is(err, ErrBrokerUnavailable) && !errors.Is(err, context.DeadlineExceeded) {
+			coid, cErr := newSessionID()
+			if cErr != nil {
+				h.fail(w, r, cErr)
+
+				return
+			}
+			form.ClientOrderID = "web-" + coid
+		}
+
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		h.render(w, "order", pageView{Title: "Заявка", Login: s.acc.Login, Error: err.Error(), Data: form})
+
+		return
+	}
+
+	s.setFlash("Заявка %d выставлена: %s %s %d по %s, статус %s", order.ID, order.Ticker,
+		sideName(order.IsBuy), order.Volume, price.Lookup(order.Ticker).Format(order.Price), order.Status)
+	http.Redirect(w, r, webPrefix, http.StatusSeeOther)
+}
+
+// placeOrder заявка из формы. ClientOrderID выдаётся вместе с формой, поэтому повторная
+// отправка той же формы не выставит вторую заявку
+func (h *WebHandler) placeOrder(ctx context.Context, acc Account, form orderForm) (models.Order, error) {
+	units, err := price.Lookup(form.Ticker).Parse(form.Price)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("неверная цена: %w", err)
+	}
+
+	volume, err := strconv.ParseInt(form.Volume, 10, 32)
+	if err != nil || volume <= 0 {
+		return models.Order{}, fmt.Errorf("количество должно быть положительным целым числом")
+	}
+
+	return h.client.Deal(ctx, acc, models.Deal{
+		Ticker:        form.Ticker,
+		Type:          form.Type,
+		Volume:        int32(volume),
+		Price:         units,
+		ClientOrderID: form.ClientOrderID,
+	})
+}
+
+func (h *WebHandler) cancel(w http.ResponseWriter, r *http.Request, s *webSession) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	orderID, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "wrong order id", http.StatusBadRequest)
+
+		return
+	}
+
+	text, _ := cancelOrder(r.Context(), h.client, s.acc, orderID)
+	s.setFlash("%s", text)
+
+	http.Redirect(w, r, webPrefix, http.StatusSeeOther)
+}
+
+func (h *WebHandler) prices(w http.ResponseWriter, r *http.Request, s *webSession) {
+	instruments, err := h.client.Instruments(r.Context())
+	if err != nil {
+		h.fail(w, r, err)
+
+		return
+	}
+
+	view := pricesView{Instruments: instruments}
+	for _, tf := range timeframes {
+		view.Timeframes = append(view.Timeframes, timeframeView{Seconds: tf.seconds, Name: tf.name})
+	}
+
+	view.Ticker, view.Seconds = pricesParams(r, instruments)
+	if view.Ticker != "" {
+		candles, err := h.client.History(r.Context(), view.Ticker, view.Seconds*chartCandles)
+		if err != nil {
+			h.fail(w, r, err)
+
+			return
+		}
+
+		candles = chart.Aggregate(candles, view.Seconds)
+		for i := len(candles) - 1; i >= 0 && len(view.Candles) < pricesRows; i-- {
+			view.Candles = append(view.Candles, candles[i])
+		}
+	}
+
+	h.render(w, "prices", pageView{Title: "Цены", Login: s.acc.Login, Data: view})
+}
+
+func (h *WebHandler) chart(w http.ResponseWriter, r *http.Request, _ *webSession) {
+	instruments, err := h.client.Instruments(r.Context())
+	if err != nil {
+		h.fail(w, r, err)
+
+		return
+	}
+
+	ticker, seconds := pricesParams(r, instruments)
+
+	candles, err := h.client.History(r.Context(), ticker, seconds*chartCandles)
+	if err != nil {
+		h.fail(w, r, err)
+
+		return
+	}
+
+	var png bytes.Buffer
+	err = chart.Candles(&png, chart.Aggregate(candles, seconds), chartWidth, chartHeight)
+	if errors.Is(err, chart.ErrNoCandles) {
+		http.NotFound(w, r)
+
+		return
+	}
+	if err != nil {
+		h.fail(w, r, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(png.Bytes())
+}
+
+// pricesParams инструмент и интервал из запроса, по умолчанию первый инструмент и первый интервал
+func pricesParams(r *http.Request, instruments []models.Instrument) (string, int64) {
+	seconds := timeframes[0].seconds
+	if tf, err := strconv.ParseInt(r.URL.Query().Get("tf"), 10, 64); err == nil && isTimeframe(tf) {
+		seconds = tf
+	}
+
+	ticker := r.URL.Query().Get("ticker")
+	if ticker == "" && len(instruments) > 0 {
+		ticker = instruments[0].Ticker
+	}
+
+	return ticker, seconds
+}
+
+type orderEventView struct {
+	ID     int64              `json:"id"`
+	Status models.OrderStatus `json:"status"`
+	Text   string             `json:"text"`
+}
+
+type quoteEventView struct {
+	Ticker string `json:"ticker"`
+	Time   int64  `json:"time"`
+	Close  string `json:"close"`
+}
+
+// events поток server-sent events: "order" - изменения заявок клиента, "quote" - новые цены
+func (h *WebHandler) events(w http.ResponseWriter, r *http.Request, s *webSession) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := r.Context()
+	orders := h.stream.Orders(ctx, s.acc)
+	quotes := h.stream.Quotes(ctx, nil)
+
+	ping := time.NewTicker(eventsPing)
+	defer ping.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.closing:
+			return
+		case <-ping.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case u, ok := <-orders:
+			if !ok {
+				return
+			}
+			err = writeEvent(w, "order", orderEventView{ID: u.Order.ID, Status: u.Order.Status, Text: formatOrderUpdate(u)})
+		case c, ok := <-quotes:
+			if !ok {
+				return
+			}
+			err = writeEvent(w, "quote", quoteEventView{Ticker: c.Ticker, Time: c.Time, Close: price.Lookup(c.Ticker).Format(c.Close)})
+		}
+
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// Shutdown закрывает потоки событий, http.Server.Shutdown не ждёт их до таймаута
+func (h *WebHandler) Shutdown() {
+	close(h.closing)
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("cant marshal %s event: %w", event, err)
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+
+	return err
+}
+
+func (h *WebHandler) render(w http.ResponseWriter, page string, view pageView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := webPages[page].ExecuteTemplate(w, "layout", view); err != nil {
+		log.Err(err).Msgf("Failed to render %s page", page)
+	}
+}
+
+// fail ошибка брокера вместо страницы, протухший токен - конец сессии и снова на вход
+func (h *WebHandler) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrUnauthorized) {
+		log.Ctx(r.Context()).Err(err).Msg("Terminal session expired")
+
+		if cookie, cErr := r.Cookie(sessionCookie); cErr == nil {
+			h.sessions.Delete(cookie.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: webPrefix, MaxAge: -1})
+		h.toLogin(w, r)
+
+		return
+	}
+
+	code := http.StatusBadGateway
+	switch {
+	case errors.Is(err, ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrBadRequest):
+		code = http.StatusBadRequest
+	}
+
+	log.Ctx(r.Context()).Err(err).Msg("Terminal request failed")
+	http.Error(w, err.Error(), code)
+}
+
+func sideName(isBuy bool) string {
+	if isBuy {
+		return "покупка"
+	}
+
+	return "продажа"
+}
+
+func newSessionID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("cant generate session id: %w", err)
+	}
+
+	return hex.EncodeToString(raw), nil
+}
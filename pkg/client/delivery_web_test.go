@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"trading/pkg/models"
+)
+
+// expiringClient брокер, который выдаёт токен на час и уже не принимает его в Status
+type expiringClient struct {
+	IClient
+}
+
+func (c *expiringClient) Login(ctx context.Context, login, password string) (Account, error) {
+	now := time.Now()
+
+	return Account{ClientID: 2, Login: login, Token: "t", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}, nil
+}
+
+func (c *expiringClient) Status(ctx context.Context, acc Account) (models.Status, error) {
+	return models.Status{}, &APIError{StatusCode: http.StatusUnauthorized, Message: "token expired"}
+}
+
+func TestWebSessionExpiresWithToken(t *testing.T) {
+	h := NewWebHandler(&expiringClient{}, nil)
+
+	form := url.Values{"login": {"Ivan"}, "password": {"qwerty"}}
+	req := httptest.NewRequest(http.MethodPost, webPrefix+"login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("login cookies = %v, want session cookie", cookies)
+	}
+	session := cookies[0]
+	if session.MaxAge > 3600 || session.MaxAge < 3500 {
+		t.Errorf("session max age = %d, want about an hour of token life", session.MaxAge)
+	}
+
+	get := func(path string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(session)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		return rec.Result()
+	}
+
+	// брокер не принял токен - сессия кончилась, страница отправляет на вход
+	resp := get(webPrefix)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != webPrefix+"login" {
+		t.Errorf("dashboard with expired token = %d to %q, want redirect to login", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if cookies := resp.Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("cookies = %v, want session cookie removed", cookies)
+	}
+
+	if resp = get(webPrefix + "dashboard"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("fragment after expired session = %d, want 401", resp.StatusCode)
+	}
+}
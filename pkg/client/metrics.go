@@ -0,0 +1,35 @@
+package client
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// итог неудачной отправки в client_send_errors_total
+const (
+	sendRetried  = "retried"
+	sendDropped  = "dropped"
+	sendOverflow = "overflow"
+)
+
+var (
+	outboundQueue = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "client_outbound_queue_depth",
+		Help: "Сообщения в очередях отправителя, ещё не ушедшие в телеграм.",
+	})
+
+	sendErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "client_send_errors_total",
+		Help: "Ошибки отправки в телеграм: retried - сообщение отправится снова, dropped - потеряно, overflow - вытеснено из переполненной очереди чата.",
+	}, []string{"result"})
+)
+
+// NewWizardSessionsCollector метрика client_wizard_sessions, регистрируется в main
+func NewWizardSessionsCollector(d *Dealer) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "client_wizard_sessions",
+		Help: "Незаконченные сделки в мастере открытия позиции, по одной на пользователя в чате.",
+	}, func() float64 {
+		return float64(d.Len())
+	})
+}
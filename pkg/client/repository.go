@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrAccountNotFound = errors.New("account not found")
+var ErrAlertNotFound = errors.New("alert not found")
+
+// IRepository хранилище клиента: привязка чатов телеграма к клиентам брокера и ценовые алерты
+type IRepository interface {
+	// Account клиент брокера, к которому пользователь userID привязал чат
+	Account(ctx context.Context, chatID, userID int64) (Account, error)
+	SaveAccount(ctx context.Context, chatID, userID int64, acc Account) error
+	DeleteAccount(ctx context.Context, chatID, userID int64) error
+	// Accounts все привязки: пользователь в чате -> клиент брокера
+	Accounts(ctx context.Context) (map[ChatUser]Account, error)
+
+	CreateAlert(ctx context.Context, alert PriceAlert) (int64, error)
+	// ArmAlert отмечает, что цена ушла на другую сторону уровня алерта
+	ArmAlert(ctx context.Context, alertID int64) error
+	// Alerts алерты пользователя в чате, AllAlerts - всех, для наблюдателя за ценами
+	Alerts(ctx context.Context, chatID, userID int64) ([]PriceAlert, error)
+	AllAlerts(ctx context.Context) ([]PriceAlert, error)
+	// DeleteAlert удаляет алерт пользователя в чате, ErrAlertNotFound если у него такого нет
+	DeleteAlert(ctx context.Context, chatID, userID, alertID int64) error
+
+	Close() error
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"trading/pkg/sqlite"
+)
+
+// migrations схема базы клиента, номер миграции - индекс в слайсе + 1
+var migrations = []string{
+	`CREATE TABLE accounts (
+		chat_id   INTEGER NOT NULL PRIMARY KEY,
+		user_id   INTEGER NOT NULL, -- пользователь телеграма, который вошёл
+		client_id INTEGER NOT NULL, -- клиент брокера
+		login     VARCHAR(300) NOT NULL,
+		token     VARCHAR(64) NOT NULL,
+		created   INTEGER NOT NULL
+	);`,
+
+	// ценовые алерты, срабатывают один раз и удаляются
+	`CREATE TABLE alerts (
+		id      INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		ticker  VARCHAR(300) NOT NULL,
+		above   INTEGER NOT NULL, -- 1 - цена поднялась до уровня, 0 - опустилась
+		price   INTEGER NOT NULL,
+		created INTEGER NOT NULL
+	);
+	CREATE INDEX alerts_chat_id ON alerts(chat_id);`,
+
+	// клиент брокера привязан к пользователю в чате, в группе каждый входит сам.
+	// Старые токены брокер выдавал без срока, считаем, что они действуют сутки
+	`CREATE TABLE accounts_v2 (
+		chat_id   INTEGER NOT NULL,
+		user_id   INTEGER NOT NULL,
+		client_id INTEGER NOT NULL,
+		login     VARCHAR(300) NOT NULL,
+		token     VARCHAR(64) NOT NULL,
+		created   INTEGER NOT NULL, -- когда выдан токен
+		expires   INTEGER NOT NULL, -- когда токен перестанет действовать
+		PRIMARY KEY (chat_id, user_id)
+	);
+	INSERT INTO accounts_v2 (chat_id, user_id, client_id, login, token, created, expires)
+		SELECT chat_id, user_id, client_id, login, token, created, created + 86400 FROM accounts;
+	DROP TABLE accounts;
+	ALTER TABLE accounts_v2 RENAME TO accounts;`,
+
+	// алерт срабатывает на пересечении уровня, старые алерты - на касании, как раньше
+	`ALTER TABLE alerts ADD COLUMN armed INTEGER NOT NULL DEFAULT 1;`,
+
+	// алерт принадлежит пользователю в чате, как и счёт. Старые алерты достаются
+	// тому, кто вошёл в чате, до привязки к пользователям он был один
+	`ALTER TABLE alerts ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0;
+	UPDATE alerts SET user_id = COALESCE((SELECT MIN(user_id) FROM accounts WHERE accounts.chat_id = alerts.chat_id), 0);
+	DROP INDEX alerts_chat_id;
+	CREATE INDEX alerts_chat_user ON alerts(chat_id, user_id);`,
+}
+
+// SQLiteRepository хранилище клиента во встроенной sqlite базе
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(ctx context.Context, path string) (*SQLiteRepository, error) {
+	db, err := sqlite.Open(ctx, path, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLiteRepository{db: db}, nil
+}
+
+func (r *SQLiteRepository) Close() error {
+	return r.db.Close()
+}
+
+const accountColumns = `client_id, login, token, created, expires`
+
+func (r *SQLiteRepository) Account(ctx context.Context, chatID, userID int64) (Account, error) {
+	var acc Account
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM accounts WHERE chat_id = ? AND user_id = ?`, chatID, userID,
+	).Scan(&acc.ClientID, &acc.Login, &acc.Token, &acc.IssuedAt, &acc.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Account{}, fmt.Errorf("%w: chat %d, user %d", ErrAccountNotFound, chatID, userID)
+	}
+	if err != nil {
+		return Account{}, fmt.Errorf("cant get account of chat %d: %w", chatID, err)
+	}
+
+	return acc, nil
+}
+
+func (r *SQLiteRepository) SaveAccount(ctx context.Context, chatID, userID int64, acc Account) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO accounts (chat_id, user_id, client_id, login, token, created, expires) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id, user_id) DO UPDATE SET
+			client_id = excluded.client_id, login = excluded.login, token = excluded.token,
+			created = excluded.created, expires = excluded.expires`,
+		chatID, userID, acc.ClientID, acc.Login, acc.Token, acc.IssuedAt, acc.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("cant save account of chat %d: %w", chatID, err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) DeleteAccount(ctx context.Context, chatID, userID int64) error {
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM accounts WHERE chat_id = ? AND user_id = ?`, chatID, userID,
+	); err != nil {
+		return fmt.Errorf("cant delete account of chat %d: %w", chatID, err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) Accounts(ctx context.Context) (map[ChatUser]Account, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT chat_id, user_id, `+accountColumns+` FROM accounts`)
+	if err != nil {
+		return nil, fmt.Errorf("cant get accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := make(map[ChatUser]Account)
+	for rows.Next() {
+		var user ChatUser
+		var acc Account
+		err = rows.Scan(&user.ChatID, &user.UserID, &acc.ClientID, &acc.Login, &acc.Token, &acc.IssuedAt, &acc.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("cant scan account: %w", err)
+		}
+		accounts[user] = acc
+	}
+
+	return accounts, rows.Err()
+}
+
+func (r *SQLiteRepository) CreateAlert(ctx context.Context, alert PriceAlert) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO alerts (chat_id, user_id, ticker, above, price, armed, created) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		alert.ChatID, alert.UserID, alert.Ticker, alert.Above, alert.Price, alert.Armed, time.Now().Unix(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("cant create alert: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("cant get alert id: %w", err)
+	}
+
+	return id, nil
+}
+
+func (r *SQLiteRepository) Alerts(ctx context.Context, chatID, userID int64) ([]PriceAlert, error) {
+	return r.queryAlerts(ctx, `SELECT `+alertColumns+` FROM alerts WHERE chat_id = ? AND user_id = ? ORDER BY id`, chatID, userID)
+}
+
+func (r *SQLiteRepository) AllAlerts(ctx context.Context) ([]PriceAlert, error) {
+	return r.queryAlerts(ctx, `SELECT `+alertColumns+` FROM alerts ORDER BY id`)
+}
+
+func (r *SQLiteRepository) ArmAlert(ctx context.Context, alertID int64) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE alerts SET armed = 1 WHERE id = ?`, alertID); err != nil {
+		return fmt.Errorf("cant arm alert %d: %w", alertID, err)
+	}
+
+	return nil
+}
+
+const alertColumns = `id, chat_id, user_id, ticker, above, price, armed`
+
+func (r *SQLiteRepository) queryAlerts(ctx context.Context, query string, args ...interface{}) ([]PriceAlert, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cant get alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []PriceAlert
+	for rows.Next() {
+		var a PriceAlert
+		if err = rows.Scan(&a.ID, &a.ChatID, &a.UserID, &a.Ticker, &a.Above, &a.Price, &a.Armed); err != nil {
+			return nil, fmt.Errorf("cant scan alert: %w", err)
+		}
+		alerts = append(alerts, a)
+	}
+
+	return alerts, rows.Err()
+}
+
+func (r *SQLiteRepository) DeleteAlert(ctx context.Context, chatID, userID, alertID int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM alerts WHERE id = ? AND chat_id = ? AND user_id = ?`, alertID, chatID, userID)
+	if err != nil {
+		return fmt.Errorf("cant delete alert %d: %w", alertID, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %d", ErrAlertNotFound, alertID)
+	}
+
+	return nil
+}
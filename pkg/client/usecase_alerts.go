@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"trading/pkg/models"
+	"trading/pkg/price"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrWrongAlert = errors.New("wrong alert")
+
+// PriceAlert уведомление в чат, когда цена инструмента пересечёт уровень. Алерт
+// принадлежит пользователю, который его поставил: в группе у каждого свои
+type PriceAlert struct {
+	ID, ChatID, UserID int64
+	Ticker             string
+	Above      bool // true - цена поднялась до Price или выше, false - опустилась
+	Price      int64
+	// Armed цена была по другую сторону уровня, следующее касание - пересечение.
+	// Алерт, поставленный, когда цена уже за уровнем, ждёт, пока она вернётся
+	Armed bool
+}
+
+func (a PriceAlert) String() string {
+	if a.Above {
+		return fmt.Sprintf("%s выше %s", a.Ticker, price.Lookup(a.Ticker).Format(a.Price))
+	}
+
+	return fmt.Sprintf("%s ниже %s", a.Ticker, price.Lookup(a.Ticker).Format(a.Price))
+}
+
+// triggered цена внутри свечи дошла до уровня
+func (a PriceAlert) triggered(c models.Candle) bool {
+	if a.Above {
+		return c.High >= a.Price
+	}
+
+	return c.Low <= a.Price
+}
+
+// before цена last по ту сторону уровня, откуда его надо пересечь
+func (a PriceAlert) before(last int64) bool {
+	if a.Above {
+		return last < a.Price
+	}
+
+	return last > a.Price
+}
+
+// ParseAlert алерт из аргументов команды: <ticker> above|below <price>. Инструмент
+// должен быть среди instruments брокера, по его последней цене алерт взводится
+func ParseAlert(chatID, userID int64, args []string, instruments []models.Instrument) (PriceAlert, error) {
+	if len(args) != 3 {
+		return PriceAlert{}, fmt.Errorf("%w: want <ticker> above|below <price>", ErrWrongAlert)
+	}
+
+	alert := PriceAlert{ChatID: chatID, UserID: userID, Ticker: strings.ToUpper(args[0])}
+
+	var last int64
+	found := false
+	for _, i := range instruments {
+		if i.Ticker == alert.Ticker {
+			last, found = i.LastPrice, true
+		}
+	}
+	if !found {
+		return PriceAlert{}, fmt.Errorf("%w: broker doesnt trade %s", ErrWrongAlert, alert.Ticker)
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "above":
+		alert.Above = true
+	case "below":
+	default:
+		return PriceAlert{}, fmt.Errorf("%w: %q, want above or below", ErrWrongAlert, args[1])
+	}
+
+	// уровень алерта не обязан лежать на сетке шага цены
+	level, err := price.Lookup(alert.Ticker).Units(args[2])
+	if err != nil || level <= 0 {
+		return PriceAlert{}, fmt.Errorf("%w: price %q", ErrWrongAlert, args[2])
+	}
+	alert.Price = level
+	// без последней цены алерт взведёт первая свеча
+	alert.Armed = last > 0 && alert.before(last)
+
+	return alert, nil
+}
+
+// Alerts ценовые алерты чатов. Активные алерты держатся в памяти,
+// чтобы не ходить в базу на каждую свечу
+type Alerts struct {
+	repo IRepository
+
+	mu     sync.Mutex
+	active map[string]map[int64]PriceAlert // ticker -> id -> алерт
+}
+
+func NewAlerts(ctx context.Context, repo IRepository) (*Alerts, error) {
+	alerts, err := repo.AllAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Alerts{repo: repo, active: make(map[string]map[int64]PriceAlert)}
+	for _, alert := range alerts {
+		a.add(alert)
+	}
+
+	return a, nil
+}
+
+func (a *Alerts) add(alert PriceAlert) {
+	if a.active[alert.Ticker] == nil {
+		a.active[alert.Ticker] = make(map[int64]PriceAlert)
+	}
+	a.active[alert.Ticker][alert.ID] = alert
+}
+
+func (a *Alerts) Create(ctx context.Context, alert PriceAlert) (PriceAlert, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id, err := a.repo.CreateAlert(ctx, alert)
+	if err != nil {
+		return PriceAlert{}, err
+	}
+	alert.ID = id
+	a.add(alert)
+
+	return alert, nil
+}
+
+func (a *Alerts) List(ctx context.Context, chatID, userID int64) ([]PriceAlert, error) {
+	return a.repo.Alerts(ctx, chatID, userID)
+}
+
+func (a *Alerts) Delete(ctx context.Context, chatID, userID, alertID int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.repo.DeleteAlert(ctx, chatID, userID, alertID); err != nil {
+		return err
+	}
+
+	for _, alerts := range a.active {
+		delete(alerts, alertID)
+	}
+
+	return nil
+}
+
+// Check алерты, сработавшие на свече. Сработавший алерт удаляется и больше не придёт.
+// Не взведённый алерт взводится, когда цена закрытия оказалась по другую сторону уровня
+func (a *Alerts) Check(ctx context.Context, c models.Candle) []PriceAlert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var fired []PriceAlert
+	for id, alert := range a.active[c.Ticker] {
+		if !alert.Armed {
+			if !alert.before(c.Close) {
+				continue
+			}
+
+			if err := a.repo.ArmAlert(ctx, id); err != nil {
+				log.Err(err).Msgf("cant arm alert %d", id)
+
+				continue
+			}
+			alert.Armed = true
+			a.active[c.Ticker][id] = alert
+
+			continue
+		}
+
+		if !alert.triggered(c) {
+			continue
+		}
+
+		err := a.repo.DeleteAlert(ctx, alert.ChatID, alert.UserID, id)
+		if err != nil && !errors.Is(err, ErrAlertNotFound) {
+			// не удалили - попробуем на следующей свече, чтобы не прислать дважды
+			log.Err(err).Msgf("cant delete fired alert %d", id)
+
+			continue
+		}
+
+		delete(a.active[c.Ticker], id)
+		if err == nil {
+			fired = append(fired, alert)
+		}
+	}
+
+	return fired
+}
+
+// Watch проверяет алерты на каждой свече из quotes, пока канал не закроется
+func (a *Alerts) Watch(ctx context.Context, quotes <-chan models.Candle, notify func(PriceAlert, models.Candle)) {
+	for c := range quotes {
+		for _, alert := range a.Check(ctx, c) {
+			notify(alert, c)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"trading/pkg/models"
+)
+
+func TestParseAlert(t *testing.T) {
+	instruments := []models.Instrument{{Ticker: "T", LastPrice: 10000}, {Ticker: "U"}}
+
+	tests := []struct {
+		name  string
+		args  []string
+		armed bool
+		err   error
+	}{
+		{"above from below", []string{"t", "above", "101"}, true, nil},
+		{"above when price is already above", []string{"T", "above", "99"}, false, nil},
+		{"below from above", []string{"T", "below", "99"}, true, nil},
+		{"no last price", []string{"U", "above", "1"}, false, nil},
+		{"unknown ticker", []string{"NOPE", "above", "1"}, false, ErrWrongAlert},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert, err := ParseAlert(1, 10, tt.args, instruments)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if alert.Armed != tt.armed {
+				t.Errorf("armed = %v, want %v", alert.Armed, tt.armed)
+			}
+		})
+	}
+}
+
+func TestAlertsFireOnCross(t *testing.T) {
+	ctx := context.Background()
+	repo, err := NewSQLiteRepository(ctx, filepath.Join(t.TempDir(), "client.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	alerts, err := NewAlerts(ctx, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// поставлен, когда цена уже выше уровня
+	if _, err = alerts.Create(ctx, PriceAlert{ChatID: 1, Ticker: "T", Above: true, Price: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	candles := []struct {
+		high, low, close int64
+		fired            int
+	}{
+		{120, 105, 110, 0}, // всё ещё выше - не пересечение
+		{110, 95, 98, 0},   // ушла под уровень - алерт взведён
+		{102, 97, 101, 1},  // пересекла снизу вверх
+	}
+	for i, c := range candles {
+		fired := alerts.Check(ctx, models.Candle{Ticker: "T", High: c.high, Low: c.low, Close: c.close})
+		if len(fired) != c.fired {
+			t.Errorf("candle %d fired %d alerts, want %d", i, len(fired), c.fired)
+		}
+
+		// взведённость переживает перезапуск
+		if i == 1 {
+			if alerts, err = NewAlerts(ctx, repo); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestAlertsPerUser(t *testing.T) {
+	ctx := context.Background()
+	repo, err := NewSQLiteRepository(ctx, filepath.Join(t.TempDir(), "client.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	alerts, err := NewAlerts(ctx, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// в группе у каждого участника свои алерты
+	own, err := alerts.Create(ctx, PriceAlert{ChatID: 1, UserID: 10, Ticker: "T", Above: true, Price: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = alerts.Create(ctx, PriceAlert{ChatID: 1, UserID: 11, Ticker: "T", Price: 90}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := alerts.List(ctx, 1, 10)
+	if err != nil || len(list) != 1 || list[0].ID != own.ID || list[0].UserID != 10 {
+		t.Errorf("List of user 10 = %+v, %v, want only alert %d", list, err, own.ID)
+	}
+
+	if err = alerts.Delete(ctx, 1, 11, own.ID); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("Delete of other user's alert = %v, want ErrAlertNotFound", err)
+	}
+	if err = alerts.Delete(ctx, 1, 10, own.ID); err != nil {
+		t.Errorf("Delete of own alert = %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/akyoto/cache"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrLoginExpired = errors.New("login link expired")
+
+// loginTTL сколько живёт ссылка на вход
+const loginTTL = 10 * time.Minute
+
+// ChatUser пользователь телеграма в чате. Клиент брокера привязан к нему, а не
+// ко всему чату: в группе каждый участник входит сам
+type ChatUser struct {
+	ChatID, UserID int64
+}
+
+// Auth вход в брокера из телеграма: бот выдаёт одноразовую ссылку, по ней
+// пользователь вводит логин и пароль брокера и привязывается в чате к клиенту
+type Auth struct {
+	client IClient
+	repo   IRepository
+	nonces *cache.Cache
+	// refreshing одна замена токена пользователя за раз, иначе вторая придёт со старым,
+	// уже отозванным. Другие пользователи друг друга не ждут
+	refreshMu  sync.Mutex
+	refreshing map[ChatUser]*userLock
+
+	// OnLogin вызывается после привязки к клиенту и после замены токена, OnLogout - после выхода
+	OnLogin  func(user ChatUser, acc Account)
+	OnLogout func(user ChatUser)
+}
+
+func NewAuth(client IClient, repo IRepository) *Auth {
+	return &Auth{
+		client: client,
+		repo:   repo,
+		nonces: cache.New(loginTTL),
+
+		refreshing: make(map[ChatUser]*userLock),
+	}
+}
+
+// userLock замок пользователя и сколько горутин его держат или ждут
+type userLock struct {
+	sync.Mutex
+	users int
+}
+
+// lockUser берёт замок пользователя, возвращает функцию, которая его отпускает.
+// Замок удаляется из refreshing, когда его больше никто не ждёт
+func (a *Auth) lockUser(user ChatUser) func() {
+	a.refreshMu.Lock()
+	l, ok := a.refreshing[user]
+	if !ok {
+		l = &userLock{}
+		a.refreshing[user] = l
+	}
+	l.users++
+	a.refreshMu.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		a.refreshMu.Lock()
+		if l.users--; l.users == 0 {
+			delete(a.refreshing, user)
+		}
+		a.refreshMu.Unlock()
+	}
+}
+
+// StartLogin одноразовый код для ссылки на вход
+func (a *Auth) StartLogin(chatID, userID int64) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("cant generate login nonce: %w", err)
+	}
+
+	nonce := hex.EncodeToString(raw)
+	a.nonces.Set(nonce, ChatUser{ChatID: chatID, UserID: userID}, loginTTL)
+
+	return nonce, nil
+}
+
+// CheckLogin чат, который запросил ссылку с этим кодом
+func (a *Auth) CheckLogin(nonce string) (int64, error) {
+	val, ok := a.nonces.Get(nonce)
+	if !ok {
+		return 0, ErrLoginExpired
+	}
+
+	return val.(ChatUser).ChatID, nil
+}
+
+// CompleteLogin входит в брокера и привязывает чат к клиенту, код больше не действует
+func (a *Auth) CompleteLogin(ctx context.Context, nonce, login, password string) (int64, Account, error) {
+	val, ok := a.nonces.Get(nonce)
+	if !ok {
+		return 0, Account{}, ErrLoginExpired
+	}
+	pending := val.(ChatUser)
+
+	acc, err := a.client.Login(ctx, login, password)
+	if err != nil {
+		return 0, Account{}, err
+	}
+
+	if err = a.repo.SaveAccount(ctx, pending.ChatID, pending.UserID, acc); err != nil {
+		return 0, Account{}, err
+	}
+	a.nonces.Delete(nonce)
+
+	if a.OnLogin != nil {
+		a.OnLogin(pending, acc)
+	}
+
+	return pending.ChatID, acc, nil
+}
+
+// Account клиент брокера, к которому пользователь userID привязал чат, ErrAccountNotFound
+// если он не входил или срок токена вышел. Когда прошла половина срока, токен меняется на новый
+func (a *Auth) Account(ctx context.Context, chatID, userID int64) (Account, error) {
+	defer a.lockUser(ChatUser{ChatID: chatID, UserID: userID})()
+
+	acc, err := a.repo.Account(ctx, chatID, userID)
+	if err != nil {
+		return Account{}, err
+	}
+
+	now := time.Now().Unix()
+	switch {
+	case acc.ExpiresAt == 0 || now < acc.IssuedAt+(acc.ExpiresAt-acc.IssuedAt)/2:
+		return acc, nil
+	case now >= acc.ExpiresAt:
+		if err = a.Logout(ctx, chatID, userID); err != nil {
+			return Account{}, err
+		}
+
+		return Account{}, fmt.Errorf("%w: token of chat %d expired", ErrAccountNotFound, chatID)
+	}
+
+	fresh, err := a.client.RefreshToken(ctx, acc)
+	if err != nil {
+		// старый токен ещё действует, заменим при следующей команде
+		log.Ctx(ctx).Err(err).Msgf("Failed to refresh token of chat %d", chatID)
+
+		return acc, nil
+	}
+
+	if err = a.repo.SaveAccount(ctx, chatID, userID, fresh); err != nil {
+		return Account{}, err
+	}
+
+	if a.OnLogin != nil {
+		a.OnLogin(ChatUser{ChatID: chatID, UserID: userID}, fresh)
+	}
+
+	return fresh, nil
+}
+
+func (a *Auth) Logout(ctx context.Context, chatID, userID int64) error {
+	if err := a.repo.DeleteAccount(ctx, chatID, userID); err != nil {
+		return err
+	}
+
+	if a.OnLogout != nil {
+		a.OnLogout(ChatUser{ChatID: chatID, UserID: userID})
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// refreshClient брокер, который на замену токена выдаёт "fresh" ещё на сутки
+type refreshClient struct {
+	IClient
+	refreshed int
+}
+
+func (c *refreshClient) RefreshToken(ctx context.Context, acc Account) (Account, error) {
+	c.refreshed++
+	acc.Token, acc.IssuedAt, acc.ExpiresAt = "fresh", time.Now().Unix(), time.Now().Add(24*time.Hour).Unix()
+
+	return acc, nil
+}
+
+func TestAuthAccount(t *testing.T) {
+	ctx := context.Background()
+	repo, err := NewSQLiteRepository(ctx, filepath.Join(t.TempDir(), "client.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	broker := &refreshClient{}
+	auth := NewAuth(broker, repo)
+	var logins, logouts []ChatUser
+	auth.OnLogin = func(user ChatUser, acc Account) { logins = append(logins, user) }
+	auth.OnLogout = func(user ChatUser) { logouts = append(logouts, user) }
+
+	now := time.Now()
+	save := func(chatID, userID int64, issued, expires time.Time) {
+		acc := Account{ClientID: 2, Login: "Ivan", Token: "old", IssuedAt: issued.Unix(), ExpiresAt: expires.Unix()}
+		if err := repo.SaveAccount(ctx, chatID, userID, acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// в группе счёт привязан к тому, кто вошёл, остальным нужно войти самим
+	save(1, 10, now, now.Add(24*time.Hour))
+	if acc, err := auth.Account(ctx, 1, 10); err != nil || acc.Token != "old" {
+		t.Errorf("Account of logged in user = %+v, %v", acc, err)
+	}
+	if _, err := auth.Account(ctx, 1, 11); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("Account of other group member = %v, want ErrAccountNotFound", err)
+	}
+
+	// на второй половине срока токен меняется
+	save(2, 20, now.Add(-13*time.Hour), now.Add(11*time.Hour))
+	acc, err := auth.Account(ctx, 2, 20)
+	if err != nil || acc.Token != "fresh" || broker.refreshed != 1 {
+		t.Errorf("Account with half expired token = %+v, %v, refreshed %d times", acc, err, broker.refreshed)
+	}
+	if acc, _ = repo.Account(ctx, 2, 20); acc.Token != "fresh" {
+		t.Errorf("saved token = %q, want fresh", acc.Token)
+	}
+	if len(logins) != 1 || logins[0] != (ChatUser{2, 20}) {
+		t.Errorf("OnLogin calls = %v, want resubscribe of chat 2", logins)
+	}
+
+	// истёкший токен - как будто не входил
+	save(3, 30, now.Add(-25*time.Hour), now.Add(-time.Hour))
+	if _, err = auth.Account(ctx, 3, 30); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("Account with expired token = %v, want ErrAccountNotFound", err)
+	}
+	if _, err = repo.Account(ctx, 3, 30); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("expired account is not deleted: %v", err)
+	}
+	if len(logouts) != 1 || logouts[0] != (ChatUser{3, 30}) {
+		t.Errorf("OnLogout calls = %v, want chat 3", logouts)
+	}
+}
+
+// slowRefreshClient брокер, у которого замена токена клиента slow ждёт release
+type slowRefreshClient struct {
+	refreshClient
+	started, release chan struct{}
+}
+
+func (c *slowRefreshClient) RefreshToken(ctx context.Context, acc Account) (Account, error) {
+	if acc.Login == "slow" {
+		close(c.started)
+		<-c.release
+	}
+	acc.Token = "fresh"
+
+	return acc, nil
+}
+
+func TestAuthRefreshPerUser(t *testing.T) {
+	ctx := context.Background()
+	repo, err := NewSQLiteRepository(ctx, filepath.Join(t.TempDir(), "client.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	broker := &slowRefreshClient{started: make(chan struct{}), release: make(chan struct{})}
+	auth := NewAuth(broker, repo)
+
+	now := time.Now()
+	for i, login := range []string{"slow", "fast"} {
+		acc := Account{ClientID: 2, Login: login, Token: "old", IssuedAt: now.Add(-13 * time.Hour).Unix(), ExpiresAt: now.Add(11 * time.Hour).Unix()}
+		if err := repo.SaveAccount(ctx, 1, int64(10+i), acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := auth.Account(ctx, 1, 10)
+		slow <- err
+	}()
+	<-broker.started
+
+	// замена токена одного участника группы не держит остальных
+	if acc, err := auth.Account(ctx, 1, 11); err != nil || acc.Token != "fresh" {
+		t.Errorf("Account while other user refreshes = %+v, %v", acc, err)
+	}
+
+	close(broker.release)
+	if err = <-slow; err != nil {
+		t.Error(err)
+	}
+	if len(auth.refreshing) != 0 {
+		t.Errorf("%d user locks left after refresh", len(auth.refreshing))
+	}
+}
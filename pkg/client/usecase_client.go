@@ -1,46 +1,258 @@
 package client
 
-import "trading/pkg/models"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"trading/pkg/models"
+	"trading/pkg/price"
+	"trading/pkg/tracing"
+)
+
+var ErrBadRequest = errors.New("bad request")
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrForbidden = errors.New("forbidden")
+var ErrNotFound = errors.New("not found")
+var ErrConflict = errors.New("conflict")
+var ErrRejected = errors.New("rejected by risk check")
+var ErrBrokerUnavailable = errors.New("broker unavailable")
 
 // IClient is broker client
 type IClient interface {
-	Status() (models.Status, error)
-	Deal() (models.Status, error)
-	Cancel() (models.Status, error)
-	History() (models.Status, error)
+	Login(ctx context.Context, login, password string) (Account, error)
+	// RefreshToken новый токен вместо acc.Token, старый брокер больше не принимает
+	RefreshToken(ctx context.Context, acc Account) (Account, error)
+	Status(ctx context.Context, acc Account) (models.Status, error)
+	Deal(ctx context.Context, acc Account, deal models.Deal) (models.Order, error)
+	Cancel(ctx context.Context, acc Account, req models.CancelRequest) (models.CancelResponse, error)
+	Order(ctx context.Context, acc Account, orderID int64, clientOrderID string) (models.Order, error)
+	// History свечи по инструменту за последние seconds секунд, 0 - сколько брокер отдаёт по умолчанию
+	History(ctx context.Context, ticker string, seconds int64) ([]models.Candle, error)
+	// Instruments инструменты, которыми торгует брокер
+	Instruments(ctx context.Context) ([]models.Instrument, error)
+}
+
+// Account клиент брокера, от имени которого делаются запросы
+type Account struct {
+	ClientID int64
+	Login    string
+	Token    string // токен входа, без него брокер поверит ClientID, если разрешено
+	// IssuedAt и ExpiresAt unix время выдачи токена и после которого брокер его не примет,
+	// ExpiresAt 0 - срок неизвестен
+	IssuedAt, ExpiresAt int64
 }
 
+// DefaultTimeout таймаут запроса к брокеру, если у контекста нет своего
+const DefaultTimeout = 5 * time.Second
+
+// clientIDHeader заголовок, по которому брокер узнаёт клиента без токена
+const clientIDHeader = "X-Client-ID"
+
+// Client http клиент апи брокера
 type Client struct {
 	BrokerAddr string
+	Timeout    time.Duration
+
+	http *http.Client
 }
 
 func NewClient(brokerAddr string) *Client {
-	return &Client{BrokerAddr: brokerAddr}
+	if !strings.Contains(brokerAddr, "://") {
+		brokerAddr = "http://" + brokerAddr
+	}
+
+	return &Client{
+		BrokerAddr: strings.TrimRight(brokerAddr, "/"),
+		Timeout:    DefaultTimeout,
+		http:       &http.Client{Transport: tracing.Transport(nil)},
+	}
 }
 
-type Position struct {
-	Ticker string
+// APIError ответ брокера с кодом ошибки, errors.Is сравнивает его с ErrNotFound и остальными
+type APIError struct {
+	StatusCode int
+	Message    string
+	Reason     string // код причины отказа риск проверки, например MAX_POSITION
 }
 
-type OpenOrder struct {
-	ID     int    `json:"id"`
-	Ticker string `json:"ticker"`
-	Price  int64  `json:"price"`
+func (e *APIError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("broker: %d %s (%s)", e.StatusCode, e.Message, e.Reason)
+	}
+
+	return fmt.Sprintf("broker: %d %s", e.StatusCode, e.Message)
 }
 
-func (c Client) Status() (models.Status, error) {
-	return models.Status{}, nil
+func (e *APIError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return target == ErrBadRequest
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusUnprocessableEntity:
+		return target == ErrRejected
+	}
+
+	return e.StatusCode >= http.StatusInternalServerError && target == ErrBrokerUnavailable
 }
-func (c Client) Deal() (models.Status, error) {
-	//TODO implement me
-	panic("implement me")
+
+func (c *Client) Login(ctx context.Context, login, password string) (Account, error) {
+	var resp models.LoginResponse
+	err := c.do(ctx, http.MethodPost, "/api/v1/login", Account{},
+		models.LoginRequest{Login: login, Password: password}, &resp,
+	)
+
+	return Account{
+		ClientID:  resp.Body.ClientID,
+		Login:     login,
+		Token:     resp.Body.Token,
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: resp.Body.ExpiresAt,
+	}, err
 }
-func (c Client) Cancel() (models.Status, error) {
-	//TODO implement me
-	panic("implement me")
+
+func (c *Client) RefreshToken(ctx context.Context, acc Account) (Account, error) {
+	var resp models.LoginResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/refresh", acc, nil, &resp); err != nil {
+		return acc, err
+	}
+
+	acc.Token, acc.IssuedAt, acc.ExpiresAt = resp.Body.Token, time.Now().Unix(), resp.Body.ExpiresAt
+
+	return acc, nil
+}
+
+func (c *Client) Status(ctx context.Context, acc Account) (models.Status, error) {
+	var status models.Status
+	err := c.do(ctx, http.MethodGet, "/api/v1/status", acc, nil, &status)
+
+	return status, err
+}
+
+func (c *Client) Deal(ctx context.Context, acc Account, deal models.Deal) (models.Order, error) {
+	var resp models.DealResponse
+	err := c.do(ctx, http.MethodPost, "/api/v1/deal", acc, models.DealRequest{Deal: deal}, &resp)
+
+	return resp.Body, err
+}
+
+func (c *Client) Cancel(ctx context.Context, acc Account, req models.CancelRequest) (models.CancelResponse, error) {
+	var resp models.CancelResponse
+	err := c.do(ctx, http.MethodPost, "/api/v1/cancel", acc, req, &resp)
+
+	return resp, err
 }
 
-func (c Client) History() (models.Status, error) {
-	//TODO implement me
-	panic("implement me")
+func (c *Client) Order(ctx context.Context, acc Account, orderID int64, clientOrderID string) (models.Order, error) {
+	query := url.Values{}
+	if clientOrderID != "" {
+		query.Set("client_order_id", clientOrderID)
+	} else {
+		query.Set("id", strconv.FormatInt(orderID, 10))
+	}
+
+	var resp models.OrderResponse
+	err := c.do(ctx, http.MethodGet, "/api/v1/order?"+query.Encode(), acc, nil, &resp)
+
+	return resp.Body, err
+}
+
+func (c *Client) History(ctx context.Context, ticker string, seconds int64) ([]models.Candle, error) {
+	query := url.Values{"ticker": {ticker}}
+	if seconds > 0 {
+		query.Set("seconds", strconv.FormatInt(seconds, 10))
+	}
+
+	var resp models.HistoryResponse
+	err := c.do(ctx, http.MethodGet, "/api/v1/history?"+query.Encode(), Account{}, nil, &resp)
+
+	return resp.Body.Prices, err
+}
+
+func (c *Client) Instruments(ctx context.Context) ([]models.Instrument, error) {
+	var resp models.InstrumentsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/instruments", Account{}, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	// параметры инструментов знает только брокер, по ним клиент читает и пишет цены
+	for _, i := range resp.Body {
+		price.Register(i.Spec())
+	}
+
+	return resp.Body, nil
+}
+
+// do отправляет запрос брокеру и разбирает ответ в out, ошибки апи возвращаются как *APIError
+func (c *Client) do(ctx context.Context, method, path string, acc Account, in, out interface{}) error {
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("cant marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BrokerAddr+path, body)
+	if err != nil {
+		return fmt.Errorf("cant create request: %w", err)
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case acc.Token != "":
+		req.Header.Set("Authorization", "Bearer "+acc.Token)
+	case acc.ClientID > 0:
+		req.Header.Set(clientIDHeader, strconv.FormatInt(acc.ClientID, 10))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("cant request broker: %w", ctx.Err())
+		}
+
+		return fmt.Errorf("%w: %v", ErrBrokerUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+
+		var errResp models.ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Error != "" {
+			apiErr.Message, apiErr.Reason = errResp.Error, errResp.Reason
+		}
+
+		return apiErr
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("cant decode %s response: %w", path, err)
+	}
+
+	return nil
 }
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"trading/pkg/models"
+)
+
+// OrderUpdate изменение заявки клиента от брокера: исполнение, снятие или отклонение
+type OrderUpdate struct {
+	Order      models.Order // состояние заявки после изменения
+	Time       int64
+	FillVolume int32 // объём исполнения, 0 если заявка снята или отклонена
+	FillPrice  int64
+	Reason     string // причина снятия или отклонения
+	Seq        int64  // номер события у клиента брокера
+	// CorrelationID ID запроса, который выставил или снял заявку
+	CorrelationID string
+	// Resync поток подписался заново, заявки в событии нет: события до него
+	// могли пройти мимо, состояние счёта надо перечитать. Только в OrdersWithResync
+	Resync bool
+}
+
+// Notifier держит поток изменений заявок для каждого привязанного пользователя
+// и передаёт их в notify с ID чата, в котором он вошёл
+type Notifier struct {
+	ctx    context.Context
+	stream *BrokerStream
+	notify func(chatID int64, u OrderUpdate)
+
+	mu       sync.Mutex
+	watching map[ChatUser]context.CancelFunc // остановка потока
+}
+
+func NewNotifier(ctx context.Context, stream *BrokerStream, notify func(chatID int64, u OrderUpdate)) *Notifier {
+	return &Notifier{
+		ctx:      ctx,
+		stream:   stream,
+		notify:   notify,
+		watching: make(map[ChatUser]context.CancelFunc),
+	}
+}
+
+// WatchAll подписывает всех, кто уже входил в брокера
+func (n *Notifier) WatchAll(ctx context.Context, repo IRepository) error {
+	accounts, err := repo.Accounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	for user, acc := range accounts {
+		n.Watch(user, acc)
+	}
+
+	return nil
+}
+
+// Watch подписывает пользователя на заявки клиента acc, прежняя подписка снимается
+func (n *Notifier) Watch(user ChatUser, acc Account) {
+	ctx, cancel := context.WithCancel(n.ctx)
+
+	n.mu.Lock()
+	if stop, ok := n.watching[user]; ok {
+		stop()
+	}
+	n.watching[user] = cancel
+	n.mu.Unlock()
+
+	go func() {
+		for u := range n.stream.Orders(ctx, acc) {
+			n.notify(user.ChatID, u)
+		}
+	}()
+}
+
+// Stop снимает подписку, например после выхода из брокера
+func (n *Notifier) Stop(user ChatUser) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if stop, ok := n.watching[user]; ok {
+		stop()
+		delete(n.watching, user)
+	}
+}
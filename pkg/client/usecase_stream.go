@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+	api "trading/pkg/gen/broker"
+	"trading/pkg/models"
+	"trading/pkg/tracing"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// задержка между переподключениями к потокам брокера, удваивается до maxReconnectDelay
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// BrokerStream потоки брокера по grpc, переподключаются сами, пока жив контекст
+type BrokerStream struct {
+	api api.BrokerClient
+}
+
+// NewBrokerStream подключается к grpc апи брокера, extra дополняет параметры
+// соединения, например в тестах соединение идёт в памяти
+func NewBrokerStream(addr string, extra ...grpc.DialOption) (*BrokerStream, error) {
+	opts := append(tracing.DialOptions(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	opts = append(opts, extra...)
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cant dial broker %s: %w", addr, err)
+	}
+
+	return &BrokerStream{api: api.NewBrokerClient(conn)}, nil
+}
+
+// Quotes свечи по инструментам tickers, по всем если пусто. Канал закрывается вместе с ctx
+func (s *BrokerStream) Quotes(ctx context.Context, tickers []string) <-chan models.Candle {
+	ch := make(chan models.Candle, 100)
+
+	go func() {
+		defer close(ch)
+
+		s.keep(ctx, "quotes", func(ctx context.Context) error {
+			stream, err := s.api.Quotes(ctx, &api.QuotesRequest{Tickers: tickers})
+			if err != nil {
+				return err
+			}
+
+			for {
+				c, err := stream.Recv()
+				if err != nil {
+					return err
+				}
+
+				select {
+				case ch <- candleFromProto(c):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		})
+	}()
+
+	return ch
+}
+
+// Orders изменения заявок клиента acc. После переподключения брокер досылает
+// события, пропущенные за время обрыва. Канал закрывается вместе с ctx
+// или когда брокер больше не принимает токен
+func (s *BrokerStream) Orders(ctx context.Context, acc Account) <-chan OrderUpdate {
+	return s.orders(ctx, acc, false)
+}
+
+// OrdersWithResync как Orders, но после каждой подписки, первой и после обрыва,
+// отдаёт событие с Resync раньше событий из неё. Брокер к этому моменту уже
+// подписал поток, так что прочитанное после него состояние счёта ничего не теряет
+func (s *BrokerStream) OrdersWithResync(ctx context.Context, acc Account) <-chan OrderUpdate {
+	return s.orders(ctx, acc, true)
+}
+
+func (s *BrokerStream) orders(ctx context.Context, acc Account, resync bool) <-chan OrderUpdate {
+	ch := make(chan OrderUpdate, 100)
+
+	md := metadata.Pairs("client-id", strconv.FormatInt(acc.ClientID, 10))
+	if acc.Token != "" {
+		md = metadata.Pairs("authorization", "Bearer "+acc.Token)
+	}
+
+	go func() {
+		defer close(ch)
+
+		// номер последнего полученного события, известен после первой подписки
+		var last int64
+		var resume bool
+
+		s.keep(ctx, "orders "+acc.Login, func(ctx context.Context) error {
+			stream, err := s.api.Orders(metadata.NewOutgoingContext(ctx, md), &api.OrdersRequest{
+				Resume: resume, AfterSeq: last,
+			})
+			if err != nil {
+				return err
+			}
+
+			header, err := stream.Header()
+			if err != nil {
+				return err
+			}
+			if !resume {
+				if values := header.Get("order-seq"); len(values) > 0 {
+					last, _ = strconv.ParseInt(values[0], 10, 64)
+				}
+				resume = true
+			}
+
+			if resync {
+				select {
+				case ch <- OrderUpdate{Resync: true, Seq: last}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			for {
+				u, err := stream.Recv()
+				if err != nil {
+					return err
+				}
+				if u.Seq > 0 {
+					last = u.Seq
+				}
+
+				select {
+				case ch <- orderUpdateFromProto(u, acc.ClientID):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		})
+	}()
+
+	return ch
+}
+
+// keep держит поток открытым: после обрыва ждёт и открывает заново
+func (s *BrokerStream) keep(ctx context.Context, name string, run func(ctx context.Context) error) {
+	delay := minReconnectDelay
+
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// переподключение с тем же токеном ничего не даст
+		if status.Code(err) == codes.Unauthenticated {
+			log.Err(err).Msgf("Broker %s stream unauthenticated, stop", name)
+
+			return
+		}
+
+		// поток долго работал - это новый обрыв, а не серия неудачных попыток
+		if time.Since(start) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+
+		log.Err(err).Msgf("Broker %s stream closed, reconnect in %v", name, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func candleFromProto(c *api.Candle) models.Candle {
+	return models.Candle{
+		ID:       c.ID,
+		Time:     c.Time,
+		Interval: c.Interval,
+		Open:     c.Open,
+		High:     c.High,
+		Low:      c.Low,
+		Close:    c.Close,
+		Volume:   c.Volume,
+		Ticker:   c.Ticker,
+	}
+}
+
+func orderUpdateFromProto(u *api.OrderUpdate, clientID int64) OrderUpdate {
+	o := u.GetOrder()
+
+	return OrderUpdate{
+		Order: models.Order{
+			ID:            o.GetID(),
+			DealID:        o.GetDealID(),
+			ClientID:      clientID,
+			Ticker:        o.GetTicker(),
+			Volume:        o.GetVolume(),
+			Filled:        o.GetFilled(),
+			Price:         o.GetPrice(),
+			IsBuy:         o.GetIsBuy(),
+			Status:        models.OrderStatus(o.GetStatus()),
+			ClientOrderID: o.GetClientOrderID(),
+		},
+		Time:       u.Time,
+		FillVolume: u.FillVolume,
+		FillPrice:  u.FillPrice,
+		Reason:     u.Reason,
+		Seq:        u.Seq,
+
+		CorrelationID: u.CorrelationID,
+	}
+}
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"trading/pkg/models"
+	"trading/pkg/price"
+
+	"github.com/akyoto/cache"
+)
+
+var ErrDealNotFound = errors.New("deal not found")
+var ErrWrongTransition = errors.New("wrong deal transition")
+var ErrWrongDealInput = errors.New("wrong deal input")
+
+// DealStep шаг мастера открытия позиции
+type DealStep string
+
+const (
+	StepSide    DealStep = "side"
+	StepTicker  DealStep = "ticker"
+	StepPrice   DealStep = "price"
+	StepVolume  DealStep = "volume"
+	StepConfirm DealStep = "confirm"
+)
+
+// DealEvent действие пользователя в мастере
+type DealEvent string
+
+const (
+	EventSelect DealEvent = "select" // кнопка с вариантом: сторона сделки, инструмент
+	EventInput  DealEvent = "input"  // текст от пользователя: цена, количество
+	EventBack   DealEvent = "back"   // на шаг назад
+	EventEdit   DealEvent = "edit"   // с подтверждения к одному из полей
+)
+
+// dealStep описание шага: каким событием он заполняется, как проверяется ввод
+// и куда мастер переходит вперёд и назад
+type dealStep struct {
+	input DealEvent
+	apply func(d *Deal, value string, instruments []string) error
+	next  DealStep
+	prev  DealStep
+}
+
+// dealSteps переходы мастера. После ввода мастер идёт на next, пропуская уже
+// заполненные поля, поэтому правка поля с подтверждения к подтверждению и возвращает
+var dealSteps = map[DealStep]dealStep{
+	StepSide:    {input: EventSelect, apply: applySide, next: StepTicker},
+	StepTicker:  {input: EventSelect, apply: applyTicker, next: StepPrice, prev: StepSide},
+	StepPrice:   {input: EventInput, apply: applyPrice, next: StepVolume, prev: StepTicker},
+	StepVolume:  {input: EventInput, apply: applyVolume, next: StepConfirm, prev: StepPrice},
+	StepConfirm: {prev: StepVolume},
+}
+
+// Deal заявка, которую пользователь собирает в мастере
+type Deal struct {
+	Step  DealStep
+	MsgID int // сообщение с мастером, его бот и редактирует
+
+	Side   string // models.DealBuy или models.DealSell
+	Ticker string
+	Price  int64
+	Volume int32
+
+	// ClientOrderID выдаётся при первой отправке брокеру: повторная отправка той же
+	// заявки не выставит вторую, а после правки поля заявка получает новый ID
+	ClientOrderID string
+}
+
+func NewDeal() Deal {
+	return Deal{Step: StepSide}
+}
+
+// Handle переход мастера по событию. instruments - инструменты брокера, нужны
+// для проверки выбора на шаге инструмента. При ошибке сделка не меняется
+func (d Deal) Handle(event DealEvent, value string, instruments []string) (Deal, error) {
+	step, ok := dealSteps[d.Step]
+	if !ok {
+		return d, fmt.Errorf("%w: unknown step %q", ErrWrongTransition, d.Step)
+	}
+
+	switch event {
+	case EventBack:
+		if step.prev == "" {
+			return d, fmt.Errorf("%w: no step before %s", ErrWrongTransition, d.Step)
+		}
+		d.Step = step.prev
+
+		return d, nil
+	case EventEdit:
+		target := DealStep(value)
+		if _, ok := dealSteps[target]; d.Step != StepConfirm || !ok || target == StepConfirm {
+			return d, fmt.Errorf("%w: cant edit %q from %s", ErrWrongTransition, value, d.Step)
+		}
+		d.Step = target
+
+		return d, nil
+	}
+
+	if step.input == "" || step.input != event {
+		return d, fmt.Errorf("%w: %s on step %s", ErrWrongTransition, event, d.Step)
+	}
+
+	if err := step.apply(&d, value, instruments); err != nil {
+		return d, err
+	}
+	d.ClientOrderID = ""
+
+	d.Step = step.next
+	for d.Step != StepConfirm && d.filled(d.Step) {
+		d.Step = dealSteps[d.Step].next
+	}
+
+	return d, nil
+}
+
+// filled поле шага уже заполнено
+func (d Deal) filled(step DealStep) bool {
+	switch step {
+	case StepSide:
+		return d.Side != ""
+	case StepTicker:
+		return d.Ticker != ""
+	case StepPrice:
+		return d.Price > 0
+	case StepVolume:
+		return d.Volume > 0
+	}
+
+	return false
+}
+
+func applySide(d *Deal, value string, _ []string) error {
+	if value != models.DealBuy && value != models.DealSell {
+		return fmt.Errorf("%w: side %q, want %s or %s", ErrWrongDealInput, value, models.DealBuy, models.DealSell)
+	}
+	d.Side = value
+
+	return nil
+}
+
+// applyTicker новый инструмент сбрасывает цену, она была в знаках прежнего
+func applyTicker(d *Deal, value string, instruments []string) error {
+	for _, ticker := range instruments {
+		if ticker == value {
+			if d.Ticker != value {
+				d.Price = 0
+			}
+			d.Ticker = value
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: broker doesnt trade %q", ErrWrongDealInput, value)
+}
+
+// applyPrice цена в знаках инструмента и на сетке его шага: 1209.9, но не 1209.95
+func applyPrice(d *Deal, value string, _ []string) error {
+	units, err := price.Lookup(d.Ticker).Parse(value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWrongDealInput, err)
+	}
+	d.Price = units
+
+	return nil
+}
+
+func applyVolume(d *Deal, value string, _ []string) error {
+	volume, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || volume <= 0 {
+		return fmt.Errorf("%w: volume must be a positive integer, got %q", ErrWrongDealInput, value)
+	}
+	d.Volume = int32(volume)
+
+	return nil
+}
+
+// Dealer сделки в мастере по пользователям в чатах: в группе каждый собирает свою.
+// Брошенная сделка забывается через dealTTL
+type Dealer struct {
+	cache *cache.Cache
+}
+
+// dealTTL сколько живёт незаконченная сделка
+const dealTTL = 5 * time.Minute
+
+func NewDealer() *Dealer {
+	return &Dealer{cache: cache.New(dealTTL)}
+}
+
+func (d *Dealer) newDeal(user ChatUser) Deal {
+	deal := NewDeal()
+	d.cache.Set(user, deal, dealTTL)
+
+	return deal
+}
+
+func (d *Dealer) getDeal(user ChatUser) (Deal, error) {
+	val, ok := d.cache.Get(user)
+	if !ok {
+		return Deal{}, fmt.Errorf("сделка не найдена: %w", ErrDealNotFound)
+	}
+
+	deal, ok := val.(Deal)
+	if !ok {
+		return Deal{}, fmt.Errorf("сделка неправильный тип: %w", ErrDealNotFound)
+	}
+
+	return deal, nil
+}
+
+func (d *Dealer) saveDeal(user ChatUser, deal Deal) {
+	d.cache.Set(user, deal, dealTTL)
+}
+
+func (d *Dealer) deleteDeal(user ChatUser) {
+	d.cache.Delete(user)
+}
+
+// Len сколько пользователей сейчас в мастере, просроченные сделки не считаются
+func (d *Dealer) Len() int {
+	n := 0
+	d.cache.Range(func(_, _ interface{}) bool {
+		n++
+
+		return true
+	})
+
+	return n
+}
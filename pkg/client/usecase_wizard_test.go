@@ -0,0 +1,410 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"trading/pkg/models"
+	"trading/pkg/price"
+)
+
+var testInstruments = []string{"IMOEX", "SPFB.RTS"}
+
+// у IMOEX параметры по умолчанию, у SPFB.RTS шаг 0.10
+func init() {
+	price.Register(price.Spec{Ticker: "SPFB.RTS", Scale: 2, TickSize: 10, PointValue: 100})
+}
+
+// filledDeal сделка на подтверждении
+func filledDeal() Deal {
+	return Deal{Step: StepConfirm, Side: models.DealBuy, Ticker: "SPFB.RTS", Price: 120000, Volume: 2}
+}
+
+func TestDealHandle(t *testing.T) {
+	tests := []struct {
+		name  string
+		deal  Deal
+		event DealEvent
+		value string
+		want  Deal
+		err   error
+	}{
+		// вперёд по шагам
+		{
+			name:  "side buy",
+			deal:  NewDeal(),
+			event: EventSelect,
+			value: models.DealBuy,
+			want:  Deal{Step: StepTicker, Side: models.DealBuy},
+		},
+		{
+			name:  "side sell",
+			deal:  NewDeal(),
+			event: EventSelect,
+			value: models.DealSell,
+			want:  Deal{Step: StepTicker, Side: models.DealSell},
+		},
+		{
+			name:  "side unknown",
+			deal:  NewDeal(),
+			event: EventSelect,
+			value: "HOLD",
+			err:   ErrWrongDealInput,
+		},
+		{
+			name:  "ticker from broker",
+			deal:  Deal{Step: StepTicker, Side: models.DealBuy},
+			event: EventSelect,
+			value: "IMOEX",
+			want:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "IMOEX"},
+		},
+		{
+			name:  "ticker not traded",
+			deal:  Deal{Step: StepTicker, Side: models.DealBuy},
+			event: EventSelect,
+			value: "SPFBRTS",
+			err:   ErrWrongDealInput,
+		},
+		{
+			name:  "price",
+			deal:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "IMOEX"},
+			event: EventInput,
+			value: "31",
+			want:  Deal{Step: StepVolume, Side: models.DealBuy, Ticker: "IMOEX", Price: 3100},
+		},
+		{
+			name:  "decimal price",
+			deal:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "SPFB.RTS"},
+			event: EventInput,
+			value: "1204.1",
+			want:  Deal{Step: StepVolume, Side: models.DealBuy, Ticker: "SPFB.RTS", Price: 120410},
+		},
+		{
+			name:  "price off tick",
+			deal:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "SPFB.RTS"},
+			event: EventInput,
+			value: "1204.15",
+			err:   ErrWrongDealInput,
+		},
+		{
+			name:  "price with extra digits",
+			deal:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "IMOEX"},
+			event: EventInput,
+			value: "31.001",
+			err:   ErrWrongDealInput,
+		},
+		{
+			name:  "price not a number",
+			deal:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "IMOEX"},
+			event: EventInput,
+			value: "дорого",
+			err:   ErrWrongDealInput,
+		},
+		{
+			name:  "price not positive",
+			deal:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "IMOEX"},
+			event: EventInput,
+			value: "0",
+			err:   ErrWrongDealInput,
+		},
+		{
+			name:  "volume",
+			deal:  Deal{Step: StepVolume, Side: models.DealBuy, Ticker: "IMOEX", Price: 3100},
+			event: EventInput,
+			value: "5",
+			want:  Deal{Step: StepConfirm, Side: models.DealBuy, Ticker: "IMOEX", Price: 3100, Volume: 5},
+		},
+		{
+			name:  "volume negative",
+			deal:  Deal{Step: StepVolume, Side: models.DealBuy, Ticker: "IMOEX", Price: 3100},
+			event: EventInput,
+			value: "-5",
+			err:   ErrWrongDealInput,
+		},
+		{
+			name:  "volume overflows int32",
+			deal:  Deal{Step: StepVolume, Side: models.DealBuy, Ticker: "IMOEX", Price: 3100},
+			event: EventInput,
+			value: "99999999999",
+			err:   ErrWrongDealInput,
+		},
+
+		// событие не того вида для шага
+		{
+			name:  "text on side step",
+			deal:  NewDeal(),
+			event: EventInput,
+			value: models.DealBuy,
+			err:   ErrWrongTransition,
+		},
+		{
+			name:  "button on price step",
+			deal:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "IMOEX"},
+			event: EventSelect,
+			value: "3100",
+			err:   ErrWrongTransition,
+		},
+		{
+			name:  "input on confirm",
+			deal:  filledDeal(),
+			event: EventInput,
+			value: "1",
+			err:   ErrWrongTransition,
+		},
+		{
+			name:  "unknown event",
+			deal:  NewDeal(),
+			event: "jump",
+			value: "confirm",
+			err:   ErrWrongTransition,
+		},
+		{
+			name:  "unknown step",
+			deal:  Deal{Step: "open"},
+			event: EventBack,
+			err:   ErrWrongTransition,
+		},
+
+		// назад
+		{
+			name:  "back from side",
+			deal:  NewDeal(),
+			event: EventBack,
+			err:   ErrWrongTransition,
+		},
+		{
+			name:  "back from ticker",
+			deal:  Deal{Step: StepTicker, Side: models.DealBuy},
+			event: EventBack,
+			want:  Deal{Step: StepSide, Side: models.DealBuy},
+		},
+		{
+			name:  "back from price",
+			deal:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "IMOEX"},
+			event: EventBack,
+			want:  Deal{Step: StepTicker, Side: models.DealBuy, Ticker: "IMOEX"},
+		},
+		{
+			name:  "back from volume",
+			deal:  Deal{Step: StepVolume, Side: models.DealBuy, Ticker: "IMOEX", Price: 3100},
+			event: EventBack,
+			want:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "IMOEX", Price: 3100},
+		},
+		{
+			name:  "back from confirm",
+			deal:  filledDeal(),
+			event: EventBack,
+			want:  func() Deal { d := filledDeal(); d.Step = StepVolume; return d }(),
+		},
+
+		// после шага назад заполненные поля пропускаются
+		{
+			name:  "reselect side skips filled fields",
+			deal:  func() Deal { d := filledDeal(); d.Step = StepSide; return d }(),
+			event: EventSelect,
+			value: models.DealSell,
+			want:  func() Deal { d := filledDeal(); d.Side = models.DealSell; return d }(),
+		},
+		{
+			name:  "reselect ticker goes to first empty field",
+			deal:  Deal{Step: StepTicker, Side: models.DealBuy, Ticker: "IMOEX", Volume: 3},
+			event: EventSelect,
+			value: "SPFB.RTS",
+			want:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "SPFB.RTS", Volume: 3},
+		},
+
+		// правка поля с подтверждения
+		{
+			name:  "edit side",
+			deal:  filledDeal(),
+			event: EventEdit,
+			value: string(StepSide),
+			want:  func() Deal { d := filledDeal(); d.Step = StepSide; return d }(),
+		},
+		{
+			name:  "edit ticker",
+			deal:  filledDeal(),
+			event: EventEdit,
+			value: string(StepTicker),
+			want:  func() Deal { d := filledDeal(); d.Step = StepTicker; return d }(),
+		},
+		{
+			name:  "edit price",
+			deal:  filledDeal(),
+			event: EventEdit,
+			value: string(StepPrice),
+			want:  func() Deal { d := filledDeal(); d.Step = StepPrice; return d }(),
+		},
+		{
+			name:  "edit volume",
+			deal:  filledDeal(),
+			event: EventEdit,
+			value: string(StepVolume),
+			want:  func() Deal { d := filledDeal(); d.Step = StepVolume; return d }(),
+		},
+		{
+			name:  "edit confirm",
+			deal:  filledDeal(),
+			event: EventEdit,
+			value: string(StepConfirm),
+			err:   ErrWrongTransition,
+		},
+		{
+			name:  "edit unknown field",
+			deal:  filledDeal(),
+			event: EventEdit,
+			value: "comment",
+			err:   ErrWrongTransition,
+		},
+		{
+			name:  "edit before confirm",
+			deal:  Deal{Step: StepPrice, Side: models.DealBuy, Ticker: "IMOEX"},
+			event: EventEdit,
+			value: string(StepSide),
+			err:   ErrWrongTransition,
+		},
+		{
+			name:  "edited price returns to confirm",
+			deal:  func() Deal { d := filledDeal(); d.Step = StepPrice; return d }(),
+			event: EventInput,
+			value: "1210",
+			want:  func() Deal { d := filledDeal(); d.Price = 121000; return d }(),
+		},
+		{
+			name:  "edited ticker asks price again",
+			deal:  func() Deal { d := filledDeal(); d.Step = StepTicker; return d }(),
+			event: EventSelect,
+			value: "IMOEX",
+			want:  func() Deal { d := filledDeal(); d.Step, d.Ticker, d.Price = StepPrice, "IMOEX", 0; return d }(),
+		},
+		{
+			name:  "same ticker keeps price",
+			deal:  func() Deal { d := filledDeal(); d.Step = StepTicker; return d }(),
+			event: EventSelect,
+			value: "SPFB.RTS",
+			want:  filledDeal(),
+		},
+		{
+			name:  "edit after submission needs new order id",
+			deal:  func() Deal { d := filledDeal(); d.Step, d.ClientOrderID = StepVolume, "tg-1-a"; return d }(),
+			event: EventInput,
+			value: "3",
+			want:  func() Deal { d := filledDeal(); d.Volume = 3; return d }(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.deal.Handle(tt.event, tt.value, testInstruments)
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				if got != tt.deal {
+					t.Fatalf("deal changed on error: %+v, was %+v", got, tt.deal)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("deal = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDealSteps каждый шаг, кроме первого, достижим назад, и из каждого шага вперёд
+// можно дойти до подтверждения
+func TestDealSteps(t *testing.T) {
+	for step, s := range dealSteps {
+		if step == StepConfirm {
+			if s.input != "" || s.apply != nil {
+				t.Errorf("confirm must not take input")
+			}
+
+			continue
+		}
+
+		if s.apply == nil || s.input == "" {
+			t.Errorf("step %s has no input", step)
+		}
+
+		seen := map[DealStep]bool{}
+		for next := step; next != StepConfirm; next = dealSteps[next].next {
+			if seen[next] || next == "" {
+				t.Fatalf("step %s never reaches confirm", step)
+			}
+			seen[next] = true
+		}
+
+		if s.prev != "" && dealSteps[s.prev].next != step {
+			t.Errorf("step %s: back goes to %s, but its next is %s", step, s.prev, dealSteps[s.prev].next)
+		}
+	}
+}
+
+func TestDealWizardFlow(t *testing.T) {
+	deal := NewDeal()
+
+	steps := []struct {
+		event DealEvent
+		value string
+		step  DealStep
+	}{
+		{EventSelect, models.DealSell, StepTicker},
+		{EventSelect, "SPFB.RTS", StepPrice},
+		{EventInput, "1205.00", StepVolume},
+		{EventBack, "", StepPrice},
+		{EventInput, "1204", StepVolume},
+		{EventInput, "3", StepConfirm},
+		{EventEdit, string(StepVolume), StepVolume},
+		{EventInput, "4", StepConfirm},
+	}
+
+	for _, s := range steps {
+		var err error
+		if deal, err = deal.Handle(s.event, s.value, testInstruments); err != nil {
+			t.Fatalf("%s %s: %v", s.event, s.value, err)
+		}
+		if deal.Step != s.step {
+			t.Fatalf("%s %s: step = %s, want %s", s.event, s.value, deal.Step, s.step)
+		}
+	}
+
+	want := Deal{Step: StepConfirm, Side: models.DealSell, Ticker: "SPFB.RTS", Price: 120400, Volume: 4}
+	if deal != want {
+		t.Fatalf("deal = %+v, want %+v", deal, want)
+	}
+}
+
+func TestDealerPerUser(t *testing.T) {
+	dealer := NewDealer()
+	tg := &TelegramClient{Dealer: dealer}
+
+	// в группе каждый участник собирает свою сделку
+	first, second := ChatUser{ChatID: 1, UserID: 10}, ChatUser{ChatID: 1, UserID: 11}
+	dealer.newDeal(first)
+	dealer.saveDeal(second, Deal{Step: StepTicker, Side: models.DealSell, MsgID: 5})
+
+	if deal, err := dealer.getDeal(first); err != nil || deal.Step != StepSide {
+		t.Errorf("deal of first user = %+v, %v, want new deal", deal, err)
+	}
+	if dealer.Len() != 2 {
+		t.Errorf("Len = %d, want 2", dealer.Len())
+	}
+
+	// кнопка под мастером второго не достаётся сделке первого
+	if _, err := tg.buttonDeal(models.Message{ChatID: 1, UserID: 12, MessageID: 5}); !errors.Is(err, ErrDealNotFound) {
+		t.Errorf("button of other user = %v, want ErrDealNotFound", err)
+	}
+	if _, err := tg.buttonDeal(models.Message{ChatID: 1, UserID: 11, MessageID: 6}); !errors.Is(err, ErrDealNotFound) {
+		t.Errorf("button of other wizard = %v, want ErrDealNotFound", err)
+	}
+	if deal, err := tg.buttonDeal(models.Message{ChatID: 1, UserID: 11, MessageID: 5}); err != nil || deal.Side != models.DealSell {
+		t.Errorf("button of own wizard = %+v, %v", deal, err)
+	}
+}
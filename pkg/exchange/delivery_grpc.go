@@ -0,0 +1,399 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	api "trading/pkg/gen/exchange"
+	"trading/pkg/metrics"
+	"trading/pkg/tracing"
+)
+
+type OHLCV struct {
+	ID, Time               int64
+	Ticker                 string
+	Open, High, Low, Close int64
+	Volume                 int32
+}
+
+// historySize сколько последних свечей биржа хранит для переподключившихся брокеров
+const historySize = 300
+
+// shutdownTimeout сколько ждать завершения запросов при остановке, потом соединения рвутся
+const shutdownTimeout = 10 * time.Second
+
+// ErrShuttingDown биржа останавливается, брокеру стоит переподключиться позже
+var ErrShuttingDown = status.Error(codes.Unavailable, "exchange is shutting down")
+
+// candleSubscriber поток свечей брокера. Свечи не ждут медленного брокера: если его
+// канал полон, подписка снимается и закрывается lagged, а поток досылает пропущенное из истории
+type candleSubscriber struct {
+	ch     chan OHLCV
+	lagged chan struct{}
+}
+
+// Exchange grpc service
+type Exchange struct {
+	Interval time.Duration
+
+	// closing закрывается при остановке, потоки брокеров завершаются с ErrShuttingDown
+	closing chan struct{}
+
+	sync.Mutex
+	consumers map[*candleSubscriber]struct{}
+	lastID    int64
+	history   []OHLCV
+	book      *OrderBook
+	api.UnimplementedExchangeServer
+}
+
+func NewExchange(interval time.Duration) *Exchange {
+	return &Exchange{
+		Interval:  interval,
+		closing:   make(chan struct{}),
+		consumers: make(map[*candleSubscriber]struct{}),
+		book:      NewOrderBook(),
+	}
+}
+
+// Serve запускает на l grpc сервер вместе со стандартным health сервисом,
+// extra дополняет параметры сервера. Возвращает функцию остановки
+func (e *Exchange) Serve(l net.Listener, extra ...grpc.ServerOption) func() {
+	opts := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor, logInterceptor, metrics.UnaryServerInterceptor),
+		grpc.ChainStreamInterceptor(tracing.StreamServerInterceptor, logStreamInterceptor, metrics.StreamServerInterceptor),
+	}, extra...)
+	server := grpc.NewServer(opts...)
+	api.RegisterExchangeServer(server, e)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	go func() {
+		if err := server.Serve(l); err != nil {
+			log.Err(err).Msg("grpc server stopped")
+		}
+	}()
+	healthServer.SetServingStatus(api.Exchange_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	return func() {
+		// сначала супервизор узнаёт, что новых брокеров сюда слать не надо,
+		// затем закрываются бесконечные потоки, иначе GracefulStop их ждал бы вечно
+		healthServer.Shutdown()
+		close(e.closing)
+		gracefulStop(server, shutdownTimeout)
+	}
+}
+
+// gracefulStop ждёт завершения запросов не дольше timeout, потом рвёт соединения
+func gracefulStop(server *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		log.Warn().Msgf("grpc server didnt stop in %v, closing connections", timeout)
+		server.Stop()
+	}
+}
+
+// Run сводит сделки из ch с заявками стакана и рассылает свечи брокерам (consumer)
+// до отмены ctx. Когда история кончилась, биржа продолжает обслуживать заявки
+func (e *Exchange) Run(ctx context.Context, ch <-chan []Entry) {
+	for {
+		var entryes []Entry
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case entryes, ok = <-ch:
+		}
+
+		if !ok {
+			<-ctx.Done()
+
+			return
+		}
+
+		if len(entryes) == 0 {
+			continue
+		}
+
+		ohlcv := Aggregate(e.book, entryes)
+		ohlcv.Time = time.Now().Unix()
+		ohlcv = e.publish(ohlcv)
+
+		log.Printf("ohlcv: %+v", ohlcv)
+	}
+}
+
+// publish нумерует свечу, кладёт её в историю и рассылает брокерам
+func (e *Exchange) publish(ohlcv OHLCV) OHLCV {
+	e.Lock()
+	defer e.Unlock()
+
+	e.lastID++
+	ohlcv.ID = e.lastID
+	e.history = append(e.history, ohlcv)
+	if len(e.history) > historySize {
+		e.history = e.history[len(e.history)-historySize:]
+	}
+
+	for sub := range e.consumers {
+		select {
+		case sub.ch <- ohlcv:
+		default:
+			e.dropLocked(sub)
+			close(sub.lagged)
+		}
+	}
+	candlesEmitted.WithLabelValues(ohlcv.Ticker).Inc()
+
+	return ohlcv
+}
+
+// statisticSubscribe подписывает брокера на новые свечи и возвращает пропущенные
+// брокером свечи с ID больше lastID и ID последней свечи на момент подписки
+func (e *Exchange) statisticSubscribe(lastID int64) (*candleSubscriber, []OHLCV, int64) {
+	e.Lock()
+	defer e.Unlock()
+
+	sub := &candleSubscriber{ch: make(chan OHLCV, 100), lagged: make(chan struct{})}
+	e.consumers[sub] = struct{}{}
+	subscribers.WithLabelValues(streamStatistic).Inc()
+
+	// биржа перезапускалась, ID начались заново - досылать нечего
+	if lastID <= 0 || lastID >= e.lastID {
+		return sub, nil, e.lastID
+	}
+
+	var missed []OHLCV
+	for _, ohlcv := range e.history {
+		if ohlcv.ID > lastID {
+			missed = append(missed, ohlcv)
+		}
+	}
+
+	return sub, missed, e.lastID
+}
+
+func (e *Exchange) statisticUnsubscribe(sub *candleSubscriber) {
+	e.Lock()
+	e.dropLocked(sub)
+	e.Unlock()
+}
+
+func (e *Exchange) dropLocked(sub *candleSubscriber) {
+	if _, ok := e.consumers[sub]; !ok {
+		return
+	}
+
+	delete(e.consumers, sub)
+	subscribers.WithLabelValues(streamStatistic).Dec()
+}
+
+func (e *Exchange) Statistic(
+	id *api.BrokerID,
+	exch api.Exchange_StatisticServer) (err error) {
+
+	sub, missed, last := e.statisticSubscribe(id.LastID)
+	defer func() { e.statisticUnsubscribe(sub) }()
+
+	// заголовки сразу, как в Results: свечи после них брокер уже не пропустит
+	if err = exch.SendHeader(metadata.Pairs("broker-id", strconv.FormatInt(id.ID, 10))); err != nil {
+		return fmt.Errorf("cant send header to broker %v: %w", id.ID, err)
+	}
+
+	if len(missed) > 0 {
+		log.Printf("resend %d candles to broker %v from %v", len(missed), id.ID, id.LastID)
+	}
+
+	// sent последняя отправленная свеча, с неё досылается история при отставании
+	sent := id.LastID
+	if sent <= 0 {
+		sent = last
+	}
+	send := func(candles ...OHLCV) error {
+		for _, ohlcv := range candles {
+			if err := e.sendOHLCV(exch, ohlcv); err != nil {
+				return fmt.Errorf("cant send mesg to broker %v: %w", id.ID, err)
+			}
+			sent = ohlcv.ID
+		}
+
+		return nil
+	}
+
+	if err = send(missed...); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-exch.Context().Done():
+			return nil
+		case <-e.closing:
+			return ErrShuttingDown
+		case ohlcv := <-sub.ch:
+			if err = send(ohlcv); err != nil {
+				return err
+			}
+		case <-sub.lagged:
+			// то, что осталось в канале, тоже есть в истории
+			sub, missed, _ = e.statisticSubscribe(sent)
+			log.Printf("broker %v is slow, resend %d candles from %v", id.ID, len(missed), sent)
+
+			if err = send(missed...); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (e *Exchange) sendOHLCV(exch api.Exchange_StatisticServer, ohlcv OHLCV) error {
+	return exch.Send(&api.OHLCV{
+		ID:       ohlcv.ID,
+		Time:     int32(ohlcv.Time),
+		Interval: int32(e.Interval / time.Second),
+		Open:     ohlcv.Open,
+		High:     ohlcv.High,
+		Low:      ohlcv.Low,
+		Close:    ohlcv.Close,
+		Volume:   ohlcv.Volume,
+		Ticker:   ohlcv.Ticker,
+	})
+}
+
+func (e *Exchange) Create(ctx context.Context, deal *api.Deal) (*api.DealID, error) {
+	// старые брокеры не знают о поле, тогда берётся ID из metadata запроса
+	if deal.CorrelationID == "" {
+		deal.CorrelationID = tracing.ID(ctx)
+	}
+
+	id, err := e.book.Create(deal)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msgf("deal rejected: %v", deal)
+
+		return nil, status.Errorf(codes.InvalidArgument, "cant create deal: %v", err)
+	}
+	log.Ctx(ctx).Info().Msgf("order %d created for broker %d", id, deal.BrokerID)
+
+	return &api.DealID{ID: id, BrokerID: int64(deal.BrokerID)}, nil
+}
+
+func (e *Exchange) Cancel(ctx context.Context, id *api.DealID) (*api.CancelResult, error) {
+	ok := e.book.Cancel(id.BrokerID, id.ID)
+	log.Ctx(ctx).Info().Msgf("cancel order %d for broker %d: %v", id.ID, id.BrokerID, ok)
+
+	return &api.CancelResult{Success: ok}, nil
+}
+
+func (e *Exchange) Results(id *api.BrokerID, exch api.Exchange_ResultsServer) (err error) {
+	sub, missed, last := e.book.subscribe(id.ID, id.LastID)
+	defer func() { e.book.unsubscribe(id.ID, sub) }()
+
+	// заголовки сразу, брокер по ним понимает, что поток установлен
+	if err = exch.SendHeader(metadata.Pairs("broker-id", strconv.FormatInt(id.ID, 10))); err != nil {
+		return fmt.Errorf("cant send header to broker %v: %w", id.ID, err)
+	}
+
+	if len(missed) > 0 {
+		log.Printf("resend %d deals to broker %v from %v", len(missed), id.ID, id.LastID)
+	}
+
+	// sent последнее отправленное исполнение, с него досылается журнал при отставании
+	sent := id.LastID
+	if sent <= 0 {
+		sent = last
+	}
+	send := func(deals ...*api.Deal) error {
+		for _, deal := range deals {
+			if err := exch.Send(deal); err != nil {
+				return fmt.Errorf("cant send deal to broker %v: %w", id.ID, err)
+			}
+			sent = deal.FillID
+		}
+
+		return nil
+	}
+
+	if err = send(missed...); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-exch.Context().Done():
+			return nil
+		case <-e.closing:
+			return ErrShuttingDown
+		case deal := <-sub.ch:
+			if err = send(deal); err != nil {
+				return err
+			}
+		case <-sub.lagged:
+			// то, что осталось в канале, тоже есть в журнале
+			sub, missed, _ = e.book.subscribe(id.ID, sent)
+			log.Printf("broker %v is slow, resend %d deals from %v", id.ID, len(missed), sent)
+
+			if err = send(missed...); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (e *Exchange) Orders(ctx context.Context, req *api.OrdersRequest) (*api.OrdersState, error) {
+	fills, lastFillID := e.book.Fills(req.BrokerID, req.SinceFillID)
+
+	return &api.OrdersState{
+		Open:       e.book.Open(req.BrokerID),
+		Fills:      fills,
+		LastFillID: lastFillID,
+	}, nil
+}
+
+func logInterceptor(
+	ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (resp interface{}, err error) {
+
+	log.Ctx(ctx).Info().Msgf("request: %v, method: %v", req, info.FullMethod)
+
+	return handler(ctx, req)
+}
+func logStreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) (err error) {
+
+	log.Ctx(stream.Context()).Info().Msgf("stream method: %v", info.FullMethod)
+
+	return handler(srv, stream)
+}
+
+//Если на биржу ставится заявка на покупку или продажу,
+//	то она ставится в очередь
+//		и когда цена доходит до неё и хватает объёма -
+//			заявка исполняется, брокеру уходит соответствующее уведомление.
+
+//Если не хватает объёма,
+//	то заявка исполняется частичсно, брокеру так же уходит уведомление
+
+//Если несколько участников поставилос заявку на одинаковый уровеньт цены,
+//	то исполняются в порядке добавления.
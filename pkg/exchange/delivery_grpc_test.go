@@ -0,0 +1,44 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSlowCandleSubscriber брокер, который не читает свечи, не останавливает биржу
+func TestSlowCandleSubscriber(t *testing.T) {
+	e := NewExchange(time.Second)
+	sub, _, last := e.statisticSubscribe(0)
+	defer e.statisticUnsubscribe(sub)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 2*cap(sub.ch); i++ {
+			e.publish(OHLCV{Ticker: "T", Close: 100})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("publish blocked on a slow subscriber")
+	}
+
+	select {
+	case <-sub.lagged:
+	default:
+		t.Fatalf("slow subscriber is not marked as lagged")
+	}
+
+	// подписчик досылает всё из истории
+	resub, missed, _ := e.statisticSubscribe(last + 1)
+	defer e.statisticUnsubscribe(resub)
+	if len(missed) != 2*cap(sub.ch)-1 {
+		t.Fatalf("resent %d candles, want %d", len(missed), 2*cap(sub.ch)-1)
+	}
+	if missed[0].ID != last+2 {
+		t.Errorf("resent from candle %d, want %d", missed[0].ID, last+2)
+	}
+}
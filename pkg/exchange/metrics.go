@@ -0,0 +1,60 @@
+package exchange
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// потоки в exchange_subscribers
+const (
+	streamStatistic = "statistic"
+	streamResults   = "results"
+)
+
+// статусы заявок в exchange_orders_total
+const (
+	orderCreated   = "created"
+	orderRejected  = "rejected"
+	orderCancelled = "cancelled"
+	orderPartial   = "partially_filled"
+	orderFilled    = "filled"
+)
+
+var (
+	replayLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "exchange_replay_lag_seconds",
+		Help: "На сколько проигрывание истории отстаёт от расписания: свеча раз в tick_aggregate_time.",
+	})
+
+	candlesEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "exchange_candles_emitted_total",
+		Help: "Разосланные брокерам свечи.",
+	}, []string{"ticker"})
+
+	subscribers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "exchange_subscribers",
+		Help: "Подписанные брокеры по потокам statistic и results.",
+	}, []string{"stream"})
+
+	ordersTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "exchange_orders_total",
+		Help: "Заявки по статусам: created, rejected, cancelled, partially_filled, filled.",
+	}, []string{"status"})
+
+	matchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "exchange_match_duration_seconds",
+		Help:    "Время сведения одной сделки из истории с заявками стакана.",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	})
+)
+
+// NewOpenOrdersGauge метрика exchange_open_orders - заявки, которые сейчас стоят
+// в стакане, регистрируется в main
+func NewOpenOrdersGauge(e *Exchange) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "exchange_open_orders",
+		Help: "Заявки в стакане.",
+	}, func() float64 {
+		return float64(e.book.Len())
+	})
+}
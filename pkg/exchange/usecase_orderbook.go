@@ -0,0 +1,315 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	api "trading/pkg/gen/exchange"
+	"trading/pkg/price"
+)
+
+var ErrWrongDeal = errors.New("wrong deal")
+
+// fillsJournalSize сколько последних исполнений каждого брокера хранится для досылки.
+// Брокер, пропустивший больше, сверяет заявки через Orders: исполненный объём там есть
+const fillsJournalSize = 10000
+
+// subscriber подписка на исполнения брокера. Стакан не ждёт медленного подписчика:
+// если его канал полон, подписка снимается и закрывается lagged, а подписчик сам
+// досылает пропущенное из журнала
+type subscriber struct {
+	ch     chan *api.Deal
+	lagged chan struct{}
+}
+
+// Order заявка брокера, стоящая в стакане
+type Order struct {
+	ID       int64
+	BrokerID int64
+	ClientID int32
+	Ticker   string
+	Volume   int32
+	Filled   int32
+	Price    int64
+	IsBuy    bool
+	// CorrelationID ID запроса, который выставил заявку, уходит в её исполнения
+	CorrelationID string
+}
+
+// OrderBook стакан заявок и журнал исполнений по брокерам
+type OrderBook struct {
+	sync.Mutex
+
+	lastOrderID int64
+	lastFillID  int64
+
+	// заявки по инструменту в порядке добавления
+	orders map[string][]*Order
+	// журнал исполнений по брокерам, из него досылаются пропущенные сделки
+	fills map[int64][]*api.Deal
+	// подписчики Results по брокерам
+	consumers map[int64]map[*subscriber]struct{}
+}
+
+func NewOrderBook() *OrderBook {
+	// ID начинаются с времени старта, чтобы после перезапуска
+	// биржи они не пересекались со старыми ID у брокеров
+	epoch := time.Now().UnixMilli() * 1000
+
+	return &OrderBook{
+		lastOrderID: epoch,
+		lastFillID:  epoch,
+		orders:      make(map[string][]*Order),
+		fills:       make(map[int64][]*api.Deal),
+		consumers:   make(map[int64]map[*subscriber]struct{}),
+	}
+}
+
+func (b *OrderBook) Create(deal *api.Deal) (int64, error) {
+	if deal.Volume <= 0 || deal.Price <= 0 || deal.Ticker == "" {
+		ordersTotal.WithLabelValues(orderRejected).Inc()
+
+		return 0, ErrWrongDeal
+	}
+
+	// заявка вне сетки шага цены никогда не совпадёт с ценой сделки
+	if err := price.Lookup(deal.Ticker).Check(deal.Price); err != nil {
+		ordersTotal.WithLabelValues(orderRejected).Inc()
+
+		return 0, fmt.Errorf("%w: %v", ErrWrongDeal, err)
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.lastOrderID++
+	b.orders[deal.Ticker] = append(b.orders[deal.Ticker], &Order{
+		ID:       b.lastOrderID,
+		BrokerID: int64(deal.BrokerID),
+		ClientID: deal.ClientID,
+		Ticker:   deal.Ticker,
+		Volume:   deal.Volume,
+		Price:    deal.Price,
+		IsBuy:    deal.IsBuy,
+
+		CorrelationID: deal.CorrelationID,
+	})
+	ordersTotal.WithLabelValues(orderCreated).Inc()
+
+	return b.lastOrderID, nil
+}
+
+// Cancel снимает заявку брокера, false - заявки нет (исполнена или не существовала)
+func (b *OrderBook) Cancel(brokerID, id int64) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	for ticker, orders := range b.orders {
+		for i, o := range orders {
+			if o.ID == id && o.BrokerID == brokerID {
+				b.orders[ticker] = append(orders[:i:i], orders[i+1:]...)
+				ordersTotal.WithLabelValues(orderCancelled).Inc()
+
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Match исполняет заявки, до которых дошла цена сделки entry.
+// Покупка исполняется, когда цена сверху вниз дошла до неё, продажа - снизу вверх.
+// На одном уровне цены заявки исполняются в порядке добавления
+func (b *OrderBook) Match(entry Entry) {
+	start := time.Now()
+	defer func() { matchDuration.Observe(time.Since(start).Seconds()) }()
+
+	b.Lock()
+	defer b.Unlock()
+
+	orders := b.orders[entry.Ticker]
+	if len(orders) == 0 {
+		return
+	}
+
+	var buys, sells []*Order
+	for _, o := range orders {
+		switch {
+		case o.IsBuy && o.Price >= entry.Last:
+			buys = append(buys, o)
+		case !o.IsBuy && o.Price <= entry.Last:
+			sells = append(sells, o)
+		}
+	}
+
+	// лучшая цена первой, stable сохраняет порядок добавления на одном уровне
+	sort.SliceStable(buys, func(i, j int) bool { return buys[i].Price > buys[j].Price })
+	sort.SliceStable(sells, func(i, j int) bool { return sells[i].Price < sells[j].Price })
+
+	b.fill(buys, entry.Vol)
+	b.fill(sells, entry.Vol)
+
+	open := orders[:0]
+	for _, o := range orders {
+		if o.Filled < o.Volume {
+			open = append(open, o)
+		}
+	}
+	b.orders[entry.Ticker] = open
+}
+
+// fill раздаёт объём сделки vol заявкам по очереди
+func (b *OrderBook) fill(orders []*Order, vol int32) {
+	for _, o := range orders {
+		if vol <= 0 {
+			return
+		}
+
+		volume := o.Volume - o.Filled
+		if volume > vol {
+			volume = vol
+		}
+		vol -= volume
+		o.Filled += volume
+
+		b.lastFillID++
+		deal := &api.Deal{
+			ID:       o.ID,
+			BrokerID: int32(o.BrokerID),
+			ClientID: o.ClientID,
+			Ticker:   o.Ticker,
+			Volume:   volume,
+			Partial:  o.Filled < o.Volume,
+			Time:     int32(time.Now().Unix()),
+			Price:    o.Price,
+			IsBuy:    o.IsBuy,
+			FillID:   b.lastFillID,
+
+			CorrelationID: o.CorrelationID,
+		}
+		b.journal(deal)
+
+		if deal.Partial {
+			ordersTotal.WithLabelValues(orderPartial).Inc()
+		} else {
+			ordersTotal.WithLabelValues(orderFilled).Inc()
+		}
+
+		for sub := range b.consumers[o.BrokerID] {
+			select {
+			case sub.ch <- deal:
+			default:
+				b.dropLocked(o.BrokerID, sub)
+				close(sub.lagged)
+			}
+		}
+	}
+}
+
+// journal запоминает исполнение для досылки, старые исполнения выкидываются
+// пачкой, чтобы не копировать журнал на каждой сделке
+func (b *OrderBook) journal(deal *api.Deal) {
+	brokerID := int64(deal.BrokerID)
+	fills := append(b.fills[brokerID], deal)
+	if len(fills) > 2*fillsJournalSize {
+		fills = append([]*api.Deal(nil), fills[len(fills)-fillsJournalSize:]...)
+	}
+	b.fills[brokerID] = fills
+}
+
+// Len сколько заявок стоит в стакане
+func (b *OrderBook) Len() int {
+	b.Lock()
+	defer b.Unlock()
+
+	n := 0
+	for _, orders := range b.orders {
+		n += len(orders)
+	}
+
+	return n
+}
+
+// Open заявки брокера, которые ещё стоят в стакане
+func (b *OrderBook) Open(brokerID int64) []*api.Order {
+	b.Lock()
+	defer b.Unlock()
+
+	var open []*api.Order
+	for _, orders := range b.orders {
+		for _, o := range orders {
+			if o.BrokerID != brokerID {
+				continue
+			}
+
+			open = append(open, &api.Order{
+				ID:       o.ID,
+				ClientID: o.ClientID,
+				Ticker:   o.Ticker,
+				Volume:   o.Volume,
+				Filled:   o.Filled,
+				Price:    o.Price,
+				IsBuy:    o.IsBuy,
+			})
+		}
+	}
+
+	sort.Slice(open, func(i, j int) bool { return open[i].ID < open[j].ID })
+
+	return open
+}
+
+// Fills исполнения брокера с FillID больше since
+func (b *OrderBook) Fills(brokerID, since int64) ([]*api.Deal, int64) {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.fillsSince(brokerID, since), b.lastFillID
+}
+
+func (b *OrderBook) fillsSince(brokerID, since int64) []*api.Deal {
+	fills := b.fills[brokerID]
+	i := sort.Search(len(fills), func(i int) bool { return fills[i].FillID > since })
+
+	return append([]*api.Deal(nil), fills[i:]...)
+}
+
+// subscribe подписывает брокера на исполнения и возвращает пропущенные
+// исполнения с FillID больше lastID и номер последнего исполнения биржи
+func (b *OrderBook) subscribe(brokerID int64, lastID int64) (*subscriber, []*api.Deal, int64) {
+	b.Lock()
+	defer b.Unlock()
+
+	sub := &subscriber{ch: make(chan *api.Deal, 100), lagged: make(chan struct{})}
+	if b.consumers[brokerID] == nil {
+		b.consumers[brokerID] = make(map[*subscriber]struct{})
+	}
+	b.consumers[brokerID][sub] = struct{}{}
+	subscribers.WithLabelValues(streamResults).Inc()
+
+	if lastID <= 0 {
+		return sub, nil, b.lastFillID
+	}
+
+	return sub, b.fillsSince(brokerID, lastID), b.lastFillID
+}
+
+// unsubscribe снимает подписку, уже снятая из-за отставания - не ошибка
+func (b *OrderBook) unsubscribe(brokerID int64, sub *subscriber) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.dropLocked(brokerID, sub)
+}
+
+func (b *OrderBook) dropLocked(brokerID int64, sub *subscriber) {
+	if _, ok := b.consumers[brokerID][sub]; !ok {
+		return
+	}
+
+	delete(b.consumers[brokerID], sub)
+	subscribers.WithLabelValues(streamResults).Dec()
+}
@@ -0,0 +1,191 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+	api "trading/pkg/gen/exchange"
+)
+
+func TestMatch(t *testing.T) {
+	type order struct {
+		isBuy  bool
+		price  int64
+		volume int32
+	}
+
+	tests := []struct {
+		name   string
+		orders []order
+		entry  Entry
+		// want исполненный объём каждой заявки после сделки
+		want []int32
+	}{
+		{
+			name:   "buy fills when price comes down to it",
+			orders: []order{{true, 100, 1}, {true, 99, 1}},
+			entry:  Entry{Last: 100, Vol: 5},
+			want:   []int32{1, 0},
+		},
+		{
+			name:   "sell fills when price comes up to it",
+			orders: []order{{false, 100, 1}, {false, 101, 1}},
+			entry:  Entry{Last: 100, Vol: 5},
+			want:   []int32{1, 0},
+		},
+		{
+			name:   "better price first",
+			orders: []order{{true, 100, 2}, {true, 101, 2}},
+			entry:  Entry{Last: 99, Vol: 3},
+			want:   []int32{1, 2},
+		},
+		{
+			name:   "same price in order of arrival",
+			orders: []order{{true, 100, 2}, {true, 100, 2}},
+			entry:  Entry{Last: 100, Vol: 3},
+			want:   []int32{2, 1},
+		},
+		{
+			name:   "buys and sells share deal volume independently",
+			orders: []order{{true, 100, 2}, {false, 100, 2}},
+			entry:  Entry{Last: 100, Vol: 2},
+			want:   []int32{2, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook()
+			sub, _, _ := book.subscribe(1, 0)
+			defer book.unsubscribe(1, sub)
+
+			ids := make([]int64, len(tt.orders))
+			for i, o := range tt.orders {
+				var err error
+				ids[i], err = book.Create(&api.Deal{BrokerID: 1, Ticker: "T", IsBuy: o.isBuy, Price: o.price, Volume: o.volume})
+				if err != nil {
+					t.Fatalf("Create: %v", err)
+				}
+			}
+
+			tt.entry.Ticker = "T"
+			book.Match(tt.entry)
+
+			filled := make(map[int64]int32)
+			fills, _ := book.Fills(1, 0)
+			for _, d := range fills {
+				filled[d.ID] += d.Volume
+				if d.Price != tt.orders[indexOf(ids, d.ID)].price {
+					t.Errorf("fill of %d by %d, want order price", d.ID, d.Price)
+				}
+			}
+			for i, id := range ids {
+				if filled[id] != tt.want[i] {
+					t.Errorf("order %d filled %d, want %d", i, filled[id], tt.want[i])
+				}
+			}
+
+			if len(sub.ch) != len(fills) {
+				t.Errorf("subscriber got %d deals, want %d", len(sub.ch), len(fills))
+			}
+
+			open := 0
+			for i := range tt.orders {
+				if tt.want[i] < tt.orders[i].volume {
+					open++
+				}
+			}
+			if book.Len() != open {
+				t.Errorf("open orders = %d, want %d", book.Len(), open)
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	book := NewOrderBook()
+
+	id, err := book.Create(&api.Deal{BrokerID: 1, Ticker: "T", IsBuy: true, Price: 100, Volume: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if book.Cancel(2, id) {
+		t.Errorf("other broker cancelled the order")
+	}
+	if !book.Cancel(1, id) {
+		t.Errorf("Cancel = false, want true")
+	}
+
+	book.Match(Entry{Ticker: "T", Last: 100, Vol: 1})
+	if fills, _ := book.Fills(1, 0); len(fills) != 0 {
+		t.Errorf("cancelled order filled: %v", fills)
+	}
+}
+
+// TestSlowSubscriber подписчик, который не читает исполнения, не останавливает стакан
+func TestSlowSubscriber(t *testing.T) {
+	book := NewOrderBook()
+	sub, _, last := book.subscribe(1, 0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 2*cap(sub.ch); i++ {
+			if _, err := book.Create(&api.Deal{BrokerID: 1, Ticker: "T", IsBuy: true, Price: 100, Volume: 1}); err != nil {
+				t.Error(err)
+
+				return
+			}
+			book.Match(Entry{Ticker: "T", Last: 100, Vol: 1})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Match blocked on a slow subscriber")
+	}
+
+	select {
+	case <-sub.lagged:
+	default:
+		t.Fatalf("slow subscriber is not marked as lagged")
+	}
+
+	// подписчик досылает всё из журнала
+	resub, missed, _ := book.subscribe(1, last)
+	defer book.unsubscribe(1, resub)
+	if len(missed) != 2*cap(sub.ch) {
+		t.Errorf("resent %d deals, want %d", len(missed), 2*cap(sub.ch))
+	}
+
+	book.unsubscribe(1, sub)
+}
+
+func TestJournalTrim(t *testing.T) {
+	book := NewOrderBook()
+	book.Lock()
+	for i := 1; i <= 2*fillsJournalSize+1; i++ {
+		book.journal(&api.Deal{BrokerID: 1, FillID: int64(i)})
+	}
+	book.Unlock()
+
+	fills, _ := book.Fills(1, 0)
+	if len(fills) != fillsJournalSize {
+		t.Fatalf("journal has %d fills, want %d", len(fills), fillsJournalSize)
+	}
+	if fills[len(fills)-1].FillID != 2*fillsJournalSize+1 {
+		t.Errorf("last fill = %d, want the newest", fills[len(fills)-1].FillID)
+	}
+}
+
+func indexOf(ids []int64, id int64) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,214 @@
+package exchange
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"trading/pkg/price"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrWrongLine = errors.New("wrong line")
+
+// Entry сделка из файла истории
+type Entry struct {
+	Ticker string
+	Date   int64 // ГГГГММДД
+	Time   int64 // ЧЧММСС
+	Last   int64
+	Vol    int32
+}
+
+// At время сделки. Пояса в файле нет, поэтому время в UTC с цифрами из файла
+func (e Entry) At() time.Time {
+	return time.Date(int(e.Date/10000), time.Month(e.Date/100%100), int(e.Date%100),
+		int(e.Time/10000), int(e.Time/100%100), int(e.Time%100), 0, time.UTC)
+}
+
+// TickReader читает сделки из csv файла истории группами с одним временем
+type TickReader struct {
+	buf  *bufio.Scanner
+	next *Entry // первая сделка следующей группы, уже прочитанная
+}
+
+func NewTickReader(r io.Reader) *TickReader {
+	buf := bufio.NewScanner(r)
+	buf.Scan() // skip header
+
+	return &TickReader{buf: buf}
+}
+
+// Next все сделки с одним временем, io.EOF после последней группы
+func (t *TickReader) Next() ([]Entry, error) {
+	var group []Entry
+	if t.next != nil {
+		group = append(group, *t.next)
+		t.next = nil
+	}
+
+	for t.buf.Scan() {
+		entry, err := ParseLine(t.buf.Text())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse line: %w", err)
+		}
+
+		if len(group) > 0 && entry.Time != group[0].Time {
+			t.next = &entry
+
+			return group, nil
+		}
+
+		group = append(group, entry)
+	}
+
+	if err := t.buf.Err(); err != nil {
+		return nil, fmt.Errorf("cant read ticks: %w", err)
+	}
+	if len(group) == 0 {
+		return nil, io.EOF
+	}
+
+	return group, nil
+}
+
+// filterTickers сделки по инструментам из allowed
+func filterTickers(entries []Entry, allowed map[string]bool) []Entry {
+	kept := entries[:0]
+	for _, e := range entries {
+		if allowed[e.Ticker] {
+			kept = append(kept, e)
+		}
+	}
+
+	return kept
+}
+
+// Replay отдаёт группы сделок из r по одной раз в tickTime, как будто торги идут
+// сейчас. Сделки по инструментам не из tickers пропускаются, пустой tickers - все.
+// Канал закрывается, когда сделки кончились
+func Replay(tickTime time.Duration, r io.Reader, tickers []string) <-chan []Entry {
+	ch := make(chan []Entry)
+	ticks := NewTickReader(r)
+
+	allowed := make(map[string]bool, len(tickers))
+	for _, t := range tickers {
+		allowed[t] = true
+	}
+
+	go func() {
+		defer close(ch)
+
+		// свеча n должна уйти в start + n*tickTime, всё, что позже, - отставание
+		start := time.Now()
+		for n := 0; ; n++ {
+			t := time.Now() // start scan time
+
+			entries, err := ticks.Next()
+			if errors.Is(err, io.EOF) {
+				log.Printf("ticks are over")
+
+				return
+			}
+			if err != nil {
+				log.Err(err).Msg("Failed to scan")
+
+				return
+			}
+
+			if len(allowed) > 0 {
+				entries = filterTickers(entries, allowed)
+				if len(entries) == 0 {
+					n--
+
+					continue
+				}
+			}
+
+			ch <- entries
+			if lag := time.Since(start.Add(time.Duration(n) * tickTime)); lag > 0 {
+				replayLag.Set(lag.Seconds())
+			} else {
+				replayLag.Set(0)
+			}
+
+			// wait tickTime - scan time
+			sleepTime := tickTime - time.Since(t)
+			log.Printf("scan time: %v, sleep time: %v", time.Since(t), sleepTime)
+			if sleepTime > 0 {
+				time.Sleep(sleepTime)
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Aggregate свеча из непустой группы сделок. Каждая сделка по пути исполняет
+// заявки book, так что заявки исполняются раньше, чем уходит свеча. ID и Time
+// свечи заполняет вызывающий
+func Aggregate(book *OrderBook, entries []Entry) OHLCV {
+	ohlcv := OHLCV{
+		Ticker: entries[0].Ticker,
+		Open:   entries[0].Last,
+		Low:    entries[0].Last,
+		Close:  entries[len(entries)-1].Last,
+	}
+
+	for _, entry := range entries {
+		book.Match(entry)
+
+		if entry.Last < ohlcv.Low {
+			ohlcv.Low = entry.Last
+		}
+
+		if entry.Last > ohlcv.High {
+			ohlcv.High = entry.Last
+		}
+
+		ohlcv.Volume += entry.Vol
+	}
+
+	return ohlcv
+}
+
+// ParseLine сделка из строки файла истории <TICKER>,<PER>,<DATE>,<TIME>,<LAST>,<VOL>
+func ParseLine(line string) (Entry, error) {
+	var entry Entry
+	es := strings.Split(line, ",")
+	if len(es) != 6 {
+		return Entry{}, ErrWrongLine
+	}
+
+	entry.Ticker = es[0]
+
+	date, err := strconv.Atoi(es[2])
+	if err != nil {
+		return Entry{}, fmt.Errorf("err parse date: %w", err)
+	}
+	entry.Date = int64(date)
+
+	etime, err := strconv.Atoi(es[3])
+	if err != nil {
+		return Entry{}, fmt.Errorf("err parse time: %w", err)
+	}
+	entry.Time = int64(etime)
+
+	// цена сделки в знаках инструмента, лишний знак - ошибка, а не сдвиг цены в 10 раз
+	entry.Last, err = price.Lookup(entry.Ticker).Units(es[4])
+	if err != nil {
+		return Entry{}, fmt.Errorf("err parse last: %w", err)
+	}
+
+	vol, err := strconv.Atoi(es[5])
+	if err != nil {
+		return Entry{}, fmt.Errorf("err parse vol: %w", err)
+	}
+	entry.Vol = int32(vol)
+
+	return entry, nil
+}
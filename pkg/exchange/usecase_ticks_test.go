@@ -0,0 +1,33 @@
+package exchange
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayTickers(t *testing.T) {
+	const ticks = `<TICKER>,<PER>,<DATE>,<TIME>,<LAST>,<VOL>
+SPFB.RTS,0,20190517,100000,1210.00,3
+SPFB.SI,0,20190517,100000,6500.00,1
+SPFB.SI,0,20190517,100001,6501.00,1
+SPFB.RTS,0,20190517,100002,1211.00,2
+`
+
+	var got []Entry
+	for entries := range Replay(time.Millisecond, strings.NewReader(ticks), []string{"SPFB.RTS"}) {
+		if len(entries) == 0 {
+			t.Fatal("empty group replayed")
+		}
+		got = append(got, entries...)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("replayed %d entries, want 2: %+v", len(got), got)
+	}
+	for _, e := range got {
+		if e.Ticker != "SPFB.RTS" {
+			t.Errorf("replayed %s", e.Ticker)
+		}
+	}
+}
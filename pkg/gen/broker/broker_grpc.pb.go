@@ -0,0 +1,531 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.20.1
+// source: api/proto/broker.proto
+
+package broker
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// BrokerClient is the client API for Broker service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BrokerClient interface {
+	// вход по логину и паролю клиента
+	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error)
+	// баланс, позиции и открытые заявки клиента
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// выставить заявку на покупку или продажу
+	Deal(ctx context.Context, in *DealRequest, opts ...grpc.CallOption) (*Order, error)
+	// снять ранее выставленную заявку
+	Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*Order, error)
+	// состояние заявки клиента
+	GetOrder(ctx context.Context, in *OrderRequest, opts ...grpc.CallOption) (*Order, error)
+	// история цен по инструменту
+	History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error)
+	// инструменты, которыми торгует брокер
+	Instruments(ctx context.Context, in *InstrumentsRequest, opts ...grpc.CallOption) (*InstrumentsResponse, error)
+	// поток цен, приходит каждую свечу от биржи
+	Quotes(ctx context.Context, in *QuotesRequest, opts ...grpc.CallOption) (Broker_QuotesClient, error)
+	// поток исполнений заявок клиента
+	Fills(ctx context.Context, in *FillsRequest, opts ...grpc.CallOption) (Broker_FillsClient, error)
+	// поток изменений заявок клиента: исполнения, снятия и отклонения
+	Orders(ctx context.Context, in *OrdersRequest, opts ...grpc.CallOption) (Broker_OrdersClient, error)
+}
+
+type brokerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBrokerClient(cc grpc.ClientConnInterface) BrokerClient {
+	return &brokerClient{cc}
+}
+
+func (c *brokerClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error) {
+	out := new(LoginResponse)
+	err := c.cc.Invoke(ctx, "/broker.Broker/Login", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, "/broker.Broker/Status", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) Deal(ctx context.Context, in *DealRequest, opts ...grpc.CallOption) (*Order, error) {
+	out := new(Order)
+	err := c.cc.Invoke(ctx, "/broker.Broker/Deal", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*Order, error) {
+	out := new(Order)
+	err := c.cc.Invoke(ctx, "/broker.Broker/Cancel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) GetOrder(ctx context.Context, in *OrderRequest, opts ...grpc.CallOption) (*Order, error) {
+	out := new(Order)
+	err := c.cc.Invoke(ctx, "/broker.Broker/GetOrder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error) {
+	out := new(HistoryResponse)
+	err := c.cc.Invoke(ctx, "/broker.Broker/History", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) Instruments(ctx context.Context, in *InstrumentsRequest, opts ...grpc.CallOption) (*InstrumentsResponse, error) {
+	out := new(InstrumentsResponse)
+	err := c.cc.Invoke(ctx, "/broker.Broker/Instruments", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) Quotes(ctx context.Context, in *QuotesRequest, opts ...grpc.CallOption) (Broker_QuotesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Broker_ServiceDesc.Streams[0], "/broker.Broker/Quotes", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &brokerQuotesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Broker_QuotesClient interface {
+	Recv() (*Candle, error)
+	grpc.ClientStream
+}
+
+type brokerQuotesClient struct {
+	grpc.ClientStream
+}
+
+func (x *brokerQuotesClient) Recv() (*Candle, error) {
+	m := new(Candle)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *brokerClient) Fills(ctx context.Context, in *FillsRequest, opts ...grpc.CallOption) (Broker_FillsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Broker_ServiceDesc.Streams[1], "/broker.Broker/Fills", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &brokerFillsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Broker_FillsClient interface {
+	Recv() (*Fill, error)
+	grpc.ClientStream
+}
+
+type brokerFillsClient struct {
+	grpc.ClientStream
+}
+
+func (x *brokerFillsClient) Recv() (*Fill, error) {
+	m := new(Fill)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *brokerClient) Orders(ctx context.Context, in *OrdersRequest, opts ...grpc.CallOption) (Broker_OrdersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Broker_ServiceDesc.Streams[2], "/broker.Broker/Orders", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &brokerOrdersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Broker_OrdersClient interface {
+	Recv() (*OrderUpdate, error)
+	grpc.ClientStream
+}
+
+type brokerOrdersClient struct {
+	grpc.ClientStream
+}
+
+func (x *brokerOrdersClient) Recv() (*OrderUpdate, error) {
+	m := new(OrderUpdate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BrokerServer is the server API for Broker service.
+// All implementations must embed UnimplementedBrokerServer
+// for forward compatibility
+type BrokerServer interface {
+	// вход по логину и паролю клиента
+	Login(context.Context, *LoginRequest) (*LoginResponse, error)
+	// баланс, позиции и открытые заявки клиента
+	Status(context.Context, *StatusRequest) (*StatusResponse, error)
+	// выставить заявку на покупку или продажу
+	Deal(context.Context, *DealRequest) (*Order, error)
+	// снять ранее выставленную заявку
+	Cancel(context.Context, *CancelRequest) (*Order, error)
+	// состояние заявки клиента
+	GetOrder(context.Context, *OrderRequest) (*Order, error)
+	// история цен по инструменту
+	History(context.Context, *HistoryRequest) (*HistoryResponse, error)
+	// инструменты, которыми торгует брокер
+	Instruments(context.Context, *InstrumentsRequest) (*InstrumentsResponse, error)
+	// поток цен, приходит каждую свечу от биржи
+	Quotes(*QuotesRequest, Broker_QuotesServer) error
+	// поток исполнений заявок клиента
+	Fills(*FillsRequest, Broker_FillsServer) error
+	// поток изменений заявок клиента: исполнения, снятия и отклонения
+	Orders(*OrdersRequest, Broker_OrdersServer) error
+	mustEmbedUnimplementedBrokerServer()
+}
+
+// UnimplementedBrokerServer must be embedded to have forward compatible implementations.
+type UnimplementedBrokerServer struct {
+}
+
+func (UnimplementedBrokerServer) Login(context.Context, *LoginRequest) (*LoginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedBrokerServer) Status(context.Context, *StatusRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedBrokerServer) Deal(context.Context, *DealRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Deal not implemented")
+}
+func (UnimplementedBrokerServer) Cancel(context.Context, *CancelRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cancel not implemented")
+}
+func (UnimplementedBrokerServer) GetOrder(context.Context, *OrderRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrder not implemented")
+}
+func (UnimplementedBrokerServer) History(context.Context, *HistoryRequest) (*HistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method History not implemented")
+}
+func (UnimplementedBrokerServer) Instruments(context.Context, *InstrumentsRequest) (*InstrumentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Instruments not implemented")
+}
+func (UnimplementedBrokerServer) Quotes(*QuotesRequest, Broker_QuotesServer) error {
+	return status.Errorf(codes.Unimplemented, "method Quotes not implemented")
+}
+func (UnimplementedBrokerServer) Fills(*FillsRequest, Broker_FillsServer) error {
+	return status.Errorf(codes.Unimplemented, "method Fills not implemented")
+}
+func (UnimplementedBrokerServer) Orders(*OrdersRequest, Broker_OrdersServer) error {
+	return status.Errorf(codes.Unimplemented, "method Orders not implemented")
+}
+func (UnimplementedBrokerServer) mustEmbedUnimplementedBrokerServer() {}
+
+// UnsafeBrokerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BrokerServer will
+// result in compilation errors.
+type UnsafeBrokerServer interface {
+	mustEmbedUnimplementedBrokerServer()
+}
+
+func RegisterBrokerServer(s grpc.ServiceRegistrar, srv BrokerServer) {
+	s.RegisterService(&Broker_ServiceDesc, srv)
+}
+
+func _Broker_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/broker.Broker/Login",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).Login(ctx, req.(*LoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/broker.Broker/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_Deal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DealRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).Deal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/broker.Broker/Deal",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).Deal(ctx, req.(*DealRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/broker.Broker/Cancel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).Cancel(ctx, req.(*CancelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_GetOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).GetOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/broker.Broker/GetOrder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).GetOrder(ctx, req.(*OrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_History_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).History(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/broker.Broker/History",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).History(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_Instruments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstrumentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).Instruments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/broker.Broker/Instruments",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).Instruments(ctx, req.(*InstrumentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_Quotes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QuotesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BrokerServer).Quotes(m, &brokerQuotesServer{stream})
+}
+
+type Broker_QuotesServer interface {
+	Send(*Candle) error
+	grpc.ServerStream
+}
+
+type brokerQuotesServer struct {
+	grpc.ServerStream
+}
+
+func (x *brokerQuotesServer) Send(m *Candle) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Broker_Fills_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FillsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BrokerServer).Fills(m, &brokerFillsServer{stream})
+}
+
+type Broker_FillsServer interface {
+	Send(*Fill) error
+	grpc.ServerStream
+}
+
+type brokerFillsServer struct {
+	grpc.ServerStream
+}
+
+func (x *brokerFillsServer) Send(m *Fill) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Broker_Orders_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(OrdersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BrokerServer).Orders(m, &brokerOrdersServer{stream})
+}
+
+type Broker_OrdersServer interface {
+	Send(*OrderUpdate) error
+	grpc.ServerStream
+}
+
+type brokerOrdersServer struct {
+	grpc.ServerStream
+}
+
+func (x *brokerOrdersServer) Send(m *OrderUpdate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Broker_ServiceDesc is the grpc.ServiceDesc for Broker service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Broker_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "broker.Broker",
+	HandlerType: (*BrokerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Login",
+			Handler:    _Broker_Login_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _Broker_Status_Handler,
+		},
+		{
+			MethodName: "Deal",
+			Handler:    _Broker_Deal_Handler,
+		},
+		{
+			MethodName: "Cancel",
+			Handler:    _Broker_Cancel_Handler,
+		},
+		{
+			MethodName: "GetOrder",
+			Handler:    _Broker_GetOrder_Handler,
+		},
+		{
+			MethodName: "History",
+			Handler:    _Broker_History_Handler,
+		},
+		{
+			MethodName: "Instruments",
+			Handler:    _Broker_Instruments_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Quotes",
+			Handler:       _Broker_Quotes_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Fills",
+			Handler:       _Broker_Fills_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Orders",
+			Handler:       _Broker_Orders_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api/proto/broker.proto",
+}
@@ -136,14 +136,17 @@ type Deal struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	ID       int64  `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"` // DealID который вернулся вам при простановке заявки
-	BrokerID int32  `protobuf:"varint,2,opt,name=BrokerID,proto3" json:"BrokerID,omitempty"`
-	ClientID int32  `protobuf:"varint,3,opt,name=ClientID,proto3" json:"ClientID,omitempty"`
-	Ticker   string `protobuf:"bytes,4,opt,name=Ticker,proto3" json:"Ticker,omitempty"`
-	Volume   int32  `protobuf:"varint,5,opt,name=Volume,proto3" json:"Volume,omitempty"`   // сколько купили-продали
-	Partial  bool   `protobuf:"varint,6,opt,name=Partial,proto3" json:"Partial,omitempty"` // флаг что сделка клиента исполнилсь частично
-	Time     int32  `protobuf:"varint,7,opt,name=Time,proto3" json:"Time,omitempty"`
-	Price    int64  `protobuf:"varint,8,opt,name=Price,proto3" json:"Price,omitempty"`
+	ID            int64  `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"` // DealID который вернулся вам при простановке заявки
+	BrokerID      int32  `protobuf:"varint,2,opt,name=BrokerID,proto3" json:"BrokerID,omitempty"`
+	ClientID      int32  `protobuf:"varint,3,opt,name=ClientID,proto3" json:"ClientID,omitempty"`
+	Ticker        string `protobuf:"bytes,4,opt,name=Ticker,proto3" json:"Ticker,omitempty"`
+	Volume        int32  `protobuf:"varint,5,opt,name=Volume,proto3" json:"Volume,omitempty"`   // сколько купили-продали
+	Partial       bool   `protobuf:"varint,6,opt,name=Partial,proto3" json:"Partial,omitempty"` // флаг что сделка клиента исполнилсь частично
+	Time          int32  `protobuf:"varint,7,opt,name=Time,proto3" json:"Time,omitempty"`
+	Price         int64  `protobuf:"varint,8,opt,name=Price,proto3" json:"Price,omitempty"`
+	IsBuy         bool   `protobuf:"varint,9,opt,name=IsBuy,proto3" json:"IsBuy,omitempty"`                 // true - покупка, false - продажа
+	FillID        int64  `protobuf:"varint,10,opt,name=FillID,proto3" json:"FillID,omitempty"`              // порядковый номер исполнения на бирже, только в Results
+	CorrelationID string `protobuf:"bytes,11,opt,name=CorrelationID,proto3" json:"CorrelationID,omitempty"` // сквозной ID запроса, который выставил заявку, повторяется в её исполнениях
 }
 
 func (x *Deal) Reset() {
@@ -234,6 +237,27 @@ func (x *Deal) GetPrice() int64 {
 	return 0
 }
 
+func (x *Deal) GetIsBuy() bool {
+	if x != nil {
+		return x.IsBuy
+	}
+	return false
+}
+
+func (x *Deal) GetFillID() int64 {
+	if x != nil {
+		return x.FillID
+	}
+	return 0
+}
+
+func (x *Deal) GetCorrelationID() string {
+	if x != nil {
+		return x.CorrelationID
+	}
+	return ""
+}
+
 type DealID struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -295,6 +319,9 @@ type BrokerID struct {
 	unknownFields protoimpl.UnknownFields
 
 	ID int64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	// последний полученный брокером OHLCV.ID (для Statistic) или Deal.FillID (для Results),
+	// при переподключении биржа досылает пропущенное из своего буфера
+	LastID int64 `protobuf:"varint,2,opt,name=LastID,proto3" json:"LastID,omitempty"`
 }
 
 func (x *BrokerID) Reset() {
@@ -336,6 +363,13 @@ func (x *BrokerID) GetID() int64 {
 	return 0
 }
 
+func (x *BrokerID) GetLastID() int64 {
+	if x != nil {
+		return x.LastID
+	}
+	return 0
+}
+
 type CancelResult struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -383,6 +417,219 @@ func (x *CancelResult) GetSuccess() bool {
 	return false
 }
 
+type OrdersRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BrokerID    int64 `protobuf:"varint,1,opt,name=BrokerID,proto3" json:"BrokerID,omitempty"`
+	SinceFillID int64 `protobuf:"varint,2,opt,name=SinceFillID,proto3" json:"SinceFillID,omitempty"` // вернуть исполнения с FillID больше этого
+}
+
+func (x *OrdersRequest) Reset() {
+	*x = OrdersRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_exchange_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OrdersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrdersRequest) ProtoMessage() {}
+
+func (x *OrdersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_exchange_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrdersRequest.ProtoReflect.Descriptor instead.
+func (*OrdersRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_exchange_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *OrdersRequest) GetBrokerID() int64 {
+	if x != nil {
+		return x.BrokerID
+	}
+	return 0
+}
+
+func (x *OrdersRequest) GetSinceFillID() int64 {
+	if x != nil {
+		return x.SinceFillID
+	}
+	return 0
+}
+
+type Order struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ID       int64  `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"` // DealID
+	ClientID int32  `protobuf:"varint,2,opt,name=ClientID,proto3" json:"ClientID,omitempty"`
+	Ticker   string `protobuf:"bytes,3,opt,name=Ticker,proto3" json:"Ticker,omitempty"`
+	Volume   int32  `protobuf:"varint,4,opt,name=Volume,proto3" json:"Volume,omitempty"` // объём заявки
+	Filled   int32  `protobuf:"varint,5,opt,name=Filled,proto3" json:"Filled,omitempty"` // сколько уже исполнено
+	Price    int64  `protobuf:"varint,6,opt,name=Price,proto3" json:"Price,omitempty"`
+	IsBuy    bool   `protobuf:"varint,7,opt,name=IsBuy,proto3" json:"IsBuy,omitempty"`
+}
+
+func (x *Order) Reset() {
+	*x = Order{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_exchange_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Order) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Order) ProtoMessage() {}
+
+func (x *Order) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_exchange_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Order.ProtoReflect.Descriptor instead.
+func (*Order) Descriptor() ([]byte, []int) {
+	return file_api_proto_exchange_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Order) GetID() int64 {
+	if x != nil {
+		return x.ID
+	}
+	return 0
+}
+
+func (x *Order) GetClientID() int32 {
+	if x != nil {
+		return x.ClientID
+	}
+	return 0
+}
+
+func (x *Order) GetTicker() string {
+	if x != nil {
+		return x.Ticker
+	}
+	return ""
+}
+
+func (x *Order) GetVolume() int32 {
+	if x != nil {
+		return x.Volume
+	}
+	return 0
+}
+
+func (x *Order) GetFilled() int32 {
+	if x != nil {
+		return x.Filled
+	}
+	return 0
+}
+
+func (x *Order) GetPrice() int64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+func (x *Order) GetIsBuy() bool {
+	if x != nil {
+		return x.IsBuy
+	}
+	return false
+}
+
+type OrdersState struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Open       []*Order `protobuf:"bytes,1,rep,name=Open,proto3" json:"Open,omitempty"`   // заявки брокера, которые стоят в стакане
+	Fills      []*Deal  `protobuf:"bytes,2,rep,name=Fills,proto3" json:"Fills,omitempty"` // исполнения после SinceFillID
+	LastFillID int64    `protobuf:"varint,3,opt,name=LastFillID,proto3" json:"LastFillID,omitempty"`
+}
+
+func (x *OrdersState) Reset() {
+	*x = OrdersState{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_exchange_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OrdersState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrdersState) ProtoMessage() {}
+
+func (x *OrdersState) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_exchange_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrdersState.ProtoReflect.Descriptor instead.
+func (*OrdersState) Descriptor() ([]byte, []int) {
+	return file_api_proto_exchange_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *OrdersState) GetOpen() []*Order {
+	if x != nil {
+		return x.Open
+	}
+	return nil
+}
+
+func (x *OrdersState) GetFills() []*Deal {
+	if x != nil {
+		return x.Fills
+	}
+	return nil
+}
+
+func (x *OrdersState) GetLastFillID() int64 {
+	if x != nil {
+		return x.LastFillID
+	}
+	return 0
+}
+
 var File_api_proto_exchange_proto protoreflect.FileDescriptor
 
 var file_api_proto_exchange_proto_rawDesc = []byte{
@@ -400,7 +647,7 @@ var file_api_proto_exchange_proto_rawDesc = []byte{
 	0x6c, 0x6f, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x56, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x18, 0x08,
 	0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x56, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06,
 	0x54, 0x69, 0x63, 0x6b, 0x65, 0x72, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x54, 0x69,
-	0x63, 0x6b, 0x65, 0x72, 0x22, 0xc2, 0x01, 0x0a, 0x04, 0x44, 0x65, 0x61, 0x6c, 0x12, 0x0e, 0x0a,
+	0x63, 0x6b, 0x65, 0x72, 0x22, 0x96, 0x02, 0x0a, 0x04, 0x44, 0x65, 0x61, 0x6c, 0x12, 0x0e, 0x0a,
 	0x02, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x02, 0x49, 0x44, 0x12, 0x1a, 0x0a,
 	0x08, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52,
 	0x08, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x12, 0x1a, 0x0a, 0x08, 0x43, 0x6c, 0x69,
@@ -412,26 +659,57 @@ var file_api_proto_exchange_proto_rawDesc = []byte{
 	0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x50, 0x61, 0x72, 0x74, 0x69, 0x61, 0x6c, 0x12,
 	0x12, 0x0a, 0x04, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x54,
 	0x69, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x50, 0x72, 0x69, 0x63, 0x65, 0x18, 0x08, 0x20, 0x01,
-	0x28, 0x03, 0x52, 0x05, 0x50, 0x72, 0x69, 0x63, 0x65, 0x22, 0x34, 0x0a, 0x06, 0x44, 0x65, 0x61,
-	0x6c, 0x49, 0x44, 0x12, 0x0e, 0x0a, 0x02, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52,
-	0x02, 0x49, 0x44, 0x12, 0x1a, 0x0a, 0x08, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x18,
-	0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x22,
-	0x1a, 0x0a, 0x08, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x12, 0x0e, 0x0a, 0x02, 0x49,
-	0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x02, 0x49, 0x44, 0x22, 0x28, 0x0a, 0x0c, 0x43,
-	0x61, 0x6e, 0x63, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x73,
-	0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x73, 0x75,
-	0x63, 0x63, 0x65, 0x73, 0x73, 0x32, 0x8f, 0x01, 0x0a, 0x08, 0x45, 0x78, 0x63, 0x68, 0x61, 0x6e,
-	0x67, 0x65, 0x12, 0x22, 0x0a, 0x09, 0x53, 0x74, 0x61, 0x74, 0x69, 0x73, 0x74, 0x69, 0x63, 0x12,
-	0x09, 0x2e, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x1a, 0x06, 0x2e, 0x4f, 0x48, 0x4c,
-	0x43, 0x56, 0x22, 0x00, 0x30, 0x01, 0x12, 0x1a, 0x0a, 0x06, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65,
-	0x12, 0x05, 0x2e, 0x44, 0x65, 0x61, 0x6c, 0x1a, 0x07, 0x2e, 0x44, 0x65, 0x61, 0x6c, 0x49, 0x44,
-	0x22, 0x00, 0x12, 0x22, 0x0a, 0x06, 0x43, 0x61, 0x6e, 0x63, 0x65, 0x6c, 0x12, 0x07, 0x2e, 0x44,
-	0x65, 0x61, 0x6c, 0x49, 0x44, 0x1a, 0x0d, 0x2e, 0x43, 0x61, 0x6e, 0x63, 0x65, 0x6c, 0x52, 0x65,
-	0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x1f, 0x0a, 0x07, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74,
-	0x73, 0x12, 0x09, 0x2e, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x1a, 0x05, 0x2e, 0x44,
-	0x65, 0x61, 0x6c, 0x22, 0x00, 0x30, 0x01, 0x42, 0x12, 0x5a, 0x10, 0x70, 0x6b, 0x67, 0x2f, 0x67,
-	0x65, 0x6e, 0x2f, 0x65, 0x78, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x33,
+	0x28, 0x03, 0x52, 0x05, 0x50, 0x72, 0x69, 0x63, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x49, 0x73, 0x42,
+	0x75, 0x79, 0x18, 0x09, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x49, 0x73, 0x42, 0x75, 0x79, 0x12,
+	0x16, 0x0a, 0x06, 0x46, 0x69, 0x6c, 0x6c, 0x49, 0x44, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x06, 0x46, 0x69, 0x6c, 0x6c, 0x49, 0x44, 0x12, 0x24, 0x0a, 0x0d, 0x43, 0x6f, 0x72, 0x72, 0x65,
+	0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x44, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d,
+	0x43, 0x6f, 0x72, 0x72, 0x65, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x44, 0x22, 0x34, 0x0a,
+	0x06, 0x44, 0x65, 0x61, 0x6c, 0x49, 0x44, 0x12, 0x0e, 0x0a, 0x02, 0x49, 0x44, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x02, 0x49, 0x44, 0x12, 0x1a, 0x0a, 0x08, 0x42, 0x72, 0x6f, 0x6b, 0x65,
+	0x72, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x42, 0x72, 0x6f, 0x6b, 0x65,
+	0x72, 0x49, 0x44, 0x22, 0x32, 0x0a, 0x08, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x12,
+	0x0e, 0x0a, 0x02, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x02, 0x49, 0x44, 0x12,
+	0x16, 0x0a, 0x06, 0x4c, 0x61, 0x73, 0x74, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x06, 0x4c, 0x61, 0x73, 0x74, 0x49, 0x44, 0x22, 0x28, 0x0a, 0x0c, 0x43, 0x61, 0x6e, 0x63, 0x65,
+	0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65,
+	0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73,
+	0x73, 0x22, 0x4d, 0x0a, 0x0d, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x12, 0x20,
+	0x0a, 0x0b, 0x53, 0x69, 0x6e, 0x63, 0x65, 0x46, 0x69, 0x6c, 0x6c, 0x49, 0x44, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x0b, 0x53, 0x69, 0x6e, 0x63, 0x65, 0x46, 0x69, 0x6c, 0x6c, 0x49, 0x44,
+	0x22, 0xa7, 0x01, 0x0a, 0x05, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x12, 0x0e, 0x0a, 0x02, 0x49, 0x44,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x02, 0x49, 0x44, 0x12, 0x1a, 0x0a, 0x08, 0x43, 0x6c,
+	0x69, 0x65, 0x6e, 0x74, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x43, 0x6c,
+	0x69, 0x65, 0x6e, 0x74, 0x49, 0x44, 0x12, 0x16, 0x0a, 0x06, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x72,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x72, 0x12, 0x16,
+	0x0a, 0x06, 0x56, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06,
+	0x56, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x46, 0x69, 0x6c, 0x6c, 0x65, 0x64,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x46, 0x69, 0x6c, 0x6c, 0x65, 0x64, 0x12, 0x14,
+	0x0a, 0x05, 0x50, 0x72, 0x69, 0x63, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x50,
+	0x72, 0x69, 0x63, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x49, 0x73, 0x42, 0x75, 0x79, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x05, 0x49, 0x73, 0x42, 0x75, 0x79, 0x22, 0x66, 0x0a, 0x0b, 0x4f, 0x72,
+	0x64, 0x65, 0x72, 0x73, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x1a, 0x0a, 0x04, 0x4f, 0x70, 0x65,
+	0x6e, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x06, 0x2e, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x52,
+	0x04, 0x4f, 0x70, 0x65, 0x6e, 0x12, 0x1b, 0x0a, 0x05, 0x46, 0x69, 0x6c, 0x6c, 0x73, 0x18, 0x02,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x05, 0x2e, 0x44, 0x65, 0x61, 0x6c, 0x52, 0x05, 0x46, 0x69, 0x6c,
+	0x6c, 0x73, 0x12, 0x1e, 0x0a, 0x0a, 0x4c, 0x61, 0x73, 0x74, 0x46, 0x69, 0x6c, 0x6c, 0x49, 0x44,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x4c, 0x61, 0x73, 0x74, 0x46, 0x69, 0x6c, 0x6c,
+	0x49, 0x44, 0x32, 0xb9, 0x01, 0x0a, 0x08, 0x45, 0x78, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x12,
+	0x22, 0x0a, 0x09, 0x53, 0x74, 0x61, 0x74, 0x69, 0x73, 0x74, 0x69, 0x63, 0x12, 0x09, 0x2e, 0x42,
+	0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x1a, 0x06, 0x2e, 0x4f, 0x48, 0x4c, 0x43, 0x56, 0x22,
+	0x00, 0x30, 0x01, 0x12, 0x1a, 0x0a, 0x06, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x12, 0x05, 0x2e,
+	0x44, 0x65, 0x61, 0x6c, 0x1a, 0x07, 0x2e, 0x44, 0x65, 0x61, 0x6c, 0x49, 0x44, 0x22, 0x00, 0x12,
+	0x22, 0x0a, 0x06, 0x43, 0x61, 0x6e, 0x63, 0x65, 0x6c, 0x12, 0x07, 0x2e, 0x44, 0x65, 0x61, 0x6c,
+	0x49, 0x44, 0x1a, 0x0d, 0x2e, 0x43, 0x61, 0x6e, 0x63, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c,
+	0x74, 0x22, 0x00, 0x12, 0x1f, 0x0a, 0x07, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x12, 0x09,
+	0x2e, 0x42, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x49, 0x44, 0x1a, 0x05, 0x2e, 0x44, 0x65, 0x61, 0x6c,
+	0x22, 0x00, 0x30, 0x01, 0x12, 0x28, 0x0a, 0x06, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x73, 0x12, 0x0e,
+	0x2e, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0c,
+	0x2e, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x73, 0x53, 0x74, 0x61, 0x74, 0x65, 0x22, 0x00, 0x42, 0x12,
+	0x5a, 0x10, 0x70, 0x6b, 0x67, 0x2f, 0x67, 0x65, 0x6e, 0x2f, 0x65, 0x78, 0x63, 0x68, 0x61, 0x6e,
+	0x67, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -446,28 +724,35 @@ func file_api_proto_exchange_proto_rawDescGZIP() []byte {
 	return file_api_proto_exchange_proto_rawDescData
 }
 
-var file_api_proto_exchange_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_api_proto_exchange_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_api_proto_exchange_proto_goTypes = []interface{}{
-	(*OHLCV)(nil),        // 0: OHLCV
-	(*Deal)(nil),         // 1: Deal
-	(*DealID)(nil),       // 2: DealID
-	(*BrokerID)(nil),     // 3: BrokerID
-	(*CancelResult)(nil), // 4: CancelResult
+	(*OHLCV)(nil),         // 0: OHLCV
+	(*Deal)(nil),          // 1: Deal
+	(*DealID)(nil),        // 2: DealID
+	(*BrokerID)(nil),      // 3: BrokerID
+	(*CancelResult)(nil),  // 4: CancelResult
+	(*OrdersRequest)(nil), // 5: OrdersRequest
+	(*Order)(nil),         // 6: Order
+	(*OrdersState)(nil),   // 7: OrdersState
 }
 var file_api_proto_exchange_proto_depIdxs = []int32{
-	3, // 0: Exchange.Statistic:input_type -> BrokerID
-	1, // 1: Exchange.Create:input_type -> Deal
-	2, // 2: Exchange.Cancel:input_type -> DealID
-	3, // 3: Exchange.Results:input_type -> BrokerID
-	0, // 4: Exchange.Statistic:output_type -> OHLCV
-	2, // 5: Exchange.Create:output_type -> DealID
-	4, // 6: Exchange.Cancel:output_type -> CancelResult
-	1, // 7: Exchange.Results:output_type -> Deal
-	4, // [4:8] is the sub-list for method output_type
-	0, // [0:4] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	6, // 0: OrdersState.Open:type_name -> Order
+	1, // 1: OrdersState.Fills:type_name -> Deal
+	3, // 2: Exchange.Statistic:input_type -> BrokerID
+	1, // 3: Exchange.Create:input_type -> Deal
+	2, // 4: Exchange.Cancel:input_type -> DealID
+	3, // 5: Exchange.Results:input_type -> BrokerID
+	5, // 6: Exchange.Orders:input_type -> OrdersRequest
+	0, // 7: Exchange.Statistic:output_type -> OHLCV
+	2, // 8: Exchange.Create:output_type -> DealID
+	4, // 9: Exchange.Cancel:output_type -> CancelResult
+	1, // 10: Exchange.Results:output_type -> Deal
+	7, // 11: Exchange.Orders:output_type -> OrdersState
+	7, // [7:12] is the sub-list for method output_type
+	2, // [2:7] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_api_proto_exchange_proto_init() }
@@ -536,6 +821,42 @@ func file_api_proto_exchange_proto_init() {
 				return nil
 			}
 		}
+		file_api_proto_exchange_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*OrdersRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_exchange_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Order); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_exchange_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*OrdersState); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -543,7 +864,7 @@ func file_api_proto_exchange_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_api_proto_exchange_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
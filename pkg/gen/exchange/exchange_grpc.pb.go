@@ -33,7 +33,11 @@ type ExchangeClient interface {
 	Cancel(ctx context.Context, in *DealID, opts ...grpc.CallOption) (*CancelResult, error)
 	// исполнение заявок от биржи к брокеру
 	// устанавливается 1 раз брокером и при исполнении какой-то заявки
+	// BrokerID.LastID - последний полученный FillID, пропущенные исполнения будут досланы
 	Results(ctx context.Context, in *BrokerID, opts ...grpc.CallOption) (Exchange_ResultsClient, error)
+	// открытые заявки брокера и его исполнения с указанного момента,
+	// брокер сверяет по ним свои заявки после старта и переподключения
+	Orders(ctx context.Context, in *OrdersRequest, opts ...grpc.CallOption) (*OrdersState, error)
 }
 
 type exchangeClient struct {
@@ -126,6 +130,15 @@ func (x *exchangeResultsClient) Recv() (*Deal, error) {
 	return m, nil
 }
 
+func (c *exchangeClient) Orders(ctx context.Context, in *OrdersRequest, opts ...grpc.CallOption) (*OrdersState, error) {
+	out := new(OrdersState)
+	err := c.cc.Invoke(ctx, "/Exchange/Orders", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ExchangeServer is the server API for Exchange service.
 // All implementations must embed UnimplementedExchangeServer
 // for forward compatibility
@@ -141,7 +154,11 @@ type ExchangeServer interface {
 	Cancel(context.Context, *DealID) (*CancelResult, error)
 	// исполнение заявок от биржи к брокеру
 	// устанавливается 1 раз брокером и при исполнении какой-то заявки
+	// BrokerID.LastID - последний полученный FillID, пропущенные исполнения будут досланы
 	Results(*BrokerID, Exchange_ResultsServer) error
+	// открытые заявки брокера и его исполнения с указанного момента,
+	// брокер сверяет по ним свои заявки после старта и переподключения
+	Orders(context.Context, *OrdersRequest) (*OrdersState, error)
 	mustEmbedUnimplementedExchangeServer()
 }
 
@@ -161,6 +178,9 @@ func (UnimplementedExchangeServer) Cancel(context.Context, *DealID) (*CancelResu
 func (UnimplementedExchangeServer) Results(*BrokerID, Exchange_ResultsServer) error {
 	return status.Errorf(codes.Unimplemented, "method Results not implemented")
 }
+func (UnimplementedExchangeServer) Orders(context.Context, *OrdersRequest) (*OrdersState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Orders not implemented")
+}
 func (UnimplementedExchangeServer) mustEmbedUnimplementedExchangeServer() {}
 
 // UnsafeExchangeServer may be embedded to opt out of forward compatibility for this service.
@@ -252,6 +272,24 @@ func (x *exchangeResultsServer) Send(m *Deal) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Exchange_Orders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OrdersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExchangeServer).Orders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Exchange/Orders",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExchangeServer).Orders(ctx, req.(*OrdersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Exchange_ServiceDesc is the grpc.ServiceDesc for Exchange service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -267,6 +305,10 @@ var Exchange_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Cancel",
 			Handler:    _Exchange_Cancel_Handler,
 		},
+		{
+			MethodName: "Orders",
+			Handler:    _Exchange_Orders_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
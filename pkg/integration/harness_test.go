@@ -0,0 +1,497 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"trading/pkg/broker"
+	"trading/pkg/client"
+	"trading/pkg/exchange"
+	api "trading/pkg/gen/broker"
+	gen "trading/pkg/gen/exchange"
+	"trading/pkg/models"
+	"trading/pkg/price"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// waitTimeout сколько ждать сообщения в телеграм или свечи у брокера
+const waitTimeout = 5 * time.Second
+
+// brokerID ID брокера на бирже
+const brokerID = 1
+
+// harness биржа, брокер и клиент в одном процессе: grpc идёт через bufconn,
+// http - через httptest, телеграм заменён на fakeTelegram. Сделки биржа берёт
+// из testdata/ticks.csv по одной секунде истории на каждый step
+type harness struct {
+	t *testing.T
+
+	ticks   *exchange.TickReader
+	entries chan []exchange.Entry
+	candles <-chan models.Candle
+
+	broker     *broker.Broker
+	brokerHTTP *httptest.Server
+	telegram   *client.TelegramClient
+	bot        *fakeTelegram
+	streams    *streamWatcher
+
+	lastMessageID int
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	price.Register(price.Spec{Ticker: "SPFB.RTS", Scale: 2, TickSize: 10, PointValue: 100})
+
+	f, err := os.Open(filepath.Join("testdata", "ticks.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &harness{
+		t:       t,
+		ticks:   exchange.NewTickReader(f),
+		entries: make(chan []exchange.Entry),
+		streams: newStreamWatcher(),
+		// ID сообщений бота начинаются далеко от ID сообщений пользователя
+		lastMessageID: 1000,
+	}
+
+	// биржа
+	exch := exchange.NewExchange(time.Second)
+	exchLis := bufconn.Listen(1 << 20)
+	stopExchange := exch.Serve(exchLis, grpc.ChainStreamInterceptor(h.streams.intercept))
+
+	var done sync.WaitGroup
+	done.Add(1)
+	go func() {
+		defer done.Done()
+		exch.Run(ctx, h.entries)
+	}()
+
+	// брокер
+	exchConn := dial(t, exchLis)
+	repo, err := broker.NewSQLiteRepository(ctx, filepath.Join(t.TempDir(), "broker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.SeedDevClients(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	h.broker = broker.NewBroker(brokerID, repo, gen.NewExchangeClient(exchConn), broker.RiskLimits{}, models.PnLAverage)
+	candles, unsubscribe := h.broker.SubscribeCandles()
+	h.candles = candles
+
+	conn := broker.NewExchangeConn(h.broker, broker.Backoff{Min: 10 * time.Millisecond, Max: 100 * time.Millisecond, Factor: 2})
+	done.Add(1)
+	go func() {
+		defer done.Done()
+		conn.Run(ctx)
+	}()
+
+	h.brokerHTTP = httptest.NewServer(broker.NewHTTPHandler(h.broker, conn))
+
+	brokerLis := bufconn.Listen(1 << 20)
+	grpcServer := broker.NewGRPCServer(h.broker)
+	server := grpc.NewServer(grpc.ChainStreamInterceptor(h.streams.intercept))
+	api.RegisterBrokerServer(server, grpcServer)
+	go func() {
+		if err := server.Serve(brokerLis); err != nil {
+			t.Logf("broker grpc server stopped: %v", err)
+		}
+	}()
+
+	// клиент
+	clientRepo, err := client.NewSQLiteRepository(ctx, filepath.Join(t.TempDir(), "client.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bClient := client.NewClient(h.brokerHTTP.URL)
+	auth := client.NewAuth(bClient, clientRepo)
+	alerts, err := client.NewAlerts(ctx, clientRepo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.NewBrokerStream("bufnet", grpc.WithContextDialer(
+		func(ctx context.Context, _ string) (net.Conn, error) { return brokerLis.DialContext(ctx) },
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make(chan tgbotapi.Chattable, 100)
+	h.bot = newFakeTelegram(out)
+
+	mux := http.NewServeMux()
+	mux.Handle("/login", client.NewLoginHandler(auth, out))
+	web := httptest.NewServer(mux)
+
+	h.telegram = client.NewTelegramClient(bClient, auth, alerts, web.URL+"/login", out)
+	go alerts.Watch(ctx, stream.Quotes(ctx, nil), h.telegram.NotifyAlert)
+
+	notifier := client.NewNotifier(ctx, stream, h.telegram.NotifyOrder)
+	auth.OnLogin, auth.OnLogout = notifier.Watch, notifier.Stop
+
+	t.Cleanup(func() {
+		cancel()
+		web.Close()
+		grpcServer.Shutdown()
+		server.Stop()
+		h.brokerHTTP.Close()
+		stopExchange()
+		done.Wait()
+
+		unsubscribe()
+		exchConn.Close()
+		clientRepo.Close()
+		repo.Close()
+		h.bot.stop()
+	})
+
+	// брокер подписан на свечи и исполнения, клиент - на цены для алертов
+	h.streams.wait(t, "Statistic", 1)
+	h.streams.wait(t, "Results", 1)
+	h.streams.wait(t, "Quotes", 1)
+
+	return h
+}
+
+// dial соединение с grpc сервером, который слушает bufconn
+func dial(t *testing.T, lis *bufconn.Listener) *grpc.ClientConn {
+	t.Helper()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+// step отдаёт бирже следующую секунду истории и ждёт, пока свеча дойдёт до брокера
+func (h *harness) step() models.Candle {
+	h.t.Helper()
+
+	entries, err := h.ticks.Next()
+	if errors.Is(err, io.EOF) {
+		h.t.Fatal("ticks are over")
+	}
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	select {
+	case h.entries <- entries:
+	case <-time.After(waitTimeout):
+		h.t.Fatal("exchange doesnt read ticks")
+	}
+
+	select {
+	case c := <-h.candles:
+		return c
+	case <-time.After(waitTimeout):
+		h.t.Fatal("broker didnt receive candle")
+	}
+
+	return models.Candle{}
+}
+
+// command команда или кнопка в чате, обрабатывается сразу, как в боте.
+// Ответы ищутся только среди сообщений после неё
+func (h *harness) command(chatID int64, messageID int, text string) {
+	h.bot.mark(chatID)
+	h.telegram.HandleCommand(models.Message{ChatID: chatID, UserID: chatID, MessageID: messageID, Text: text})
+}
+
+// input текст пользователя в чате
+func (h *harness) input(chatID int64, text string) {
+	h.lastMessageID++
+	h.bot.mark(chatID)
+	h.telegram.HandleUserInput(models.Message{ChatID: chatID, UserID: chatID, MessageID: h.lastMessageID, Text: text})
+}
+
+// login входит в брокера из чата по ссылке, которую прислал бот,
+// и ждёт подписки чата на его заявки
+func (h *harness) login(chatID int64, login, password string) {
+	h.t.Helper()
+
+	h.command(chatID, 0, "start")
+	link := h.bot.wait(h.t, chatID, "войдите в брокера").url
+	if link == "" {
+		h.t.Fatal("no login link in message")
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	form := url.Values{"nonce": {u.Query().Get("nonce")}, "login": {login}, "password": {password}}
+	resp, err := http.PostForm(u.Scheme+"://"+u.Host+u.Path, form)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	h.bot.wait(h.t, chatID, "Вы вошли в брокера как "+login)
+	h.streams.wait(h.t, "Orders", 1)
+}
+
+// placeOrder выставляет заявку через мастер сделки в чате
+func (h *harness) placeOrder(chatID int64, side, ticker, orderPrice, volume string) sentMessage {
+	h.t.Helper()
+
+	h.command(chatID, 0, "deal_start")
+	wizard := h.bot.wait(h.t, chatID, "Выберите действие")
+
+	h.command(chatID, wizard.id, "deal select "+side)
+	h.command(chatID, wizard.id, "deal select "+ticker)
+	h.input(chatID, orderPrice)
+	h.input(chatID, volume)
+	h.bot.wait(h.t, chatID, "Проверьте заявку")
+
+	h.command(chatID, wizard.id, "deal open")
+
+	return h.bot.wait(h.t, chatID, "выставлена")
+}
+
+// streamWatcher отмечает grpc потоки, которые уже подписались на события,
+// подписка видна по заголовкам ответа
+type streamWatcher struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	open    map[string]int
+}
+
+func newStreamWatcher() *streamWatcher {
+	w := &streamWatcher{open: make(map[string]int)}
+	w.changed = sync.NewCond(&w.mu)
+
+	return w
+}
+
+func (w *streamWatcher) intercept(
+	srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	method := path.Base(info.FullMethod)
+	s := &watchedStream{ServerStream: stream, subscribed: func() {
+		w.mu.Lock()
+		w.open[method]++
+		w.mu.Unlock()
+		w.changed.Broadcast()
+	}}
+
+	err := handler(srv, s)
+
+	if s.sent {
+		w.mu.Lock()
+		w.open[method]--
+		w.mu.Unlock()
+	}
+
+	return err
+}
+
+// wait ждёт, пока подпишутся n потоков method
+func (w *streamWatcher) wait(t *testing.T, method string, n int) {
+	t.Helper()
+
+	timer := time.AfterFunc(waitTimeout, w.changed.Broadcast)
+	defer timer.Stop()
+	deadline := time.Now().Add(waitTimeout)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.open[method] < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s streams: %d, want %d", method, w.open[method], n)
+		}
+		w.changed.Wait()
+	}
+}
+
+type watchedStream struct {
+	grpc.ServerStream
+	subscribed func()
+	sent       bool
+}
+
+func (s *watchedStream) SendHeader(md metadata.MD) error {
+	err := s.ServerStream.SendHeader(md)
+	if err == nil && !s.sent {
+		s.sent = true
+		s.subscribed()
+	}
+
+	return err
+}
+
+// sentMessage сообщение бота: новое или правка старого
+type sentMessage struct {
+	chatID int64
+	id     int
+	text   string
+	url    string // ссылка первой кнопки со ссылкой
+}
+
+// fakeTelegram вместо телеграма: сохраняет всё, что клиент отправил в чаты,
+// новым сообщениям выдаёт ID, как телеграм
+type fakeTelegram struct {
+	mu       sync.Mutex
+	changed  chan struct{}
+	messages []sentMessage
+	from     map[int64]int // с какого сообщения wait ищет в чате
+	lastID   int
+	done     chan struct{}
+}
+
+func newFakeTelegram(out <-chan tgbotapi.Chattable) *fakeTelegram {
+	f := &fakeTelegram{
+		changed: make(chan struct{}),
+		from:    make(map[int64]int),
+		lastID:  1,
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		for {
+			select {
+			case <-f.done:
+				return
+			case msg := <-out:
+				f.receive(msg)
+			}
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeTelegram) stop() {
+	close(f.done)
+}
+
+func (f *fakeTelegram) receive(msg tgbotapi.Chattable) {
+	var m sentMessage
+
+	switch msg := msg.(type) {
+	case tgbotapi.MessageConfig:
+		f.lastID++
+		m = sentMessage{chatID: msg.ChatID, id: f.lastID, text: msg.Text}
+		if markup, ok := msg.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup); ok {
+			m.url = buttonURL(markup)
+		}
+	case tgbotapi.EditMessageTextConfig:
+		m = sentMessage{chatID: msg.ChatID, id: msg.MessageID, text: msg.Text}
+	// у картинок вместо текста подпись
+	case tgbotapi.PhotoConfig:
+		f.lastID++
+		m = sentMessage{chatID: msg.ChatID, id: f.lastID, text: msg.Caption}
+	case tgbotapi.EditMessageMediaConfig:
+		m = sentMessage{chatID: msg.ChatID, id: msg.MessageID}
+		if photo, ok := msg.Media.(tgbotapi.InputMediaPhoto); ok {
+			m.text = photo.Caption
+		}
+	case tgbotapi.EditMessageCaptionConfig:
+		m = sentMessage{chatID: msg.ChatID, id: msg.MessageID, text: msg.Caption}
+	default:
+		// удаление сообщений и ответы на кнопки тестам не нужны
+		return
+	}
+
+	// текст в markdown без экранирования, чтобы искать по нему
+	if strings.Contains(m.text, "\\") {
+		m.text = strings.ReplaceAll(m.text, "\\", "")
+	}
+
+	f.mu.Lock()
+	f.messages = append(f.messages, m)
+	close(f.changed)
+	f.changed = make(chan struct{})
+	f.mu.Unlock()
+}
+
+func buttonURL(markup tgbotapi.InlineKeyboardMarkup) string {
+	for _, row := range markup.InlineKeyboard {
+		for _, b := range row {
+			if b.URL != nil {
+				return *b.URL
+			}
+		}
+	}
+
+	return ""
+}
+
+// mark дальше wait ищет в чате только сообщения, отправленные после этого
+// вызова: ответы на прошлые команды с тем же текстом не подходят
+func (f *fakeTelegram) mark(chatID int64) {
+	f.mu.Lock()
+	f.from[chatID] = len(f.messages)
+	f.mu.Unlock()
+}
+
+// wait первое сообщение чата с текстом text после mark, ждёт его не дольше waitTimeout
+func (f *fakeTelegram) wait(t *testing.T, chatID int64, text string) sentMessage {
+	t.Helper()
+
+	timeout := time.After(waitTimeout)
+	for {
+		f.mu.Lock()
+		changed := f.changed
+		for _, m := range f.messages[f.from[chatID]:] {
+			if m.chatID == chatID && strings.Contains(m.text, text) {
+				f.mu.Unlock()
+
+				return m
+			}
+		}
+		f.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("no message %q in chat %d, got:\n%s", text, chatID, f.dump(chatID))
+		}
+	}
+}
+
+func (f *fakeTelegram) dump(chatID int64) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var b strings.Builder
+	for _, m := range f.messages {
+		if m.chatID == chatID {
+			b.WriteString(m.text + "\n")
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"trading/pkg/models"
+)
+
+// чат пользователя и его клиент у брокера из тестовых клиентов миграций
+const (
+	chatID   = 42
+	login    = "Ivan"
+	password = "qwerty"
+	clientID = 2
+)
+
+func TestBuyFilledWhenPriceDrops(t *testing.T) {
+	h := newHarness(t)
+	h.login(chatID, login, password)
+
+	if c := h.step(); c.Close != 121000 {
+		t.Fatalf("first close = %d, want 121000", c.Close)
+	}
+
+	// у тестовых клиентов 2000 рублей, на один контракт хватает
+	placed := h.placeOrder(chatID, models.DealBuy, "SPFB.RTS", "1208.50", "1")
+	var orderID int64
+	if _, err := fmt.Sscanf(placed.text, "Заявка %d выставлена", &orderID); err != nil {
+		t.Fatalf("cant parse order id from %q: %v", placed.text, err)
+	}
+
+	// 1209.50 - до заявки цена не дошла, 1208.50 - исполнение
+	h.step()
+	h.step()
+
+	h.bot.wait(t, chatID, fmt.Sprintf("✅ Заявка #%d SPFB.RTS покупка 1 по 1208.50 исполнена: 1 по 1208.50", orderID))
+
+	status, err := h.broker.Status(context.Background(), clientID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Body.Positions) != 1 || status.Body.Positions[0].Volume != 1 {
+		t.Fatalf("positions = %+v, want 1 SPFB.RTS", status.Body.Positions)
+	}
+	if len(status.Body.OpenOrders) != 0 {
+		t.Errorf("open orders = %+v, want none", status.Body.OpenOrders)
+	}
+}
+
+func TestCancelOrderFromChat(t *testing.T) {
+	h := newHarness(t)
+	h.login(chatID, login, password)
+	h.step()
+
+	placed := h.placeOrder(chatID, models.DealSell, "SPFB.RTS", "1215.00", "1")
+	var orderID int64
+	if _, err := fmt.Sscanf(placed.text, "Заявка %d выставлена", &orderID); err != nil {
+		t.Fatalf("cant parse order id from %q: %v", placed.text, err)
+	}
+
+	h.command(chatID, 0, fmt.Sprintf("cancel %d", orderID))
+	h.bot.wait(t, chatID, fmt.Sprintf("Заявка %d снята", orderID))
+	h.bot.wait(t, chatID, fmt.Sprintf("🚫 Заявка #%d SPFB.RTS продажа 1 по 1215.00 снята", orderID))
+
+	// снятая заявка не исполняется, даже когда цена до неё дошла бы
+	for i := 0; i < 5; i++ {
+		h.step()
+	}
+
+	status, err := h.broker.Status(context.Background(), clientID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Body.Positions) != 0 || len(status.Body.OpenOrders) != 0 {
+		t.Fatalf("status = %+v, want no positions and orders", status.Body)
+	}
+}
+
+func TestPriceAlert(t *testing.T) {
+	h := newHarness(t)
+	h.step()
+
+	// цена 1210.00 уже выше 1209.00, алерт ждёт возврата под уровень
+	h.command(chatID, 0, "alert SPFB.RTS above 1209.00")
+	h.bot.wait(t, chatID, "алерт сработает, когда она вернётся")
+	h.command(chatID, 0, "alert SPFB.RTS above 1211.20")
+	h.bot.wait(t, chatID, "🔔 Алерт 2")
+
+	// 1209.50, 1208.00, 1209.00 - ниже уровня, затем 1211.50
+	for i := 0; i < 4; i++ {
+		h.step()
+	}
+
+	h.bot.wait(t, chatID, "цена 1211.50, последняя 1211.50")
+}
+
+func TestWrongPriceRejectedInWizard(t *testing.T) {
+	h := newHarness(t)
+	h.login(chatID, login, password)
+	h.step()
+
+	h.command(chatID, 0, "deal_start")
+	wizard := h.bot.wait(t, chatID, "Выберите действие")
+	h.command(chatID, wizard.id, "deal select "+models.DealBuy)
+	h.command(chatID, wizard.id, "deal select SPFB.RTS")
+	h.input(chatID, "1208.55")
+
+	h.bot.wait(t, chatID, "❗")
+}
+
+func TestPricesChart(t *testing.T) {
+	h := newHarness(t)
+	h.step()
+	h.step()
+
+	h.command(chatID, 0, "prices")
+	chart := h.bot.wait(t, chatID, "SPFB.RTS, последняя цена 1209.50")
+
+	h.command(chatID, chart.id, "prices SPFB.RTS 7")
+	h.bot.wait(t, chatID, "unknown timeframe")
+
+	// нет цен по инструменту - правится подпись того же сообщения
+	h.command(chatID, chart.id, "prices NOPE 1")
+	if note := h.bot.wait(t, chatID, "Брокер сейчас не торгует NOPE"); note.id != chart.id {
+		t.Errorf("note sent as message %d, want edit of chart %d", note.id, chart.id)
+	}
+}
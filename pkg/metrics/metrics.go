@@ -0,0 +1,84 @@
+// Package metrics общие для сервисов метрики prometheus: grpc и http запросы и /metrics
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Завершённые grpc вызовы по методу и коду ответа.",
+	}, []string{"method", "code"})
+
+	grpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Время обработки unary grpc вызова.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	grpcStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "grpc_server_streams",
+		Help: "Открытые серверные grpc потоки.",
+	}, []string{"method"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Время обработки http запроса.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler", "method", "code"})
+)
+
+// Handler отдаёт метрики процесса
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// UnaryServerInterceptor считает вызовы и время их обработки
+func UnaryServerInterceptor(
+	ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	grpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+	grpcHandled.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+
+	return resp, err
+}
+
+// StreamServerInterceptor считает открытые потоки и коды, с которыми они закрылись.
+// Время жизни потока не меряется - подписки живут, пока клиент подключён
+func StreamServerInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+
+	streams := grpcStreams.WithLabelValues(info.FullMethod)
+	streams.Inc()
+	defer streams.Dec()
+
+	err := handler(srv, stream)
+	grpcHandled.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+
+	return err
+}
+
+// InstrumentHTTP меряет время ответа обработчика, name - метка handler,
+// обычно шаблон пути
+func InstrumentHTTP(name string, h http.Handler) http.Handler {
+	return promhttp.InstrumentHandlerDuration(
+		httpDuration.MustCurryWith(prometheus.Labels{"handler": name}), h,
+	)
+}
@@ -0,0 +1,89 @@
+package models
+
+// запросы и ответы json апи брокера, см README
+
+const (
+	DealBuy  = "BUY"
+	DealSell = "SELL"
+)
+
+// Deal параметры новой заявки
+type Deal struct {
+	Ticker string `json:"ticker"`
+	Type   string `json:"type"` // BUY или SELL
+	Volume int32  `json:"volume"`
+	Price  int64  `json:"price"`
+	// ClientOrderID ключ идемпотентности, повтор с тем же ID вернёт уже выставленную заявку
+	ClientOrderID string `json:"client_order_id,omitempty"`
+}
+
+// DealRequest POST /api/v1/deal
+type DealRequest struct {
+	Deal Deal `json:"deal"`
+}
+
+type DealResponse struct {
+	Body Order `json:"body"`
+}
+
+// CancelRequest POST /api/v1/cancel, заявка ищется по client_order_id, если он задан, иначе по id
+type CancelRequest struct {
+	ID            int64  `json:"id"`
+	ClientOrderID string `json:"client_order_id,omitempty"`
+}
+
+type CancelResponse struct {
+	Body struct {
+		ID     int64       `json:"id"`
+		Status OrderStatus `json:"status"`
+	} `json:"body"`
+}
+
+// OrderResponse GET /api/v1/order?id=1 или ?client_order_id=abc
+type OrderResponse struct {
+	Body Order `json:"body"`
+}
+
+// HistoryResponse GET /api/v1/history?ticker=SPFB.RTS&seconds=300, seconds - глубина
+// истории, не больше часа
+type HistoryResponse struct {
+	Body struct {
+		Ticker string   `json:"ticker"`
+		Prices []Candle `json:"prices"`
+	} `json:"body"`
+}
+
+// Instrument инструмент, которым торгует брокер, LastPrice - 0 если цены ещё нет.
+// Scale, TickSize и PointValue - его price.Spec, цены в json - в его знаках
+type Instrument struct {
+	Ticker     string `json:"ticker"`
+	LastPrice  int64  `json:"last_price"`
+	Scale      int    `json:"scale"`
+	TickSize   int64  `json:"tick_size"`
+	PointValue int64  `json:"point_value"` // копейки, в json - рубли
+}
+
+// InstrumentsResponse GET /api/v1/instruments
+type InstrumentsResponse struct {
+	Body []Instrument `json:"body"`
+}
+
+// LoginRequest POST /api/v1/login, в ответ токен для заголовка Authorization: Bearer
+type LoginRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type LoginResponse struct {
+	Body struct {
+		ClientID  int64  `json:"client_id"`
+		Token     string `json:"token"`
+		ExpiresAt int64  `json:"expires_at"` // unix время, после которого токен не действует
+	} `json:"body"`
+}
+
+// ErrorResponse тело ответа апи брокера при ошибке
+type ErrorResponse struct {
+	Error  string `json:"error"`
+	Reason string `json:"reason,omitempty"` // код причины отказа в заявке, например MAX_POSITION
+}
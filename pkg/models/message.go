@@ -2,6 +2,9 @@ package models
 
 type Message struct {
 	ChatID    int64
+	UserID    int64 // пользователь телеграма, который написал сообщение или нажал кнопку
 	MessageID int
 	Text      string
+	// CorrelationID ID запроса, выданный обновлению телеграма, с ним уходят запросы к брокеру
+	CorrelationID string
 }
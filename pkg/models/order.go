@@ -0,0 +1,89 @@
+package models
+
+// OrderStatus состояние заявки клиента
+type OrderStatus string
+
+const (
+	OrderNew       OrderStatus = "new"
+	OrderPlaced    OrderStatus = "placed"
+	OrderPartial   OrderStatus = "partial"
+	OrderFilled    OrderStatus = "filled"
+	OrderCancelled OrderStatus = "cancelled"
+	OrderRejected  OrderStatus = "rejected"
+)
+
+// IsOpen заявка ещё стоит в стакане биржи
+func (s OrderStatus) IsOpen() bool {
+	return s == OrderNew || s == OrderPlaced || s == OrderPartial
+}
+
+// Client клиент брокера
+type Client struct {
+	ID           int64  `json:"id"`
+	LoginID      int64  `json:"login_id"`
+	Login        string `json:"login"`
+	PasswordHash string `json:"-"`
+	Balance      int64  `json:"balance"`
+}
+
+// Position позиция клиента по инструменту и её оценка по последней цене
+type Position struct {
+	Ticker        string  `json:"ticker"`
+	Volume        int64   `json:"volume"`
+	AvgPrice      float64 `json:"avg_price"`
+	MarkPrice     int64   `json:"mark_price"`
+	RealizedPnL   float64 `json:"realized_pnl"`
+	UnrealizedPnL float64 `json:"unrealized_pnl"`
+}
+
+// PnLMethod способ расчёта средней цены входа и реализованного результата
+type PnLMethod string
+
+const (
+	PnLAverage PnLMethod = "average" // средняя цена
+	PnLFIFO    PnLMethod = "fifo"    // первая купленная - первая проданная
+)
+
+// Order заявка клиента, DealID - идентификатор заявки на бирже,
+// ClientOrderID - идентификатор, который выдал сам клиент
+type Order struct {
+	ID            int64       `json:"id"`
+	ClientOrderID string      `json:"client_order_id,omitempty"`
+	DealID        int64       `json:"deal_id"`
+	ClientID      int64       `json:"client_id"`
+	Ticker        string      `json:"ticker"`
+	Volume        int32       `json:"volume"`
+	Filled        int32       `json:"filled"`
+	Price         int64       `json:"price"`
+	IsBuy         bool        `json:"is_buy"`
+	Status        OrderStatus `json:"status"`
+}
+
+// MaxClientOrderIDLen ограничение длины ClientOrderID
+const MaxClientOrderIDLen = 64
+
+// Fill исполнение (полное или частичное) заявки на бирже
+type Fill struct {
+	FillID   int64  `json:"fill_id"`
+	DealID   int64  `json:"deal_id"`
+	ClientID int64  `json:"client_id"`
+	Ticker   string `json:"ticker"`
+	Volume   int32  `json:"volume"`
+	Partial  bool   `json:"partial"`
+	Time     int64  `json:"time"`
+	Price    int64  `json:"price"`
+	IsBuy    bool   `json:"is_buy"`
+}
+
+// Candle OHLCV свеча по инструменту
+type Candle struct {
+	ID       int64  `json:"id"`
+	Time     int64  `json:"time"`
+	Interval int32  `json:"interval"`
+	Open     int64  `json:"open"`
+	High     int64  `json:"high"`
+	Low      int64  `json:"low"`
+	Close    int64  `json:"close"`
+	Volume   int32  `json:"volume"`
+	Ticker   string `json:"ticker"`
+}
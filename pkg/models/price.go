@@ -0,0 +1,235 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"trading/pkg/price"
+)
+
+// В json апи цены - десятичные числа в знаках инструмента (1209.90), внутри и в
+// grpc - int64 в минимальных единицах (120990). Переводит по price.Lookup
+
+// decimal цена units инструмента ticker числом в json
+func decimal(ticker string, units int64) json.Number {
+	return json.Number(price.Lookup(ticker).Format(units))
+}
+
+// units цена из json в минимальных единицах, нет поля - 0
+func units(ticker string, n json.Number) (int64, error) {
+	if n == "" {
+		return 0, nil
+	}
+
+	u, err := price.Lookup(ticker).Units(n.String())
+	if err != nil {
+		return 0, fmt.Errorf("cant parse %s price: %w", ticker, err)
+	}
+
+	return u, nil
+}
+
+type jsonDeal Deal
+
+func (d Deal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonDeal
+		Price json.Number `json:"price"`
+	}{jsonDeal(d), decimal(d.Ticker, d.Price)})
+}
+
+func (d *Deal) UnmarshalJSON(b []byte) error {
+	var v struct {
+		jsonDeal
+		Price json.Number `json:"price"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*d = Deal(v.jsonDeal)
+	var err error
+	d.Price, err = units(d.Ticker, v.Price)
+
+	return err
+}
+
+type jsonOrder Order
+
+func (o Order) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonOrder
+		Price json.Number `json:"price"`
+	}{jsonOrder(o), decimal(o.Ticker, o.Price)})
+}
+
+func (o *Order) UnmarshalJSON(b []byte) error {
+	var v struct {
+		jsonOrder
+		Price json.Number `json:"price"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*o = Order(v.jsonOrder)
+	var err error
+	o.Price, err = units(o.Ticker, v.Price)
+
+	return err
+}
+
+type jsonFill Fill
+
+func (f Fill) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonFill
+		Price json.Number `json:"price"`
+	}{jsonFill(f), decimal(f.Ticker, f.Price)})
+}
+
+func (f *Fill) UnmarshalJSON(b []byte) error {
+	var v struct {
+		jsonFill
+		Price json.Number `json:"price"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*f = Fill(v.jsonFill)
+	var err error
+	f.Price, err = units(f.Ticker, v.Price)
+
+	return err
+}
+
+type jsonCandle Candle
+
+type candleJSON struct {
+	jsonCandle
+	Open  json.Number `json:"open"`
+	High  json.Number `json:"high"`
+	Low   json.Number `json:"low"`
+	Close json.Number `json:"close"`
+}
+
+func (c Candle) MarshalJSON() ([]byte, error) {
+	return json.Marshal(candleJSON{
+		jsonCandle: jsonCandle(c),
+		Open:       decimal(c.Ticker, c.Open),
+		High:       decimal(c.Ticker, c.High),
+		Low:        decimal(c.Ticker, c.Low),
+		Close:      decimal(c.Ticker, c.Close),
+	})
+}
+
+func (c *Candle) UnmarshalJSON(b []byte) error {
+	var v candleJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*c = Candle(v.jsonCandle)
+	for _, p := range []struct {
+		dst *int64
+		n   json.Number
+	}{{&c.Open, v.Open}, {&c.High, v.High}, {&c.Low, v.Low}, {&c.Close, v.Close}} {
+		var err error
+		if *p.dst, err = units(c.Ticker, p.n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type jsonPosition Position
+
+// positionJSON средняя цена - дробное число, у неё больше знаков, чем у инструмента
+type positionJSON struct {
+	jsonPosition
+	AvgPrice  float64     `json:"avg_price"`
+	MarkPrice json.Number `json:"mark_price"`
+}
+
+func (p Position) MarshalJSON() ([]byte, error) {
+	return json.Marshal(positionJSON{
+		jsonPosition: jsonPosition(p),
+		AvgPrice:     price.Lookup(p.Ticker).Float(p.AvgPrice),
+		MarkPrice:    decimal(p.Ticker, p.MarkPrice),
+	})
+}
+
+func (p *Position) UnmarshalJSON(b []byte) error {
+	var v positionJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*p = Position(v.jsonPosition)
+	p.AvgPrice = v.AvgPrice / price.Lookup(p.Ticker).Float(1)
+
+	var err error
+	p.MarkPrice, err = units(p.Ticker, v.MarkPrice)
+
+	return err
+}
+
+type jsonInstrument Instrument
+
+// instrumentJSON цены инструмента в его собственных знаках, клиенту не нужен
+// его Spec заранее
+type instrumentJSON struct {
+	jsonInstrument
+	LastPrice  json.Number `json:"last_price"`
+	TickSize   json.Number `json:"tick_size"`
+	PointValue json.Number `json:"point_value"`
+}
+
+func (i Instrument) MarshalJSON() ([]byte, error) {
+	spec := i.Spec()
+
+	return json.Marshal(instrumentJSON{
+		jsonInstrument: jsonInstrument(i),
+		LastPrice:      json.Number(spec.Format(i.LastPrice)),
+		TickSize:       json.Number(spec.Format(i.TickSize)),
+		PointValue:     json.Number(price.FormatMoney(i.PointValue)),
+	})
+}
+
+func (i *Instrument) UnmarshalJSON(b []byte) error {
+	var v instrumentJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*i = Instrument(v.jsonInstrument)
+
+	// старый брокер без параметров инструмента
+	if v.TickSize == "" {
+		def := price.DefaultSpec(i.Ticker)
+		i.Scale, i.TickSize, i.PointValue = def.Scale, def.TickSize, def.PointValue
+	} else {
+		var err error
+		if i.TickSize, err = price.ParseDecimal(v.TickSize.String(), i.Scale); err != nil {
+			return fmt.Errorf("cant parse %s tick size: %w", i.Ticker, err)
+		}
+		if i.PointValue, err = price.ParseMoney(v.PointValue.String()); err != nil {
+			return fmt.Errorf("cant parse %s point value: %w", i.Ticker, err)
+		}
+	}
+
+	if v.LastPrice != "" {
+		var err error
+		if i.LastPrice, err = price.ParseDecimal(v.LastPrice.String(), i.Scale); err != nil {
+			return fmt.Errorf("cant parse %s price: %w", i.Ticker, err)
+		}
+	}
+
+	return nil
+}
+
+// Spec параметры инструмента из ответа брокера
+func (i Instrument) Spec() price.Spec {
+	return price.Spec{Ticker: i.Ticker, Scale: i.Scale, TickSize: i.TickSize, PointValue: i.PointValue}
+}
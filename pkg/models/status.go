@@ -2,13 +2,11 @@ package models
 
 type Status struct {
 	Body struct {
-		Balance   int `json:"balance"`
-		Positions []struct {
-			Ticker string `json:"ticker"`
-		} `json:"positions"`
-		OpenOrders []struct {
-			ID     int    `json:"id"`
-			Ticker string `json:"ticker"`
-		} `json:"open_orders"`
+		Balance       int64      `json:"balance"`
+		PnLMethod     PnLMethod  `json:"pnl_method"`
+		RealizedPnL   float64    `json:"realized_pnl"`
+		UnrealizedPnL float64    `json:"unrealized_pnl"`
+		Positions     []Position `json:"positions"`
+		OpenOrders    []Order    `json:"open_orders"`
 	} `json:"body"`
 }
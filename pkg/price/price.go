@@ -0,0 +1,141 @@
+// Package price точные цены и деньги без float.
+//
+// Цена хранится в int64 как число минимальных единиц инструмента: при Scale = 2
+// цена 1209.90 - это 120990. Так цены лежат в базах, ходят по grpc и сравниваются
+// в стакане. В десятичный вид они переводятся только на краях: при чтении файла
+// сделок, вводе пользователя и в json апи брокера. Параметры инструмента - Spec.
+//
+// Деньги (баланс, сумма заявки, результат) - int64 в копейках, см. MoneyScale
+package price
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrSyntax    = errors.New("not a decimal number")
+	ErrPrecision = errors.New("too many decimal places")
+	ErrOffTick   = errors.New("price is off the tick grid")
+	ErrRange     = errors.New("number out of range")
+)
+
+// MoneyScale знаков после запятой у денег, деньги считаются в копейках
+const MoneyScale = 2
+
+// maxScale больше знаков int64 с запасом на целую часть не вместит
+const maxScale = 9
+
+var pow10 = func() [maxScale + 1]int64 {
+	var p [maxScale + 1]int64
+	p[0] = 1
+	for i := 1; i <= maxScale; i++ {
+		p[i] = p[i-1] * 10
+	}
+
+	return p
+}()
+
+// ParseDecimal число s в единицах 10^-scale: "1209.9" при scale 2 - 120990.
+// Лишние ненулевые знаки после запятой - ErrPrecision, округления нет
+func ParseDecimal(s string, scale int) (int64, error) {
+	if scale < 0 || scale > maxScale {
+		return 0, fmt.Errorf("%w: scale %d", ErrRange, scale)
+	}
+
+	str := strings.TrimSpace(s)
+	neg := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(strings.TrimPrefix(str, "-"), "+")
+
+	intPart, frac := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, frac = str[:i], str[i+1:]
+	}
+	if intPart == "" && frac == "" || !digits(intPart) || !digits(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrSyntax, s)
+	}
+
+	if len(frac) > scale {
+		if strings.Trim(frac[scale:], "0") != "" {
+			return 0, fmt.Errorf("%w: %q, at most %d", ErrPrecision, s, scale)
+		}
+		frac = frac[:scale]
+	}
+	frac += strings.Repeat("0", scale-len(frac))
+
+	var units int64
+	for _, c := range intPart + frac {
+		d := int64(c - '0')
+		if units > (math.MaxInt64-d)/10 {
+			return 0, fmt.Errorf("%w: %q", ErrRange, s)
+		}
+		units = units*10 + d
+	}
+
+	if neg {
+		units = -units
+	}
+
+	return units, nil
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FormatDecimal units в единицах 10^-scale со всеми scale знаками: 120990 при scale 2 - "1209.90"
+func FormatDecimal(units int64, scale int) string {
+	if scale <= 0 {
+		return fmt.Sprintf("%d", units)
+	}
+
+	sign := ""
+	u := uint64(units)
+	if units < 0 {
+		sign, u = "-", uint64(-units)
+	}
+
+	p := uint64(pow10[scale])
+
+	return fmt.Sprintf("%s%d.%0*d", sign, u/p, scale, u%p)
+}
+
+// ParseMoney сумма в рублях "1500.5" в копейках
+func ParseMoney(s string) (int64, error) {
+	return ParseDecimal(s, MoneyScale)
+}
+
+// FormatMoney копейки в рублях: 150050 - "1500.50"
+func FormatMoney(kopecks int64) string {
+	return FormatDecimal(kopecks, MoneyScale)
+}
+
+// divRound a/b с округлением половины от нуля, b > 0
+func divRound(a, b int64) int64 {
+	q, r := a/b, a%b
+	if 2*abs(r) >= b {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+
+	return q
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
@@ -0,0 +1,93 @@
+package price
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in    string
+		scale int
+		want  int64
+		err   error
+	}{
+		{"1209.90", 2, 120990, nil},
+		{"1209.9", 2, 120990, nil},
+		{"1209", 2, 120900, nil},
+		{"1209.900", 2, 120990, nil},
+		{".5", 2, 50, nil},
+		{"-0.10", 2, -10, nil},
+		{"7", 0, 7, nil},
+		{"1209.95", 1, 0, ErrPrecision},
+		{"12,5", 2, 0, ErrSyntax},
+		{"", 2, 0, ErrSyntax},
+		{".", 2, 0, ErrSyntax},
+		{"1e3", 2, 0, ErrSyntax},
+		{"99999999999999999999", 2, 0, ErrRange},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDecimal(tt.in, tt.scale)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseDecimal(%q, %d) error = %v, want %v", tt.in, tt.scale, err, tt.err)
+
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDecimal(%q, %d) = %d, want %d", tt.in, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		units int64
+		scale int
+		want  string
+	}{
+		{120990, 2, "1209.90"},
+		{5, 2, "0.05"},
+		{-5, 2, "-0.05"},
+		{42, 0, "42"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatDecimal(tt.units, tt.scale); got != tt.want {
+			t.Errorf("FormatDecimal(%d, %d) = %q, want %q", tt.units, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestSpec(t *testing.T) {
+	spec, err := ParseSpec("SPFB.RTS:2:0.10:1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Spec{Ticker: "SPFB.RTS", Scale: 2, TickSize: 10, PointValue: 150}
+	if spec != want {
+		t.Fatalf("spec = %+v, want %+v", spec, want)
+	}
+	if got := spec.String(); got != "SPFB.RTS:2:0.10:1.50" {
+		t.Errorf("String() = %q", got)
+	}
+
+	if _, err = spec.Parse("1209.95"); !errors.Is(err, ErrOffTick) {
+		t.Errorf("off tick price: error = %v", err)
+	}
+	if _, err = spec.Parse("0"); !errors.Is(err, ErrRange) {
+		t.Errorf("zero price: error = %v", err)
+	}
+
+	// 3 контракта по 1209.90 при пункте 1.5 рубля - 5444.55 рубля
+	if got := spec.Notional(120990, 3); got != 544455 {
+		t.Errorf("Notional = %d, want 544455", got)
+	}
+
+	for _, s := range []string{"SPFB.RTS:2:0.10", "SPFB.RTS:x:0.10:1", "SPFB.RTS:1:0.05:1", "SPFB.RTS:2:0:1", ":2:0.1:1"} {
+		if _, err = ParseSpec(s); !errors.Is(err, ErrWrongSpec) {
+			t.Errorf("ParseSpec(%q) error = %v, want %v", s, err, ErrWrongSpec)
+		}
+	}
+}
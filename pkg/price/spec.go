@@ -0,0 +1,158 @@
+package price
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrWrongSpec = errors.New("wrong instrument spec")
+
+// Spec параметры инструмента
+type Spec struct {
+	Ticker string
+	// Scale знаков после запятой в цене, столько же цифр убирается при переводе в int64
+	Scale int
+	// TickSize шаг цены в минимальных единицах, цена заявки должна делиться на него
+	TickSize int64
+	// PointValue стоимость пункта цены (1.0) одного контракта в копейках
+	PointValue int64
+}
+
+// DefaultSpec параметры инструмента, которого нет в конфиге: два знака,
+// любой шаг, пункт стоит рубль. С ними цены считаются так же, как до появления Spec
+func DefaultSpec(ticker string) Spec {
+	return Spec{Ticker: ticker, Scale: 2, TickSize: 1, PointValue: 100}
+}
+
+// ParseSpec инструмент из строки конфига "тикер:знаки:шаг:стоимость пункта в рублях",
+// например "SPFB.RTS:2:0.10:1"
+func ParseSpec(s string) (Spec, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 4 || parts[0] == "" {
+		return Spec{}, fmt.Errorf("%w: %q, want ticker:scale:tick:point_value", ErrWrongSpec, s)
+	}
+
+	spec := Spec{Ticker: parts[0]}
+
+	var err error
+	if spec.Scale, err = strconv.Atoi(parts[1]); err != nil || spec.Scale < 0 || spec.Scale > maxScale {
+		return Spec{}, fmt.Errorf("%w: %q, scale must be in [0, %d]", ErrWrongSpec, s, maxScale)
+	}
+
+	if spec.TickSize, err = ParseDecimal(parts[2], spec.Scale); err != nil || spec.TickSize <= 0 {
+		return Spec{}, fmt.Errorf("%w: %q, tick must be positive with at most %d decimals", ErrWrongSpec, s, spec.Scale)
+	}
+
+	if spec.PointValue, err = ParseMoney(parts[3]); err != nil || spec.PointValue <= 0 {
+		return Spec{}, fmt.Errorf("%w: %q, point value must be positive rubles", ErrWrongSpec, s)
+	}
+
+	return spec, nil
+}
+
+func (s Spec) String() string {
+	return fmt.Sprintf("%s:%d:%s:%s", s.Ticker, s.Scale, s.Format(s.TickSize), FormatMoney(s.PointValue))
+}
+
+// Units цена из строки в минимальных единицах без проверки шага, для цен сделок и уровней
+func (s Spec) Units(str string) (int64, error) {
+	return ParseDecimal(str, s.Scale)
+}
+
+// Parse цена заявки из строки: точно, положительная и на сетке шага цены
+func (s Spec) Parse(str string) (int64, error) {
+	units, err := s.Units(str)
+	if err != nil {
+		return 0, err
+	}
+
+	if units <= 0 {
+		return 0, fmt.Errorf("%w: price must be positive, got %s", ErrRange, s.Format(units))
+	}
+
+	return units, s.Check(units)
+}
+
+// Check цена лежит на сетке шага цены
+func (s Spec) Check(units int64) error {
+	if s.TickSize > 1 && units%s.TickSize != 0 {
+		return fmt.Errorf("%w: %s is not a multiple of %s for %s", ErrOffTick, s.Format(units), s.Format(s.TickSize), s.Ticker)
+	}
+
+	return nil
+}
+
+// Format цена в десятичном виде со всеми знаками инструмента
+func (s Spec) Format(units int64) string {
+	return FormatDecimal(units, s.Scale)
+}
+
+// Float цена числом, только для показа и статистики
+func (s Spec) Float(units float64) float64 {
+	return units / float64(pow10[s.Scale])
+}
+
+// Notional стоимость volume контрактов по цене units в копейках
+func (s Spec) Notional(units, volume int64) int64 {
+	return divRound(units*volume*s.PointValue, pow10[s.Scale])
+}
+
+// Money результат в минимальных единицах цены (разница цен, умноженная на объём)
+// в копейках. Дробный, потому что средняя цена входа дробная
+func (s Spec) Money(units float64) float64 {
+	return units * float64(s.PointValue) / float64(pow10[s.Scale])
+}
+
+// ParseSpecs инструменты из списка строк конфига, см. ParseSpec
+func ParseSpecs(list []string) ([]Spec, error) {
+	specs := make([]Spec, 0, len(list))
+	for _, s := range list {
+		spec, err := ParseSpec(s)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
+
+// Specs параметры инструментов по тикеру
+type Specs map[string]Spec
+
+// Get параметры инструмента, DefaultSpec если его нет
+func (s Specs) Get(ticker string) Spec {
+	if spec, ok := s[ticker]; ok {
+		return spec
+	}
+
+	return DefaultSpec(ticker)
+}
+
+// registry параметры инструментов процесса, по ним json апи переводит цены в десятичный вид
+var registry = struct {
+	sync.RWMutex
+	specs Specs
+}{specs: Specs{}}
+
+// Register добавляет или заменяет параметры инструментов процесса. Биржа и брокер
+// берут их из конфига, клиент - из списка инструментов брокера
+func Register(specs ...Spec) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, spec := range specs {
+		registry.specs[spec.Ticker] = spec
+	}
+}
+
+// Lookup параметры инструмента процесса, DefaultSpec если он не зарегистрирован
+func Lookup(ticker string) Spec {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	return registry.specs.Get(ticker)
+}
@@ -0,0 +1,271 @@
+package robot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"trading/pkg/client"
+	"trading/pkg/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Config подключение робота к брокеру и счёт, от имени которого он торгует
+type Config struct {
+	BrokerAddr     string // http апи: заявки и состояние счёта
+	BrokerGRPCAddr string // grpc апи: свечи и изменения заявок
+	Login          string
+	Password       string
+	// Tickers инструменты, свечи которых получает стратегия, пусто - все
+	Tickers []string
+}
+
+// повторы заявки, на которую брокер не ответил
+const (
+	dealAttempts   = 3
+	dealRetryDelay = time.Second
+	// resyncRetryDelay через сколько снова читать счёт, если после переподключения не удалось
+	resyncRetryDelay = 5 * time.Second
+)
+
+// brokerGateway заявки через http апи брокера от имени счёта acc
+type brokerGateway struct {
+	client *client.Client
+	acc    client.Account
+}
+
+// Deal без ответа брокера отправляет заявку ещё раз с тем же ClientOrderID:
+// если первая дошла, брокер вернёт её, а не выставит вторую
+func (g *brokerGateway) Deal(ctx context.Context, deal models.Deal) (models.Order, error) {
+	var order models.Order
+	var err error
+	for attempt := 1; ; attempt++ {
+		order, err = g.client.Deal(ctx, g.acc, deal)
+		if !errors.Is(err, client.ErrBrokerUnavailable) || deal.ClientOrderID == "" || attempt == dealAttempts {
+			break
+		}
+
+		log.Ctx(ctx).Err(err).Msgf("Deal %s not answered, resend", deal.ClientOrderID)
+
+		select {
+		case <-ctx.Done():
+			return order, err
+		case <-time.After(dealRetryDelay):
+		}
+	}
+
+	if errors.Is(err, client.ErrRejected) || errors.Is(err, client.ErrBadRequest) {
+		return order, fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+
+	return order, err
+}
+
+func (g *brokerGateway) Cancel(ctx context.Context, orderID int64) (models.OrderStatus, error) {
+	resp, err := g.client.Cancel(ctx, g.acc, models.CancelRequest{ID: orderID})
+
+	return resp.Body.Status, err
+}
+
+// Run входит в брокера и торгует стратегией s до отмены ctx. Свечи, изменения
+// заявок и таймеры передаются роботу по одному из этой горутины
+func Run(ctx context.Context, config Config, name string, s Strategy) error {
+	bClient := client.NewClient(config.BrokerAddr)
+
+	acc, err := bClient.Login(ctx, config.Login, config.Password)
+	if err != nil {
+		return fmt.Errorf("cant login as %s: %w", config.Login, err)
+	}
+
+	// заодно регистрирует параметры инструментов для цен в json
+	if _, err = bClient.Instruments(ctx); err != nil {
+		return fmt.Errorf("cant load instruments: %w", err)
+	}
+
+	stream, err := client.NewBrokerStream(config.BrokerGRPCAddr)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// сначала подписка, потом состояние счёта: исполнения между ними не потеряются,
+	// а уже учтённые в состоянии робот пропустит по Filled заявок
+	quotes := stream.Quotes(ctx, config.Tickers)
+	updates := subscribeOrders(ctx, stream, acc)
+	if err = updates.subscribed(ctx); err != nil {
+		return fmt.Errorf("%w: %s", err, acc.Login)
+	}
+
+	status, err := bClient.Status(ctx, acc)
+	if err != nil {
+		return fmt.Errorf("cant load account state: %w", err)
+	}
+
+	gateway := &brokerGateway{client: bClient, acc: acc}
+	r := New(name, s, gateway)
+	r.Start(ctx, time.Now(), status.Body.Positions, status.Body.OpenOrders)
+	log.Printf("robot %s started for %s: %d positions, %d open orders",
+		name, acc.Login, len(status.Body.Positions), len(status.Body.OpenOrders))
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	refresh := time.NewTimer(refreshIn(acc))
+	defer refresh.Stop()
+
+	resync := time.NewTimer(time.Duration(math.MaxInt64))
+	defer resync.Stop()
+
+	for {
+		resetTimer(timer, r)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case c, ok := <-quotes:
+			if !ok {
+				return nil
+			}
+
+			r.Advance(ctx, time.Now())
+			r.HandleCandle(ctx, c)
+		case u, ok := <-updates.ch:
+			// до отмены ctx поток заявок закрывается, только если брокер больше не принимает токен
+			if !ok && ctx.Err() == nil {
+				return fmt.Errorf("%w: broker closed order updates of %s", client.ErrUnauthorized, acc.Login)
+			}
+			if !ok {
+				return nil
+			}
+
+			r.Advance(ctx, time.Now())
+			if !u.Resync {
+				handleUpdate(ctx, r, u)
+
+				continue
+			}
+
+			if err = resyncRobot(ctx, r, gateway); err != nil {
+				log.Err(err).Msgf("Failed to resync robot %s", name)
+				resync.Reset(resyncRetryDelay)
+			}
+		case <-resync.C:
+			if err = resyncRobot(ctx, r, gateway); err != nil {
+				log.Err(err).Msgf("Failed to resync robot %s", name)
+				resync.Reset(resyncRetryDelay)
+			}
+		case <-timer.C:
+			r.Advance(ctx, time.Now())
+		case <-refresh.C:
+			fresh, err := bClient.RefreshToken(ctx, gateway.acc)
+			if err != nil {
+				log.Err(err).Msgf("Failed to refresh token of %s", acc.Login)
+				refresh.Reset(time.Minute)
+
+				continue
+			}
+
+			// поток заявок переподключается с новым токеном, старый брокер больше не примет
+			gateway.acc = fresh
+			updates.stop()
+			updates = subscribeOrders(ctx, stream, fresh)
+			refresh.Reset(refreshIn(fresh))
+		}
+	}
+}
+
+// orderUpdates поток изменений заявок, который можно снять отдельно от робота
+type orderUpdates struct {
+	ch   <-chan client.OrderUpdate
+	stop context.CancelFunc
+}
+
+func subscribeOrders(ctx context.Context, stream *client.BrokerStream, acc client.Account) orderUpdates {
+	ctx, cancel := context.WithCancel(ctx)
+
+	return orderUpdates{ch: stream.OrdersWithResync(ctx, acc), stop: cancel}
+}
+
+// subscribed ждёт, пока брокер подпишет поток: первое событие потока - Resync
+func (u orderUpdates) subscribed(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case _, ok := <-u.ch:
+		if !ok {
+			return fmt.Errorf("%w: broker closed order updates", client.ErrUnauthorized)
+		}
+	}
+
+	return nil
+}
+
+// resyncRobot перечитывает счёт после переподключения потока заявок. Заявки
+// робота, которых среди открытых уже нет, запрашиваются по одной, чтобы узнать,
+// чем они кончились
+func resyncRobot(ctx context.Context, r *Robot, g *brokerGateway) error {
+	status, err := g.client.Status(ctx, g.acc)
+	if err != nil {
+		return fmt.Errorf("cant load account state: %w", err)
+	}
+
+	open := make(map[int64]bool, len(status.Body.OpenOrders))
+	for _, o := range status.Body.OpenOrders {
+		open[o.ID] = true
+	}
+
+	orders := status.Body.OpenOrders
+	for _, o := range r.Orders() {
+		if open[o.ID] {
+			continue
+		}
+
+		closed, err := g.client.Order(ctx, g.acc, o.ID, "")
+		if err != nil {
+			return fmt.Errorf("cant load order %d: %w", o.ID, err)
+		}
+		orders = append(orders, closed)
+	}
+
+	r.Resync(ctx, status.Body.Positions, orders)
+
+	return nil
+}
+
+// refreshIn через сколько менять токен: на половине срока, без срока - не менять
+func refreshIn(acc client.Account) time.Duration {
+	if acc.ExpiresAt == 0 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Until(time.Unix(acc.IssuedAt+(acc.ExpiresAt-acc.IssuedAt)/2, 0))
+}
+
+// resetTimer взводит timer на ближайший таймер робота
+func resetTimer(timer *time.Timer, r *Robot) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+
+	if at, ok := r.NextTimer(); ok {
+		timer.Reset(time.Until(at))
+	}
+}
+
+func handleUpdate(ctx context.Context, r *Robot, u client.OrderUpdate) {
+	switch {
+	case u.FillVolume > 0:
+		r.HandleFill(ctx, Fill{Order: u.Order, Volume: u.FillVolume, Price: u.FillPrice, Time: u.Time})
+	case u.Order.Status == models.OrderCancelled:
+		r.HandleCancel(ctx, u.Order)
+	case u.Order.Status == models.OrderRejected:
+		r.HandleReject(ctx, u.Order, u.Reason)
+	}
+}
@@ -0,0 +1,57 @@
+package robot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"trading/pkg/client"
+	"trading/pkg/models"
+)
+
+func TestDealResend(t *testing.T) {
+	var mu sync.Mutex
+	var ids []string
+
+	// брокер принимает первую заявку, но ответ до робота не доходит
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req models.DealRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+
+		mu.Lock()
+		ids = append(ids, req.Deal.ClientOrderID)
+		first := len(ids) == 1
+		mu.Unlock()
+
+		if first {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+			}
+			conn.Close()
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(models.DealResponse{Body: models.Order{
+			ID: 1, ClientOrderID: req.Deal.ClientOrderID, Status: models.OrderPlaced,
+		}})
+	}))
+	defer srv.Close()
+
+	g := &brokerGateway{client: client.NewClient(srv.URL), acc: client.Account{ClientID: 1}}
+	order, err := g.Deal(context.Background(), models.Deal{Ticker: "T", Type: models.DealBuy, Price: 100, Volume: 1, ClientOrderID: "robot-1"})
+	if err != nil {
+		t.Fatalf("Deal: %v", err)
+	}
+	if order.ID != 1 {
+		t.Errorf("order = %+v, want 1", order)
+	}
+	if len(ids) != 2 || ids[0] != ids[1] {
+		t.Errorf("client order ids = %v, want the same one twice", ids)
+	}
+}
@@ -0,0 +1,140 @@
+// Package strategies примеры стратегий для роботов, регистрируются при импорте:
+//
+//	import _ "trading/pkg/robot/strategies"
+package strategies
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"trading/pkg/models"
+	"trading/pkg/robot"
+
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	robot.Register("sma", NewSMACross)
+}
+
+// SMACross пересечение скользящих средних: быстрая выше медленной - длинная позиция
+// volume контрактов, ниже - короткая. Заявки лимитные по цене закрытия свечи,
+// неисполненная снимается через ttl
+type SMACross struct {
+	robot.Base
+
+	Ticker     string
+	Fast, Slow int
+	Volume     int64
+	TTL        time.Duration
+
+	closes []int64
+	// прошлое положение быстрой средней относительно медленной: 1 выше, -1 ниже
+	side int
+}
+
+// NewSMACross параметры: ticker (SPFB.RTS), fast (5), slow (20), volume (1), ttl (30s)
+func NewSMACross(params robot.Params) (robot.Strategy, error) {
+	s := &SMACross{Ticker: params.String("ticker", "SPFB.RTS")}
+
+	var err error
+	if s.Fast, err = params.Int("fast", 5); err != nil {
+		return nil, err
+	}
+	if s.Slow, err = params.Int("slow", 20); err != nil {
+		return nil, err
+	}
+	volume, err := params.Int("volume", 1)
+	if err != nil {
+		return nil, err
+	}
+	s.Volume = int64(volume)
+	if s.TTL, err = params.Duration("ttl", 30*time.Second); err != nil {
+		return nil, err
+	}
+
+	if s.Fast <= 0 || s.Slow <= s.Fast || s.Volume <= 0 {
+		return nil, fmt.Errorf("%w: want 0 < fast < slow and volume > 0, got fast=%d slow=%d volume=%d",
+			robot.ErrWrongParams, s.Fast, s.Slow, s.Volume)
+	}
+
+	return s, nil
+}
+
+func (s *SMACross) OnCandle(ctx context.Context, r *robot.Robot, c models.Candle) {
+	if c.Ticker != s.Ticker {
+		return
+	}
+
+	s.closes = append(s.closes, c.Close)
+	if len(s.closes) > s.Slow {
+		s.closes = s.closes[1:]
+	}
+	if len(s.closes) < s.Slow {
+		return
+	}
+
+	side := 1
+	if mean(s.closes[len(s.closes)-s.Fast:]) < mean(s.closes) {
+		side = -1
+	}
+
+	// первая полная медленная средняя только запоминает положение
+	crossed := s.side != 0 && side != s.side
+	s.side = side
+	if !crossed {
+		return
+	}
+
+	s.trade(ctx, r, c.Close, s.Volume*int64(side))
+}
+
+// trade снимает прежние заявки и доводит позицию до target
+func (s *SMACross) trade(ctx context.Context, r *robot.Robot, units, target int64) {
+	for _, o := range r.Orders() {
+		if o.Ticker != s.Ticker {
+			continue
+		}
+
+		if err := r.Cancel(ctx, o.ID); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msgf("sma: cant cancel order %d", o.ID)
+		}
+	}
+
+	var order models.Order
+	var err error
+	switch diff := target - r.Position(s.Ticker).Volume; {
+	case diff > 0:
+		order, err = r.Buy(ctx, s.Ticker, units, int32(diff))
+	case diff < 0:
+		order, err = r.Sell(ctx, s.Ticker, units, int32(-diff))
+	default:
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msgf("sma: cant place order for %s", s.Ticker)
+
+		return
+	}
+
+	r.After(s.TTL, func(ctx context.Context) {
+		for _, o := range r.Orders() {
+			if o.ID != order.ID {
+				continue
+			}
+
+			if err := r.Cancel(ctx, o.ID); err != nil {
+				log.Ctx(ctx).Warn().Err(err).Msgf("sma: cant cancel order %d", o.ID)
+			}
+		}
+	})
+}
+
+func mean(values []int64) float64 {
+	var sum int64
+	for _, v := range values {
+		sum += v
+	}
+
+	return float64(sum) / float64(len(values))
+}
@@ -0,0 +1,361 @@
+package robot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"trading/pkg/models"
+	"trading/pkg/price"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrRejected брокер отказал в заявке, например по риск проверкам
+var ErrRejected = errors.New("order rejected")
+
+// Gateway то, через что робот выставляет и снимает заявки: брокер или симуляция в бэктесте.
+// Отказ в заявке возвращается как ошибка с ErrRejected
+type Gateway interface {
+	Deal(ctx context.Context, deal models.Deal) (models.Order, error)
+	// Cancel возвращает состояние заявки после снятия, уже исполненную снять нельзя
+	Cancel(ctx context.Context, orderID int64) (models.OrderStatus, error)
+}
+
+// Fill исполнение заявки робота
+type Fill struct {
+	Order  models.Order // состояние заявки после исполнения
+	Volume int32
+	Price  int64
+	Time   int64
+}
+
+// Position позиция робота по инструменту
+type Position struct {
+	Ticker string
+	Volume int64 // больше нуля - длинная, меньше - короткая
+	// AvgPrice средняя цена входа в минимальных единицах цены, дробная
+	AvgPrice float64
+}
+
+type timer struct {
+	at time.Time
+	fn func(ctx context.Context)
+}
+
+// Robot состояние робота и апи для стратегии: заявки, позиции, последние свечи,
+// таймеры. Не потокобезопасен: события ему по одному передаёт среда исполнения
+// (Run или бэктест), а стратегия зовёт его только из своих колбэков
+type Robot struct {
+	Name string
+
+	strategy Strategy
+	gateway  Gateway
+
+	now       time.Time
+	positions map[string]*Position
+	orders    map[int64]models.Order // открытые заявки
+	// filled сколько исполнений заявки уже учтено в позиции: брокер после
+	// переподключения досылает события, которые могли уже дойти
+	filled map[int64]int32
+	last   map[string]models.Candle
+	timers []timer // по возрастанию at
+	// pending колбэки, которые стратегия вызвала бы изнутри своего же колбэка,
+	// выполняются после него
+	pending   []func(ctx context.Context)
+	lastOrder int
+}
+
+func New(name string, s Strategy, g Gateway) *Robot {
+	return &Robot{
+		Name:      name,
+		strategy:  s,
+		gateway:   g,
+		positions: make(map[string]*Position),
+		orders:    make(map[int64]models.Order),
+		filled:    make(map[int64]int32),
+		last:      make(map[string]models.Candle),
+	}
+}
+
+// апи для стратегии
+
+// Now текущее время робота: настоящее при торговле, время истории в бэктесте
+func (r *Robot) Now() time.Time {
+	return r.now
+}
+
+// Buy выставляет заявку на покупку volume контрактов по цене units
+func (r *Robot) Buy(ctx context.Context, ticker string, units int64, volume int32) (models.Order, error) {
+	return r.place(ctx, models.Deal{Ticker: ticker, Type: models.DealBuy, Price: units, Volume: volume})
+}
+
+// Sell выставляет заявку на продажу volume контрактов по цене units
+func (r *Robot) Sell(ctx context.Context, ticker string, units int64, volume int32) (models.Order, error) {
+	return r.place(ctx, models.Deal{Ticker: ticker, Type: models.DealSell, Price: units, Volume: volume})
+}
+
+// place отказ брокера возвращается ошибкой и ещё приходит в OnOrderRejected,
+// чтобы стратегия разбирала все отказы в одном месте
+func (r *Robot) place(ctx context.Context, deal models.Deal) (models.Order, error) {
+	var order models.Order
+	err := price.Lookup(deal.Ticker).Check(deal.Price)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrRejected, err)
+	} else {
+		// повторная отправка после обрыва не выставит вторую заявку
+		r.lastOrder++
+		deal.ClientOrderID = fmt.Sprintf("robot-%s-%d-%d", r.Name, r.now.Unix(), r.lastOrder)
+
+		order, err = r.gateway.Deal(ctx, deal)
+	}
+
+	if errors.Is(err, ErrRejected) {
+		rejected := models.Order{
+			Ticker: deal.Ticker,
+			Volume: deal.Volume,
+			Price:  deal.Price,
+			IsBuy:  deal.Type == models.DealBuy,
+			Status: models.OrderRejected,
+		}
+		r.later(func(ctx context.Context) { r.strategy.OnOrderRejected(ctx, r, rejected, err.Error()) })
+
+		return rejected, err
+	}
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	switch order.Status {
+	case models.OrderFilled, models.OrderCancelled, models.OrderRejected:
+	default:
+		r.orders[order.ID] = order
+	}
+	log.Ctx(ctx).Info().Msgf("robot %s: order %d %s %s %d by %s",
+		r.Name, order.ID, deal.Type, deal.Ticker, deal.Volume, price.Lookup(deal.Ticker).Format(deal.Price))
+
+	return order, nil
+}
+
+// Cancel снимает заявку, снятие придёт обновлением заявки
+func (r *Robot) Cancel(ctx context.Context, orderID int64) error {
+	status, err := r.gateway.Cancel(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	if status == models.OrderCancelled {
+		delete(r.orders, orderID)
+	}
+
+	return nil
+}
+
+// Position позиция по инструменту, нулевая если её нет
+func (r *Robot) Position(ticker string) Position {
+	if p, ok := r.positions[ticker]; ok {
+		return *p
+	}
+
+	return Position{Ticker: ticker}
+}
+
+// Orders открытые заявки по возрастанию ID
+func (r *Robot) Orders() []models.Order {
+	orders := make([]models.Order, 0, len(r.orders))
+	for _, o := range r.orders {
+		orders = append(orders, o)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+
+	return orders
+}
+
+// Last последняя свеча по инструменту
+func (r *Robot) Last(ticker string) (models.Candle, bool) {
+	c, ok := r.last[ticker]
+
+	return c, ok
+}
+
+// After вызовет fn через d по времени робота
+func (r *Robot) After(d time.Duration, fn func(ctx context.Context)) {
+	t := timer{at: r.now.Add(d), fn: fn}
+	i := sort.Search(len(r.timers), func(i int) bool { return r.timers[i].at.After(t.at) })
+
+	r.timers = append(r.timers, timer{})
+	copy(r.timers[i+1:], r.timers[i:])
+	r.timers[i] = t
+}
+
+// апи для среды исполнения
+
+// Start загружает состояние счёта и вызывает OnStart
+func (r *Robot) Start(ctx context.Context, now time.Time, positions []models.Position, orders []models.Order) {
+	r.now = now
+	r.setPositions(positions)
+	for _, o := range orders {
+		r.orders[o.ID] = o
+		r.filled[o.ID] = o.Filled
+	}
+
+	r.run(ctx, func(ctx context.Context) { r.strategy.OnStart(ctx, r) })
+}
+
+// Resync заменяет позиции состоянием счёта после переподключения. orders -
+// открытые заявки счёта и нынешнее состояние заявок робота, которые уже не
+// открыты. Исполнения, которые робот пропустил, стратегия получает в OnFill
+// по цене заявки, снятия и отказы - как обычно. Позиция их уже учитывает
+func (r *Robot) Resync(ctx context.Context, positions []models.Position, orders []models.Order) {
+	r.positions = make(map[string]*Position)
+	r.setPositions(positions)
+
+	for _, o := range orders {
+		_, tracked := r.orders[o.ID]
+		missed := o.Filled - r.filled[o.ID]
+		r.filled[o.ID] = o.Filled
+
+		switch o.Status {
+		case models.OrderCancelled:
+			delete(r.orders, o.ID)
+		case models.OrderRejected:
+			if tracked {
+				r.HandleReject(ctx, o, "")
+			}
+		case models.OrderFilled:
+			delete(r.orders, o.ID)
+		default:
+			r.orders[o.ID] = o
+		}
+
+		if tracked && missed > 0 {
+			f := Fill{Order: o, Volume: missed, Price: o.Price, Time: r.now.Unix()}
+			r.run(ctx, func(ctx context.Context) { r.strategy.OnFill(ctx, r, f) })
+		}
+	}
+}
+
+func (r *Robot) setPositions(positions []models.Position) {
+	for _, p := range positions {
+		if p.Volume != 0 {
+			r.positions[p.Ticker] = &Position{Ticker: p.Ticker, Volume: p.Volume, AvgPrice: p.AvgPrice}
+		}
+	}
+}
+
+// Advance переводит часы робота на now и вызывает наступившие таймеры
+func (r *Robot) Advance(ctx context.Context, now time.Time) {
+	if now.After(r.now) {
+		r.now = now
+	}
+
+	for len(r.timers) > 0 && !r.timers[0].at.After(r.now) {
+		t := r.timers[0]
+		r.timers = r.timers[1:]
+		r.run(ctx, t.fn)
+	}
+}
+
+// NextTimer время ближайшего таймера
+func (r *Robot) NextTimer() (time.Time, bool) {
+	if len(r.timers) == 0 {
+		return time.Time{}, false
+	}
+
+	return r.timers[0].at, true
+}
+
+func (r *Robot) HandleCandle(ctx context.Context, c models.Candle) {
+	r.last[c.Ticker] = c
+	r.run(ctx, func(ctx context.Context) { r.strategy.OnCandle(ctx, r, c) })
+}
+
+// HandleFill меняет позицию и состояние заявки, затем вызывает OnFill.
+// Исполнение, которое уже учтено по Filled заявки, пропускается
+func (r *Robot) HandleFill(ctx context.Context, f Fill) {
+	known := r.filled[f.Order.ID]
+	if f.Order.Filled > 0 {
+		if f.Order.Filled <= known {
+			return
+		}
+		if fresh := f.Order.Filled - known; fresh < f.Volume {
+			f.Volume = fresh
+		}
+		r.filled[f.Order.ID] = f.Order.Filled
+	}
+
+	r.applyFill(f)
+
+	if f.Order.Status == models.OrderFilled {
+		delete(r.orders, f.Order.ID)
+	} else {
+		r.orders[f.Order.ID] = f.Order
+	}
+
+	r.run(ctx, func(ctx context.Context) { r.strategy.OnFill(ctx, r, f) })
+}
+
+// HandleCancel заявка снята, не важно, кем
+func (r *Robot) HandleCancel(ctx context.Context, o models.Order) {
+	delete(r.orders, o.ID)
+}
+
+// HandleReject заявку отклонила биржа уже после того, как брокер её принял
+func (r *Robot) HandleReject(ctx context.Context, o models.Order, reason string) {
+	delete(r.orders, o.ID)
+	r.run(ctx, func(ctx context.Context) { r.strategy.OnOrderRejected(ctx, r, o, reason) })
+}
+
+// applyFill позиция по средней цене: добавление к позиции усредняет цену,
+// сокращение её не меняет, переворот начинает позицию с цены исполнения
+func (r *Robot) applyFill(f Fill) {
+	p, ok := r.positions[f.Order.Ticker]
+	if !ok {
+		p = &Position{Ticker: f.Order.Ticker}
+		r.positions[f.Order.Ticker] = p
+	}
+
+	volume := int64(f.Volume)
+	if !f.Order.IsBuy {
+		volume = -volume
+	}
+
+	next := p.Volume + volume
+	switch {
+	case p.Volume == 0 || (p.Volume > 0) == (volume > 0):
+		p.AvgPrice = (p.AvgPrice*float64(abs(p.Volume)) + float64(f.Price)*float64(abs(volume))) / float64(abs(next))
+	case next == 0:
+		p.AvgPrice = 0
+	case (next > 0) != (p.Volume > 0):
+		p.AvgPrice = float64(f.Price)
+	}
+	p.Volume = next
+
+	if p.Volume == 0 {
+		delete(r.positions, p.Ticker)
+	}
+}
+
+// run вызывает колбэк стратегии и те, что он отложил
+func (r *Robot) run(ctx context.Context, fn func(ctx context.Context)) {
+	fn(ctx)
+
+	for len(r.pending) > 0 {
+		next := r.pending[0]
+		r.pending = r.pending[1:]
+		next(ctx)
+	}
+}
+
+func (r *Robot) later(fn func(ctx context.Context)) {
+	r.pending = append(r.pending, fn)
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
@@ -0,0 +1,223 @@
+package robot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"trading/pkg/models"
+	"trading/pkg/price"
+)
+
+// fakeGateway принимает заявки, пока rejectAll не выставлен
+type fakeGateway struct {
+	deals     []models.Deal
+	rejectAll bool
+}
+
+func (g *fakeGateway) Deal(ctx context.Context, deal models.Deal) (models.Order, error) {
+	if g.rejectAll {
+		return models.Order{}, ErrRejected
+	}
+
+	g.deals = append(g.deals, deal)
+
+	return models.Order{
+		ID:            int64(len(g.deals)),
+		ClientOrderID: deal.ClientOrderID,
+		Ticker:        deal.Ticker,
+		Volume:        deal.Volume,
+		Price:         deal.Price,
+		IsBuy:         deal.Type == models.DealBuy,
+		Status:        models.OrderNew,
+	}, nil
+}
+
+func (g *fakeGateway) Cancel(ctx context.Context, orderID int64) (models.OrderStatus, error) {
+	return models.OrderCancelled, nil
+}
+
+type recorder struct {
+	Base
+	rejected []string
+	fills    []Fill
+}
+
+func (s *recorder) OnFill(ctx context.Context, r *Robot, f Fill) {
+	s.fills = append(s.fills, f)
+}
+
+func (s *recorder) OnOrderRejected(ctx context.Context, r *Robot, o models.Order, reason string) {
+	s.rejected = append(s.rejected, o.Ticker)
+}
+
+func TestPositionAveraging(t *testing.T) {
+	r := New("test", &recorder{}, &fakeGateway{})
+	ctx := context.Background()
+	r.Start(ctx, time.Unix(0, 0), nil, nil)
+
+	fills := []struct {
+		isBuy  bool
+		volume int32
+		price  int64
+		want   Position
+	}{
+		{true, 1, 100, Position{Ticker: "T", Volume: 1, AvgPrice: 100}},
+		{true, 1, 110, Position{Ticker: "T", Volume: 2, AvgPrice: 105}},
+		{false, 1, 120, Position{Ticker: "T", Volume: 1, AvgPrice: 105}},
+		{false, 3, 90, Position{Ticker: "T", Volume: -2, AvgPrice: 90}},
+		{true, 2, 80, Position{Ticker: "T"}},
+	}
+
+	for i, f := range fills {
+		order := models.Order{ID: int64(i + 1), Ticker: "T", IsBuy: f.isBuy, Status: models.OrderFilled}
+		r.HandleFill(ctx, Fill{Order: order, Volume: f.volume, Price: f.price})
+
+		if got := r.Position("T"); got != f.want {
+			t.Errorf("fill %d: position = %+v, want %+v", i, got, f.want)
+		}
+	}
+}
+
+func TestOrdersAndTimers(t *testing.T) {
+	price.Register(price.Spec{Ticker: "TICK", Scale: 0, TickSize: 10})
+
+	s := &recorder{}
+	g := &fakeGateway{}
+	r := New("test", s, g)
+	ctx := context.Background()
+	r.Start(ctx, time.Unix(1000, 0), nil, nil)
+
+	order, err := r.Buy(ctx, "TICK", 100, 1)
+	if err != nil {
+		t.Fatalf("Buy: %v", err)
+	}
+	if g.deals[0].ClientOrderID == "" {
+		t.Errorf("Buy: ClientOrderID is empty")
+	}
+	if len(r.Orders()) != 1 {
+		t.Fatalf("Orders() = %v, want 1 open order", r.Orders())
+	}
+
+	// цена не по шагу отклоняется без обращения к брокеру
+	if _, err = r.Buy(ctx, "TICK", 105, 1); !errors.Is(err, ErrRejected) {
+		t.Errorf("Buy off tick: error = %v, want %v", err, ErrRejected)
+	}
+	if len(g.deals) != 1 {
+		t.Errorf("Buy off tick: gateway got %d deals, want 1", len(g.deals))
+	}
+
+	var fired bool
+	r.After(time.Minute, func(ctx context.Context) {
+		fired = true
+		if err := r.Cancel(ctx, order.ID); err != nil {
+			t.Errorf("Cancel: %v", err)
+		}
+	})
+
+	r.Advance(ctx, time.Unix(1059, 0))
+	if fired {
+		t.Fatalf("timer fired before its time")
+	}
+
+	r.Advance(ctx, time.Unix(1060, 0))
+	if !fired || len(r.Orders()) != 0 {
+		t.Errorf("after timer: fired = %v, open orders = %v", fired, r.Orders())
+	}
+
+	// отказ из колбэка приходит в OnOrderRejected после него
+	g.rejectAll = true
+	r.After(0, func(ctx context.Context) {
+		if _, err := r.Sell(ctx, "TICK", 100, 1); !errors.Is(err, ErrRejected) {
+			t.Errorf("Sell: error = %v, want %v", err, ErrRejected)
+		}
+		if len(s.rejected) != 1 {
+			t.Errorf("OnOrderRejected called inside the callback")
+		}
+	})
+	r.Advance(ctx, time.Unix(1060, 0))
+
+	if len(s.rejected) != 2 {
+		t.Errorf("rejected = %v, want 2 rejections", s.rejected)
+	}
+}
+
+func TestDuplicateFills(t *testing.T) {
+	s := &recorder{}
+	r := New("test", s, &fakeGateway{})
+	ctx := context.Background()
+	// у открытой заявки на 3 контракта один уже исполнен и учтён в позиции
+	open := models.Order{ID: 7, Ticker: "T", Volume: 3, Filled: 1, Price: 100, IsBuy: true, Status: models.OrderPartial}
+	r.Start(ctx, time.Unix(0, 0), []models.Position{{Ticker: "T", Volume: 1, AvgPrice: 100}}, []models.Order{open})
+
+	fill := func(filled, volume int32) {
+		o := open
+		o.Filled = filled
+		if filled == o.Volume {
+			o.Status = models.OrderFilled
+		}
+		r.HandleFill(ctx, Fill{Order: o, Volume: volume, Price: 100})
+	}
+
+	// досланное после подписки исполнение, уже учтённое в состоянии счёта
+	fill(1, 1)
+	fill(2, 1)
+	// повтор после переподключения
+	fill(2, 1)
+	// событие о двух контрактах, один из которых уже учтён
+	fill(3, 2)
+
+	if got := r.Position("T").Volume; got != 3 {
+		t.Errorf("position = %d, want 3", got)
+	}
+	if len(s.fills) != 2 || s.fills[1].Volume != 1 {
+		t.Errorf("OnFill got %+v, want 2 fills of 1", s.fills)
+	}
+	if len(r.Orders()) != 0 {
+		t.Errorf("Orders() = %v, want none", r.Orders())
+	}
+}
+
+func TestResync(t *testing.T) {
+	s := &recorder{}
+	r := New("test", s, &fakeGateway{})
+	ctx := context.Background()
+	r.Start(ctx, time.Unix(0, 0), nil, nil)
+
+	partial, err := r.Buy(ctx, "T", 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filled, err := r.Buy(ctx, "T", 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := r.Sell(ctx, "T", 120, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// пока поток переподключался, заявки исполнились и одну сняли
+	partial.Filled, partial.Status = 1, models.OrderPartial
+	filled.Filled, filled.Status = 1, models.OrderFilled
+	cancelled.Status = models.OrderCancelled
+	r.Resync(ctx, []models.Position{{Ticker: "T", Volume: 2, AvgPrice: 100}},
+		[]models.Order{partial, filled, cancelled})
+
+	if got := r.Position("T"); got.Volume != 2 {
+		t.Errorf("position = %+v, want 2", got)
+	}
+	if orders := r.Orders(); len(orders) != 1 || orders[0].ID != partial.ID {
+		t.Errorf("Orders() = %v, want only %d", orders, partial.ID)
+	}
+	if len(s.fills) != 2 {
+		t.Fatalf("OnFill got %+v, want missed fills of 2 orders", s.fills)
+	}
+
+	// брокер досылает те же исполнения - позиция уже их учитывает
+	r.HandleFill(ctx, Fill{Order: filled, Volume: 1, Price: 100})
+	r.HandleFill(ctx, Fill{Order: partial, Volume: 1, Price: 100})
+	if got := r.Position("T").Volume; got != 2 || len(s.fills) != 2 {
+		t.Errorf("after replay: position = %d, fills = %d, want 2 and 2", got, len(s.fills))
+	}
+}
@@ -0,0 +1,143 @@
+// Package robot библиотека для торговых роботов. Стратегия получает свечи, исполнения
+// и отклонения своих заявок через колбэки, а выставляет заявки, смотрит позицию и
+// ставит таймеры через Robot. Один и тот же код стратегии торгует через брокера (Run)
+// и прогоняется на истории в бэктесте: Robot не знает, откуда берутся события.
+package robot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"trading/pkg/models"
+)
+
+var ErrUnknownStrategy = errors.New("unknown strategy")
+var ErrWrongParams = errors.New("wrong strategy params")
+
+// Strategy торговая стратегия. Колбэки вызываются по одному, из одной горутины,
+// поэтому состояние стратегии не нужно защищать
+type Strategy interface {
+	// OnStart вызывается один раз, когда позиция и заявки счёта уже загружены
+	OnStart(ctx context.Context, r *Robot)
+	OnCandle(ctx context.Context, r *Robot, c models.Candle)
+	// OnFill исполнение заявки робота, позиция к этому моменту уже изменена
+	OnFill(ctx context.Context, r *Robot, f Fill)
+	// OnOrderRejected отказ брокера или биржи, в том числе сразу при выставлении
+	OnOrderRejected(ctx context.Context, r *Robot, o models.Order, reason string)
+}
+
+// Base пустые колбэки, чтобы стратегия реализовала только нужные
+type Base struct{}
+
+func (Base) OnStart(context.Context, *Robot)                               {}
+func (Base) OnCandle(context.Context, *Robot, models.Candle)               {}
+func (Base) OnFill(context.Context, *Robot, Fill)                          {}
+func (Base) OnOrderRejected(context.Context, *Robot, models.Order, string) {}
+
+// Factory создаёт стратегию с параметрами из конфига
+type Factory func(params Params) (Strategy, error)
+
+var registry = struct {
+	sync.RWMutex
+	factories map[string]Factory
+}{factories: make(map[string]Factory)}
+
+// Register добавляет стратегию под именем name, обычно из init пакета стратегии.
+// Повторное имя - ошибка программиста, поэтому паника
+func Register(name string, f Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.factories[name]; ok {
+		panic("robot: strategy " + name + " registered twice")
+	}
+	registry.factories[name] = f
+}
+
+// NewStrategy стратегия name с параметрами params
+func NewStrategy(name string, params Params) (Strategy, error) {
+	registry.RLock()
+	f, ok := registry.factories[name]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, have %s", ErrUnknownStrategy, name, strings.Join(Strategies(), ", "))
+	}
+
+	return f(params)
+}
+
+// Strategies имена зарегистрированных стратегий
+func Strategies() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Params параметры стратегии из конфига, строки ключ=значение
+type Params map[string]string
+
+// ParseParams параметры из списка "ключ=значение"
+func ParseParams(list []string) (Params, error) {
+	params := make(Params, len(list))
+	for _, kv := range list {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("%w: %q, want key=value", ErrWrongParams, kv)
+		}
+		params[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return params, nil
+}
+
+// String значение key, def если его нет
+func (p Params) String(key, def string) string {
+	if v, ok := p[key]; ok && v != "" {
+		return v
+	}
+
+	return def
+}
+
+// Int целое значение key, def если его нет
+func (p Params) Int(key string, def int) (int, error) {
+	v, ok := p[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s=%q is not an integer", ErrWrongParams, key, v)
+	}
+
+	return n, nil
+}
+
+// Duration интервал key в формате time.ParseDuration, def если его нет
+func (p Params) Duration(key string, def time.Duration) (time.Duration, error) {
+	v, ok := p[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s=%q is not a duration", ErrWrongParams, key, v)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite" // sqlite на чистом go, сборка без cgo
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Open открывает sqlite базу и доводит её схему до последней миграции,
+// каждая миграция применяется один раз в своей транзакции
+func Open(ctx context.Context, path string, migrations []string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite",
+		path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("cant open sqlite %s: %w", path, err)
+	}
+
+	// sqlite не умеет параллельную запись, так не ловим SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if err = migrate(ctx, db, migrations); err != nil {
+		_ = db.Close()
+
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// IsUniqueViolation ошибка нарушения уникального индекса
+func IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// migrate применяет к базе ещё не применённые миграции, номер миграции - индекс в слайсе + 1
+func migrate(ctx context.Context, db *sql.DB, migrations []string) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY
+	)`)
+	if err != nil {
+		return fmt.Errorf("cant create schema_migrations: %w", err)
+	}
+
+	var version int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("cant read schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err = applyMigration(ctx, db, i+1, migrations[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, version int, query string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cant begin migration %d: %w", version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("cant apply migration %d: %w", version, err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+		return fmt.Errorf("cant save migration %d: %w", version, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("cant commit migration %d: %w", version, err)
+	}
+
+	return nil
+}
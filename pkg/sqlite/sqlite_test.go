@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	migrations := []string{
+		`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE)`,
+		`INSERT INTO items (name) VALUES ('first')`,
+	}
+
+	db, err := Open(ctx, path, migrations)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	_, err = db.ExecContext(ctx, `INSERT INTO items (name) VALUES ('first')`)
+	if !IsUniqueViolation(err) {
+		t.Errorf("duplicate insert: error = %v, want unique violation", err)
+	}
+	db.Close()
+
+	// повторное открытие не применяет миграции второй раз, новая применяется
+	migrations = append(migrations, `INSERT INTO items (name) VALUES ('second')`)
+	db, err = Open(ctx, path, migrations)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db.Close()
+
+	var n int
+	if err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM items`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("items = %d, want 2", n)
+	}
+}
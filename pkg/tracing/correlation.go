@@ -0,0 +1,80 @@
+// Package tracing сквозной ID запроса (correlation ID) и трейсы OpenTelemetry.
+//
+// ID создаётся на краю системы: на обновление из телеграма или на http/grpc запрос
+// без ID. Дальше он передаётся в заголовке X-Correlation-ID и в grpc metadata
+// x-correlation-id, попадает в строки лога, записанные через log.Ctx(ctx), в атрибут
+// correlation.id спанов и в поле CorrelationID сделок биржи.
+// Трейсы пишутся, только если настроен экспорт, см. Setup
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header http заголовок с ID запроса
+const Header = "X-Correlation-ID"
+
+// metadataKey ключ grpc metadata с ID запроса
+const metadataKey = "x-correlation-id"
+
+// LogField поле лога с ID запроса
+const LogField = "correlation_id"
+
+// attrCorrelationID атрибут спана с ID запроса, по нему спаны ищутся в коллекторе
+const attrCorrelationID = attribute.Key("correlation.id")
+
+const tracerName = "trading"
+
+type idKey struct{}
+
+// NewID случайный ID запроса
+func NewID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// WithID кладёт в ctx ID запроса и логгер с ним. Пустой id - новый ID
+func WithID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		id = NewID()
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attrCorrelationID.String(id))
+
+	logger := log.Logger.With().Str(LogField, id).Logger()
+
+	return logger.WithContext(context.WithValue(ctx, idKey{}, id))
+}
+
+// ID запроса из ctx, пусто если его нет
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+
+	return id
+}
+
+// Start спан внутри сервиса, например обработка сообщения из потока биржи
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, opts...)
+	if id := ID(ctx); id != "" {
+		span.SetAttributes(attrCorrelationID.String(id))
+	}
+
+	return ctx, span
+}
+
+// UseContextLogger log.Ctx без ID запроса пишет в общий логгер, а не в никуда.
+// Вызывается в main после настройки log.Logger
+func UseContextLogger() {
+	zerolog.DefaultContextLogger = &log.Logger
+}
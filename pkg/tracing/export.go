@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// zipkinTimeout сколько ждать коллектор при отправке одной пачки спанов
+const zipkinTimeout = 10 * time.Second
+
+// Setup включает экспорт трейсов сервиса service: в файл file построчно в JSON и/или
+// в коллектор по адресу zipkinURL (zipkin v2 JSON, его принимают OpenTelemetry
+// Collector, Jaeger и Zipkin). Без обоих спаны не пишутся, но трейс всё равно
+// передаётся дальше. Возвращает функцию, которая дописывает спаны при остановке
+func Setup(service, file, zipkinURL string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var closers []func() error
+	var exporters []sdktrace.SpanExporter
+
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("cant open trace file: %w", err)
+		}
+		closers = append(closers, f.Close)
+
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			return nil, fmt.Errorf("cant create file exporter: %w", err)
+		}
+		exporters = append(exporters, exp)
+	}
+
+	if zipkinURL != "" {
+		exp, err := zipkin.New(zipkinURL, zipkin.WithClient(&http.Client{Timeout: zipkinTimeout}))
+		if err != nil {
+			return nil, fmt.Errorf("cant create zipkin exporter: %w", err)
+		}
+		exporters = append(exporters, exp)
+	}
+
+	if len(exporters) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	}
+	for _, exp := range exporters {
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		for _, c := range closers {
+			if cErr := c(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}
+
+		return err
+	}, nil
+}
@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// metadataCarrier grpc metadata для пропагатора OpenTelemetry
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// serverContext продолжает трейс и ID запроса клиента или начинает новые
+func serverContext(ctx context.Context, method string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+	ctx, span := Start(ctx, method, trace.WithSpanKind(trace.SpanKindServer))
+
+	return WithID(ctx, metadataCarrier(md).Get(metadataKey)), span
+}
+
+// outgoingContext передаёт ID запроса и трейс серверу
+func outgoingContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+
+	if id := ID(ctx); id != "" {
+		md.Set(metadataKey, id)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(otelcodes.Error, status.Convert(err).Message())
+	}
+	span.End()
+}
+
+// UnaryServerInterceptor ставится в цепочке первым, чтобы ID запроса был и в логах остальных
+func UnaryServerInterceptor(
+	ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	ctx, span := serverContext(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	endSpan(span, err)
+
+	return resp, err
+}
+
+// serverStream поток с контекстом, в котором лежит ID запроса
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func StreamServerInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+
+	ctx, span := serverContext(stream.Context(), info.FullMethod)
+	err := handler(srv, serverStream{ServerStream: stream, ctx: ctx})
+	endSpan(span, err)
+
+	return err
+}
+
+func UnaryClientInterceptor(
+	ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+
+	ctx, span := Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient))
+	err := invoker(outgoingContext(ctx), method, req, reply, cc, opts...)
+	endSpan(span, err)
+
+	return err
+}
+
+// StreamClientInterceptor спан покрывает только открытие потока, подписки живут часами
+func StreamClientInterceptor(
+	ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+
+	ctx, span := Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient))
+	stream, err := streamer(outgoingContext(ctx), desc, cc, method, opts...)
+	endSpan(span, err)
+
+	return stream, err
+}
+
+// DialOptions интерцепторы клиента для grpc.Dial
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptor),
+	}
+}
@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware продолжает трейс и ID запроса из заголовков или начинает новые,
+// ID возвращается в заголовке ответа
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Start(ctx, r.Method+" "+r.URL.Path, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		ctx = WithID(ctx, r.Header.Get(Header))
+		w.Header().Set(Header, ID(ctx))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// transport передаёт ID запроса и трейс в заголовках
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport http клиент, который передаёт ID запроса и трейс. base nil - http.DefaultTransport
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return transport{base: base}
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), req.Method+" "+req.URL.Path, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	req = req.Clone(ctx)
+	if id := ID(ctx); id != "" {
+		req.Header.Set(Header, id)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil:
+		span.SetStatus(otelcodes.Error, err.Error())
+	case resp.StatusCode >= http.StatusInternalServerError:
+		span.SetStatus(otelcodes.Error, fmt.Sprintf("http status %d", resp.StatusCode))
+	}
+
+	return resp, err
+}
@@ -0,0 +1,175 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// recordSpans пишет спаны в память на время теста
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	rec := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	return rec
+}
+
+func TestHTTPPropagation(t *testing.T) {
+	rec := recordSpans(t)
+
+	var got string
+	server := httptest.NewServer(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ID(r.Context())
+	})))
+	defer server.Close()
+
+	client := &http.Client{Transport: Transport(nil)}
+
+	// ID запроса клиента доходит до сервера и возвращается в ответе
+	req, _ := http.NewRequestWithContext(WithID(context.Background(), "from-client"), http.MethodGet, server.URL+"/x", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got != "from-client" || resp.Header.Get(Header) != "from-client" {
+		t.Errorf("server ID %q, response header %q, want from-client", got, resp.Header.Get(Header))
+	}
+
+	// без ID сервер выдаёт новый
+	resp, err = http.Get(server.URL + "/y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got == "" || got == "from-client" || resp.Header.Get(Header) != got {
+		t.Errorf("new ID %q, response header %q", got, resp.Header.Get(Header))
+	}
+
+	// спан сервера продолжает трейс клиента
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("ended %d spans, want server and client of the first request and server of the second", len(spans))
+	}
+	serverSpan, clientSpan := spans[0], spans[1]
+	if serverSpan.Parent().SpanID() != clientSpan.SpanContext().SpanID() {
+		t.Errorf("server span parent %v, want client span %v", serverSpan.Parent().SpanID(), clientSpan.SpanContext().SpanID())
+	}
+}
+
+func TestGRPCPropagation(t *testing.T) {
+	recordSpans(t)
+
+	ids := make(chan string, 2)
+	captureUnary := func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ids <- ID(ctx)
+
+		return handler(ctx, req)
+	}
+	captureStream := func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ids <- ID(ss.Context())
+
+		return nil
+	}
+
+	l := bufconn.Listen(1 << 16)
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor, captureUnary),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor, captureStream),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(l) }()
+	defer server.Stop()
+
+	opts := append(DialOptions(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+	)
+	conn, err := grpc.Dial("bufnet", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	ctx := WithID(context.Background(), "unary-id")
+	if _, err = client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-ids; got != "unary-id" {
+		t.Errorf("unary server ID = %q, want unary-id", got)
+	}
+
+	stream, err := client.Watch(WithID(context.Background(), "stream-id"), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = stream.Recv()
+	if got := <-ids; got != "stream-id" {
+		t.Errorf("stream server ID = %q, want stream-id", got)
+	}
+}
+
+func TestZipkinExport(t *testing.T) {
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+
+	received := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer collector.Close()
+
+	shutdown, err := Setup("broker", "", collector.URL+"/api/v2/spans")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := Start(WithID(context.Background(), "zipkin-id"), "deal")
+	span.End()
+	if err = shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var spans []struct {
+		Name          string            `json:"name"`
+		Tags          map[string]string `json:"tags"`
+		LocalEndpoint struct {
+			ServiceName string `json:"serviceName"`
+		} `json:"localEndpoint"`
+	}
+	if err = json.Unmarshal(<-received, &spans); err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 1 || spans[0].Name != "deal" || spans[0].LocalEndpoint.ServiceName != "broker" ||
+		spans[0].Tags[string(attrCorrelationID)] != "zipkin-id" {
+		t.Errorf("exported spans = %+v, want deal of broker with correlation.id zipkin-id", spans)
+	}
+}